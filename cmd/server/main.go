@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,8 +17,11 @@ import (
 
 	"pupervisor/internal/api"
 	"pupervisor/internal/config"
+	"pupervisor/internal/middleware"
 	"pupervisor/internal/service"
 	"pupervisor/internal/storage"
+	"pupervisor/internal/syslog"
+	"pupervisor/internal/tracing"
 	"pupervisor/web"
 )
 
@@ -24,17 +31,21 @@ func main() {
 	flag.Parse()
 
 	// Load server config
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize storage
-	store, err := storage.New(*dbPath)
+	store, err := openStorage(*dbPath, cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database at %s: %v", *dbPath, err)
 	}
-	defer store.Close()
-
-	absDbPath, _ := filepath.Abs(*dbPath)
-	log.Printf("Database initialized at %s", absDbPath)
+	if store != nil {
+		defer store.Close()
+		absDbPath, _ := filepath.Abs(*dbPath)
+		log.Printf("Database initialized at %s", absDbPath)
+	}
 
 	// Load process configuration
 	procCfg, err := config.LoadProcessConfig(*configPath)
@@ -43,20 +54,94 @@ func main() {
 		log.Println("Starting with empty process list. Create pupervisor.yaml to define processes.")
 		procCfg = &config.SupervisorConfig{Processes: []config.ProcessConfig{}}
 	}
+	if err := procCfg.CheckCommands(cfg.Server.CommandAllowlist); err != nil {
+		log.Fatalf("Invalid process configuration in %s: %v", *configPath, err)
+	}
 
 	// Initialize process manager
 	pm := service.NewProcessManager(procCfg, store)
+	pm.SetConfigPath(*configPath)
+	pm.SetServerSettings(cfg.Settings)
+	pm.SetCrashReplay(cfg.Server.CrashReplay)
+	pm.SetCommandAllowlist(cfg.Server.CommandAllowlist)
+	if procCfg.SyslogAddr != "" {
+		w, err := syslog.New(procCfg.SyslogProto, procCfg.SyslogAddr, procCfg.SyslogFacility)
+		if err != nil {
+			log.Fatalf("Invalid process configuration in %s: %v", *configPath, err)
+		}
+		defer w.Close()
+		pm.SetSyslog(w)
+		log.Printf("Sending supervisor events to syslog at %s over %s", procCfg.SyslogAddr, procCfg.SyslogProto)
+	}
+	if procCfg.Archive.Endpoint != "" {
+		a, err := pm.StartArchive(procCfg.Archive)
+		if err != nil {
+			log.Fatalf("Invalid process configuration in %s: %v", *configPath, err)
+		}
+		defer a.Close()
+		pm.WatchArchiveSetting()
+		log.Printf("Archiving rotated logs to bucket %s at %s while archive_enabled is set", procCfg.Archive.Bucket, procCfg.Archive.Endpoint)
+	}
+	pm.WatchNotificationSettings()
+	pm.WatchSafeMode()
+	pm.WatchEscalationRules()
 
 	// Get embedded filesystems
 	templatesFS := web.GetTemplatesFS()
 	staticFS := web.GetStaticFS()
 
 	// Create router
-	router, err := api.NewRouter(pm, templatesFS, staticFS)
+	router, err := newRouter(pm, cfg, templatesFS, staticFS)
 	if err != nil {
 		log.Fatalf("Failed to create router: %v", err)
 	}
 
+	if cfg.Server.ReadOnly {
+		log.Printf("Read-only mode: mutating API requests are rejected")
+	}
+	if cfg.Auth.Enabled() {
+		log.Printf("Authentication required for API requests")
+	}
+
+	// Serve mutating requests on the admin listener only
+	var adminSrv *http.Server
+	if cfg.Server.AdminAddress != "" {
+		router.Use(middleware.PublicOnly)
+
+		adminRouter, err := newRouter(pm, cfg, templatesFS, staticFS)
+		if err != nil {
+			log.Fatalf("Failed to create admin router: %v", err)
+		}
+		adminSrv = &http.Server{
+			Addr:         cfg.Server.AdminAddress,
+			Handler:      adminRouter,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		if host, _, err := net.SplitHostPort(cfg.Server.AdminAddress); err == nil {
+			if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				log.Printf("Warning: admin address %s is not a loopback address", cfg.Server.AdminAddress)
+			}
+		}
+	}
+
+	// Enable request tracing
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Endpoint)
+		if err != nil {
+			log.Fatalf("Failed to initialize tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Printf("Failed to flush traces: %v", err)
+			}
+		}()
+		log.Printf("OpenTelemetry tracing enabled")
+	}
+
 	// Create server
 	srv := &http.Server{
 		Addr:         cfg.Server.Address,
@@ -66,8 +151,18 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Health checks run first so autostart can wait for dependencies to be
+	// healthy
+	pm.StartHealthChecks()
 	// Start auto-start processes
 	pm.StartAll()
+	pm.StartWatchdog()
+	pm.StartBinaryChecks()
+	pm.StartUsageSampling()
+	pm.StartStorageMaintenance()
+	if err := pm.StartFileWatches(); err != nil {
+		log.Printf("Warning: reload_on_change is disabled: %v", err)
+	}
 
 	// Start server in goroutine
 	go func() {
@@ -78,6 +173,27 @@ func main() {
 		}
 	}()
 
+	if adminSrv != nil {
+		go func() {
+			log.Printf("Starting admin server on %s", cfg.Server.AdminAddress)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin server error: %v", err)
+			}
+		}()
+	}
+
+	// Reload process config on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("Received SIGHUP, reloading process config")
+			if _, err := pm.Reload("SIGHUP"); err != nil {
+				log.Printf("Config reload failed: %v", err)
+			}
+		}
+	}()
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -92,9 +208,62 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			log.Printf("Admin server forced to shutdown: %v", err)
+		}
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
 	log.Println("Server exited gracefully")
 }
+
+// newRouter creates a router with the middleware that applies to every
+// listener.
+func newRouter(pm *service.ProcessManager, cfg *config.Config, templatesFS, staticFS fs.FS) (*api.Router, error) {
+	router, err := api.NewRouter(pm, cfg.Server.JSONCase, cfg.Server.BasePath, cfg.Tracing.Enabled, templatesFS, staticFS)
+	if err != nil {
+		return nil, err
+	}
+	router.Use(middleware.Auth(cfg.Auth))
+	if cfg.Server.ReadOnly {
+		router.Use(middleware.ReadOnly)
+	}
+	router.Use(middleware.SafeMode(pm.SafeMode))
+	return router, nil
+}
+
+// openStorage opens the database, applying the corruption policy when the
+// file is corrupt. It returns a nil Storage when the policy disables storage.
+func openStorage(dbPath string, cfg config.DatabaseConfig) (*storage.Storage, error) {
+	opts := storage.Options{
+		BusyTimeout: cfg.BusyTimeout,
+		Synchronous: cfg.Synchronous,
+		CacheSize:   cfg.CacheSize,
+		MaxSize:     int64(cfg.MaxSize) << 20,
+
+		ErrorDedupWindow: time.Duration(cfg.ErrorDedupWindow) * time.Second,
+	}
+
+	store, err := storage.New(dbPath, opts)
+	if !errors.Is(err, storage.ErrCorrupt) {
+		return store, err
+	}
+
+	switch cfg.CorruptionPolicy {
+	case config.DBCorruptionRecreate:
+		aside, moveErr := storage.MoveAside(dbPath)
+		if moveErr != nil {
+			return nil, fmt.Errorf("%w; moving it aside failed: %v", err, moveErr)
+		}
+		log.Printf("ERROR: database %s is corrupt (%v); moved it to %s and starting with an empty database", dbPath, err, aside)
+		return storage.New(dbPath, opts)
+	case config.DBCorruptionDisable:
+		log.Printf("ERROR: database %s is corrupt (%v); running without storage, crash history, settings and logs are not saved", dbPath, err)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w (set DB_CORRUPTION_POLICY to recreate or disable to start anyway)", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
+	"pupervisor/web"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// garbageDB writes a file that is not a SQLite database and returns its path.
+func garbageDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pupervisor.db")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("not a database\n"), 1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenStorageCorruptFails(t *testing.T) {
+	for _, policy := range []string{"", config.DBCorruptionFail} {
+		t.Run("policy "+policy, func(t *testing.T) {
+			path := garbageDB(t)
+			store, err := openStorage(path, config.DatabaseConfig{CorruptionPolicy: policy})
+			if !errors.Is(err, storage.ErrCorrupt) {
+				t.Fatalf("openStorage() error = %v, want ErrCorrupt", err)
+			}
+			if store != nil {
+				store.Close()
+				t.Error("openStorage() returned a store")
+			}
+			if data, _ := os.ReadFile(path); !bytes.HasPrefix(data, []byte("not a database")) {
+				t.Error("the corrupt file was modified")
+			}
+		})
+	}
+}
+
+func TestOpenStorageCorruptRecreate(t *testing.T) {
+	path := garbageDB(t)
+	store, err := openStorage(path, config.DatabaseConfig{CorruptionPolicy: config.DBCorruptionRecreate})
+	if err != nil {
+		t.Fatalf("openStorage() error = %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetSetting("probe", "1"); err != nil {
+		t.Errorf("new database is not writable: %v", err)
+	}
+
+	matches, _ := filepath.Glob(path + ".corrupt-*")
+	var aside []string
+	for _, m := range matches {
+		if !strings.HasSuffix(m, "-wal") && !strings.HasSuffix(m, "-shm") {
+			aside = append(aside, m)
+		}
+	}
+	if len(aside) != 1 {
+		t.Fatalf("moved-aside files = %v, want one", matches)
+	}
+	if data, _ := os.ReadFile(aside[0]); !bytes.HasPrefix(data, []byte("not a database")) {
+		t.Errorf("%s does not hold the corrupt file", aside[0])
+	}
+}
+
+func TestOpenStorageCorruptDisable(t *testing.T) {
+	path := garbageDB(t)
+	store, err := openStorage(path, config.DatabaseConfig{CorruptionPolicy: config.DBCorruptionDisable})
+	if err != nil || store != nil {
+		t.Fatalf("openStorage() = %v, %v, want no store and no error", store, err)
+	}
+}
+
+func TestOpenStorageHealthy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pupervisor.db")
+	store, err := openStorage(path, config.DatabaseConfig{CorruptionPolicy: config.DBCorruptionDisable})
+	if err != nil || store == nil {
+		t.Fatalf("openStorage() = %v, %v, want a store", store, err)
+	}
+	store.Close()
+}
+
+func TestRouterSpans(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	cfg := &config.Config{
+		Tracing: config.TracingConfig{Enabled: true},
+		Auth:    config.AuthConfig{Tokens: map[string]string{"secret": "admin"}},
+	}
+	pm := service.NewProcessManager(&config.SupervisorConfig{}, nil)
+	router, err := newRouter(pm, cfg, web.GetTemplatesFS(), web.GetStaticFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.HandleFunc("/api/panic", func(http.ResponseWriter, *http.Request) { panic("boom") })
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"recovered panic", "/api/panic", http.StatusInternalServerError},
+		{"rejected by auth", "/api/processes", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.want != http.StatusUnauthorized {
+				req.Header.Set("Authorization", "Bearer secret")
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+
+			var span sdktrace.ReadOnlySpan
+			for _, s := range spans.Ended() {
+				if s.Name() == "GET "+tt.path {
+					span = s
+				}
+			}
+			if span == nil {
+				t.Fatalf("no span for GET %s", tt.path)
+			}
+			var status int64
+			for _, attr := range span.Attributes() {
+				if attr.Key == "http.response.status_code" {
+					status = attr.Value.AsInt64()
+				}
+			}
+			if status != int64(tt.want) {
+				t.Errorf("span status code = %d, want %d", status, tt.want)
+			}
+			if tt.want >= 500 && span.Status().Code != codes.Error {
+				t.Errorf("span status = %v, want an error", span.Status().Code)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"io/fs"
 	"net/http"
+	"strings"
 
 	"pupervisor/internal/handlers"
 	"pupervisor/internal/middleware"
@@ -13,27 +14,36 @@ import (
 
 type Router struct {
 	*mux.Router
+	basePath string
 }
 
-func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router, error) {
+// NewRouter creates the router for the UI and API. With a basePath such as
+// "/supervisor", every route is served below it instead of at the root.
+// With tracing, every request gets a span.
+func NewRouter(pm *service.ProcessManager, jsonCase, basePath string, tracing bool, templatesFS, staticFS fs.FS) (*Router, error) {
 	r := mux.NewRouter()
 
-	tmplHandler, err := handlers.NewTemplateHandler(templatesFS)
+	tmplHandler, err := handlers.NewTemplateHandler(templatesFS, basePath)
 	if err != nil {
 		return nil, err
 	}
 
-	procHandler := handlers.NewProcessHandler(pm)
+	procHandler := handlers.NewProcessHandler(pm, jsonCase)
+	metricsHandler := handlers.NewMetricsHandler(pm)
 
 	// Health check endpoints
 	r.HandleFunc("/health", handlers.HealthCheck).Methods(http.MethodGet)
 	r.HandleFunc("/ready", handlers.ReadyCheck).Methods(http.MethodGet)
 
+	// Prometheus metrics
+	r.HandleFunc("/metrics", metricsHandler.Prometheus).Methods(http.MethodGet)
+
 	// Web UI routes
 	r.HandleFunc("/", tmplHandler.ServeTemplate("dashboard")).Methods(http.MethodGet)
 	r.HandleFunc("/processes", tmplHandler.ServeTemplate("processes")).Methods(http.MethodGet)
 	r.HandleFunc("/logs", tmplHandler.ServeTemplate("logs")).Methods(http.MethodGet)
 	r.HandleFunc("/crashes", tmplHandler.ServeTemplate("crashes")).Methods(http.MethodGet)
+	r.HandleFunc("/partials/crashes", tmplHandler.ServeCrashRows(pm)).Methods(http.MethodGet)
 	r.HandleFunc("/settings", tmplHandler.ServeTemplate("settings")).Methods(http.MethodGet)
 
 	// Serve static files
@@ -45,26 +55,110 @@ func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router
 	api.HandleFunc("/processes", procHandler.GetProcesses).Methods(http.MethodGet)
 	api.HandleFunc("/processes/restart-all", procHandler.RestartAllProcesses).Methods(http.MethodPost)
 	api.HandleFunc("/processes/restart-selected", procHandler.RestartSelectedProcesses).Methods(http.MethodPost)
+	api.HandleFunc("/processes/restart", procHandler.RestartByLabel).Methods(http.MethodPost)
+	api.HandleFunc("/processes/summary", procHandler.GetProcessSummary).Methods(http.MethodGet)
+	api.HandleFunc("/processes/shutdown-plan", procHandler.GetShutdownPlan).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}", procHandler.GetProcess).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/describe", procHandler.DescribeProcess).Methods(http.MethodGet)
 	api.HandleFunc("/processes/{name}/start", procHandler.StartProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/ensure-running", procHandler.EnsureRunning).Methods(http.MethodPost)
 	api.HandleFunc("/processes/{name}/stop", procHandler.StopProcess).Methods(http.MethodPost)
 	api.HandleFunc("/processes/{name}/restart", procHandler.RestartProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{base}/rolling-restart", procHandler.RollingRestartReplicas).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/hold", procHandler.HoldProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/release", procHandler.ReleaseProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/silence", procHandler.SilenceProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/silence", procHandler.UnsilenceProcess).Methods(http.MethodDelete)
+	api.HandleFunc("/processes/{name}/metrics", procHandler.GetProcessMetrics).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/ready", procHandler.ProcessReady).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/healthcheck/test", procHandler.TestHealthCheck).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/clone", procHandler.CloneProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/heartbeat", procHandler.Heartbeat).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/console", procHandler.Console).Methods(http.MethodGet)
+	api.HandleFunc("/control", procHandler.Control).Methods(http.MethodGet)
+	api.HandleFunc("/jobs/{id}", procHandler.GetJob).Methods(http.MethodGet)
 	api.HandleFunc("/logs", procHandler.GetLogs).Methods(http.MethodGet)
 	api.HandleFunc("/logs/worker", procHandler.GetWorkerLogs).Methods(http.MethodGet)
 	api.HandleFunc("/logs/system", procHandler.GetSystemLogs).Methods(http.MethodGet)
 	api.HandleFunc("/logs/worker/{workerName}", procHandler.GetWorkerSpecificLogs).Methods(http.MethodGet)
+	api.HandleFunc("/logs/correlation/{id}", procHandler.GetCorrelatedLogs).Methods(http.MethodGet)
+
+	// Config routes
+	api.HandleFunc("/config/reload", procHandler.ReloadConfig).Methods(http.MethodPost)
+	api.HandleFunc("/config/export", procHandler.ExportConfig).Methods(http.MethodGet)
+	api.HandleFunc("/config/changes", procHandler.GetConfigChanges).Methods(http.MethodGet)
+	api.HandleFunc("/metrics/json", procHandler.GetMetricsJSON).Methods(http.MethodGet)
+	api.HandleFunc("/topology.dot", procHandler.GetTopologyDOT).Methods(http.MethodGet)
 
 	// Crash history routes
 	api.HandleFunc("/crashes", procHandler.GetCrashes).Methods(http.MethodGet)
+	api.HandleFunc("/crashes", procHandler.DeleteCrashes).Methods(http.MethodDelete)
 	api.HandleFunc("/crashes/stats", procHandler.GetCrashStats).Methods(http.MethodGet)
+	api.HandleFunc("/crashes/top", procHandler.GetTopCrashers).Methods(http.MethodGet)
+	api.HandleFunc("/crashes/compare", procHandler.CompareCrashes).Methods(http.MethodGet)
+	api.HandleFunc("/crashes/{id:[0-9]+}/command", procHandler.GetCrashCommand).Methods(http.MethodGet)
+	api.HandleFunc("/crashes/{id:[0-9]+}/replay", procHandler.ReplayCrash).Methods(http.MethodPost)
+	api.HandleFunc("/crashes/{id:[0-9]+}", procHandler.DeleteCrash).Methods(http.MethodDelete)
 	api.HandleFunc("/crashes/{name}", procHandler.GetCrashesByProcess).Methods(http.MethodGet)
 
+	// State transition feed
+	api.HandleFunc("/transitions", procHandler.GetTransitions).Methods(http.MethodGet)
+
+	// Supervisor info
+	api.HandleFunc("/info", procHandler.GetInfo).Methods(http.MethodGet)
+
+	// Storage routes
+	api.HandleFunc("/stats/storage", procHandler.GetStorageStats).Methods(http.MethodGet)
+	api.HandleFunc("/maintenance/cleanup", procHandler.CleanupStorage).Methods(http.MethodPost)
+	api.HandleFunc("/maintenance/migrate", procHandler.MigrateStorage).Methods(http.MethodPost)
+
+	// Notification routes
+	api.HandleFunc("/notifications", procHandler.GetNotifications).Methods(http.MethodGet)
+
 	// Settings routes
 	api.HandleFunc("/settings", procHandler.GetSettings).Methods(http.MethodGet)
+	api.HandleFunc("/settings/typed", procHandler.GetTypedSettings).Methods(http.MethodGet)
+	api.HandleFunc("/settings/effective", procHandler.GetEffectiveSettings).Methods(http.MethodGet)
 	api.HandleFunc("/settings", procHandler.UpdateSettings).Methods(http.MethodPost)
+	api.HandleFunc("/settings/{key}", procHandler.GetSetting).Methods(http.MethodGet)
+	api.HandleFunc("/settings/{key}", procHandler.SetSetting).Methods(http.MethodPut)
+	api.HandleFunc("/safe-mode", procHandler.GetSafeMode).Methods(http.MethodGet)
+	api.HandleFunc("/safe-mode", procHandler.SetSafeMode).Methods(http.MethodPut)
+
+	// Batched reads, dispatched through this router
+	api.HandleFunc("/batch", handlers.NewBatchHandler(r, jsonCase).Batch).Methods(http.MethodPost)
 
-	// Apply middleware
+	// Apply middleware. Tracing goes first so that spans cover everything
+	// after it, including the 500 Recovery writes for a panic.
+	if tracing {
+		r.Use(middleware.Tracing)
+	}
 	r.Use(middleware.Recovery)
 	r.Use(middleware.Logging)
 
-	return &Router{Router: r}, nil
+	return &Router{Router: r, basePath: basePath}, nil
+}
+
+// ServeHTTP strips the base path before routing, so routes, middleware and
+// batched requests all see paths relative to it. The bare base path
+// redirects to the dashboard; paths outside it are not found.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.basePath == "" {
+		r.Router.ServeHTTP(w, req)
+		return
+	}
+
+	if req.URL.Path == r.basePath {
+		target := r.basePath + "/"
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
+		}
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, r.basePath+"/") {
+		http.NotFound(w, req)
+		return
+	}
+	http.StripPrefix(r.basePath, r.Router).ServeHTTP(w, req)
 }
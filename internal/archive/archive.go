@@ -0,0 +1,250 @@
+// Package archive uploads rotated log segments to an S3-compatible bucket,
+// signing requests with AWS Signature Version 4.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// queueSize is how many segments wait for upload before new ones are
+// dropped.
+const queueSize = 100
+
+// Upload attempts and the backoff between them
+const (
+	maxAttempts = 5
+	retryBase   = 2 * time.Second
+	retryMax    = time.Minute
+)
+
+const uploadTimeout = 2 * time.Minute
+
+// Config is where segments are uploaded. Objects are written path-style to
+// <Endpoint>/<Bucket>/<Prefix><key>.
+type Config struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+type segment struct {
+	key  string
+	data []byte
+}
+
+// Archiver uploads segments in the background so rotation never waits for
+// the network. Failed uploads are retried with backoff and reported once
+// they give up; while the archiver is disabled segments are discarded.
+type Archiver struct {
+	cfg      Config
+	endpoint *url.URL
+	client   *http.Client
+	report   func(level, message string)
+	// retryWait is the wait before the first retry, retryBase outside tests
+	retryWait time.Duration
+
+	enabled atomic.Bool
+	queue   chan segment
+	done    chan struct{}
+}
+
+// New returns a disabled Archiver for cfg. report receives the outcome of
+// uploads at level info, warning or error.
+func New(cfg Config, report func(level, message string)) (*Archiver, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid archive endpoint %q: must be an http or https URL", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("archive bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("archive credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	a := &Archiver{
+		cfg:       cfg,
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: uploadTimeout},
+		report:    report,
+		retryWait: retryBase,
+		queue:     make(chan segment, queueSize),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// SetEnabled starts or stops accepting segments. Segments already queued
+// are still uploaded.
+func (a *Archiver) SetEnabled(enabled bool) {
+	a.enabled.Store(enabled)
+}
+
+// Enabled reports whether segments are accepted.
+func (a *Archiver) Enabled() bool {
+	return a.enabled.Load()
+}
+
+// Upload queues data to be stored under key, relative to the configured
+// prefix. It never blocks; the segment is dropped if the archiver is
+// disabled or the queue is full.
+func (a *Archiver) Upload(key string, data []byte) {
+	if !a.enabled.Load() {
+		return
+	}
+	select {
+	case a.queue <- segment{key: a.cfg.Prefix + key, data: data}:
+	default:
+		a.report("error", fmt.Sprintf("Archive upload of %s dropped, %d segments are already waiting", key, queueSize))
+	}
+}
+
+// Close stops uploading. Queued segments are discarded.
+func (a *Archiver) Close() {
+	close(a.done)
+}
+
+func (a *Archiver) run() {
+	for {
+		select {
+		case seg := <-a.queue:
+			a.upload(seg)
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// upload puts seg, retrying with backoff up to maxAttempts times.
+func (a *Archiver) upload(seg segment) {
+	backoff := a.retryWait
+	for attempt := 1; ; attempt++ {
+		err := a.put(seg.key, seg.data)
+		if err == nil {
+			a.report("info", fmt.Sprintf("Archived %s (%d bytes) to bucket %s", seg.key, len(seg.data), a.cfg.Bucket))
+			return
+		}
+		if attempt == maxAttempts {
+			a.report("error", fmt.Sprintf("Archive upload of %s failed after %d attempts: %v", seg.key, attempt, err))
+			return
+		}
+		a.report("warning", fmt.Sprintf("Archive upload of %s failed (attempt %d/%d): %v, retrying in %s", seg.key, attempt, maxAttempts, err, backoff))
+
+		select {
+		case <-time.After(backoff):
+		case <-a.done:
+			return
+		}
+		backoff = min(backoff*2, retryMax)
+	}
+}
+
+// put uploads one object with a signed PUT request.
+func (a *Archiver) put(key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	u := *a.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + a.cfg.Bucket + "/" + key
+	u.RawPath = strings.TrimSuffix(a.endpoint.EscapedPath(), "/") + "/" + encodePath(a.cfg.Bucket+"/"+key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	a.sign(req, data, time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req for the s3
+// service.
+func (a *Archiver) sign(req *http.Request, payload []byte, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // no query
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + a.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+a.cfg.SecretKey), day)
+	key = hmacSHA256(key, a.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// encodePath percent-encodes everything in path but the unreserved
+// characters of RFC 3986 and "/", as S3 signing requires.
+func encodePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
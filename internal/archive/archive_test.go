@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request is what the test server saw of an upload.
+type request struct {
+	method, uri string
+	header      http.Header
+	host        string
+	body        string
+}
+
+// testServer records uploads and answers the first failures of them with
+// 503 Service Unavailable.
+func testServer(t *testing.T, failures int) (*httptest.Server, func() []request) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{r.Method, r.RequestURI, r.Header.Clone(), r.Host, string(body)})
+		fail := len(requests) <= failures
+		mu.Unlock()
+		if fail {
+			http.Error(w, "slow down", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), requests...)
+	}
+}
+
+// newTestArchiver returns an enabled Archiver for srv that retries without
+// waiting, and a channel with its reports.
+func newTestArchiver(t *testing.T, srv *httptest.Server) (*Archiver, chan string) {
+	t.Helper()
+	reports := make(chan string, 20)
+	a, err := New(Config{
+		Endpoint:  srv.URL + "/s3/",
+		Bucket:    "logs",
+		Region:    "eu-west-1",
+		Prefix:    "host-1/",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+	}, func(level, message string) { reports <- level + ": " + message })
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.retryWait = time.Millisecond
+	a.SetEnabled(true)
+	t.Cleanup(a.Close)
+	return a, reports
+}
+
+// waitReport returns the next report at level, failing on other levels.
+func waitReport(t *testing.T, reports chan string, level string) string {
+	t.Helper()
+	for {
+		select {
+		case r := <-reports:
+			if strings.HasPrefix(r, level+": ") {
+				return r
+			}
+			if !strings.HasPrefix(r, "warning: ") {
+				t.Fatalf("unexpected report %q", r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for a report at level %s", level)
+		}
+	}
+}
+
+// signature recomputes the SigV4 signature of r as the server would.
+func signature(r request, secret, region string) string {
+	amzDate := r.header.Get("X-Amz-Date")
+	canonical := strings.Join([]string{
+		r.method,
+		r.uri,
+		"",
+		"host:" + r.host,
+		"x-amz-content-sha256:" + r.header.Get("X-Amz-Content-Sha256"),
+		"x-amz-date:" + amzDate,
+		"",
+		"host;x-amz-content-sha256;x-amz-date",
+		r.header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+	key := hmacSHA256([]byte("AWS4"+secret), amzDate[:8])
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+sha256Hex([]byte(canonical))))
+}
+
+func TestUpload(t *testing.T) {
+	srv, requests := testServer(t, 2)
+	a, reports := newTestArchiver(t, srv)
+
+	const data = "line1\nline2\n"
+	a.Upload("app.log-2025 01", []byte(data))
+	if r := waitReport(t, reports, "info"); !strings.Contains(r, "Archived host-1/app.log-2025 01 (12 bytes) to bucket logs") {
+		t.Errorf("report = %q", r)
+	}
+
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("server got %d requests, want 2 failed and 1 retry", len(got))
+	}
+	for i, r := range got {
+		if r.method != http.MethodPut || r.uri != "/s3/logs/host-1/app.log-2025%2001" {
+			t.Errorf("request %d: %s %s, want PUT /s3/logs/host-1/app.log-2025%%2001", i, r.method, r.uri)
+		}
+		if r.body != data {
+			t.Errorf("request %d: body = %q, want %q", i, r.body, data)
+		}
+
+		sum := sha256.Sum256([]byte(data))
+		if h := r.header.Get("X-Amz-Content-Sha256"); h != hex.EncodeToString(sum[:]) {
+			t.Errorf("request %d: x-amz-content-sha256 = %q, want the hash of the body", i, h)
+		}
+		date, err := time.Parse("20060102T150405Z", r.header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Fatalf("request %d: x-amz-date: %v", i, err)
+		}
+		want := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=AKID/%s/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+			date.Format("20060102"), signature(r, "secret", "eu-west-1"))
+		if auth := r.header.Get("Authorization"); auth != want {
+			t.Errorf("request %d: Authorization = %q, want %q", i, auth, want)
+		}
+	}
+}
+
+func TestUploadGivesUp(t *testing.T) {
+	srv, requests := testServer(t, maxAttempts)
+	a, reports := newTestArchiver(t, srv)
+
+	a.Upload("app.log-1", []byte("x"))
+	if r := waitReport(t, reports, "error"); !strings.Contains(r, fmt.Sprintf("failed after %d attempts: 503 Service Unavailable: slow down", maxAttempts)) {
+		t.Errorf("report = %q", r)
+	}
+	if n := len(requests()); n != maxAttempts {
+		t.Errorf("server got %d requests, want %d", n, maxAttempts)
+	}
+}
+
+func TestUploadDisabled(t *testing.T) {
+	srv, requests := testServer(t, 0)
+	a, reports := newTestArchiver(t, srv)
+
+	a.SetEnabled(false)
+	a.Upload("dropped-1", []byte("x"))
+	a.SetEnabled(true)
+	a.Upload("kept", []byte("x"))
+	waitReport(t, reports, "info")
+	a.SetEnabled(false)
+	a.Upload("dropped-2", []byte("x"))
+
+	// Uploads are made in order, so a discarded segment would have been
+	// uploaded before the kept one
+	time.Sleep(50 * time.Millisecond)
+	got := requests()
+	if len(got) != 1 || got[0].uri != "/s3/logs/host-1/kept" {
+		t.Errorf("server got %v, want only the segment uploaded while enabled", got)
+	}
+}
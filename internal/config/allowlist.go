@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveCommand returns the path a process command is executed from,
+// resolving it the way exec.Cmd does: names without a separator are searched
+// in PATH, relative paths are relative to the working directory dir.
+func ResolveCommand(command, dir string) (string, error) {
+	if dir != "" && !filepath.IsAbs(command) && filepath.Base(command) != command {
+		command = filepath.Join(dir, command)
+	}
+
+	path, err := exec.LookPath(command)
+	if err != nil && !errors.Is(err, exec.ErrDot) {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// CheckCommandAllowed reports an error unless the command of cfg, or the
+// shell of a shell process, resolves to a path on the allowlist. Entries
+// ending in a separator allow every path below that directory, others allow
+// exactly that path. An empty allowlist allows everything.
+func CheckCommandAllowed(allowlist []string, cfg ProcessConfig) error {
+	if len(allowlist) == 0 {
+		return nil
+	}
+
+	command, _ := cfg.Executable()
+	path, err := ResolveCommand(command, cfg.Directory)
+	if err != nil {
+		return fmt.Errorf("command %q of process %s is not allowed: cannot resolve it: %w", command, cfg.Name, err)
+	}
+
+	for _, entry := range allowlist {
+		if strings.HasSuffix(entry, "/") || strings.HasSuffix(entry, string(filepath.Separator)) {
+			if strings.HasPrefix(path, filepath.Clean(entry)+string(filepath.Separator)) {
+				return nil
+			}
+		} else if path == filepath.Clean(entry) {
+			return nil
+		}
+	}
+	return fmt.Errorf("command %q of process %s is not allowed: %s is not on the command allowlist", command, cfg.Name, path)
+}
+
+// CheckCommands checks the command of every process against the allowlist.
+func (c *SupervisorConfig) CheckCommands(allowlist []string) error {
+	for _, procCfg := range c.Processes {
+		if err := CheckCommandAllowed(allowlist, procCfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseAllowlist splits a comma-separated list of absolute paths.
+func parseAllowlist(value string) ([]string, error) {
+	var allowlist []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !filepath.IsAbs(entry) {
+			return nil, fmt.Errorf("invalid COMMAND_ALLOWLIST entry %q: must be an absolute path", entry)
+		}
+		allowlist = append(allowlist, entry)
+	}
+	return allowlist, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckCommandAllowed(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(bin, "app")
+	if err := os.WriteFile(app, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		allowlist []string
+		cfg       ProcessConfig
+		wantErr   bool
+	}{
+		{"empty allowlist", nil, ProcessConfig{Command: "/does/not/exist"}, false},
+		{"exact path", []string{app}, ProcessConfig{Command: app}, false},
+		{"directory", []string{bin + "/"}, ProcessConfig{Command: app}, false},
+		{"path without separator is not a directory", []string{bin}, ProcessConfig{Command: app}, true},
+		{"sibling directory", []string{dir + "/other/"}, ProcessConfig{Command: app}, true},
+		{"prefix of a name", []string{app + "x"}, ProcessConfig{Command: app}, true},
+		{"relative to the directory", []string{app}, ProcessConfig{Command: "bin/app", Directory: dir}, false},
+		{"unclean entry", []string{bin + "/../bin/app"}, ProcessConfig{Command: app}, false},
+		{"unresolvable", []string{app}, ProcessConfig{Command: "no-such-command-here"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "app"
+			err := CheckCommandAllowed(tt.allowlist, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCommandAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"/usr/bin/python3", []string{"/usr/bin/python3"}, false},
+		{" /usr/bin/python3 , /opt/app/ ,", []string{"/usr/bin/python3", "/opt/app/"}, false},
+		{"/usr/bin/python3,python3", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseAllowlist(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAllowlist(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseAllowlist(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
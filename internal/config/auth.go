@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Roles an authenticated client can have. Viewers can only read.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// AuthConfig enables authentication of API requests with static bearer
+// tokens, JWTs verified against a JWKS URL, or both. With neither every
+// request is allowed.
+type AuthConfig struct {
+	// Tokens maps static bearer tokens to their role
+	Tokens map[string]string
+	// JWKSURL is where the signing keys of the OIDC provider are published
+	JWKSURL string
+	// Issuer and Audience, if set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// RoleClaim is the claim, or dotted path to a nested claim such as
+	// realm_access.roles, holding the client's roles. Tokens where it
+	// contains AdminRole get the admin role, all others the viewer role.
+	RoleClaim string
+	AdminRole string
+}
+
+// Enabled reports whether requests have to authenticate.
+func (c AuthConfig) Enabled() bool {
+	return len(c.Tokens) > 0 || c.JWKSURL != ""
+}
+
+// parseAuthTokens parses a comma-separated list of token:role entries. The
+// role defaults to admin.
+func parseAuthTokens(value string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		token, role, found := strings.Cut(entry, ":")
+		if !found {
+			role = RoleAdmin
+		}
+		if token == "" {
+			return nil, fmt.Errorf("invalid AUTH_TOKENS entry: empty token")
+		}
+		if role != RoleAdmin && role != RoleViewer {
+			return nil, fmt.Errorf("invalid AUTH_TOKENS role %q: must be admin or viewer", role)
+		}
+		tokens[token] = role
+	}
+	return tokens, nil
+}
@@ -1,26 +1,261 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
-	Server ServerConfig
+	Server   ServerConfig
+	Database DatabaseConfig
+	Tracing  TracingConfig
+	Auth     AuthConfig
+
+	// Settings records each resolved value and where it came from
+	Settings []Setting
 }
 
 type ServerConfig struct {
 	Address string
+	// AdminAddress, if set, gets its own listener serving every route while
+	// the one on Address only serves read requests
+	AdminAddress string
+	// ReadOnly rejects every mutating API request with 403
+	ReadOnly bool
+	// JSONCase is the field name casing of API responses
+	JSONCase string
+	// BasePath is the path prefix every route is served under, e.g.
+	// "/supervisor" behind a reverse proxy; "" serves them at the root
+	BasePath string
+	// CrashReplay allows re-running a crashed process's command via the API
+	CrashReplay bool
+	// CommandAllowlist restricts the binaries processes may run, see
+	// CheckCommandAllowed. Empty allows any.
+	CommandAllowlist []string
+}
+
+// API response casings
+const (
+	JSONCaseSnake = "snake" // process_name
+	JSONCaseCamel = "camel" // processName
+)
+
+// DatabaseConfig holds SQLite tuning pragmas. Zero values keep the SQLite
+// defaults.
+type DatabaseConfig struct {
+	BusyTimeout int    // milliseconds to wait on a locked database
+	Synchronous string // OFF, NORMAL, FULL or EXTRA
+	CacheSize   int    // pages if positive, KiB if negative
+	MaxSize     int    // megabytes before the oldest records are deleted; 0 disables
+	// ErrorDedupWindow is the seconds within which identical error logs
+	// are counted on one entry; 0 disables
+	ErrorDedupWindow int
+	// CorruptionPolicy is what to do when the database file is corrupt, one
+	// of the DBCorruption* policies
+	CorruptionPolicy string
+}
+
+// Policies for a corrupt database file
+const (
+	// DBCorruptionFail refuses to start
+	DBCorruptionFail = "fail"
+	// DBCorruptionRecreate moves the file aside and starts with a new one
+	DBCorruptionRecreate = "recreate"
+	// DBCorruptionDisable starts without storage
+	DBCorruptionDisable = "disable"
+)
+
+// TracingConfig enables OpenTelemetry request tracing exported via OTLP/HTTP.
+type TracingConfig struct {
+	Enabled  bool
+	Endpoint string
 }
 
-func LoadConfig() *Config {
+func LoadConfig() (*Config, error) {
 	address := os.Getenv("SERVER_ADDRESS")
 	if address == "" {
 		address = ":8080"
 	}
-	
-	return &Config{
+
+	busyTimeout, err := intEnv("DB_BUSY_TIMEOUT", 5000)
+	if err != nil {
+		return nil, err
+	}
+	cacheSize, err := intEnv("DB_CACHE_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := intEnv("DB_MAX_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	errorDedupWindow, err := intEnv("DB_ERROR_DEDUP_WINDOW", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	corruptionPolicy := os.Getenv("DB_CORRUPTION_POLICY")
+	switch corruptionPolicy {
+	case "":
+		corruptionPolicy = DBCorruptionFail
+	case DBCorruptionFail, DBCorruptionRecreate, DBCorruptionDisable:
+	default:
+		return nil, fmt.Errorf("invalid DB_CORRUPTION_POLICY %q: must be fail, recreate or disable", corruptionPolicy)
+	}
+
+	readOnly := false
+	if v := os.Getenv("READ_ONLY"); v != "" {
+		readOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid READ_ONLY %q: must be true or false", v)
+		}
+	}
+
+	jsonCase := os.Getenv("JSON_CASE")
+	switch jsonCase {
+	case "":
+		jsonCase = JSONCaseSnake
+	case JSONCaseSnake, JSONCaseCamel:
+	default:
+		return nil, fmt.Errorf("invalid JSON_CASE %q: must be snake or camel", jsonCase)
+	}
+
+	basePath := strings.TrimSuffix(os.Getenv("BASE_PATH"), "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		return nil, fmt.Errorf("invalid BASE_PATH %q: must start with /", basePath)
+	}
+
+	crashReplay := false
+	if v := os.Getenv("CRASH_REPLAY"); v != "" {
+		crashReplay, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CRASH_REPLAY %q: must be true or false", v)
+		}
+	}
+
+	allowlist, err := parseAllowlist(os.Getenv("COMMAND_ALLOWLIST"))
+	if err != nil {
+		return nil, err
+	}
+
+	adminAddress, err := adminListenAddress(os.Getenv("ADMIN_ADDRESS"))
+	if err != nil {
+		return nil, err
+	}
+
+	authTokens, err := parseAuthTokens(os.Getenv("AUTH_TOKENS"))
+	if err != nil {
+		return nil, err
+	}
+	roleClaim := os.Getenv("AUTH_ROLE_CLAIM")
+	if roleClaim == "" {
+		roleClaim = "role"
+	}
+	adminRole := os.Getenv("AUTH_ADMIN_ROLE")
+	if adminRole == "" {
+		adminRole = RoleAdmin
+	}
+
+	otelEnabled := false
+	if v := os.Getenv("OTEL_ENABLED"); v != "" {
+		otelEnabled, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTEL_ENABLED %q: must be true or false", v)
+		}
+	}
+
+	cfg := &Config{
 		Server: ServerConfig{
-			Address: address,
+			Address:          address,
+			AdminAddress:     adminAddress,
+			ReadOnly:         readOnly,
+			JSONCase:         jsonCase,
+			BasePath:         basePath,
+			CrashReplay:      crashReplay,
+			CommandAllowlist: allowlist,
+		},
+		Database: DatabaseConfig{
+			BusyTimeout: busyTimeout,
+			Synchronous: os.Getenv("DB_SYNCHRONOUS"),
+			CacheSize:   cacheSize,
+			MaxSize:     maxSize,
+
+			ErrorDedupWindow: errorDedupWindow,
+			CorruptionPolicy: corruptionPolicy,
 		},
+		Tracing: TracingConfig{
+			Enabled:  otelEnabled,
+			Endpoint: os.Getenv("OTEL_ENDPOINT"),
+		},
+		Auth: AuthConfig{
+			Tokens:    authTokens,
+			JWKSURL:   os.Getenv("AUTH_JWKS_URL"),
+			Issuer:    os.Getenv("AUTH_ISSUER"),
+			Audience:  os.Getenv("AUTH_AUDIENCE"),
+			RoleClaim: roleClaim,
+			AdminRole: adminRole,
+		},
+	}
+
+	cfg.Settings = []Setting{
+		{Key: "SERVER_ADDRESS", Value: cfg.Server.Address, Source: envSource("SERVER_ADDRESS")},
+		{Key: "ADMIN_ADDRESS", Value: cfg.Server.AdminAddress, Source: envSource("ADMIN_ADDRESS")},
+		{Key: "READ_ONLY", Value: cfg.Server.ReadOnly, Source: envSource("READ_ONLY")},
+		{Key: "JSON_CASE", Value: cfg.Server.JSONCase, Source: envSource("JSON_CASE")},
+		{Key: "BASE_PATH", Value: cfg.Server.BasePath, Source: envSource("BASE_PATH")},
+		{Key: "CRASH_REPLAY", Value: cfg.Server.CrashReplay, Source: envSource("CRASH_REPLAY")},
+		{Key: "COMMAND_ALLOWLIST", Value: cfg.Server.CommandAllowlist, Source: envSource("COMMAND_ALLOWLIST")},
+		{Key: "DB_BUSY_TIMEOUT", Value: cfg.Database.BusyTimeout, Source: envSource("DB_BUSY_TIMEOUT")},
+		{Key: "DB_SYNCHRONOUS", Value: cfg.Database.Synchronous, Source: envSource("DB_SYNCHRONOUS")},
+		{Key: "DB_CACHE_SIZE", Value: cfg.Database.CacheSize, Source: envSource("DB_CACHE_SIZE")},
+		{Key: "DB_MAX_SIZE", Value: cfg.Database.MaxSize, Source: envSource("DB_MAX_SIZE")},
+		{Key: "DB_ERROR_DEDUP_WINDOW", Value: cfg.Database.ErrorDedupWindow, Source: envSource("DB_ERROR_DEDUP_WINDOW")},
+		{Key: "DB_CORRUPTION_POLICY", Value: cfg.Database.CorruptionPolicy, Source: envSource("DB_CORRUPTION_POLICY")},
+		{Key: "OTEL_ENABLED", Value: cfg.Tracing.Enabled, Source: envSource("OTEL_ENABLED")},
+		{Key: "OTEL_ENDPOINT", Value: cfg.Tracing.Endpoint, Source: envSource("OTEL_ENDPOINT")},
+		// Only the number of tokens is reported, never the tokens
+		{Key: "AUTH_TOKENS", Value: len(cfg.Auth.Tokens), Source: envSource("AUTH_TOKENS")},
+		{Key: "AUTH_JWKS_URL", Value: cfg.Auth.JWKSURL, Source: envSource("AUTH_JWKS_URL")},
+		{Key: "AUTH_ISSUER", Value: cfg.Auth.Issuer, Source: envSource("AUTH_ISSUER")},
+		{Key: "AUTH_AUDIENCE", Value: cfg.Auth.Audience, Source: envSource("AUTH_AUDIENCE")},
+		{Key: "AUTH_ROLE_CLAIM", Value: cfg.Auth.RoleClaim, Source: envSource("AUTH_ROLE_CLAIM")},
+		{Key: "AUTH_ADMIN_ROLE", Value: cfg.Auth.AdminRole, Source: envSource("AUTH_ADMIN_ROLE")},
+	}
+
+	return cfg, nil
+}
+
+// adminListenAddress resolves ADMIN_ADDRESS. An address without a host,
+// such as ":9090" or "9090", binds to loopback only, so changes are not
+// exposed beyond the machine unless a host is given explicitly.
+func adminListenAddress(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if _, err := strconv.ParseUint(value, 10, 16); err == nil {
+		return net.JoinHostPort("127.0.0.1", value), nil
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid ADMIN_ADDRESS %q: %w", value, err)
 	}
-}
\ No newline at end of file
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func intEnv(key string, def int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be an integer", key, value)
+	}
+	return n, nil
+}
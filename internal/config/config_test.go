@@ -0,0 +1,122 @@
+package config
+
+import "testing"
+
+func TestAdminListenAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{":9090", "127.0.0.1:9090", false},
+		{"9090", "127.0.0.1:9090", false},
+		{"127.0.0.1:9090", "127.0.0.1:9090", false},
+		{"localhost:9090", "localhost:9090", false},
+		{"0.0.0.0:9090", "0.0.0.0:9090", false},
+		{"[::1]:9090", "[::1]:9090", false},
+		{"admin.internal", "", true},
+		{"99999", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := adminListenAddress(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("adminListenAddress(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("adminListenAddress(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAdminAddress(t *testing.T) {
+	t.Setenv("ADMIN_ADDRESS", ":9191")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Server.AdminAddress != "127.0.0.1:9191" {
+		t.Errorf("AdminAddress = %q, want loopback", cfg.Server.AdminAddress)
+	}
+}
+
+func TestLoadConfigDatabase(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.Database.BusyTimeout != 5000 || cfg.Database.CacheSize != 0 || cfg.Database.Synchronous != "" {
+			t.Errorf("Database = %+v, want a 5000ms busy timeout and SQLite defaults", cfg.Database)
+		}
+	})
+	t.Run("from environment", func(t *testing.T) {
+		t.Setenv("DB_BUSY_TIMEOUT", "100")
+		t.Setenv("DB_SYNCHRONOUS", "NORMAL")
+		t.Setenv("DB_CACHE_SIZE", "-4000")
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.Database.BusyTimeout != 100 || cfg.Database.Synchronous != "NORMAL" || cfg.Database.CacheSize != -4000 {
+			t.Errorf("Database = %+v, want the environment values", cfg.Database)
+		}
+	})
+	t.Run("not an integer", func(t *testing.T) {
+		t.Setenv("DB_CACHE_SIZE", "lots")
+		if _, err := LoadConfig(); err == nil {
+			t.Error("LoadConfig() with DB_CACHE_SIZE=lots succeeded")
+		}
+	})
+}
+
+func TestLoadConfigSettingSources(t *testing.T) {
+	t.Setenv("SERVER_ADDRESS", ":9000")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	want := map[string]Setting{
+		"SERVER_ADDRESS":  {Key: "SERVER_ADDRESS", Value: ":9000", Source: SourceEnv},
+		"DB_BUSY_TIMEOUT": {Key: "DB_BUSY_TIMEOUT", Value: 5000, Source: SourceDefault},
+	}
+	for _, s := range cfg.Settings {
+		if w, ok := want[s.Key]; ok {
+			if s != w {
+				t.Errorf("setting %s = %+v, want %+v", s.Key, s, w)
+			}
+			delete(want, s.Key)
+		}
+	}
+	for key := range want {
+		t.Errorf("setting %s not reported", key)
+	}
+}
+
+func TestLoadConfigJSONCase(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", JSONCaseSnake, false},
+		{"snake", JSONCaseSnake, false},
+		{"camel", JSONCaseCamel, false},
+		{"kebab", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("JSON_CASE", tt.value)
+			cfg, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Server.JSONCase != tt.want {
+				t.Errorf("JSONCase = %q, want %q", cfg.Server.JSONCase, tt.want)
+			}
+		})
+	}
+}
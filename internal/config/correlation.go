@@ -0,0 +1,21 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ParseCorrelationPattern compiles a correlation_pattern. The correlation id
+// of a line is the pattern's first capture group, or the whole match if it
+// has none. An empty pattern disables extraction and returns nil.
+func ParseCorrelationPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid correlation_pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+)
+
+// DefaultLogPrefix is prepended to process output lines when no logprefix is
+// configured.
+const DefaultLogPrefix = "[{{.Name}}] "
+
+// LogPrefixData is the data a logprefix template is executed with.
+type LogPrefixData struct {
+	Name   string
+	Stream string // "stdout" or "stderr"
+	Pid    int
+}
+
+// ParseLogPrefix parses a logprefix template. Nil means DefaultLogPrefix.
+func ParseLogPrefix(prefix *string) (*template.Template, error) {
+	text := DefaultLogPrefix
+	if prefix != nil {
+		text = *prefix
+	}
+
+	tmpl, err := template.New("logprefix").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logprefix %q: %w", text, err)
+	}
+	// Catch references to unknown fields now rather than on the first line
+	if err := tmpl.Execute(io.Discard, LogPrefixData{}); err != nil {
+		return nil, fmt.Errorf("invalid logprefix %q: %w", text, err)
+	}
+	return tmpl, nil
+}
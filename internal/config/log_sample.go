@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogSampling is how many of a process's output lines reach the log view.
+// Exactly one of Rate and Every is set.
+type LogSampling struct {
+	// Rate is the chance that each line is kept, between 0 and 1
+	Rate float64
+	// Every keeps one line in every Every lines, in turn
+	Every int
+}
+
+// ParseLogSampleRate parses a sample_rate: a fraction such as "0.1" keeps
+// each line at random with that probability, "1 in N" keeps every Nth line.
+// An empty rate disables sampling and returns nil.
+func ParseLogSampleRate(rate string) (*LogSampling, error) {
+	if rate == "" {
+		return nil, nil
+	}
+
+	if one, n, ok := strings.Cut(rate, " in "); ok {
+		every, err := strconv.Atoi(strings.TrimSpace(n))
+		if strings.TrimSpace(one) != "1" || err != nil || every < 1 {
+			return nil, fmt.Errorf("invalid sample_rate %q: must be a fraction such as 0.1 or \"1 in N\"", rate)
+		}
+		return &LogSampling{Every: every}, nil
+	}
+
+	f, err := strconv.ParseFloat(rate, 64)
+	if err != nil || f <= 0 || f > 1 {
+		return nil, fmt.Errorf("invalid sample_rate %q: must be a fraction such as 0.1 or \"1 in N\"", rate)
+	}
+	return &LogSampling{Rate: f}, nil
+}
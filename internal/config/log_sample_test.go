@@ -0,0 +1,38 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogSampleRate(t *testing.T) {
+	tests := []struct {
+		rate    string
+		want    *LogSampling
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"0.1", &LogSampling{Rate: 0.1}, false},
+		{"1", &LogSampling{Rate: 1}, false},
+		{"1 in 10", &LogSampling{Every: 10}, false},
+		{" 1 in 3", &LogSampling{Every: 3}, false},
+		{"0", nil, true},
+		{"1.5", nil, true},
+		{"-0.1", nil, true},
+		{"2 in 10", nil, true},
+		{"1 in 0", nil, true},
+		{"1 in many", nil, true},
+		{"10%", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rate, func(t *testing.T) {
+			got, err := ParseLogSampleRate(tt.rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLogSampleRate(%q) error = %v, wantErr %v", tt.rate, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLogSampleRate(%q) = %+v, want %+v", tt.rate, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,33 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// processNamePattern is what a process name must match to be usable in API
+// URLs without escaping.
+var processNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// reservedProcessNames are the endpoints below /api/processes that would
+// hide GET /api/processes/{name} of a process with the same name.
+var reservedProcessNames = []string{"summary", "shutdown-plan"}
+
+// ValidProcessName reports whether name can be used as a process name:
+// letters, digits, '.', '_', '@' and '-', starting with a letter or digit,
+// other than the reserved names summary and shutdown-plan.
+func ValidProcessName(name string) bool {
+	return processNamePattern.MatchString(name) && !slices.Contains(reservedProcessNames, name)
+}
+
 type ProcessConfig struct {
 	Name        string            `yaml:"name"`
 	Command     string            `yaml:"command"`
@@ -15,14 +37,324 @@ type ProcessConfig struct {
 	AutoStart   bool              `yaml:"autostart"`
 	AutoRestart bool              `yaml:"autorestart"`
 	StartSecs   int               `yaml:"startsecs,omitempty"`
-	StopSignal  string            `yaml:"stopsignal,omitempty"`
-	StopTimeout int               `yaml:"stoptimeout,omitempty"`
-	Stdout      string            `yaml:"stdout,omitempty"`
-	Stderr      string            `yaml:"stderr,omitempty"`
+	// Shell runs Command as a shell command line, with Args as $1, $2 and
+	// so on, in ShellPath; unset ShellPath inherits the global default_shell
+	Shell     bool   `yaml:"shell,omitempty"`
+	ShellPath string `yaml:"shell_path,omitempty"`
+	// BootDelaySeconds delays the autostart when the supervisor boots by
+	// this many seconds; later starts and restarts are not delayed
+	BootDelaySeconds int    `yaml:"boot_delay_seconds,omitempty"`
+	StopSignal       string `yaml:"stopsignal,omitempty"`
+	StopTimeout      int    `yaml:"stoptimeout,omitempty"`
+	Stdout           string `yaml:"stdout,omitempty"`
+	Stderr           string `yaml:"stderr,omitempty"`
+	User             string `yaml:"user,omitempty"`
+	// Umask is an octal file mode creation mask, e.g. "022"
+	Umask string `yaml:"umask,omitempty"`
+	// MaxLineLength truncates longer output lines; -1 disables truncation
+	MaxLineLength int `yaml:"maxlinelength,omitempty"`
+	// ExpectLongRunning flags a clean exit (code 0) as an anomaly rather
+	// than a normal completion
+	ExpectLongRunning bool `yaml:"expect_long_running,omitempty"`
+	// MinUptime is how many seconds a process must stay up after starting
+	// to count as started successfully; 0 disables the check
+	MinUptime int `yaml:"min_uptime,omitempty"`
+	// SlowStopThreshold is how many seconds a graceful stop may take before
+	// a warning is logged; 0 inherits the global value, -1 disables it
+	SlowStopThreshold int `yaml:"slow_stop_threshold,omitempty"`
+	// RestartJitterMax adds a random delay of up to this many seconds to
+	// every automatic restart; 0 inherits the global value, -1 disables it
+	RestartJitterMax int `yaml:"restart_jitter_max,omitempty"`
+	// StartupStderrLines is how many stderr lines written in the first
+	// StartupStderrWindow seconds of each run are kept apart from the
+	// rolling output, so errors on boot are not pushed out by later output;
+	// -1 disables this
+	StartupStderrLines  int `yaml:"startup_stderr_lines,omitempty"`
+	StartupStderrWindow int `yaml:"startup_stderr_window,omitempty"`
+	// SplitLogs writes stdout and stderr to <name>.out.log and <name>.err.log
+	// in the logdir instead of a combined <name>.log
+	SplitLogs bool `yaml:"splitlogs,omitempty"`
+	// LogFsyncPolicy overrides the global log_fsync_policy for this
+	// process's log files
+	LogFsyncPolicy string `yaml:"log_fsync_policy,omitempty"`
+	// SampleRate keeps only some output lines in the log view, see
+	// ParseLogSampleRate; log files and crash output still get every line
+	SampleRate string `yaml:"sample_rate,omitempty"`
+	// LogBufferSize is how many output lines per stream are kept in memory
+	// and LogRetentionDays how many days the process's error logs are kept
+	// in the database; 0 inherits the global log_buffer_size and retention,
+	// a LogRetentionDays of -1 keeps them until the size limit is reached
+	LogBufferSize    int `yaml:"log_buffer_size,omitempty"`
+	LogRetentionDays int `yaml:"log_retention_days,omitempty"`
+	// LogSinceStart annotates each output line in the log view with the
+	// time elapsed since the process instance started
+	LogSinceStart bool `yaml:"log_since_start,omitempty"`
+	// LogPrefix is a text/template prepended to each output line in the log
+	// view; unset inherits the global logprefix, "" disables the prefix
+	LogPrefix *string `yaml:"logprefix,omitempty"`
+	// CorrelationPattern is a regular expression extracting a correlation
+	// id from each output line, see ParseCorrelationPattern; "" inherits the
+	// global correlation_pattern
+	CorrelationPattern string `yaml:"correlation_pattern,omitempty"`
+	// Singleton guards against running the process twice, e.g. when an
+	// instance outlived a supervisor that crashed: a file lock in lockdir is
+	// held for as long as the process runs. If an instance still holds it on
+	// start, "refuse" fails the start and "adopt" supervises that instance.
+	Singleton string `yaml:"singleton,omitempty"`
+	// AllowConsole keeps the process's stdin open for interactive consoles
+	// attached through the API
+	AllowConsole bool `yaml:"allow_console,omitempty"`
+	// Replicas runs this many instances of the process, named <name>-0,
+	// <name>-1 and so on. ${INSTANCE} in their command, args, directory and
+	// environment is the instance's 0-based index and ${PORT} is PortBase
+	// plus that index.
+	Replicas int `yaml:"replicas,omitempty"`
+	PortBase int `yaml:"port_base,omitempty"`
+	// MaxUnavailable is how many replicas a rolling restart may have down
+	// at once, counting those already not ready; 0 means 1
+	MaxUnavailable int `yaml:"max_unavailable,omitempty"`
+	// Instance is the index of a replica, set when replicas are expanded
+	Instance *int `yaml:"instance,omitempty"`
+	// ReloadOnChange lists files, relative to Directory, whose changes
+	// restart the process or, with ReloadSignal set, send it that signal
+	ReloadOnChange []string `yaml:"reload_on_change,omitempty"`
+	ReloadSignal   string   `yaml:"reload_signal,omitempty"`
+	// Notify names the webhooks that get this process's events instead of
+	// the default ones, e.g. the owning team's channel
+	Notify []string `yaml:"notify,omitempty"`
+	// NotifyCooldown is the least number of seconds between crash alerts
+	// about this process; crashes in between are recorded but not sent
+	NotifyCooldown int `yaml:"notify_cooldown,omitempty"`
+	// DisplayName is shown in the UI instead of Name, which stays the key
+	// in API routes
+	DisplayName string `yaml:"display_name,omitempty"`
+	// Labels group processes for bulk operations, e.g. tier: critical
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Priority orders startup among processes without dependencies between
+	// them: lower starts first and stops last. DependsOn always wins.
+	Priority  int      `yaml:"priority,omitempty"`
+	DependsOn []string `yaml:"depends_on,omitempty"`
+
+	// HeartbeatTimeout enables the watchdog: a running process that sends no
+	// heartbeat (API call or touching HeartbeatFile) for this many seconds is
+	// considered hung and restarted.
+	HeartbeatTimeout int    `yaml:"heartbeattimeout,omitempty"`
+	HeartbeatFile    string `yaml:"heartbeatfile,omitempty"`
+
+	HealthCheck *HealthCheckConfig `yaml:"healthcheck,omitempty"`
+	// StopCheck confirms after a stop that the process's service is down,
+	// e.g. that no detached child still serves its port
+	StopCheck *StopCheckConfig `yaml:"stopcheck,omitempty"`
+
+	// CanRestart is a shell command run before every automatic restart.
+	// A non-zero exit code defers the restart until the command succeeds.
+	CanRestart        string `yaml:"canrestart,omitempty"`
+	CanRestartTimeout int    `yaml:"canrestarttimeout,omitempty"`
+
+	// StartCondition is a shell command run before every start, automatic
+	// or not. A non-zero exit code defers the start, checking the condition
+	// again every StartConditionInterval seconds until it succeeds.
+	StartCondition         string `yaml:"startcondition,omitempty"`
+	StartConditionTimeout  int    `yaml:"startconditiontimeout,omitempty"`
+	StartConditionInterval int    `yaml:"startconditioninterval,omitempty"`
+
+	// PreStartCheck is a shell command that must exit zero before every
+	// spawn, e.g. pg_isready. It is tried PreStartCheckAttempts times,
+	// PreStartCheckInterval seconds apart; if it never passes the start
+	// fails.
+	PreStartCheck         string `yaml:"pre_start_check,omitempty"`
+	PreStartCheckTimeout  int    `yaml:"pre_start_check_timeout,omitempty"`
+	PreStartCheckAttempts int    `yaml:"pre_start_check_attempts,omitempty"`
+	PreStartCheckInterval int    `yaml:"pre_start_check_interval,omitempty"`
+}
+
+// HealthCheckConfig describes how to probe a running process. Exactly one of
+// Command (exit code 0), HTTP (2xx/3xx response) or TCP (connect) is used.
+type HealthCheckConfig struct {
+	Command  string `yaml:"command,omitempty"`
+	HTTP     string `yaml:"http,omitempty"`
+	TCP      string `yaml:"tcp,omitempty"`
+	Interval int    `yaml:"interval,omitempty"` // seconds between checks
+	Timeout  int    `yaml:"timeout,omitempty"`  // seconds per check
+	Retries  int    `yaml:"retries,omitempty"`  // consecutive failures before unhealthy
+}
+
+// StopCheckConfig probes a stopped process's service until it no longer
+// answers: an HTTP GET that gets any response or a TCP connect that
+// succeeds means it is still up. If it is still up after Timeout seconds a
+// warning is logged.
+type StopCheckConfig struct {
+	HTTP    string `yaml:"http,omitempty"`
+	TCP     string `yaml:"tcp,omitempty"`
+	Timeout int    `yaml:"timeout,omitempty"`
+}
+
+type WebhookConfig struct {
+	Name string `yaml:"name,omitempty"`
+	URL  string `yaml:"url"`
+}
+
+type NotificationConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"`
+	// Default names the webhooks for events of processes without notify;
+	// empty means every webhook
+	Default []string `yaml:"default,omitempty"`
+	// FailureThreshold consecutive failures open a target's circuit breaker
+	// for Cooldown seconds.
+	FailureThreshold int `yaml:"failurethreshold,omitempty"`
+	Cooldown         int `yaml:"cooldown,omitempty"`
+	// LogLines recent output lines are attached to crash notifications, with
+	// every match of the Redact regular expressions masked.
+	LogLines int      `yaml:"loglines,omitempty"`
+	Redact   []string `yaml:"redact,omitempty"`
+	// DedupWindow seconds after a crash is notified, crashes with the same
+	// fingerprint are only counted and reported every SummaryInterval seconds.
+	DedupWindow     int `yaml:"dedupwindow,omitempty"`
+	SummaryInterval int `yaml:"summaryinterval,omitempty"`
+	// Retry controls how failed webhook deliveries are retried
+	Retry WebhookRetryConfig `yaml:"retry,omitempty"`
+}
+
+// WebhookRetryConfig controls webhook delivery attempts. Connection errors
+// and responses matching RetryStatus are retried after BackoffBase seconds,
+// doubling up to BackoffMax, or after the response's Retry-After if given.
+type WebhookRetryConfig struct {
+	MaxAttempts int      `yaml:"maxattempts,omitempty"` // including the first attempt
+	Timeout     int      `yaml:"timeout,omitempty"`     // seconds per attempt
+	BackoffBase int      `yaml:"backoffbase,omitempty"`
+	BackoffMax  int      `yaml:"backoffmax,omitempty"`  // also caps Retry-After
+	RetryStatus []string `yaml:"retrystatus,omitempty"` // status codes such as "429" or classes such as "5xx"
+}
+
+// ArchiveConfig is the S3-compatible bucket rotated log segments are
+// uploaded to while the archive_enabled setting is on. AccessKey and
+// SecretKey default to $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY.
+type ArchiveConfig struct {
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Bucket    string `yaml:"bucket,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	Prefix    string `yaml:"prefix,omitempty"`
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+}
+
+// Log file fsync policies
+const (
+	LogFsyncNone     = "none"
+	LogFsyncInterval = "interval"
+	LogFsyncAlways   = "always"
+)
+
+func validLogFsyncPolicy(policy string) bool {
+	return policy == LogFsyncNone || policy == LogFsyncInterval || policy == LogFsyncAlways
 }
 
+// Singleton modes
+const (
+	SingletonRefuse = "refuse"
+	SingletonAdopt  = "adopt"
+)
+
+// Dependency wait policies
+const (
+	DependencyWaitStrict  = "strict"
+	DependencyWaitLenient = "lenient"
+)
+
+// reloadSignals are the signals reload_signal may name
+var reloadSignals = []string{"SIGHUP", "SIGINT", "SIGQUIT", "SIGTERM", "SIGUSR1", "SIGUSR2"}
+
+var retryStatusPattern = regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+
 type SupervisorConfig struct {
+	// SecretsFile is a KEY=VALUE file used to resolve ${secret:key}
+	// references when no other secret provider is configured.
+	SecretsFile   string             `yaml:"secretsfile,omitempty"`
+	Notifications NotificationConfig `yaml:"notifications,omitempty"`
+	// Environment is the base environment of every process, below each
+	// process's own environment
+	Environment map[string]string `yaml:"environment,omitempty"`
+	// DefaultShell is the default ProcessConfig.ShellPath
+	DefaultShell string `yaml:"default_shell,omitempty"`
+	// LogPrefix is the default output line prefix, see ProcessConfig.LogPrefix
+	LogPrefix *string `yaml:"logprefix,omitempty"`
+	// CorrelationPattern is the default ProcessConfig.CorrelationPattern
+	CorrelationPattern string `yaml:"correlation_pattern,omitempty"`
+	// LogDir enables writing process output to files in this directory.
+	// Each file is rotated once it exceeds LogMaxSize megabytes, keeping
+	// LogBackups old files.
+	LogDir     string `yaml:"logdir,omitempty"`
+	LogMaxSize int    `yaml:"logmaxsize,omitempty"`
+	LogBackups int    `yaml:"logbackups,omitempty"`
+	// LogFsyncPolicy is when log files are flushed to disk: never
+	// explicitly ("none"), every LogFsyncInterval milliseconds ("interval")
+	// or after every line ("always")
+	LogFsyncPolicy   string `yaml:"log_fsync_policy,omitempty"`
+	LogFsyncInterval int    `yaml:"log_fsync_interval,omitempty"`
+	// LogBufferSize is the default ProcessConfig.LogBufferSize
+	LogBufferSize int `yaml:"log_buffer_size,omitempty"`
+	// LogMemoryLimit caps the megabytes of output kept in memory for all
+	// processes together; 0 means no limit
+	LogMemoryLimit int `yaml:"log_memory_limit,omitempty"`
+	// LockDir holds the lock files of singleton processes
+	LockDir string `yaml:"lockdir,omitempty"`
+	// HealthCheckConcurrency caps how many health checks run at once, the
+	// others waiting for a free slot; 0 means no limit
+	HealthCheckConcurrency int `yaml:"health_check_concurrency,omitempty"`
+	// UsageSampleInterval is how often, in seconds, the memory and CPU
+	// usage of running processes is sampled; -1 disables sampling.
+	// UsageWindow is how many seconds of samples are kept.
+	UsageSampleInterval int `yaml:"usage_sample_interval,omitempty"`
+	UsageWindow         int `yaml:"usage_window,omitempty"`
+	// RestartJitter randomizes automatic restart delays by up to this
+	// fraction (0.0-1.0) of startsecs, so processes that crash together do
+	// not restart in lockstep
+	RestartJitter float64 `yaml:"restart_jitter,omitempty"`
+	// RestartJitterMax is the default ProcessConfig.RestartJitterMax
+	RestartJitterMax int `yaml:"restart_jitter_max,omitempty"`
+	// Retention is how many days crash records and error logs are kept; -1
+	// keeps them until the database size limit is reached
+	Retention int `yaml:"retention,omitempty"`
+	// TransitionRetention is how many days process state transitions are
+	// kept; -1 keeps them until the database size limit is reached
+	TransitionRetention int `yaml:"transitionretention,omitempty"`
+	// BinaryCheckInterval is how often, in seconds, every process's command
+	// is verified to exist and be executable; -1 disables the check
+	BinaryCheckInterval int `yaml:"binarycheckinterval,omitempty"`
+	// SlowStopThreshold is the default ProcessConfig.SlowStopThreshold
+	SlowStopThreshold int `yaml:"slow_stop_threshold,omitempty"`
+	// ExitCodeHistory is how many of each process's last exit codes are
+	// reported with it
+	ExitCodeHistory int `yaml:"exit_code_history,omitempty"`
+	// CrashOutputMaxBytes caps the stdout and stderr stored with each crash
+	// record, keeping the end of the output; -1 stores it in full
+	CrashOutputMaxBytes int `yaml:"crash_output_max_bytes,omitempty"`
+	// DependencyWaitTimeout is how many seconds autostart waits for a
+	// process's dependencies to be ready before starting it; 0 does not
+	// wait. DependencyWaitPolicy is what happens to a process whose
+	// dependencies are not ready in time: "strict" leaves it stopped,
+	// "lenient" starts it anyway.
+	DependencyWaitTimeout int    `yaml:"dependency_wait_timeout,omitempty"`
+	DependencyWaitPolicy  string `yaml:"dependency_wait_policy,omitempty"`
+	// SyslogAddr, if set, is a syslog server that also receives the
+	// supervisor's own events, over SyslogProto (udp or tcp) with
+	// SyslogFacility (e.g. daemon or local0)
+	SyslogAddr     string `yaml:"syslog_addr,omitempty"`
+	SyslogProto    string `yaml:"syslog_proto,omitempty"`
+	SyslogFacility string `yaml:"syslog_facility,omitempty"`
+	// Archive, if its endpoint is set, is where rotated log files and
+	// batches of evicted supervisor events are uploaded
+	Archive ArchiveConfig `yaml:"archive,omitempty"`
+	// StopOrder lists processes to stop first, in this order, when the
+	// supervisor shuts down; the others follow in reverse start order
+	StopOrder []string `yaml:"stop_order,omitempty"`
+	// Units are systemd .service files loaded as additional processes
+	Units     []string        `yaml:"units,omitempty"`
 	Processes []ProcessConfig `yaml:"processes"`
+
+	// Settings records the supervisor-wide values and where they came from
+	Settings []Setting `yaml:"-"`
 }
 
 func LoadProcessConfig(path string) (*SupervisorConfig, error) {
@@ -36,18 +368,576 @@ func LoadProcessConfig(path string) (*SupervisorConfig, error) {
 		return nil, err
 	}
 
-	// Set defaults
+	for _, unit := range cfg.Units {
+		procCfg, err := LoadSystemdUnit(unit)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Processes = append(cfg.Processes, procCfg)
+	}
+
+	// Units and every replica get the base environment too
 	for i := range cfg.Processes {
-		if cfg.Processes[i].StopSignal == "" {
-			cfg.Processes[i].StopSignal = "SIGTERM"
+		cfg.Processes[i].Environment = mergeEnvironment(cfg.Environment, cfg.Processes[i].Environment)
+	}
+
+	cfg.Processes, err = expandReplicas(cfg.Processes)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkStopOrder(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkNotifyChannels(); err != nil {
+		return nil, err
+	}
+
+	// Note which values the file sets before defaults fill in the rest
+	sources := map[string]string{
+		"notifications.failurethreshold":  fileSource(cfg.Notifications.FailureThreshold),
+		"notifications.cooldown":          fileSource(cfg.Notifications.Cooldown),
+		"notifications.loglines":          fileSource(cfg.Notifications.LogLines),
+		"notifications.summaryinterval":   fileSource(cfg.Notifications.SummaryInterval),
+		"notifications.retry.maxattempts": fileSource(cfg.Notifications.Retry.MaxAttempts),
+		"notifications.retry.timeout":     fileSource(cfg.Notifications.Retry.Timeout),
+		"notifications.retry.backoffbase": fileSource(cfg.Notifications.Retry.BackoffBase),
+		"notifications.retry.backoffmax":  fileSource(cfg.Notifications.Retry.BackoffMax),
+		"notifications.retry.retrystatus": SourceDefault,
+		"binarycheckinterval":             fileSource(cfg.BinaryCheckInterval),
+		"slow_stop_threshold":             fileSource(cfg.SlowStopThreshold),
+		"crash_output_max_bytes":          fileSource(cfg.CrashOutputMaxBytes),
+		"exit_code_history":               fileSource(cfg.ExitCodeHistory),
+		"retention":                       fileSource(cfg.Retention),
+		"transitionretention":             fileSource(cfg.TransitionRetention),
+		"logmaxsize":                      fileSource(cfg.LogMaxSize),
+		"logbackups":                      fileSource(cfg.LogBackups),
+		"log_buffer_size":                 fileSource(cfg.LogBufferSize),
+		"log_fsync_policy":                fileSource(cfg.LogFsyncPolicy),
+		"log_fsync_interval":              fileSource(cfg.LogFsyncInterval),
+		"lockdir":                         fileSource(cfg.LockDir),
+		"default_shell":                   fileSource(cfg.DefaultShell),
+		"usage_sample_interval":           fileSource(cfg.UsageSampleInterval),
+		"usage_window":                    fileSource(cfg.UsageWindow),
+		"dependency_wait_policy":          fileSource(cfg.DependencyWaitPolicy),
+		"syslog_proto":                    fileSource(cfg.SyslogProto),
+		"syslog_facility":                 fileSource(cfg.SyslogFacility),
+		"archive.region":                  fileSource(cfg.Archive.Region),
+	}
+
+	if len(cfg.Notifications.Retry.RetryStatus) > 0 {
+		sources["notifications.retry.retrystatus"] = SourceFile
+	}
+
+	// Set defaults
+	if cfg.Notifications.FailureThreshold == 0 {
+		cfg.Notifications.FailureThreshold = 5
+	}
+	if cfg.Notifications.Cooldown == 0 {
+		cfg.Notifications.Cooldown = 60
+	}
+	if cfg.Notifications.LogLines == 0 {
+		cfg.Notifications.LogLines = 20
+	}
+	if cfg.Notifications.DedupWindow < 0 || cfg.Notifications.SummaryInterval < 0 {
+		return nil, fmt.Errorf("notifications: dedupwindow and summaryinterval must not be negative")
+	}
+	if cfg.Notifications.SummaryInterval == 0 {
+		cfg.Notifications.SummaryInterval = cfg.Notifications.DedupWindow
+	}
+	if err := cfg.Notifications.Retry.setDefaults(); err != nil {
+		return nil, fmt.Errorf("notifications: %w", err)
+	}
+	if cfg.RestartJitter < 0 || cfg.RestartJitter > 1 {
+		return nil, fmt.Errorf("invalid restart_jitter %v: must be between 0.0 and 1.0", cfg.RestartJitter)
+	}
+	if cfg.RestartJitterMax < 0 {
+		return nil, fmt.Errorf("invalid restart_jitter_max %d: must not be negative", cfg.RestartJitterMax)
+	}
+	if cfg.BinaryCheckInterval == 0 {
+		cfg.BinaryCheckInterval = 60
+	}
+	if cfg.SlowStopThreshold == 0 {
+		cfg.SlowStopThreshold = 5
+	}
+	if cfg.ExitCodeHistory < 0 {
+		return nil, fmt.Errorf("invalid exit_code_history %d: must not be negative", cfg.ExitCodeHistory)
+	}
+	if cfg.ExitCodeHistory == 0 {
+		cfg.ExitCodeHistory = 10
+	}
+	if cfg.CrashOutputMaxBytes < -1 {
+		return nil, fmt.Errorf("invalid crash_output_max_bytes %d: must be positive or -1", cfg.CrashOutputMaxBytes)
+	}
+	if cfg.CrashOutputMaxBytes == 0 {
+		cfg.CrashOutputMaxBytes = 64 << 10
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = -1
+	}
+	if cfg.TransitionRetention == 0 {
+		cfg.TransitionRetention = 30
+	}
+	if cfg.LogMaxSize == 0 {
+		cfg.LogMaxSize = 10
+	}
+	if cfg.LogBackups == 0 {
+		cfg.LogBackups = 5
+	}
+	if cfg.LogBufferSize < 0 {
+		return nil, fmt.Errorf("invalid log_buffer_size %d: must not be negative", cfg.LogBufferSize)
+	}
+	if cfg.LogBufferSize == 0 {
+		cfg.LogBufferSize = 500
+	}
+	if cfg.LogFsyncPolicy == "" {
+		cfg.LogFsyncPolicy = LogFsyncInterval
+	} else if !validLogFsyncPolicy(cfg.LogFsyncPolicy) {
+		return nil, fmt.Errorf("invalid log_fsync_policy %q: must be none, interval or always", cfg.LogFsyncPolicy)
+	}
+	if cfg.LogFsyncInterval < 0 {
+		return nil, fmt.Errorf("invalid log_fsync_interval %d: must not be negative", cfg.LogFsyncInterval)
+	}
+	if cfg.LogFsyncInterval == 0 {
+		cfg.LogFsyncInterval = 1000
+	}
+	if cfg.DefaultShell == "" {
+		cfg.DefaultShell = defaultShell
+	} else if err := checkShell(cfg.DefaultShell); err != nil {
+		return nil, fmt.Errorf("invalid default_shell: %w", err)
+	}
+	if cfg.LockDir == "" {
+		cfg.LockDir = filepath.Join(os.TempDir(), "pupervisor-locks")
+	}
+	if cfg.UsageSampleInterval < -1 || cfg.UsageWindow < 0 {
+		return nil, fmt.Errorf("invalid usage_sample_interval %d or usage_window %d: must be positive", cfg.UsageSampleInterval, cfg.UsageWindow)
+	}
+	if cfg.UsageSampleInterval == 0 {
+		cfg.UsageSampleInterval = 10
+	}
+	if cfg.UsageWindow == 0 {
+		cfg.UsageWindow = 3600
+	}
+	if cfg.LogMemoryLimit < 0 {
+		return nil, fmt.Errorf("invalid log_memory_limit %d: must not be negative", cfg.LogMemoryLimit)
+	}
+	if cfg.SyslogProto == "" {
+		cfg.SyslogProto = "udp"
+	} else if cfg.SyslogProto != "udp" && cfg.SyslogProto != "tcp" {
+		return nil, fmt.Errorf("invalid syslog_proto %q: must be udp or tcp", cfg.SyslogProto)
+	}
+	if cfg.SyslogFacility == "" {
+		cfg.SyslogFacility = "daemon"
+	}
+	if cfg.Archive.Endpoint != "" {
+		if cfg.Archive.Bucket == "" {
+			return nil, fmt.Errorf("archive.bucket is required with archive.endpoint")
 		}
-		if cfg.Processes[i].StopTimeout == 0 {
-			cfg.Processes[i].StopTimeout = 10
+		if cfg.Archive.Region == "" {
+			cfg.Archive.Region = "us-east-1"
 		}
-		if cfg.Processes[i].StartSecs == 0 {
-			cfg.Processes[i].StartSecs = 1
+		if cfg.Archive.AccessKey == "" {
+			cfg.Archive.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if cfg.Archive.SecretKey == "" {
+			cfg.Archive.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		if cfg.Archive.AccessKey == "" || cfg.Archive.SecretKey == "" {
+			return nil, fmt.Errorf("archive.access_key and archive.secret_key (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY) are required with archive.endpoint")
+		}
+	}
+	if cfg.HealthCheckConcurrency < 0 {
+		return nil, fmt.Errorf("invalid health_check_concurrency %d: must not be negative", cfg.HealthCheckConcurrency)
+	}
+	if cfg.DependencyWaitTimeout < 0 {
+		return nil, fmt.Errorf("invalid dependency_wait_timeout %d: must not be negative", cfg.DependencyWaitTimeout)
+	}
+	if cfg.DependencyWaitPolicy == "" {
+		cfg.DependencyWaitPolicy = DependencyWaitLenient
+	} else if cfg.DependencyWaitPolicy != DependencyWaitStrict && cfg.DependencyWaitPolicy != DependencyWaitLenient {
+		return nil, fmt.Errorf("invalid dependency_wait_policy %q: must be strict or lenient", cfg.DependencyWaitPolicy)
+	}
+	stopOrderSource := SourceDefault
+	if len(cfg.StopOrder) > 0 {
+		stopOrderSource = SourceFile
+	}
+	defaultChannelsSource := SourceDefault
+	if len(cfg.Notifications.Default) > 0 {
+		defaultChannelsSource = SourceFile
+	}
+	cfg.Settings = []Setting{
+		{Key: "secretsfile", Value: cfg.SecretsFile, Source: fileSource(cfg.SecretsFile)},
+		{Key: "restart_jitter", Value: cfg.RestartJitter, Source: fileSource(cfg.RestartJitter)},
+		{Key: "restart_jitter_max", Value: cfg.RestartJitterMax, Source: fileSource(cfg.RestartJitterMax)},
+		{Key: "binarycheckinterval", Value: cfg.BinaryCheckInterval, Source: sources["binarycheckinterval"]},
+		{Key: "slow_stop_threshold", Value: cfg.SlowStopThreshold, Source: sources["slow_stop_threshold"]},
+		{Key: "crash_output_max_bytes", Value: cfg.CrashOutputMaxBytes, Source: sources["crash_output_max_bytes"]},
+		{Key: "exit_code_history", Value: cfg.ExitCodeHistory, Source: sources["exit_code_history"]},
+		{Key: "retention", Value: cfg.Retention, Source: sources["retention"]},
+		{Key: "transitionretention", Value: cfg.TransitionRetention, Source: sources["transitionretention"]},
+		{Key: "correlation_pattern", Value: cfg.CorrelationPattern, Source: fileSource(cfg.CorrelationPattern)},
+		{Key: "logdir", Value: cfg.LogDir, Source: fileSource(cfg.LogDir)},
+		{Key: "logmaxsize", Value: cfg.LogMaxSize, Source: sources["logmaxsize"]},
+		{Key: "logbackups", Value: cfg.LogBackups, Source: sources["logbackups"]},
+		{Key: "log_fsync_policy", Value: cfg.LogFsyncPolicy, Source: sources["log_fsync_policy"]},
+		{Key: "log_fsync_interval", Value: cfg.LogFsyncInterval, Source: sources["log_fsync_interval"]},
+		{Key: "log_buffer_size", Value: cfg.LogBufferSize, Source: sources["log_buffer_size"]},
+		{Key: "log_memory_limit", Value: cfg.LogMemoryLimit, Source: fileSource(cfg.LogMemoryLimit)},
+		{Key: "lockdir", Value: cfg.LockDir, Source: sources["lockdir"]},
+		{Key: "default_shell", Value: cfg.DefaultShell, Source: sources["default_shell"]},
+		{Key: "health_check_concurrency", Value: cfg.HealthCheckConcurrency, Source: fileSource(cfg.HealthCheckConcurrency)},
+		{Key: "usage_sample_interval", Value: cfg.UsageSampleInterval, Source: sources["usage_sample_interval"]},
+		{Key: "usage_window", Value: cfg.UsageWindow, Source: sources["usage_window"]},
+		{Key: "dependency_wait_timeout", Value: cfg.DependencyWaitTimeout, Source: fileSource(cfg.DependencyWaitTimeout)},
+		{Key: "dependency_wait_policy", Value: cfg.DependencyWaitPolicy, Source: sources["dependency_wait_policy"]},
+		{Key: "syslog_addr", Value: cfg.SyslogAddr, Source: fileSource(cfg.SyslogAddr)},
+		{Key: "syslog_proto", Value: cfg.SyslogProto, Source: sources["syslog_proto"]},
+		{Key: "syslog_facility", Value: cfg.SyslogFacility, Source: sources["syslog_facility"]},
+		{Key: "archive.endpoint", Value: cfg.Archive.Endpoint, Source: fileSource(cfg.Archive.Endpoint)},
+		{Key: "archive.bucket", Value: cfg.Archive.Bucket, Source: fileSource(cfg.Archive.Bucket)},
+		{Key: "archive.region", Value: cfg.Archive.Region, Source: sources["archive.region"]},
+		{Key: "archive.prefix", Value: cfg.Archive.Prefix, Source: fileSource(cfg.Archive.Prefix)},
+		{Key: "stop_order", Value: cfg.StopOrder, Source: stopOrderSource},
+		{Key: "notifications.failurethreshold", Value: cfg.Notifications.FailureThreshold, Source: sources["notifications.failurethreshold"]},
+		{Key: "notifications.cooldown", Value: cfg.Notifications.Cooldown, Source: sources["notifications.cooldown"]},
+		{Key: "notifications.loglines", Value: cfg.Notifications.LogLines, Source: sources["notifications.loglines"]},
+		{Key: "notifications.default", Value: cfg.Notifications.Default, Source: defaultChannelsSource},
+		{Key: "notifications.dedupwindow", Value: cfg.Notifications.DedupWindow, Source: fileSource(cfg.Notifications.DedupWindow)},
+		{Key: "notifications.summaryinterval", Value: cfg.Notifications.SummaryInterval, Source: sources["notifications.summaryinterval"]},
+		{Key: "notifications.retry.maxattempts", Value: cfg.Notifications.Retry.MaxAttempts, Source: sources["notifications.retry.maxattempts"]},
+		{Key: "notifications.retry.timeout", Value: cfg.Notifications.Retry.Timeout, Source: sources["notifications.retry.timeout"]},
+		{Key: "notifications.retry.backoffbase", Value: cfg.Notifications.Retry.BackoffBase, Source: sources["notifications.retry.backoffbase"]},
+		{Key: "notifications.retry.backoffmax", Value: cfg.Notifications.Retry.BackoffMax, Source: sources["notifications.retry.backoffmax"]},
+		{Key: "notifications.retry.retrystatus", Value: cfg.Notifications.Retry.RetryStatus, Source: sources["notifications.retry.retrystatus"]},
+	}
+
+	for _, pattern := range cfg.Notifications.Redact {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+	}
+
+	if _, err := ParseLogPrefix(cfg.LogPrefix); err != nil {
+		return nil, err
+	}
+	if _, err := ParseCorrelationPattern(cfg.CorrelationPattern); err != nil {
+		return nil, err
+	}
+
+	for i := range cfg.Processes {
+		if err := cfg.SetProcessDefaults(&cfg.Processes[i]); err != nil {
+			return nil, err
 		}
 	}
 
 	return &cfg, nil
 }
+
+// SetProcessDefaults validates a process definition and fills in its unset
+// options, from the supervisor-wide ones where there are any. It is applied
+// to every process LoadProcessConfig loads and to every process added later,
+// e.g. by cloning.
+func (cfg *SupervisorConfig) SetProcessDefaults(p *ProcessConfig) error {
+	if !ValidProcessName(p.Name) {
+		return fmt.Errorf("invalid process name %q: use letters, digits, '.', '_', '@' and '-', starting with a letter or digit, other than summary and shutdown-plan", p.Name)
+	}
+	if p.LogPrefix == nil {
+		p.LogPrefix = cfg.LogPrefix
+	} else if _, err := ParseLogPrefix(p.LogPrefix); err != nil {
+		return fmt.Errorf("process %s: %w", p.Name, err)
+	}
+	if p.CorrelationPattern == "" {
+		p.CorrelationPattern = cfg.CorrelationPattern
+	} else if _, err := ParseCorrelationPattern(p.CorrelationPattern); err != nil {
+		return fmt.Errorf("process %s: %w", p.Name, err)
+	}
+	if p.LogFsyncPolicy == "" {
+		p.LogFsyncPolicy = cfg.LogFsyncPolicy
+	} else if !validLogFsyncPolicy(p.LogFsyncPolicy) {
+		return fmt.Errorf("process %s: invalid log_fsync_policy %q: must be none, interval or always",
+			p.Name, p.LogFsyncPolicy)
+	}
+	if _, err := ParseLogSampleRate(p.SampleRate); err != nil {
+		return fmt.Errorf("process %s: %w", p.Name, err)
+	}
+	if p.StopSignal == "" {
+		p.StopSignal = "SIGTERM"
+	}
+	if sig := p.ReloadSignal; sig != "" && !slices.Contains(reloadSignals, sig) {
+		return fmt.Errorf("process %s: invalid reload_signal %q: must be one of %s",
+			p.Name, sig, strings.Join(reloadSignals, ", "))
+	}
+	if mode := p.Singleton; mode != "" && mode != SingletonRefuse && mode != SingletonAdopt {
+		return fmt.Errorf("process %s: invalid singleton %q: must be refuse or adopt", p.Name, mode)
+	}
+	if p.StopTimeout == 0 {
+		p.StopTimeout = 10
+	}
+	if p.StartSecs == 0 {
+		p.StartSecs = 1
+	}
+	if p.LogBufferSize < 0 || p.LogRetentionDays < -1 {
+		return fmt.Errorf("process %s: log_buffer_size must not be negative and log_retention_days must be positive or -1", p.Name)
+	}
+	if p.LogBufferSize == 0 {
+		p.LogBufferSize = cfg.LogBufferSize
+	}
+	if p.LogRetentionDays == 0 {
+		p.LogRetentionDays = cfg.Retention
+	}
+	if p.MaxLineLength == 0 {
+		p.MaxLineLength = 8192
+	}
+	if p.SlowStopThreshold == 0 {
+		p.SlowStopThreshold = cfg.SlowStopThreshold
+	}
+	if p.RestartJitterMax < -1 {
+		return fmt.Errorf("process %s: restart_jitter_max must not be negative, or -1 to disable it", p.Name)
+	}
+	if p.RestartJitterMax == 0 {
+		p.RestartJitterMax = cfg.RestartJitterMax
+	}
+	if p.StartupStderrLines < -1 || p.StartupStderrWindow < 0 {
+		return fmt.Errorf("process %s: startup_stderr_lines must be positive or -1 and startup_stderr_window must not be negative", p.Name)
+	}
+	if p.StartupStderrLines == 0 {
+		p.StartupStderrLines = 20
+	}
+	if p.StartupStderrWindow == 0 {
+		p.StartupStderrWindow = 10
+	}
+	if p.PreStartCheckTimeout < 0 || p.PreStartCheckAttempts < 0 || p.PreStartCheckInterval < 0 {
+		return fmt.Errorf("process %s: pre_start_check_timeout, pre_start_check_attempts and pre_start_check_interval must not be negative", p.Name)
+	}
+	if p.NotifyCooldown < 0 {
+		return fmt.Errorf("process %s: notify_cooldown must not be negative", p.Name)
+	}
+	if p.MaxUnavailable < 0 {
+		return fmt.Errorf("process %s: max_unavailable must not be negative", p.Name)
+	}
+	if p.BootDelaySeconds < 0 {
+		return fmt.Errorf("process %s: boot_delay_seconds must not be negative", p.Name)
+	}
+	if p.MinUptime < 0 {
+		return fmt.Errorf("process %s: min_uptime must not be negative", p.Name)
+	}
+	if p.CanRestartTimeout == 0 {
+		p.CanRestartTimeout = 10
+	}
+	if p.StartConditionTimeout == 0 {
+		p.StartConditionTimeout = 10
+	}
+	if p.StartConditionInterval == 0 {
+		p.StartConditionInterval = 10
+	}
+	if p.Shell {
+		if p.ShellPath == "" {
+			p.ShellPath = cfg.DefaultShell
+		}
+		if err := checkShell(p.ShellPath); err != nil {
+			return fmt.Errorf("process %s: %w", p.Name, err)
+		}
+	}
+	if umask := p.Umask; umask != "" {
+		if v, err := strconv.ParseUint(umask, 8, 32); err != nil || v > 0o777 {
+			return fmt.Errorf("process %s: invalid umask %q: must be an octal value such as 022", p.Name, umask)
+		}
+	}
+	if hc := p.HealthCheck; hc != nil {
+		if err := hc.setDefaults(); err != nil {
+			return fmt.Errorf("process %s: %w", p.Name, err)
+		}
+	}
+	if sc := p.StopCheck; sc != nil {
+		if err := sc.setDefaults(); err != nil {
+			return fmt.Errorf("process %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkStopOrder reports an error if StopOrder names an unknown process or
+// the same process twice.
+func (cfg *SupervisorConfig) checkStopOrder() error {
+	known := make(map[string]bool, len(cfg.Processes))
+	for _, proc := range cfg.Processes {
+		known[proc.Name] = true
+	}
+
+	seen := make(map[string]bool, len(cfg.StopOrder))
+	for _, name := range cfg.StopOrder {
+		if !known[name] {
+			return fmt.Errorf("stop_order: unknown process %s", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("stop_order: process %s listed twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// WebhookName is how notify and notifications.default refer to a webhook:
+// its name, or its URL if it has none.
+func (wh WebhookConfig) WebhookName() string {
+	if wh.Name != "" {
+		return wh.Name
+	}
+	return wh.URL
+}
+
+// checkNotifyChannels reports an error if notifications.default or a
+// process's notify names a webhook that is not configured.
+func (cfg *SupervisorConfig) checkNotifyChannels() error {
+	webhooks := make(map[string]bool, len(cfg.Notifications.Webhooks))
+	for _, wh := range cfg.Notifications.Webhooks {
+		webhooks[wh.WebhookName()] = true
+	}
+
+	for _, name := range cfg.Notifications.Default {
+		if !webhooks[name] {
+			return fmt.Errorf("notifications: default: unknown webhook %s", name)
+		}
+	}
+	for _, proc := range cfg.Processes {
+		for _, name := range proc.Notify {
+			if !webhooks[name] {
+				return fmt.Errorf("process %s: notify: unknown webhook %s", proc.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyOverrides returns a copy of cfg with the given fields replaced. Keys are
+// the YAML option names (e.g. "args", "environment"); nested maps such as
+// environment are merged rather than replaced.
+func ApplyOverrides(cfg ProcessConfig, overrides map[string]any) (ProcessConfig, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	var base map[string]any
+	if err := yaml.Unmarshal(data, &base); err != nil {
+		return cfg, err
+	}
+
+	for key, value := range overrides {
+		nested, isMap := value.(map[string]any)
+		existing, hasMap := base[key].(map[string]any)
+		if isMap && hasMap {
+			for k, v := range nested {
+				existing[k] = v
+			}
+			continue
+		}
+		base[key] = value
+	}
+
+	data, err = yaml.Marshal(base)
+	if err != nil {
+		return cfg, err
+	}
+
+	var result ProcessConfig
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return cfg, err
+	}
+	return result, nil
+}
+
+func (rc *WebhookRetryConfig) setDefaults() error {
+	if rc.MaxAttempts < 0 || rc.Timeout < 0 || rc.BackoffBase < 0 || rc.BackoffMax < 0 {
+		return fmt.Errorf("retry: maxattempts, timeout, backoffbase and backoffmax must not be negative")
+	}
+	for _, status := range rc.RetryStatus {
+		if !retryStatusPattern.MatchString(status) {
+			return fmt.Errorf("retry: invalid retrystatus %q: must be a status code such as 429 or a class such as 5xx", status)
+		}
+	}
+
+	if rc.MaxAttempts == 0 {
+		rc.MaxAttempts = 3
+	}
+	if rc.Timeout == 0 {
+		rc.Timeout = 10
+	}
+	if rc.BackoffBase == 0 {
+		rc.BackoffBase = 1
+	}
+	if rc.BackoffMax == 0 {
+		rc.BackoffMax = 30
+	}
+	if len(rc.RetryStatus) == 0 {
+		rc.RetryStatus = []string{"429", "5xx"}
+	}
+	return nil
+}
+
+func (hc *HealthCheckConfig) setDefaults() error {
+	probes := 0
+	for _, probe := range []string{hc.Command, hc.HTTP, hc.TCP} {
+		if probe != "" {
+			probes++
+		}
+	}
+	if probes != 1 {
+		return fmt.Errorf("healthcheck needs exactly one of command, http or tcp")
+	}
+
+	if hc.Interval == 0 {
+		hc.Interval = 10
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = 5
+	}
+	if hc.Retries == 0 {
+		hc.Retries = 3
+	}
+	return nil
+}
+
+func (sc *StopCheckConfig) setDefaults() error {
+	if (sc.HTTP == "") == (sc.TCP == "") {
+		return fmt.Errorf("stopcheck needs exactly one of http or tcp")
+	}
+	if sc.Timeout < 0 {
+		return fmt.Errorf("stopcheck: timeout must not be negative")
+	}
+	if sc.Timeout == 0 {
+		sc.Timeout = 5
+	}
+	return nil
+}
+
+// RequiresRestart reports whether changing a process definition from old to
+// updated only takes effect after a restart, i.e. whether anything used to
+// spawn the process or capture its output changed. Other options such as
+// autorestart, priority or health checks are applied to the running process.
+func RequiresRestart(old, updated ProcessConfig) bool {
+	spawn := func(c ProcessConfig) ProcessConfig {
+		return ProcessConfig{
+			Command:            c.Command,
+			Args:               c.Args,
+			Shell:              c.Shell,
+			ShellPath:          c.ShellPath,
+			Directory:          c.Directory,
+			Environment:        c.Environment,
+			User:               c.User,
+			Umask:              c.Umask,
+			Stdout:             c.Stdout,
+			Stderr:             c.Stderr,
+			MaxLineLength:      c.MaxLineLength,
+			LogBufferSize:      c.LogBufferSize,
+			LogPrefix:          c.LogPrefix,
+			CorrelationPattern: c.CorrelationPattern,
+			SplitLogs:          c.SplitLogs,
+			LogFsyncPolicy:     c.LogFsyncPolicy,
+			SampleRate:         c.SampleRate,
+			LogSinceStart:      c.LogSinceStart,
+			AllowConsole:       c.AllowConsole,
+			PortBase:           c.PortBase,
+		}
+	}
+	return !reflect.DeepEqual(spawn(old), spawn(updated))
+}
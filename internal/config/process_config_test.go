@@ -0,0 +1,373 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadProcessConfig loads the given config file contents.
+func loadProcessConfig(t *testing.T, yaml string) (*SupervisorConfig, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pupervisor.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadProcessConfig(path)
+}
+
+func TestHealthCheckProbes(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthcheck string
+		wantErr     bool
+	}{
+		{"command", `{command: "true"}`, false},
+		{"http", `{http: "http://localhost/health"}`, false},
+		{"none", `{interval: 5}`, true},
+		{"two probes", `{command: "true", tcp: "localhost:80"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadProcessConfig(t, `
+processes:
+  - name: app
+    command: sleep
+    healthcheck: `+tt.healthcheck+`
+`)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadProcessConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxLineLengthDefault(t *testing.T) {
+	cfg, err := loadProcessConfig(t, `
+processes:
+  - name: default
+    command: sleep
+  - name: unlimited
+    command: sleep
+    maxlinelength: -1
+`)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig: %v", err)
+	}
+	if got := cfg.Processes[0].MaxLineLength; got != 8192 {
+		t.Errorf("default MaxLineLength = %d, want 8192", got)
+	}
+	if got := cfg.Processes[1].MaxLineLength; got != -1 {
+		t.Errorf("MaxLineLength = %d, want -1", got)
+	}
+}
+
+func TestRequiresRestart(t *testing.T) {
+	base := ProcessConfig{
+		Name:        "web",
+		Command:     "server",
+		Args:        []string{"--port", "8080"},
+		Environment: map[string]string{"MODE": "prod"},
+		AutoRestart: true,
+		Priority:    10,
+	}
+	tests := []struct {
+		name   string
+		change func(*ProcessConfig)
+		want   bool
+	}{
+		{"nothing", func(*ProcessConfig) {}, false},
+		{"command", func(c *ProcessConfig) { c.Command = "server2" }, true},
+		{"args", func(c *ProcessConfig) { c.Args = []string{"--port", "9090"} }, true},
+		{"environment", func(c *ProcessConfig) { c.Environment = map[string]string{"MODE": "dev"} }, true},
+		{"directory", func(c *ProcessConfig) { c.Directory = "/srv" }, true},
+		{"user", func(c *ProcessConfig) { c.User = "nobody" }, true},
+		{"max line length", func(c *ProcessConfig) { c.MaxLineLength = 100 }, true},
+		{"autorestart", func(c *ProcessConfig) { c.AutoRestart = false }, false},
+		{"priority", func(c *ProcessConfig) { c.Priority = 1 }, false},
+		{"health check", func(c *ProcessConfig) { c.HealthCheck = &HealthCheckConfig{TCP: "localhost:80"} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := base
+			updated.Args = append([]string(nil), base.Args...)
+			tt.change(&updated)
+			if got := RequiresRestart(base, updated); got != tt.want {
+				t.Errorf("RequiresRestart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	base := ProcessConfig{
+		Name:        "web",
+		Command:     "server",
+		Args:        []string{"--port", "8080"},
+		Environment: map[string]string{"MODE": "prod", "LEVEL": "info"},
+		AutoRestart: true,
+	}
+
+	got, err := ApplyOverrides(base, map[string]any{
+		"args":        []any{"--port", "9090"},
+		"environment": map[string]any{"LEVEL": "debug", "TRACE": "1"},
+		"autorestart": false,
+	})
+	if err != nil {
+		t.Fatalf("ApplyOverrides: %v", err)
+	}
+
+	want := ProcessConfig{
+		Name:        "web",
+		Command:     "server",
+		Args:        []string{"--port", "9090"},
+		Environment: map[string]string{"MODE": "prod", "LEVEL": "debug", "TRACE": "1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyOverrides() = %+v, want %+v", got, want)
+	}
+	if base.Environment["LEVEL"] != "info" || base.Args[1] != "8080" {
+		t.Errorf("ApplyOverrides modified its input: %+v", base)
+	}
+
+	if _, err := ApplyOverrides(base, map[string]any{"args": "not a list"}); err == nil {
+		t.Error("ApplyOverrides() with a string for args succeeded")
+	}
+}
+
+func TestProcessConfigSettingSources(t *testing.T) {
+	cfg, err := loadProcessConfig(t, `
+notifications:
+  failurethreshold: 2
+processes: []
+`)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig: %v", err)
+	}
+
+	want := map[string]Setting{
+		"notifications.failurethreshold": {Key: "notifications.failurethreshold", Value: 2, Source: SourceFile},
+		"notifications.loglines":         {Key: "notifications.loglines", Value: 20, Source: SourceDefault},
+	}
+	for _, s := range cfg.Settings {
+		if w, ok := want[s.Key]; ok {
+			if s != w {
+				t.Errorf("setting %s = %+v, want %+v", s.Key, s, w)
+			}
+			delete(want, s.Key)
+		}
+	}
+	for key := range want {
+		t.Errorf("setting %s not reported", key)
+	}
+}
+
+func TestValidProcessName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"web", true},
+		{"web-0", true},
+		{"api.v2", true},
+		{"worker_1", true},
+		{"job@host", true},
+		{"9lives", true},
+		{"", false},
+		{"-web", false},
+		{".hidden", false},
+		{"my app", false},
+		{"a/b", false},
+		{"web?x=1", false},
+		{"café", false},
+		{"summary", false},
+		{"shutdown-plan", false},
+		{"summary-0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidProcessName(tt.name); got != tt.want {
+				t.Errorf("ValidProcessName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNotifyChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"known webhooks", `
+notifications:
+  webhooks:
+    - name: ops
+      url: http://ops.example/hook
+    - url: http://dev.example/hook
+  default: [ops]
+processes:
+  - name: web
+    command: ./server
+    notify: [ops, http://dev.example/hook]
+`, ""},
+		{"unknown default", `
+notifications:
+  webhooks:
+    - name: ops
+      url: http://ops.example/hook
+  default: [pager]
+processes: []
+`, "notifications: default: unknown webhook pager"},
+		{"unknown process notify", `
+notifications:
+  webhooks:
+    - name: ops
+      url: http://ops.example/hook
+processes:
+  - name: web
+    command: ./server
+    notify: [ops, pager]
+`, "process web: notify: unknown webhook pager"},
+		{"notify without webhooks", `
+processes:
+  - name: web
+    command: ./server
+    notify: [ops]
+`, "process web: notify: unknown webhook ops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadProcessConfig(t, tt.yaml)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadProcessConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadProcessConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogMemoryLimit(t *testing.T) {
+	if _, err := loadProcessConfig(t, "log_memory_limit: -1\nprocesses: []\n"); err == nil {
+		t.Error("LoadProcessConfig() with a negative log_memory_limit succeeded")
+	}
+}
+
+func TestReloadSignal(t *testing.T) {
+	tests := []struct {
+		signal  string
+		wantErr bool
+	}{
+		{"SIGHUP", false},
+		{"SIGUSR2", false},
+		{"SIGKILL", true},
+		{"HUP", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signal, func(t *testing.T) {
+			_, err := loadProcessConfig(t, `
+processes:
+  - name: web
+    command: ./server
+    reload_on_change: [app.conf]
+    reload_signal: `+tt.signal+"\n")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadProcessConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSingletonMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{"refuse", false},
+		{"adopt", false},
+		{"share", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			_, err := loadProcessConfig(t, `
+processes:
+  - name: job
+    command: ./job
+    singleton: `+tt.mode+"\n")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadProcessConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStopCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		stopcheck   string
+		wantTimeout int
+		wantErr     bool
+	}{
+		{"tcp", `{tcp: "127.0.0.1:8080"}`, 5, false},
+		{"http with timeout", `{http: "http://127.0.0.1:8080/", timeout: 2}`, 2, false},
+		{"neither", `{timeout: 2}`, 0, true},
+		{"both", `{tcp: "127.0.0.1:8080", http: "http://127.0.0.1:8080/"}`, 0, true},
+		{"negative timeout", `{tcp: "127.0.0.1:8080", timeout: -1}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadProcessConfig(t, `
+processes:
+  - name: web
+    command: ./server
+    stopcheck: `+tt.stopcheck+"\n")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadProcessConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Processes[0].StopCheck.Timeout != tt.wantTimeout {
+				t.Errorf("Timeout = %d, want %d", cfg.Processes[0].StopCheck.Timeout, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestNotifyCooldown(t *testing.T) {
+	if _, err := loadProcessConfig(t, `
+processes:
+  - name: web
+    command: ./server
+    notify_cooldown: -1
+`); err == nil {
+		t.Error("LoadProcessConfig() with a negative notify_cooldown succeeded")
+	}
+}
+
+func TestPreStartCheckOptions(t *testing.T) {
+	for _, option := range []string{"pre_start_check_timeout", "pre_start_check_attempts", "pre_start_check_interval"} {
+		t.Run(option, func(t *testing.T) {
+			_, err := loadProcessConfig(t, `
+processes:
+  - name: web
+    command: ./server
+    pre_start_check: pg_isready
+    `+option+`: -1
+`)
+			if err == nil {
+				t.Errorf("LoadProcessConfig() with a negative %s succeeded", option)
+			}
+		})
+	}
+}
+
+func TestHealthCheckConcurrency(t *testing.T) {
+	if _, err := loadProcessConfig(t, "health_check_concurrency: -1\nprocesses: []\n"); err == nil {
+		t.Error("LoadProcessConfig() with a negative health_check_concurrency succeeded")
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expandReplicas replaces every process with replicas set by that many
+// instances named <name>-0, <name>-1, ..., each with its Instance index.
+// It reports an error when the ports of replicas overlap.
+func expandReplicas(procs []ProcessConfig) ([]ProcessConfig, error) {
+	var expanded []ProcessConfig
+	for _, proc := range procs {
+		if proc.Replicas < 0 {
+			return nil, fmt.Errorf("process %s: replicas must not be negative", proc.Name)
+		}
+		if proc.PortBase < 0 || proc.PortBase+max(proc.Replicas, 1)-1 > 65535 {
+			return nil, fmt.Errorf("process %s: port_base %d does not leave a valid port for every replica", proc.Name, proc.PortBase)
+		}
+		if proc.Replicas == 0 {
+			expanded = append(expanded, proc)
+			continue
+		}
+
+		for i := range proc.Replicas {
+			instance := proc
+			instance.Name = fmt.Sprintf("%s-%d", proc.Name, i)
+			instance.Replicas = 0
+			instance.Instance = &i
+			expanded = append(expanded, instance)
+		}
+	}
+
+	ports := make(map[int]string)
+	for _, proc := range expanded {
+		port := proc.Port()
+		if port == 0 {
+			continue
+		}
+		if other, ok := ports[port]; ok {
+			return nil, fmt.Errorf("processes %s and %s are both assigned port %d", other, proc.Name, port)
+		}
+		ports[port] = proc.Name
+	}
+	return expanded, nil
+}
+
+// Port is the port assigned to a replica: PortBase plus its instance
+// index. It is 0 for processes that are not replicas or have no PortBase.
+func (c ProcessConfig) Port() int {
+	if c.PortBase == 0 || c.Instance == nil {
+		return 0
+	}
+	return c.PortBase + *c.Instance
+}
+
+// WithInstanceVars returns a copy of a replica's config with ${INSTANCE} and
+// ${PORT} in its command, args, directory and environment replaced by its
+// instance index and port. Other processes are returned unchanged, leaving
+// such references to the shell.
+func (c ProcessConfig) WithInstanceVars() ProcessConfig {
+	if c.Instance == nil {
+		return c
+	}
+
+	pairs := []string{"${INSTANCE}", strconv.Itoa(*c.Instance)}
+	if port := c.Port(); port != 0 {
+		pairs = append(pairs, "${PORT}", strconv.Itoa(port))
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	resolved := c
+	resolved.Command = replacer.Replace(c.Command)
+	resolved.Directory = replacer.Replace(c.Directory)
+
+	if len(c.Args) > 0 {
+		resolved.Args = make([]string, len(c.Args))
+		for i, arg := range c.Args {
+			resolved.Args[i] = replacer.Replace(arg)
+		}
+	}
+
+	if len(c.Environment) > 0 {
+		resolved.Environment = make(map[string]string, len(c.Environment))
+		for k, v := range c.Environment {
+			resolved.Environment[k] = replacer.Replace(v)
+		}
+	}
+	return resolved
+}
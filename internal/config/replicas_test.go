@@ -0,0 +1,89 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandReplicas(t *testing.T) {
+	cfg, err := loadProcessConfig(t, `
+processes:
+  - name: web
+    command: ./server
+    args: ["--port", "${PORT}", "--id", "${INSTANCE}"]
+    replicas: 3
+    port_base: 8000
+    environment:
+      PORT: "${PORT}"
+      DATA: /var/lib/web/${INSTANCE}
+  - name: worker
+    command: ./worker
+    args: ["${INSTANCE}"]
+`)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig() error = %v", err)
+	}
+
+	var names []string
+	for _, proc := range cfg.Processes {
+		names = append(names, proc.Name)
+	}
+	if want := []string{"web-0", "web-1", "web-2", "worker"}; !slices.Equal(names, want) {
+		t.Fatalf("process names = %v, want %v", names, want)
+	}
+
+	web := cfg.Processes[2].WithInstanceVars()
+	if want := []string{"--port", "8002", "--id", "2"}; !slices.Equal(web.Args, want) {
+		t.Errorf("Args = %q, want %q", web.Args, want)
+	}
+	if web.Environment["PORT"] != "8002" || web.Environment["DATA"] != "/var/lib/web/2" {
+		t.Errorf("Environment = %v, want PORT 8002 and DATA /var/lib/web/2", web.Environment)
+	}
+	if web.Port() != 8002 {
+		t.Errorf("Port() = %d, want 8002", web.Port())
+	}
+
+	// The template is left as is for the next expansion
+	if cfg.Processes[2].Args[1] != "${PORT}" {
+		t.Errorf("WithInstanceVars() modified the config's Args: %q", cfg.Processes[2].Args)
+	}
+
+	// References outside replicas are left to the shell
+	worker := cfg.Processes[3].WithInstanceVars()
+	if !slices.Equal(worker.Args, []string{"${INSTANCE}"}) || worker.Port() != 0 {
+		t.Errorf("worker = Args %q, Port %d, want unchanged", worker.Args, worker.Port())
+	}
+}
+
+func TestExpandReplicasErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		processes string
+	}{
+		{"negative replicas", `
+  - name: web
+    command: ./server
+    replicas: -1`},
+		{"ports beyond 65535", `
+  - name: web
+    command: ./server
+    replicas: 2
+    port_base: 65535`},
+		{"overlapping ports", `
+  - name: web
+    command: ./server
+    replicas: 3
+    port_base: 8000
+  - name: api
+    command: ./server
+    replicas: 2
+    port_base: 8002`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadProcessConfig(t, "processes:"+tt.processes+"\n"); err == nil {
+				t.Error("LoadProcessConfig() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import "os"
+
+// Setting sources, from lowest to highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceDB      = "db"
+)
+
+// Setting is a resolved setting value together with the layer it came from.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// envSource reports whether key is set in the environment.
+func envSource(key string) string {
+	if os.Getenv(key) != "" {
+		return SourceEnv
+	}
+	return SourceDefault
+}
+
+// fileSource reports whether a value was given in the config file, i.e. was
+// non-zero before defaults were applied.
+func fileSource[T comparable](value T) string {
+	var zero T
+	if value != zero {
+		return SourceFile
+	}
+	return SourceDefault
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os/exec"
+)
+
+// defaultShell runs the command lines of shell processes unless
+// default_shell names another
+const defaultShell = "/bin/sh"
+
+// Executable returns the program a process is spawned with and its
+// arguments: Command and Args, or for a shell process ShellPath running
+// Command with the process name as $0 and Args as $1, $2 and so on.
+func (c ProcessConfig) Executable() (string, []string) {
+	if !c.Shell {
+		return c.Command, c.Args
+	}
+	shell := c.ShellPath
+	if shell == "" {
+		shell = defaultShell
+	}
+	return shell, append([]string{"-c", c.Command, c.Name}, c.Args...)
+}
+
+// mergeEnvironment returns base overlaid with env, or env unchanged if base
+// is empty.
+func mergeEnvironment(base, env map[string]string) map[string]string {
+	if len(base) == 0 {
+		return env
+	}
+	merged := maps.Clone(base)
+	maps.Copy(merged, env)
+	return merged
+}
+
+// checkShell reports an error unless shell names an executable, either a
+// path or a program on the PATH.
+func checkShell(shell string) error {
+	if _, err := exec.LookPath(shell); err != nil {
+		return fmt.Errorf("shell %q not found: %w", shell, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExecutable(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ProcessConfig
+		wantPath string
+		wantArgs []string
+	}{
+		{"plain", ProcessConfig{Name: "web", Command: "./server", Args: []string{"-v"}}, "./server", []string{"-v"}},
+		{"shell", ProcessConfig{Name: "web", Command: "./server $1 | tee log", Args: []string{"-v"}, Shell: true}, "/bin/sh", []string{"-c", "./server $1 | tee log", "web", "-v"}},
+		{"shell path", ProcessConfig{Name: "web", Command: "./server", Shell: true, ShellPath: "bash"}, "bash", []string{"-c", "./server", "web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, args := tt.cfg.Executable()
+			if path != tt.wantPath || !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("Executable() = %q, %q, want %q, %q", path, args, tt.wantPath, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBaseEnvironment(t *testing.T) {
+	cfg, err := loadProcessConfig(t, `
+environment:
+  MODE: production
+  DATA: /var/lib/shared
+  PORT: "0"
+  NODE: node-${INSTANCE}
+processes:
+  - name: web
+    command: ./server
+    replicas: 2
+    port_base: 8000
+    environment:
+      DATA: /var/lib/web/${INSTANCE}
+      PORT: "${PORT}"
+  - name: worker
+    command: ./worker
+`)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig() error = %v", err)
+	}
+
+	// Process and replica variables take precedence over the base environment
+	web := cfg.Processes[1].WithInstanceVars()
+	want := map[string]string{"MODE": "production", "DATA": "/var/lib/web/1", "PORT": "8001", "NODE": "node-1"}
+	if !maps.Equal(web.Environment, want) {
+		t.Errorf("web-1 Environment = %v, want %v", web.Environment, want)
+	}
+	if !maps.Equal(cfg.Processes[2].Environment, cfg.Environment) {
+		t.Errorf("worker Environment = %v, want the base environment %v", cfg.Processes[2].Environment, cfg.Environment)
+	}
+}
+
+func TestDefaultShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr string
+	}{
+		{"default", `
+processes:
+  - name: web
+    command: echo hi
+    shell: true`, "/bin/sh", ""},
+		{"global", `
+default_shell: sh
+processes:
+  - name: web
+    command: echo hi
+    shell: true`, "sh", ""},
+		{"own", `
+default_shell: sh
+processes:
+  - name: web
+    command: echo hi
+    shell: true
+    shell_path: /bin/sh`, "/bin/sh", ""},
+		{"missing global", `
+default_shell: /nonexistent/sh
+processes: []`, "", "invalid default_shell"},
+		{"missing own", `
+processes:
+  - name: web
+    command: echo hi
+    shell: true
+    shell_path: /nonexistent/sh`, "", "process web: shell"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadProcessConfig(t, tt.yaml)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadProcessConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadProcessConfig() error = %v", err)
+			}
+			if got := cfg.Processes[0].ShellPath; got != tt.want {
+				t.Errorf("ShellPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// supportedUnitDirectives lists the [Service] directives LoadSystemdUnit
+// understands. Anything else is rejected rather than silently ignored.
+var supportedUnitDirectives = []string{"ExecStart", "Environment", "WorkingDirectory", "Restart", "User"}
+
+// LoadSystemdUnit converts a minimal systemd .service unit into a process
+// config. The process is named after the unit file and starts automatically.
+// Only Description is accepted in [Unit]; [Install] is ignored.
+func LoadSystemdUnit(path string) (ProcessConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ProcessConfig{}, err
+	}
+	defer f.Close()
+
+	cfg := ProcessConfig{
+		Name:      strings.TrimSuffix(filepath.Base(path), ".service"),
+		AutoStart: true,
+	}
+
+	section := ""
+	lineNo := 0
+	var pending string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Backslash continues the directive on the next line
+		if strings.HasSuffix(line, "\\") {
+			pending += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = strings.TrimSpace(pending + line)
+		pending = ""
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if section != "Unit" && section != "Service" && section != "Install" {
+				return cfg, fmt.Errorf("%s:%d: unsupported section [%s]", path, lineNo, section)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return cfg, fmt.Errorf("%s:%d: expected Key=Value, got %q", path, lineNo, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch section {
+		case "Install":
+			continue
+		case "Unit":
+			if key != "Description" {
+				return cfg, fmt.Errorf("%s:%d: unsupported directive %s in [Unit] (only Description is supported)", path, lineNo, key)
+			}
+			continue
+		case "Service":
+		default:
+			return cfg, fmt.Errorf("%s:%d: directive %s outside of a section", path, lineNo, key)
+		}
+
+		if err := applyUnitDirective(&cfg, key, value); err != nil {
+			return cfg, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Command == "" {
+		return cfg, fmt.Errorf("%s: missing ExecStart in [Service]", path)
+	}
+
+	return cfg, nil
+}
+
+func applyUnitDirective(cfg *ProcessConfig, key, value string) error {
+	switch key {
+	case "ExecStart":
+		// Strip systemd's special executable prefixes we can honor as-is
+		value = strings.TrimLeft(value, "-@")
+		if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "!") {
+			return fmt.Errorf("unsupported ExecStart prefix %q", value[:1])
+		}
+		words, err := splitUnitWords(value)
+		if err != nil {
+			return fmt.Errorf("ExecStart: %w", err)
+		}
+		if len(words) == 0 {
+			return fmt.Errorf("ExecStart is empty")
+		}
+		cfg.Command = words[0]
+		cfg.Args = words[1:]
+
+	case "Environment":
+		words, err := splitUnitWords(value)
+		if err != nil {
+			return fmt.Errorf("Environment: %w", err)
+		}
+		for _, word := range words {
+			k, v, ok := strings.Cut(word, "=")
+			if !ok {
+				return fmt.Errorf("Environment: expected NAME=value, got %q", word)
+			}
+			if cfg.Environment == nil {
+				cfg.Environment = make(map[string]string)
+			}
+			cfg.Environment[k] = v
+		}
+
+	case "WorkingDirectory":
+		cfg.Directory = strings.TrimPrefix(value, "-")
+
+	case "Restart":
+		switch value {
+		case "no":
+			cfg.AutoRestart = false
+		case "always", "on-success", "on-failure", "on-abnormal", "on-abort", "on-watchdog":
+			cfg.AutoRestart = true
+		default:
+			return fmt.Errorf("unsupported Restart value %q", value)
+		}
+
+	case "User":
+		cfg.User = value
+
+	default:
+		return fmt.Errorf("unsupported directive %s in [Service] (supported: %s)", key, strings.Join(supportedUnitDirectives, ", "))
+	}
+
+	return nil
+}
+
+// splitUnitWords splits a unit value into words, honoring single and double
+// quotes and backslash escapes.
+func splitUnitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// maxBatchSize caps the number of sub-requests in one batch.
+const maxBatchSize = 20
+
+// BatchHandler runs several read requests against the router in one round
+// trip.
+type BatchHandler struct {
+	router   http.Handler
+	jsonCase string
+}
+
+// NewBatchHandler creates a handler dispatching sub-requests to router.
+func NewBatchHandler(router http.Handler, jsonCase string) *BatchHandler {
+	return &BatchHandler{router: router, jsonCase: jsonCase}
+}
+
+// BatchRequest is one sub-request of a batch.
+type BatchRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// BatchResponse is the result of one sub-request. Body holds the JSON the
+// endpoint returned, or a string for other content types.
+type BatchResponse struct {
+	Status int `json:"status"`
+	Body   any `json:"body"`
+}
+
+// Batch executes a JSON array of GET sub-requests in order and returns
+// their responses in the same order. Mutating methods are rejected so a
+// batch can never change state.
+func (h *BatchHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	var reqs []BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+
+	if len(reqs) == 0 {
+		h.writeError(w, http.StatusBadRequest, errors.New("empty batch"), "Batch must contain at least one request")
+		return
+	}
+	if len(reqs) > maxBatchSize {
+		h.writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("batch of %d requests", len(reqs)),
+			fmt.Sprintf("Batch must contain at most %d requests", maxBatchSize))
+		return
+	}
+
+	for i, req := range reqs {
+		if req.Method == "" {
+			reqs[i].Method = http.MethodGet
+		} else if !strings.EqualFold(req.Method, http.MethodGet) {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("request %d: method %s not allowed", i, req.Method),
+				"Only GET requests may be batched")
+			return
+		}
+		if !strings.HasPrefix(req.Path, "/") {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("request %d: invalid path %q", i, req.Path),
+				"Paths must start with /")
+			return
+		}
+	}
+
+	responses := make([]BatchResponse, len(reqs))
+	for i, req := range reqs {
+		responses[i] = h.do(r, req)
+	}
+
+	h.writeJSON(w, http.StatusOK, responses)
+}
+
+// do serves a single sub-request, keeping the headers of the outer request
+// so that authentication and tracing apply to it as well.
+func (h *BatchHandler) do(outer *http.Request, req BatchRequest) BatchResponse {
+	sub := httptest.NewRequestWithContext(outer.Context(), http.MethodGet, req.Path, nil)
+	sub.Header = outer.Header.Clone()
+	sub.Header.Del("Content-Length")
+	sub.Header.Del("Content-Type")
+	sub.RemoteAddr = outer.RemoteAddr
+
+	rec := httptest.NewRecorder()
+	h.router.ServeHTTP(rec, sub)
+
+	resp := BatchResponse{Status: rec.Code}
+	switch {
+	case rec.Body.Len() == 0:
+	case strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json"):
+		resp.Body = json.RawMessage(rec.Body.Bytes())
+	default:
+		resp.Body = rec.Body.String()
+	}
+	return resp
+}
+
+func (h *BatchHandler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(withJSONCase(data, h.jsonCase)); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+func (h *BatchHandler) writeError(w http.ResponseWriter, status int, err error, message string) {
+	h.writeJSON(w, status, ErrorResponse{
+		Error:   err.Error(),
+		Message: message,
+	})
+}
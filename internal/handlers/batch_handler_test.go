@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// newBatchRouter returns a router serving POST /api/batch next to a few
+// test routes, behind bearer token authentication like the real one.
+func newBatchRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/whoami", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"actor":%q}`, middleware.Actor(r))
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/api/text", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "plain")
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/api/processes/{name}/console", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "console")
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/api/batch", NewBatchHandler(r, config.JSONCaseSnake).Batch).Methods(http.MethodPost)
+
+	r.Use(middleware.Auth(config.AuthConfig{Tokens: map[string]string{
+		"admin-token":  config.RoleAdmin,
+		"viewer-token": config.RoleViewer,
+	}}))
+	return r
+}
+
+func postBatch(t *testing.T, router http.Handler, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBatchLimits(t *testing.T) {
+	router := newBatchRouter()
+	batchOf := func(n int) string {
+		reqs := make([]string, n)
+		for i := range reqs {
+			reqs[i] = `{"path":"/api/text"}`
+		}
+		return "[" + strings.Join(reqs, ",") + "]"
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid JSON", `{"path":`, http.StatusBadRequest},
+		{"empty", `[]`, http.StatusBadRequest},
+		{"at the limit", batchOf(maxBatchSize), http.StatusOK},
+		{"over the limit", batchOf(maxBatchSize + 1), http.StatusRequestEntityTooLarge},
+		{"explicit GET", `[{"method":"get","path":"/api/text"}]`, http.StatusOK},
+		{"mutating method", `[{"path":"/api/text"},{"method":"POST","path":"/api/text"}]`, http.StatusBadRequest},
+		{"relative path", `[{"path":"api/text"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postBatch(t, router, "admin-token", tt.body); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestBatchResponses(t *testing.T) {
+	rec := postBatch(t, newBatchRouter(), "admin-token", `[{"path":"/api/whoami"},{"path":"/api/text"},{"path":"/api/missing"}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var responses []struct {
+		Status int             `json:"status"`
+		Body   json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `{"actor":"token:admin"}`},
+		{http.StatusOK, `"plain"`},
+		{http.StatusNotFound, `"404 page not found\n"`},
+	}
+	if len(responses) != len(want) {
+		t.Fatalf("got %d responses, want %d", len(responses), len(want))
+	}
+	for i, w := range want {
+		if responses[i].Status != w.status || string(responses[i].Body) != w.body {
+			t.Errorf("response %d = %d %s, want %d %s", i, responses[i].Status, responses[i].Body, w.status, w.body)
+		}
+	}
+}
+
+// TestBatchSubRequestAuth checks that every sub-request goes through
+// authentication with the caller's credentials, so a batch cannot reach
+// what its caller could not reach directly.
+func TestBatchSubRequestAuth(t *testing.T) {
+	router := newBatchRouter()
+	body := `[{"path":"/api/whoami"},{"path":"/api/processes/web/console"}]`
+
+	tests := []struct {
+		name     string
+		token    string
+		code     int
+		statuses []int
+		actor    string
+	}{
+		{"admin", "admin-token", http.StatusOK, []int{http.StatusOK, http.StatusOK}, "token:admin"},
+		{"viewer", "viewer-token", http.StatusOK, []int{http.StatusOK, http.StatusForbidden}, "token:viewer"},
+		{"no token", "", http.StatusUnauthorized, nil, ""},
+		{"invalid token", "guess", http.StatusUnauthorized, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postBatch(t, router, tt.token, body)
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var responses []struct {
+				Status int             `json:"status"`
+				Body   json.RawMessage `json:"body"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.statuses {
+				if responses[i].Status != want {
+					t.Errorf("sub-request %d status = %d, want %d", i, responses[i].Status, want)
+				}
+			}
+			var who struct {
+				Actor string `json:"actor"`
+			}
+			if err := json.Unmarshal(responses[0].Body, &who); err != nil {
+				t.Fatal(err)
+			}
+			if who.Actor != tt.actor {
+				t.Errorf("sub-request actor = %q, want %q", who.Actor, tt.actor)
+			}
+		})
+	}
+}
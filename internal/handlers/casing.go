@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"pupervisor/internal/config"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// withJSONCase returns data with the json tag names of its structs converted
+// to the given casing, ready for encoding/json. Only field names are renamed;
+// map keys such as labels or environment variables are data and kept as is.
+func withJSONCase(data any, jsonCase string) any {
+	if jsonCase != config.JSONCaseCamel {
+		return data
+	}
+	return camelValue(reflect.ValueOf(data))
+}
+
+func camelValue(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	// Types with their own encoding (time.Time, json.RawMessage) are kept
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return camelValue(v.Elem())
+	case reflect.Struct:
+		out := make(map[string]any)
+		camelFields(v, out)
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := json.Marshal(iter.Key().Interface())
+			if err != nil {
+				continue
+			}
+			out[strings.Trim(string(key), `"`)] = camelValue(iter.Value())
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface() // []byte encodes as base64
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = camelValue(v.Index(i))
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// camelFields adds the exported fields of struct v to out, following the
+// encoding/json rules for tags, omitempty and embedded structs.
+func camelFields(v reflect.Value, out map[string]any) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				camelFields(fv, out)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && isEmptyValue(fv) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		out[snakeToCamel(name)] = camelValue(fv)
+	}
+}
+
+// isEmptyValue mirrors the omitempty check of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero() && v.Kind() != reflect.Struct
+}
+
+// snakeToCamel converts process_name to processName.
+func snakeToCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
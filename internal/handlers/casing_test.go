@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+type casingBase struct {
+	ProcessName string `json:"process_name"`
+}
+
+type casingSample struct {
+	casingBase
+	ExitCode   int               `json:"exit_code"`
+	LastError  string            `json:"last_error,omitempty"`
+	Labels     map[string]string `json:"labels"`
+	Children   []casingBase      `json:"child_processes"`
+	CrashedAt  time.Time         `json:"crashed_at"`
+	Raw        json.RawMessage   `json:"raw_value"`
+	Hidden     string            `json:"-"`
+	Untagged   bool
+	unexported int
+}
+
+func TestWithJSONCase(t *testing.T) {
+	data := casingSample{
+		casingBase: casingBase{ProcessName: "web"},
+		ExitCode:   1,
+		Labels:     map[string]string{"team_name": "core"},
+		Children:   []casingBase{{ProcessName: "worker"}},
+		CrashedAt:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Raw:        json.RawMessage(`{"keep_me":1}`),
+		Hidden:     "secret",
+	}
+
+	tests := []struct {
+		jsonCase string
+		want     string
+	}{
+		{config.JSONCaseSnake, `{"process_name":"web","exit_code":1,"labels":{"team_name":"core"},"child_processes":[{"process_name":"worker"}],"crashed_at":"2025-01-02T03:04:05Z","raw_value":{"keep_me":1},"Untagged":false}`},
+		{config.JSONCaseCamel, `{"Untagged":false,"childProcesses":[{"processName":"worker"}],"crashedAt":"2025-01-02T03:04:05Z","exitCode":1,"labels":{"team_name":"core"},"processName":"web","rawValue":{"keep_me":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jsonCase, func(t *testing.T) {
+			got, err := json.Marshal(withJSONCase(data, tt.jsonCase))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("withJSONCase(%s) =\n%s\nwant\n%s", tt.jsonCase, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	tests := map[string]string{
+		"process_name":      "processName",
+		"last_healthy_at":   "lastHealthyAt",
+		"pid":               "pid",
+		"trailing_":         "trailing",
+		"double__under":     "doubleUnder",
+		"already_camelCase": "alreadyCamelCase",
+	}
+	for in, want := range tests {
+		if got := snakeToCamel(in); got != want {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCamelCaseResponses(t *testing.T) {
+	_, pm, _ := newTestHandler(t, `
+processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+    display_name: Web server
+    labels: {team_name: core}
+`)
+	h := NewProcessHandler(pm, config.JSONCaseCamel)
+
+	if err := pm.StartProcess("web"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+	t.Cleanup(func() { pm.StopProcess("web") })
+	if err := pm.Heartbeat("web"); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.GetProcesses(rec, httptest.NewRequest(http.MethodGet, "/api/processes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var processes []struct {
+		DisplayName   string            `json:"displayName"`
+		LastHeartbeat string            `json:"lastHeartbeat"`
+		Labels        map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &processes); err != nil {
+		t.Fatal(err)
+	}
+	if len(processes) != 1 || processes[0].DisplayName != "Web server" || processes[0].LastHeartbeat == "" || processes[0].Labels["team_name"] != "core" {
+		t.Errorf("GET /api/processes = %s, want displayName, lastHeartbeat and the label key as is", rec.Body)
+	}
+}
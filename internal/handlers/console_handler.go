@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pupervisor/internal/service"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/websocket"
+)
+
+// maxConsoleMessage is the largest message a console may send to a process.
+const maxConsoleMessage = 64 << 10
+
+// Console upgrades to a WebSocket attached to a process with allow_console.
+// Each output line is sent as a JSON text message {"stream": "stdout", "line":
+// "..."}; each message received is written as is to the process's stdin.
+// Problems writing to stdin are reported on the "system" stream. The socket
+// stays open across restarts of the process.
+func (h *ProcessHandler) Console(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := checkSameOrigin(r); err != nil {
+		h.writeError(w, http.StatusForbidden, err, "Consoles can only be opened from this server's own pages")
+		return
+	}
+
+	lines, detach, err := h.pm.AttachConsole(name)
+	switch {
+	case errors.Is(err, service.ErrProcessNotFound):
+		h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+		return
+	case errors.Is(err, service.ErrConsoleNotAllowed):
+		h.writeError(w, http.StatusForbidden, err, "Set allow_console on "+name+" to attach a console")
+		return
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to attach console")
+		return
+	}
+	defer detach()
+
+	// The socket outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	server := websocket.Server{
+		// checkSameOrigin has run; unlike the default, accept no Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = maxConsoleMessage
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				for {
+					var msg []byte
+					if err := websocket.Message.Receive(ws, &msg); err != nil {
+						return
+					}
+					if err := h.pm.WriteStdin(name, msg); err != nil {
+						line := service.ConsoleLine{Stream: "system", Line: fmt.Sprintf("input not written: %v", err)}
+						if websocket.JSON.Send(ws, line) != nil {
+							return
+						}
+					}
+				}
+			}()
+
+			for {
+				select {
+				case line := <-lines:
+					if err := websocket.JSON.Send(ws, line); err != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkSameOrigin rejects WebSocket connections opened by pages of other
+// sites. Clients that send no Origin, i.e. that are not browsers, are
+// accepted.
+func checkSameOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+		return fmt.Errorf("cross-origin console connection from %q", origin)
+	}
+	return nil
+}
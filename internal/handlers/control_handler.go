@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pupervisor/internal/middleware"
+	"pupervisor/internal/service"
+
+	"golang.org/x/net/websocket"
+)
+
+// maxControlMessage is the largest command a control channel accepts.
+const maxControlMessage = 4 << 10
+
+// ControlCommand is a message sent on a control channel. ID is echoed in
+// the response so clients can match it to the command.
+type ControlCommand struct {
+	ID      string `json:"id"`
+	Action  string `json:"action"`
+	Process string `json:"process"`
+}
+
+// ControlResponse answers a ControlCommand. Status is what the REST
+// endpoint of the action reports, e.g. "restarted", or "error". Code is the
+// HTTP status that endpoint responds with when the action fails.
+type ControlResponse struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Code   int    `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Control upgrades to a WebSocket pushing every status change and log
+// entry as a service.Event and running start, stop and restart commands
+// sent as ControlCommand messages, each answered by a ControlResponse of
+// type "response". Commands run concurrently, so a slow restart does not
+// hold up events or other commands. Viewers and read-only servers may
+// connect, but their commands are refused, as are all commands while safe
+// mode is active.
+func (h *ProcessHandler) Control(w http.ResponseWriter, r *http.Request) {
+	if err := checkSameOrigin(r); err != nil {
+		h.writeError(w, http.StatusForbidden, err, "Control channels can only be opened from this server's own pages")
+		return
+	}
+	denied := middleware.ChangesDenied(r)
+
+	events, unsubscribe := h.pm.SubscribeEvents()
+	defer unsubscribe()
+
+	// The socket outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	server := websocket.Server{
+		// checkSameOrigin has run; unlike the default, accept no Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = maxControlMessage
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			responses := make(chan ControlResponse)
+
+			go func() {
+				defer cancel()
+				for {
+					var msg []byte
+					if err := websocket.Message.Receive(ws, &msg); err != nil {
+						return
+					}
+					var cmd ControlCommand
+					if err := json.Unmarshal(msg, &cmd); err != nil {
+						go h.respond(ctx, responses, ControlResponse{ID: cmd.ID, Status: "error", Error: "invalid message: " + err.Error()})
+						continue
+					}
+					go func() {
+						h.respond(ctx, responses, h.runControl(ctx, cmd, denied))
+					}()
+				}
+			}()
+
+			for {
+				var msg any
+				select {
+				case event := <-events:
+					msg = event
+				case resp := <-responses:
+					msg = resp
+				case <-ctx.Done():
+					return
+				}
+				if err := websocket.JSON.Send(ws, withJSONCase(msg, h.jsonCase)); err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// respond hands resp to the writer of a control channel, unless the
+// channel has closed meanwhile.
+func (h *ProcessHandler) respond(ctx context.Context, responses chan<- ControlResponse, resp ControlResponse) {
+	resp.Type = "response"
+	select {
+	case responses <- resp:
+	case <-ctx.Done():
+	}
+}
+
+// runControl runs one command received on a control channel. denied is why
+// the channel's caller may not make changes, if they may not.
+func (h *ProcessHandler) runControl(ctx context.Context, cmd ControlCommand, denied string) ControlResponse {
+	resp := ControlResponse{ID: cmd.ID, Status: "error"}
+
+	switch {
+	case cmd.Action != "start" && cmd.Action != "stop" && cmd.Action != "restart":
+		resp.Error = fmt.Sprintf("unknown action %q: must be start, stop or restart", cmd.Action)
+		return resp
+	case cmd.Process == "":
+		resp.Error = "process is required"
+		return resp
+	case denied != "":
+		resp.Error = denied
+		return resp
+	case h.pm.SafeMode():
+		resp.Error = "Safe mode is active; disable it with PUT /api/safe-mode to make changes"
+		return resp
+	}
+
+	var err error
+	switch cmd.Action {
+	case "start":
+		err = h.pm.StartProcessContext(ctx, cmd.Process)
+		resp.Status = "started"
+	case "stop":
+		err = h.pm.StopProcessContext(ctx, cmd.Process)
+		resp.Status = "stopped"
+	case "restart":
+		err = h.pm.RestartProcessContext(ctx, cmd.Process)
+		resp.Status = "restarted"
+	}
+	switch {
+	case errors.Is(err, service.ErrStartDeferred):
+		resp.Status = "deferred"
+	case err != nil:
+		resp.Status = "error"
+		resp.Code = controlErrorCode(err)
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// controlErrorCode maps the error of a start, stop or restart to the status
+// the REST endpoints respond with.
+func controlErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrProcessNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrProcessAlreadyRunning),
+		errors.Is(err, service.ErrProcessNotRunning),
+		errors.Is(err, service.ErrProcessHeld),
+		errors.Is(err, service.ErrSingletonRunning):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrPreStartCheckFailed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
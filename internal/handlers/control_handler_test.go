@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pupervisor/internal/middleware"
+
+	"golang.org/x/net/websocket"
+)
+
+const controlConfig = `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+`
+
+// dialControl opens a control channel on srv with the given Origin.
+func dialControl(srv *httptest.Server, origin string) (*websocket.Conn, error) {
+	cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/control", origin)
+	if err != nil {
+		return nil, err
+	}
+	return websocket.DialConfig(cfg)
+}
+
+// receiveUntil reads messages until one satisfies match and returns it.
+func receiveUntil(t *testing.T, ws *websocket.Conn, what string, match func(msg map[string]any) bool) map[string]any {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg map[string]any
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("waiting for %s: %v", what, err)
+		}
+		if match(msg) {
+			return msg
+		}
+	}
+}
+
+func isResponse(id string) func(map[string]any) bool {
+	return func(msg map[string]any) bool { return msg["type"] == "response" && msg["id"] == id }
+}
+
+func TestControlChannel(t *testing.T) {
+	h, pm, _ := newTestHandler(t, controlConfig)
+	srv := httptest.NewServer(http.HandlerFunc(h.Control))
+	defer srv.Close()
+
+	ws, err := dialControl(srv, srv.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+
+	// Events and responses are not ordered relative to each other
+	websocket.JSON.Send(ws, ControlCommand{ID: "1", Action: "start", Process: "app"})
+	var sawStatus, sawLog bool
+	var resp map[string]any
+	receiveUntil(t, ws, "the status and log events and the start response", func(msg map[string]any) bool {
+		switch msg["type"] {
+		case "status":
+			sawStatus = sawStatus || msg["process"] == "app" && msg["to"] == "running"
+		case "log":
+			entry, _ := msg["log"].(map[string]any)
+			sawLog = sawLog || entry != nil && strings.Contains(entry["message"].(string), "started with PID")
+		case "response":
+			resp = msg
+		}
+		return sawStatus && sawLog && resp != nil
+	})
+	if resp["id"] != "1" || resp["status"] != "started" {
+		t.Fatalf("start response = %v", resp)
+	}
+	if p, _ := pm.GetProcess("app"); p.Status != "running" {
+		t.Fatalf("status after start = %s, want running", p.Status)
+	}
+
+	websocket.JSON.Send(ws, ControlCommand{ID: "2", Action: "stop", Process: "app"})
+	if resp := receiveUntil(t, ws, "the stop response", isResponse("2")); resp["status"] != "stopped" {
+		t.Fatalf("stop response = %v", resp)
+	}
+	if p, _ := pm.GetProcess("app"); p.Status != "stopped" {
+		t.Errorf("status after stop = %s, want stopped", p.Status)
+	}
+
+	websocket.JSON.Send(ws, ControlCommand{ID: "3", Action: "delete", Process: "app"})
+	if resp := receiveUntil(t, ws, "the invalid command response", isResponse("3")); resp["status"] != "error" {
+		t.Errorf("unknown action response = %v, want an error", resp)
+	}
+}
+
+func TestControlChannelRefusesCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, h *ProcessHandler) http.Handler
+		want  string
+	}{
+		{
+			name: "read-only",
+			setup: func(t *testing.T, h *ProcessHandler) http.Handler {
+				return middleware.ReadOnly(http.HandlerFunc(h.Control))
+			},
+			want: "read-only mode",
+		},
+		{
+			name: "safe mode",
+			setup: func(t *testing.T, h *ProcessHandler) http.Handler {
+				if err := h.pm.SetSafeMode(true, "test"); err != nil {
+					t.Fatal(err)
+				}
+				return http.HandlerFunc(h.Control)
+			},
+			want: "Safe mode is active",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, pm, _ := newTestHandler(t, controlConfig)
+			srv := httptest.NewServer(tt.setup(t, h))
+			defer srv.Close()
+
+			ws, err := dialControl(srv, srv.URL)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer ws.Close()
+
+			websocket.JSON.Send(ws, ControlCommand{ID: "1", Action: "start", Process: "app"})
+			resp := receiveUntil(t, ws, "the start response", isResponse("1"))
+			if resp["status"] != "error" || !strings.Contains(resp["error"].(string), tt.want) {
+				t.Errorf("response = %v, want an error containing %q", resp, tt.want)
+			}
+			if p, _ := pm.GetProcess("app"); p.Status == "running" {
+				t.Error("process started")
+			}
+		})
+	}
+}
+
+func TestControlChannelRejectsCrossOrigin(t *testing.T) {
+	h, _, _ := newTestHandler(t, controlConfig)
+	srv := httptest.NewServer(http.HandlerFunc(h.Control))
+	defer srv.Close()
+
+	if ws, err := dialControl(srv, "http://evil.example"); err == nil {
+		ws.Close()
+		t.Fatal("cross-origin handshake accepted")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/control", nil)
+	req.Header.Set("Origin", "http://evil.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", resp.StatusCode)
+	}
+}
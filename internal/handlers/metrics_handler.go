@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pupervisor/internal/service"
+)
+
+type MetricsHandler struct {
+	pm *service.ProcessManager
+}
+
+func NewMetricsHandler(pm *service.ProcessManager) *MetricsHandler {
+	return &MetricsHandler{pm: pm}
+}
+
+// Prometheus serves process metrics in the Prometheus text exposition format.
+func (h *MetricsHandler) Prometheus(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.pm.CollectMetricsSnapshot()
+	if err != nil {
+		log.Printf("Error collecting metrics: %v", err)
+		http.Error(w, "Failed to collect metrics", http.StatusInternalServerError)
+		return
+	}
+	metrics := snapshot.Processes
+
+	var buf bytes.Buffer
+
+	writeHeader(&buf, "pupervisor_processes", "gauge", "Number of configured processes.")
+	fmt.Fprintf(&buf, "pupervisor_processes %d\n", snapshot.Total)
+
+	writeHeader(&buf, "pupervisor_processes_running", "gauge", "Number of running processes.")
+	fmt.Fprintf(&buf, "pupervisor_processes_running %d\n", snapshot.Running)
+
+	writeHeader(&buf, "pupervisor_process_up", "gauge", "Whether the process is running (1) or not (0).")
+	for _, m := range metrics {
+		up := 0
+		if m.Up {
+			up = 1
+		}
+		fmt.Fprintf(&buf, "pupervisor_process_up{process=%q} %d\n", m.Name, up)
+	}
+
+	writeHeader(&buf, "pupervisor_process_crashes_total", "counter", "Number of crashes of the process, including those recorded before the supervisor started.")
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "pupervisor_process_crashes_total{process=%q} %d\n", m.Name, m.Crashes)
+	}
+
+	writeHeader(&buf, "pupervisor_process_restarts_total", "counter", "Number of starts after the first since the supervisor started.")
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "pupervisor_process_restarts_total{process=%q} %d\n", m.Name, m.Restarts)
+	}
+
+	writeHeader(&buf, "pupervisor_process_uptime_seconds", "gauge", "How long the running process has been up.")
+	for _, m := range metrics {
+		if m.Up {
+			fmt.Fprintf(&buf, "pupervisor_process_uptime_seconds{process=%q} %s\n", m.Name, strconv.FormatFloat(m.UptimeSeconds, 'f', 3, 64))
+		}
+	}
+
+	writeHeader(&buf, "pupervisor_process_memory_bytes", "gauge", "Resident memory of the running process.")
+	for _, m := range metrics {
+		if m.Up {
+			fmt.Fprintf(&buf, "pupervisor_process_memory_bytes{process=%q} %d\n", m.Name, m.MemoryBytes)
+		}
+	}
+
+	writeHeader(&buf, "pupervisor_process_cpu_percent", "gauge", "CPU usage of the running process, in percent of one core.")
+	for _, m := range metrics {
+		if m.Up {
+			fmt.Fprintf(&buf, "pupervisor_process_cpu_percent{process=%q} %s\n", m.Name, strconv.FormatFloat(m.CPUPercent, 'g', -1, 64))
+		}
+	}
+
+	writeHeader(&buf, "pupervisor_process_uptime_before_crash_seconds", "histogram", "How long the process ran before crashing.")
+	for _, m := range metrics {
+		writeHistogram(&buf, "pupervisor_process_uptime_before_crash_seconds", m.Name, m.UptimeBeforeCrash)
+	}
+
+	writeHeader(&buf, "pupervisor_process_restart_interval_seconds", "histogram", "Time between consecutive starts of a crashing process.")
+	for _, m := range metrics {
+		writeHistogram(&buf, "pupervisor_process_restart_interval_seconds", m.Name, m.RestartInterval)
+	}
+
+	writeHeader(&buf, "pupervisor_process_start_duration_seconds", "histogram", "How long starts took from spawn until the process was ready.")
+	for _, m := range metrics {
+		writeHistogram(&buf, "pupervisor_process_start_duration_seconds", m.Name, m.StartDuration)
+	}
+
+	writeHeader(&buf, "pupervisor_process_stop_duration_seconds", "histogram", "How long graceful stops took from the stop signal until exit.")
+	for _, m := range metrics {
+		writeHistogram(&buf, "pupervisor_process_stop_duration_seconds", m.Name, m.StopDuration)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func writeHeader(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+}
+
+func writeHistogram(buf *bytes.Buffer, name, process string, h *service.Histogram) {
+	for i, upper := range h.Buckets {
+		le := strconv.FormatFloat(upper, 'g', -1, 64)
+		fmt.Fprintf(buf, "%s_bucket{process=%q,le=%q} %d\n", name, process, le, h.Counts[i])
+	}
+	fmt.Fprintf(buf, "%s_bucket{process=%q,le=\"+Inf\"} %d\n", name, process, h.Count)
+	fmt.Fprintf(buf, "%s_sum{process=%q} %s\n", name, process, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+	fmt.Fprintf(buf, "%s_count{process=%q} %d\n", name, process, h.Count)
+}
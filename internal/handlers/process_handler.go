@@ -1,24 +1,35 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os/exec"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
+	"pupervisor/internal/middleware"
 	"pupervisor/internal/models"
 	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
 
 	"github.com/gorilla/mux"
 )
 
 type ProcessHandler struct {
-	pm *service.ProcessManager
+	pm       *service.ProcessManager
+	jsonCase string
 }
 
-func NewProcessHandler(pm *service.ProcessManager) *ProcessHandler {
-	return &ProcessHandler{pm: pm}
+// NewProcessHandler creates a handler writing responses with the given
+// config.JSONCase* field casing.
+func NewProcessHandler(pm *service.ProcessManager, jsonCase string) *ProcessHandler {
+	return &ProcessHandler{pm: pm, jsonCase: jsonCase}
 }
 
 type ErrorResponse struct {
@@ -34,7 +45,7 @@ type SuccessResponse struct {
 func (h *ProcessHandler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
+	if err := json.NewEncoder(w).Encode(withJSONCase(data, h.jsonCase)); err != nil {
 		log.Printf("Error encoding JSON response: %v", err)
 	}
 }
@@ -46,16 +57,176 @@ func (h *ProcessHandler) writeError(w http.ResponseWriter, status int, err error
 	})
 }
 
+// GetProcesses lists the processes. ?health= keeps those with that health:
+// healthy, unhealthy or unknown, which includes processes without a health
+// check. ?label= keeps those matching a label selector.
 func (h *ProcessHandler) GetProcesses(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	health := query.Get("health")
+	switch health {
+	case "", service.HealthHealthy, service.HealthUnhealthy, service.HealthUnknown:
+	default:
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid health %q", health), "health must be healthy, unhealthy or unknown")
+		return
+	}
+
+	var sel service.Selector
+	if query.Has("label") {
+		var err error
+		sel, err = service.ParseSelector(query.Get("label"))
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err, "Invalid label selector")
+			return
+		}
+	}
+
 	processes := h.pm.GetProcesses()
+	if health != "" || sel != nil {
+		filtered := make([]models.Process, 0, len(processes))
+		for _, p := range processes {
+			if health != "" && processHealth(p) != health {
+				continue
+			}
+			if sel != nil && !sel.Matches(p.Labels) {
+				continue
+			}
+			filtered = append(filtered, p)
+		}
+		processes = filtered
+	}
 	h.writeJSON(w, http.StatusOK, processes)
 }
 
+// processHealth is the process's health, unknown if it has no health check.
+func processHealth(p models.Process) string {
+	if p.Health == "" {
+		return service.HealthUnknown
+	}
+	return p.Health
+}
+
+// GetProcessSummary returns the name, state, uptime and restart count of
+// every process, as JSON or, with ?format=text, as aligned columns under a
+// header line.
+func (h *ProcessHandler) GetProcessSummary(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" {
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported format %q", format), "format must be json or text")
+		return
+	}
+
+	summary := h.pm.Summary()
+	if format != "text" {
+		h.writeJSON(w, http.StatusOK, summary)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tUPTIME\tRESTARTS")
+	for _, p := range summary {
+		uptime := "-"
+		if p.State == "running" {
+			uptime = (time.Duration(p.UptimeSeconds) * time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", p.Name, p.State, uptime, p.Restarts)
+	}
+	_ = tw.Flush()
+}
+
+// GetMetricsJSON returns the data of the Prometheus /metrics endpoint as a
+// single JSON document, for dashboards and scripts without Prometheus.
+func (h *ProcessHandler) GetMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.pm.CollectMetricsSnapshot()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to collect metrics")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, snapshot)
+}
+
+// GetProcessMetrics returns the process's memory and CPU usage samples,
+// those of the last ?window= (e.g. 5m) or all that are kept.
+func (h *ProcessHandler) GetProcessMetrics(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var window time.Duration
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", v), "window must be a positive duration such as 5m")
+			return
+		}
+		window = d
+	}
+
+	history, err := h.pm.UsageHistory(name, window)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, history)
+}
+
+// GetProcess returns one process in detail, including its startup stderr.
+func (h *ProcessHandler) GetProcess(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	process, ok := h.pm.GetProcess(name)
+	if !ok {
+		h.writeError(w, http.StatusNotFound, service.ErrProcessNotFound, "Process not found: "+name)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, process)
+}
+
+// DescribeProcess returns a process's masked config, state, metrics and
+// recent crashes, transitions and logs in one response.
+func (h *ProcessHandler) DescribeProcess(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	desc, err := h.pm.Describe(name)
+	if errors.Is(err, service.ErrProcessNotFound) {
+		h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to describe process")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, desc)
+}
+
+// StartProcess starts a process. With ?wait_stable=true it only responds
+// once the process has stayed up for its min_uptime.
 func (h *ProcessHandler) StartProcess(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	if err := h.pm.StartProcess(name); err != nil {
+	waitStable, _ := strconv.ParseBool(r.URL.Query().Get("wait_stable"))
+
+	var err error
+	if waitStable {
+		// min_uptime may outlast the server's write timeout
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		err = h.pm.StartProcessStable(r.Context(), name)
+	} else {
+		err = h.pm.StartProcessContext(r.Context(), name)
+	}
+	if errors.Is(err, service.ErrStartDeferred) {
+		h.writeJSON(w, http.StatusAccepted, SuccessResponse{
+			Status:  "deferred",
+			Message: "Start condition of " + name + " does not hold, it will be started once it does",
+		})
+		return
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrUnstableStart) {
+			h.writeError(w, http.StatusInternalServerError, err, "Process "+name+" exited before min_uptime")
+			return
+		}
 		if errors.Is(err, service.ErrProcessNotFound) {
 			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
 			return
@@ -64,6 +235,18 @@ func (h *ProcessHandler) StartProcess(w http.ResponseWriter, r *http.Request) {
 			h.writeError(w, http.StatusConflict, err, "Process already running: "+name)
 			return
 		}
+		if errors.Is(err, service.ErrProcessHeld) {
+			h.writeError(w, http.StatusConflict, err, "Process is held, release it first: "+name)
+			return
+		}
+		if errors.Is(err, service.ErrSingletonRunning) {
+			h.writeError(w, http.StatusConflict, err, "Another instance is running: "+name)
+			return
+		}
+		if errors.Is(err, service.ErrPreStartCheckFailed) {
+			h.writeError(w, http.StatusServiceUnavailable, err, "Pre-start check of "+name+" did not pass")
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, err, "Failed to start process")
 		return
 	}
@@ -74,11 +257,52 @@ func (h *ProcessHandler) StartProcess(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// EnsureRunning starts a process unless it is running and responds with its
+// state once it is ready, or after ?timeout= (default 30s).
+func (h *ProcessHandler) EnsureRunning(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	timeout := 30 * time.Second
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", v), "timeout must be a positive duration such as 30s or 2m")
+			return
+		}
+		timeout = d
+	}
+
+	// The wait may outlast the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	process, err := h.pm.EnsureRunning(ctx, name)
+	switch {
+	case errors.Is(err, service.ErrProcessNotFound):
+		h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+	case errors.Is(err, service.ErrProcessHeld):
+		h.writeError(w, http.StatusConflict, err, "Process is held, release it first: "+name)
+	case errors.Is(err, service.ErrStartDeferred):
+		h.writeError(w, http.StatusConflict, err, "Start condition of "+name+" does not hold")
+	case errors.Is(err, service.ErrNotReady):
+		h.writeError(w, http.StatusGatewayTimeout, err, fmt.Sprintf("Process %s is %s, not ready after %s", name, process.Status, timeout))
+	case errors.Is(err, service.ErrUnstableStart):
+		h.writeError(w, http.StatusInternalServerError, err, "Process "+name+" exited before it was ready")
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to start process")
+	default:
+		h.writeJSON(w, http.StatusOK, process)
+	}
+}
+
 func (h *ProcessHandler) StopProcess(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	if err := h.pm.StopProcess(name); err != nil {
+	if err := h.pm.StopProcessContext(r.Context(), name); err != nil {
 		if errors.Is(err, service.ErrProcessNotFound) {
 			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
 			return
@@ -97,15 +321,42 @@ func (h *ProcessHandler) StopProcess(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RestartProcess restarts a process. With ?force=true a pending automatic
+// restart is cancelled instead of waited out.
 func (h *ProcessHandler) RestartProcess(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	if err := h.pm.RestartProcess(name); err != nil {
+	var err error
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+		err = h.pm.ForceRestartProcess(r.Context(), name)
+	} else {
+		err = h.pm.RestartProcessContext(r.Context(), name)
+	}
+	if errors.Is(err, service.ErrStartDeferred) {
+		h.writeJSON(w, http.StatusAccepted, SuccessResponse{
+			Status:  "deferred",
+			Message: "Process " + name + " stopped; its start condition does not hold, it will be started once it does",
+		})
+		return
+	}
+	if err != nil {
 		if errors.Is(err, service.ErrProcessNotFound) {
 			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
 			return
 		}
+		if errors.Is(err, service.ErrProcessHeld) {
+			h.writeError(w, http.StatusConflict, err, "Process is held, release it first: "+name)
+			return
+		}
+		if errors.Is(err, service.ErrSingletonRunning) {
+			h.writeError(w, http.StatusConflict, err, "Another instance is running: "+name)
+			return
+		}
+		if errors.Is(err, service.ErrPreStartCheckFailed) {
+			h.writeError(w, http.StatusServiceUnavailable, err, "Pre-start check of "+name+" did not pass")
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, err, "Failed to restart process")
 		return
 	}
@@ -116,176 +367,1152 @@ func (h *ProcessHandler) RestartProcess(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-type BulkRestartRequest struct {
-	Names []string `json:"names"`
-}
+// HoldProcess stops a process and keeps it out of supervision until it is
+// released, e.g. while a deploy replaces its binary.
+func (h *ProcessHandler) HoldProcess(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
 
-type BulkRestartResponse struct {
-	Status    string `json:"status"`
-	Restarted int    `json:"restarted"`
-	Failed    int    `json:"failed"`
-	Message   string `json:"message"`
+	if err := h.pm.HoldProcess(name); err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to hold process")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, SuccessResponse{
+		Status:  "held",
+		Message: "Process " + name + " held",
+	})
 }
 
-func (h *ProcessHandler) RestartAllProcesses(w http.ResponseWriter, r *http.Request) {
-	restarted, failed := h.pm.RestartAll()
+type SilenceRequest struct {
+	Duration string `json:"duration"`
+}
 
-	h.writeJSON(w, http.StatusOK, BulkRestartResponse{
-		Status:    "completed",
-		Restarted: restarted,
-		Failed:    failed,
-		Message:   fmt.Sprintf("Restarted %d processes, %d failed", restarted, failed),
-	})
+type SilenceResponse struct {
+	Status        string `json:"status"`
+	Message       string `json:"message"`
+	SilencedUntil string `json:"silenced_until"`
 }
 
-func (h *ProcessHandler) RestartSelectedProcesses(w http.ResponseWriter, r *http.Request) {
-	var req BulkRestartRequest
+// SilenceProcess suppresses a process's notifications for the duration in
+// the body, e.g. {"duration": "30m"}, while an incident is being handled.
+func (h *ProcessHandler) SilenceProcess(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var req SilenceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
 		return
 	}
-
-	if len(req.Names) == 0 {
-		h.writeError(w, http.StatusBadRequest, errors.New("no processes specified"), "Please select at least one process")
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil || d <= 0 {
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", req.Duration), "duration must be a positive duration such as 30m or 2h")
 		return
 	}
 
-	restarted, failed := h.pm.RestartSelected(req.Names)
+	until, err := h.pm.SilenceProcess(name, d)
+	if err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to silence process")
+		return
+	}
 
-	h.writeJSON(w, http.StatusOK, BulkRestartResponse{
-		Status:    "completed",
-		Restarted: restarted,
-		Failed:    failed,
-		Message:   fmt.Sprintf("Restarted %d processes, %d failed", restarted, failed),
+	h.writeJSON(w, http.StatusOK, SilenceResponse{
+		Status:        "silenced",
+		Message:       "Notifications for " + name + " silenced",
+		SilencedUntil: until.Format(time.RFC3339),
 	})
 }
 
-func (h *ProcessHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
-	logs := h.pm.GetLogs(100)
-	h.writeJSON(w, http.StatusOK, logs)
-}
+// UnsilenceProcess lets a silenced process's notifications through again.
+func (h *ProcessHandler) UnsilenceProcess(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
 
-func (h *ProcessHandler) GetWorkerLogs(w http.ResponseWriter, r *http.Request) {
-	allLogs := h.pm.GetLogs(200)
-	// Filter worker output logs (messages starting with [processname])
-	workerLogs := make([]models.LogEntry, 0)
-	for _, log := range allLogs {
-		if log.Worker != "" && len(log.Message) > 0 && log.Message[0] == '[' {
-			workerLogs = append(workerLogs, log)
+	if err := h.pm.UnsilenceProcess(name); err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
 		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to unsilence process")
+		return
 	}
-	h.writeJSON(w, http.StatusOK, workerLogs)
-}
 
-func (h *ProcessHandler) GetSystemLogs(w http.ResponseWriter, r *http.Request) {
-	allLogs := h.pm.GetLogs(200)
-	// Filter system event logs (not worker output)
-	systemLogs := make([]models.LogEntry, 0)
-	for _, log := range allLogs {
-		if log.Worker == "" || (len(log.Message) > 0 && log.Message[0] != '[') {
-			systemLogs = append(systemLogs, log)
-		}
-	}
-	h.writeJSON(w, http.StatusOK, systemLogs)
+	h.writeJSON(w, http.StatusOK, SuccessResponse{
+		Status:  "unsilenced",
+		Message: "Notifications for " + name + " resumed",
+	})
 }
 
-func (h *ProcessHandler) GetWorkerSpecificLogs(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	workerName := vars["workerName"]
-
-	logs := h.pm.GetLogsByProcess(workerName, 50)
-	h.writeJSON(w, http.StatusOK, logs)
+type ReadinessResponse struct {
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"`
 }
 
-// Crash history endpoints
-
-func (h *ProcessHandler) GetCrashes(w http.ResponseWriter, r *http.Request) {
-	store := h.pm.GetStorage()
-	if store == nil {
-		h.writeJSON(w, http.StatusOK, []struct{}{})
-		return
-	}
+// ProcessReady is a readiness probe for load balancers: 200 while the process
+// runs, is not being stopped and passes its health check, if any, else 503.
+func (h *ProcessHandler) ProcessReady(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
 
-	crashes, err := store.GetCrashes(100)
+	ready, reason, err := h.pm.Readiness(name)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash history")
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get readiness")
 		return
 	}
 
-	h.writeJSON(w, http.StatusOK, crashes)
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	h.writeJSON(w, status, ReadinessResponse{Ready: ready, Reason: reason})
 }
 
-func (h *ProcessHandler) GetCrashesByProcess(w http.ResponseWriter, r *http.Request) {
+// TestHealthCheck runs a process's health probe once and returns the result,
+// pass or fail, with 200. Its health state is not changed.
+func (h *ProcessHandler) TestHealthCheck(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	store := h.pm.GetStorage()
-	if store == nil {
-		h.writeJSON(w, http.StatusOK, []interface{}{})
-		return
-	}
-
-	crashes, err := store.GetCrashesByProcess(name, 50)
+	result, err := h.pm.TestHealthCheck(name)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash history")
+		switch {
+		case errors.Is(err, service.ErrProcessNotFound):
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+		case errors.Is(err, service.ErrNoHealthCheck):
+			h.writeError(w, http.StatusBadRequest, err, "Process "+name+" has no healthcheck configured")
+		default:
+			h.writeError(w, http.StatusInternalServerError, err, "Failed to test health check")
+		}
 		return
 	}
 
-	h.writeJSON(w, http.StatusOK, crashes)
+	h.writeJSON(w, http.StatusOK, result)
 }
 
-func (h *ProcessHandler) GetCrashStats(w http.ResponseWriter, r *http.Request) {
-	store := h.pm.GetStorage()
-	if store == nil {
-		h.writeJSON(w, http.StatusOK, map[string]int{})
-		return
-	}
+func (h *ProcessHandler) ReleaseProcess(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
 
-	stats, err := store.GetCrashStats()
-	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash stats")
+	if err := h.pm.ReleaseProcess(name); err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to release process")
 		return
 	}
 
-	h.writeJSON(w, http.StatusOK, stats)
+	h.writeJSON(w, http.StatusOK, SuccessResponse{
+		Status:  "released",
+		Message: "Process " + name + " released",
+	})
 }
 
-// Settings endpoints
+func (h *ProcessHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
 
-func (h *ProcessHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
-	store := h.pm.GetStorage()
-	if store == nil {
-		h.writeJSON(w, http.StatusOK, map[string]string{})
+	if err := h.pm.Heartbeat(name); err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		if errors.Is(err, service.ErrProcessNotRunning) {
+			h.writeError(w, http.StatusConflict, err, "Process not running: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to record heartbeat")
 		return
 	}
 
-	settings, err := store.GetAllSettings()
-	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err, "Failed to get settings")
-		return
-	}
+	h.writeJSON(w, http.StatusOK, SuccessResponse{Status: "ok"})
+}
 
-	h.writeJSON(w, http.StatusOK, settings)
+type CloneProcessRequest struct {
+	NewName   string         `json:"new_name"`
+	Overrides map[string]any `json:"overrides,omitempty"`
 }
 
-func (h *ProcessHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
-	store := h.pm.GetStorage()
-	if store == nil {
-		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
-		return
-	}
+func (h *ProcessHandler) CloneProcess(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
 
-	var settings map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+	var req CloneProcessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
 		return
 	}
 
-	for key, value := range settings {
-		if err := store.SetSetting(key, value); err != nil {
-			h.writeError(w, http.StatusInternalServerError, err, "Failed to save setting: "+key)
-			return
+	if err := h.pm.CloneProcess(name, req.NewName, req.Overrides); err != nil {
+		switch {
+		case errors.Is(err, service.ErrProcessNotFound):
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+		case errors.Is(err, service.ErrProcessExists):
+			h.writeError(w, http.StatusConflict, err, "Process already exists: "+req.NewName)
+		case errors.Is(err, service.ErrInvalidProcessName):
+			h.writeError(w, http.StatusBadRequest, err, "new_name must use letters, digits, '.', '_', '@' and '-', starting with a letter or digit, and not be summary or shutdown-plan")
+		default:
+			h.writeError(w, http.StatusBadRequest, err, "Invalid overrides")
 		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, SuccessResponse{
+		Status:  "created",
+		Message: "Process " + req.NewName + " cloned from " + name,
+	})
+}
+
+type BulkRestartRequest struct {
+	Names []string `json:"names"`
+}
+
+type BulkRestartResponse struct {
+	Status    string `json:"status"`
+	Restarted int    `json:"restarted"`
+	Failed    int    `json:"failed"`
+	Message   string `json:"message"`
+}
+
+// isAsync reports whether the client asked for a bulk operation to run in
+// the background (?async=true).
+func isAsync(r *http.Request) bool {
+	async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+	return async
+}
+
+func (h *ProcessHandler) RestartAllProcesses(w http.ResponseWriter, r *http.Request) {
+	if isAsync(r) {
+		h.writeJSON(w, http.StatusAccepted, h.pm.RestartAllAsync())
+		return
+	}
+
+	restarted, failed := h.pm.RestartAll()
+
+	h.writeJSON(w, http.StatusOK, BulkRestartResponse{
+		Status:    "completed",
+		Restarted: restarted,
+		Failed:    failed,
+		Message:   fmt.Sprintf("Restarted %d processes, %d failed", restarted, failed),
+	})
+}
+
+func (h *ProcessHandler) RestartSelectedProcesses(w http.ResponseWriter, r *http.Request) {
+	var req BulkRestartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+
+	if len(req.Names) == 0 {
+		h.writeError(w, http.StatusBadRequest, errors.New("no processes specified"), "Please select at least one process")
+		return
+	}
+
+	if isAsync(r) {
+		h.writeJSON(w, http.StatusAccepted, h.pm.RestartSelectedAsync(req.Names))
+		return
+	}
+
+	restarted, failed := h.pm.RestartSelected(req.Names)
+
+	h.writeJSON(w, http.StatusOK, BulkRestartResponse{
+		Status:    "completed",
+		Restarted: restarted,
+		Failed:    failed,
+		Message:   fmt.Sprintf("Restarted %d processes, %d failed", restarted, failed),
+	})
+}
+
+// LabelRestartResponse reports a restart of the processes matching a label
+// selector.
+type LabelRestartResponse struct {
+	BulkRestartResponse
+	Results []service.JobResult `json:"results"`
+	// MaxUnavailable is the limit a rolling restart of replicas observed
+	MaxUnavailable int `json:"max_unavailable,omitempty"`
+}
+
+// RestartByLabel restarts every process matching ?label=<selector>, one at a
+// time with ?strategy=rolling.
+func (h *ProcessHandler) RestartByLabel(w http.ResponseWriter, r *http.Request) {
+	sel, err := service.ParseSelector(r.URL.Query().Get("label"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid label selector")
+		return
+	}
+
+	strategy := r.URL.Query().Get("strategy")
+	switch strategy {
+	case "":
+		strategy = service.StrategyAll
+	case service.StrategyAll, service.StrategyRolling:
+	default:
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("unknown strategy %q", strategy), "Strategy must be all or rolling")
+		return
+	}
+
+	names := h.pm.MatchingProcesses(sel)
+
+	if isAsync(r) {
+		h.writeJSON(w, http.StatusAccepted, h.pm.RestartMatchingAsync(names, strategy))
+		return
+	}
+
+	results := h.pm.RestartMatching(names, strategy)
+
+	var restarted, failed int
+	for _, result := range results {
+		if result.Status == "ok" {
+			restarted++
+		} else {
+			failed++
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, LabelRestartResponse{
+		BulkRestartResponse: BulkRestartResponse{
+			Status:    "completed",
+			Restarted: restarted,
+			Failed:    failed,
+			Message:   fmt.Sprintf("Restarted %d processes, %d failed", restarted, failed),
+		},
+		Results: results,
+	})
+}
+
+// RollingRestartReplicas restarts the replicas of {base}, at most
+// max_unavailable at a time, waiting up to ?timeout= (default 60s) for each
+// to become healthy and stopping at the first that does not.
+func (h *ProcessHandler) RollingRestartReplicas(w http.ResponseWriter, r *http.Request) {
+	base := mux.Vars(r)["base"]
+
+	timeout := 60 * time.Second
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", v), "timeout must be a positive duration such as 30s or 2m")
+			return
+		}
+		timeout = d
+	}
+
+	if isAsync(r) {
+		job, err := h.pm.RollingRestartReplicasAsync(base, timeout)
+		if err != nil {
+			h.writeError(w, http.StatusNotFound, err, "No replicas of "+base)
+			return
+		}
+		h.writeJSON(w, http.StatusAccepted, job)
+		return
+	}
+
+	// The roll may outlast the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	results, err := h.pm.RollingRestartReplicas(base, timeout)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err, "No replicas of "+base)
+		return
+	}
+
+	var restarted, failed int
+	for _, result := range results {
+		if result.Status == "ok" {
+			restarted++
+		} else {
+			failed++
+		}
+	}
+
+	status := "completed"
+	if failed > 0 {
+		status = "aborted"
+	}
+	maxUnavailable := h.pm.ReplicaMaxUnavailable(base)
+	h.writeJSON(w, http.StatusOK, LabelRestartResponse{
+		BulkRestartResponse: BulkRestartResponse{
+			Status:    status,
+			Restarted: restarted,
+			Failed:    failed,
+			Message:   fmt.Sprintf("Restarted %d of %d replicas of %s, at most %d unavailable at a time", restarted, len(results), base, maxUnavailable),
+		},
+		Results:        results,
+		MaxUnavailable: maxUnavailable,
+	})
+}
+
+func (h *ProcessHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := h.pm.GetJob(id)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err, "Job not found: "+id)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, job)
+}
+
+func (h *ProcessHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	logs := h.pm.GetLogs(100)
+	h.writeJSON(w, http.StatusOK, logs)
+}
+
+func (h *ProcessHandler) GetWorkerLogs(w http.ResponseWriter, r *http.Request) {
+	allLogs := h.pm.GetLogs(200)
+	// Filter worker output logs
+	workerLogs := make([]models.LogEntry, 0)
+	for _, log := range allLogs {
+		if log.Source == models.LogSourceOutput {
+			workerLogs = append(workerLogs, log)
+		}
+	}
+	h.writeJSON(w, http.StatusOK, workerLogs)
+}
+
+func (h *ProcessHandler) GetSystemLogs(w http.ResponseWriter, r *http.Request) {
+	allLogs := h.pm.GetLogs(200)
+	// Filter system event logs (not worker output)
+	systemLogs := make([]models.LogEntry, 0)
+	for _, log := range allLogs {
+		if log.Source != models.LogSourceOutput {
+			systemLogs = append(systemLogs, log)
+		}
+	}
+	h.writeJSON(w, http.StatusOK, systemLogs)
+}
+
+func (h *ProcessHandler) GetWorkerSpecificLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workerName := vars["workerName"]
+
+	logs := h.pm.GetLogsByProcess(workerName, 50)
+	h.writeJSON(w, http.StatusOK, logs)
+}
+
+// GetCorrelatedLogs returns the output lines of all processes carrying the
+// correlation id, oldest first.
+func (h *ProcessHandler) GetCorrelatedLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	logs := h.pm.GetLogsByCorrelation(vars["id"])
+	h.writeJSON(w, http.StatusOK, logs)
+}
+
+// Config endpoints
+
+func (h *ProcessHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	result, err := h.pm.Reload(middleware.Actor(r))
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to reload config")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+// GetConfigChanges returns the timeline of setting and process config
+// changes, oldest first, optionally only those of one key and within a time
+// range.
+func (h *ProcessHandler) GetConfigChanges(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, []struct{}{})
+		return
+	}
+
+	query := r.URL.Query()
+
+	var bounds [2]time.Time
+	for i, param := range []string{"from", "to"} {
+		v := query.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", param, v), param+" must be an RFC 3339 time such as 2024-01-02T15:04:05Z")
+			return
+		}
+		bounds[i] = t
+	}
+
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v), "limit must be an integer between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	changes, err := store.GetConfigChanges(query.Get("key"), bounds[0], bounds[1], limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get config changes")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, changes)
+}
+
+// ExportConfig renders the process definitions in another format. Only
+// format=sh, a shell script launching every process, is supported.
+func (h *ProcessHandler) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "sh" {
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported format %q", format), "format must be sh")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-shellscript; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="pupervisor.sh"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, h.pm.ExportShell())
+}
+
+// GetShutdownPlan returns the order a graceful shutdown would stop the
+// running processes in, or every process with ?all=true.
+func (h *ProcessHandler) GetShutdownPlan(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	h.writeJSON(w, http.StatusOK, h.pm.ShutdownPlan(all))
+}
+
+// GetTopologyDOT returns the dependency graph in Graphviz DOT format.
+func (h *ProcessHandler) GetTopologyDOT(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, h.pm.TopologyDOT())
+}
+
+// Crash history endpoints
+
+func (h *ProcessHandler) GetCrashes(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, []struct{}{})
+		return
+	}
+
+	crashes, err := store.GetCrashes(100, r.URL.Query().Get("version"))
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash history")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, crashes)
+}
+
+func (h *ProcessHandler) GetCrashesByProcess(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, []interface{}{})
+		return
+	}
+
+	crashes, err := store.GetCrashesByProcess(name, 50)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash history")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, crashes)
+}
+
+func (h *ProcessHandler) CompareCrashes(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	var crashes [2]*storage.CrashRecord
+	for i, param := range []string{"a", "b"} {
+		id, err := strconv.ParseInt(r.URL.Query().Get(param), 10, 64)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err, "Invalid crash id in parameter "+param)
+			return
+		}
+
+		crashes[i], err = store.GetCrashByID(id)
+		if errors.Is(err, storage.ErrCrashNotFound) {
+			h.writeError(w, http.StatusNotFound, err, fmt.Sprintf("Crash not found: %d", id))
+			return
+		}
+		if err != nil {
+			h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash")
+			return
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, service.CompareCrashes(*crashes[0], *crashes[1]))
+}
+
+// DeleteCrashesRequest selects the crashes to delete. At least one field is
+// required; Before is an RFC 3339 time.
+type DeleteCrashesRequest struct {
+	Process     string `json:"process,omitempty"`
+	Before      string `json:"before,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// DeleteCrashesResponse reports how many crash records were removed.
+type DeleteCrashesResponse struct {
+	Status  string `json:"status"`
+	Deleted int64  `json:"deleted"`
+}
+
+// DeleteCrashes deletes the crashes matching the filter in the request body.
+func (h *ProcessHandler) DeleteCrashes(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	var req DeleteCrashesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+
+	filter := storage.CrashFilter{
+		ProcessName: req.Process,
+		Fingerprint: req.Fingerprint,
+	}
+	if req.Before != "" {
+		t, err := time.Parse(time.RFC3339, req.Before)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid before %q", req.Before), "before must be an RFC 3339 time such as 2024-01-02T15:04:05Z")
+			return
+		}
+		filter.Before = t
+	}
+	if filter.IsEmpty() {
+		h.writeError(w, http.StatusBadRequest, errors.New("empty filter"), "Specify at least one of process, before or fingerprint")
+		return
+	}
+
+	deleted, err := store.DeleteCrashes(filter)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to delete crashes")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, DeleteCrashesResponse{Status: "deleted", Deleted: deleted})
+}
+
+// DeleteCrash deletes a single crash record.
+func (h *ProcessHandler) DeleteCrash(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid crash id")
+		return
+	}
+
+	err = store.DeleteCrash(id)
+	if errors.Is(err, storage.ErrCrashNotFound) {
+		h.writeError(w, http.StatusNotFound, err, fmt.Sprintf("Crash not found: %d", id))
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to delete crash")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, DeleteCrashesResponse{Status: "deleted", Deleted: 1})
+}
+
+// CrashCommandResponse is the command line recorded with a crash.
+type CrashCommandResponse struct {
+	ID          int64    `json:"id"`
+	ProcessName string   `json:"process_name"`
+	CommandLine []string `json:"command_line"`
+}
+
+func (h *ProcessHandler) GetCrashCommand(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid crash id")
+		return
+	}
+
+	crash, err := store.GetCrashByID(id)
+	if errors.Is(err, storage.ErrCrashNotFound) {
+		h.writeError(w, http.StatusNotFound, err, fmt.Sprintf("Crash not found: %d", id))
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash")
+		return
+	}
+	if len(crash.CommandLine) == 0 {
+		h.writeError(w, http.StatusNotFound, service.ErrNoCommandLine, fmt.Sprintf("No command line recorded for crash %d", id))
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, CrashCommandResponse{
+		ID:          crash.ID,
+		ProcessName: crash.ProcessName,
+		CommandLine: crash.CommandLine,
+	})
+}
+
+// ReplayCrash runs the command of a crash once and streams its combined
+// output as plain text, followed by its exit status. The command is killed
+// if the client disconnects.
+func (h *ProcessHandler) ReplayCrash(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid crash id")
+		return
+	}
+
+	cmd, err := h.pm.ReplayCommand(r.Context(), id)
+	switch {
+	case errors.Is(err, service.ErrReplayDisabled):
+		h.writeError(w, http.StatusForbidden, err, "Crash replay is disabled, set CRASH_REPLAY=true to enable it")
+		return
+	case errors.Is(err, storage.ErrCrashNotFound):
+		h.writeError(w, http.StatusNotFound, err, fmt.Sprintf("Crash not found: %d", id))
+		return
+	case errors.Is(err, service.ErrNoCommandLine):
+		h.writeError(w, http.StatusNotFound, err, fmt.Sprintf("No command line recorded for crash %d", id))
+		return
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to prepare replay")
+		return
+	}
+
+	// The replay may outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	out := &flushWriter{w: w, rc: rc}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			fmt.Fprintf(out, "\n[exited with code %d]\n", exitErr.ExitCode())
+		} else {
+			fmt.Fprintf(out, "\n[failed: %v]\n", err)
+		}
+		return
+	}
+	fmt.Fprintf(out, "\n[exited with code 0]\n")
+}
+
+// flushWriter sends every write to the client immediately.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		_ = f.rc.Flush()
+	}
+	return n, err
+}
+
+func (h *ProcessHandler) GetTopCrashers(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, []struct{}{})
+		return
+	}
+
+	window := time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", v), "window must be a positive duration such as 1h or 30m")
+			return
+		}
+		window = d
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v), "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	top, err := store.GetTopCrashers(time.Now().Add(-window), limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get top crashers")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, top)
+}
+
+func (h *ProcessHandler) GetCrashStats(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, map[string]int{})
+		return
+	}
+
+	stats, err := store.GetCrashStats()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get crash stats")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+// Notification history endpoints
+
+func (h *ProcessHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, []struct{}{})
+		return
+	}
+
+	notifications, err := store.GetNotifications(100)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get notification history")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, notifications)
+}
+
+// GetTransitions returns the process state transitions newest first.
+// ?since= (RFC 3339) limits them to later ones, ?before= (transition id)
+// pages to older ones.
+func (h *ProcessHandler) GetTransitions(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, []struct{}{})
+		return
+	}
+
+	query := r.URL.Query()
+
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since %q", v), "since must be an RFC 3339 time such as 2024-01-02T15:04:05Z")
+			return
+		}
+		since = t
+	}
+
+	var before int64
+	if v := query.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid before %q", v), "before must be a transition id")
+			return
+		}
+		before = n
+	}
+
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v), "limit must be an integer between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	transitions, err := store.GetTransitions(since, before, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get transitions")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, transitions)
+}
+
+// GetStorageStats returns the database size and row counts.
+func (h *ProcessHandler) GetStorageStats(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get storage stats")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+// CleanupResponse reports how many rows a retention cleanup deleted per
+// table.
+type CleanupResponse struct {
+	Status  string           `json:"status"`
+	Deleted map[string]int64 `json:"deleted"`
+}
+
+// CleanupStorage runs the retention cleanup now, keeping ?days= days of
+// records if given instead of the configured retention.
+func (h *ProcessHandler) CleanupStorage(w http.ResponseWriter, r *http.Request) {
+	days := 0
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid days %q", v), "days must be a positive number")
+			return
+		}
+		days = n
+	}
+
+	deleted, err := h.pm.CleanupStorage(days)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to delete old records")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, CleanupResponse{Status: "cleaned", Deleted: deleted})
+}
+
+type MigrateResponse struct {
+	Status  string              `json:"status"`
+	Applied []storage.Migration `json:"applied"`
+	Version int                 `json:"version"`
+}
+
+// MigrateStorage applies pending database migrations. With none pending it
+// changes nothing and reports the schema as already current.
+func (h *ProcessHandler) MigrateStorage(w http.ResponseWriter, r *http.Request) {
+	applied, version, err := h.pm.MigrateStorage()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to migrate database")
+		return
+	}
+
+	status := "migrated"
+	if len(applied) == 0 {
+		status = "already current"
+	}
+	h.writeJSON(w, http.StatusOK, MigrateResponse{Status: status, Applied: applied, Version: version})
+}
+
+// InfoResponse describes the supervisor itself rather than its processes.
+type InfoResponse struct {
+	LogMemory service.LogMemoryUsage `json:"log_memory"`
+}
+
+func (h *ProcessHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, InfoResponse{
+		LogMemory: h.pm.LogMemoryUsage(),
+	})
+}
+
+// Settings endpoints
+
+func (h *ProcessHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, map[string]string{})
+		return
+	}
+
+	settings, err := store.GetAllSettings()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get settings")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, settings)
+}
+
+type SettingRequest struct {
+	Value *string `json:"value"`
+}
+
+// SettingResponse is a single setting. Set is false for a known key that has
+// no value yet.
+type SettingResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Set   bool   `json:"set"`
+}
+
+// GetSetting returns one setting. Keys that are neither known nor set are
+// 404.
+func (h *ProcessHandler) GetSetting(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	value, set, err := h.pm.Setting(key)
+	if errors.Is(err, service.ErrUnknownSetting) {
+		h.writeError(w, http.StatusNotFound, err, "Unknown setting: "+key)
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get setting")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, SettingResponse{Key: key, Value: value, Set: set})
+}
+
+// SetSetting saves one setting after checking its value against the
+// setting's type.
+func (h *ProcessHandler) SetSetting(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	var req SettingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+	if req.Value == nil {
+		h.writeError(w, http.StatusBadRequest, errors.New("value is required"), "Set value to the new setting value")
+		return
+	}
+
+	err := h.pm.SetSettingValue(key, *req.Value, middleware.Actor(r))
+	switch {
+	case errors.Is(err, service.ErrUnknownSetting):
+		h.writeError(w, http.StatusNotFound, err, "Unknown setting: "+key)
+		return
+	case errors.Is(err, service.ErrInvalidSetting):
+		h.writeError(w, http.StatusBadRequest, err, "Invalid value for setting: "+key)
+		return
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to save setting: "+key)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, SettingResponse{Key: key, Value: *req.Value, Set: true})
+}
+
+type SafeModeRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type SafeModeResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (h *ProcessHandler) GetSafeMode(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, SafeModeResponse{Enabled: h.pm.SafeMode()})
+}
+
+// SetSafeMode turns safe mode on or off. It is the one mutating route
+// served while safe mode is active.
+func (h *ProcessHandler) SetSafeMode(w http.ResponseWriter, r *http.Request) {
+	var req SafeModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+	if req.Enabled == nil {
+		h.writeError(w, http.StatusBadRequest, errors.New("enabled is required"), "Set enabled to true or false")
+		return
+	}
+
+	if err := h.pm.SetSafeMode(*req.Enabled, middleware.Actor(r)); err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to save safe mode")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, SafeModeResponse{Enabled: h.pm.SafeMode()})
+}
+
+// GetEffectiveSettings returns each resolved setting and the layer it came from.
+func (h *ProcessHandler) GetEffectiveSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.pm.EffectiveSettings()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get settings")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, settings)
+}
+
+// GetTypedSettings returns the settings coerced to their schema types.
+func (h *ProcessHandler) GetTypedSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.pm.TypedSettings()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get settings")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, settings)
+}
+
+// SettingErrorsResponse lists every rejected setting of a settings update
+// with the reason it was rejected.
+type SettingErrorsResponse struct {
+	Error   string            `json:"error"`
+	Message string            `json:"message"`
+	Errors  map[string]string `json:"errors"`
+}
+
+// UpdateSettings saves several settings at once. It checks them all first
+// and, if any is unknown or invalid, saves none and responds 422 with the
+// reason for each.
+func (h *ProcessHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var settings map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+
+	err := h.pm.SetSettingValues(settings, middleware.Actor(r))
+	var invalid service.SettingErrors
+	if errors.As(err, &invalid) {
+		h.writeJSON(w, http.StatusUnprocessableEntity, SettingErrorsResponse{
+			Error:   err.Error(),
+			Message: "No settings were saved",
+			Errors:  invalid,
+		})
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to save settings")
+		return
 	}
 
 	h.writeJSON(w, http.StatusOK, SuccessResponse{
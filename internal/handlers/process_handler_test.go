@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/websocket"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
+)
+
+// newTestHandler returns a handler for a process manager loaded from the
+// given config file contents, with a fresh database. Its processes are
+// stopped when the test ends.
+func newTestHandler(t *testing.T, yaml string) (*ProcessHandler, *service.ProcessManager, *storage.Storage) {
+	t.Helper()
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "pupervisor.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadProcessConfig(path)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig: %v", err)
+	}
+
+	store, err := storage.New(filepath.Join(dir, "test.db"), storage.Options{BusyTimeout: 5000})
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+
+	pm := service.NewProcessManager(cfg, store)
+	pm.WatchSafeMode()
+	t.Cleanup(func() {
+		pm.StopAll()
+		store.Close()
+	})
+	return NewProcessHandler(pm, config.JSONCaseSnake), pm, store
+}
+
+func TestCompareCrashesHandler(t *testing.T) {
+	h, _, store := newTestHandler(t, "processes: []\n")
+	for _, stderr := range []string{"boom", "bang"} {
+		if err := store.SaveCrash(&storage.CrashRecord{ProcessName: "app", ExitCode: 1, Stderr: stderr, StartedAt: time.Now(), CrashedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"both found", "a=1&b=2", http.StatusOK},
+		{"bad id", "a=one&b=2", http.StatusBadRequest},
+		{"missing id", "a=1", http.StatusBadRequest},
+		{"unknown id", "a=1&b=99", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.CompareCrashes(rec, httptest.NewRequest(http.MethodGet, "/api/crashes/compare?"+tt.query, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var cmp service.CrashComparison
+			if err := json.Unmarshal(rec.Body.Bytes(), &cmp); err != nil {
+				t.Fatal(err)
+			}
+			if cmp.Identical || len(cmp.StderrDiff) != 2 {
+				t.Errorf("comparison = %+v, want boom removed and bang added", cmp)
+			}
+		})
+	}
+}
+
+func TestGetTransitionsHandler(t *testing.T) {
+	h, _, store := newTestHandler(t, "processes: []\n")
+	for _, to := range []string{"running", "stopped", "running"} {
+		if err := store.SaveTransition(&storage.Transition{ProcessName: "app", ToState: to, CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		count int
+	}{
+		{"all", "", http.StatusOK, 3},
+		{"limit", "limit=2", http.StatusOK, 2},
+		{"before", "before=3", http.StatusOK, 2},
+		{"since", "since=2000-01-01T00:00:00Z", http.StatusOK, 3},
+		{"since in the future", "since=2999-01-01T00:00:00Z", http.StatusOK, 0},
+		{"bad since", "since=yesterday", http.StatusBadRequest, 0},
+		{"bad before", "before=0", http.StatusBadRequest, 0},
+		{"limit too big", "limit=1001", http.StatusBadRequest, 0},
+		{"limit not a number", "limit=all", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.GetTransitions(rec, httptest.NewRequest(http.MethodGet, "/api/transitions?"+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var transitions []storage.Transition
+			if err := json.Unmarshal(rec.Body.Bytes(), &transitions); err != nil {
+				t.Fatal(err)
+			}
+			if len(transitions) != tt.count {
+				t.Errorf("got %d transitions, want %d", len(transitions), tt.count)
+			}
+		})
+	}
+}
+
+func TestEnsureRunningHandler(t *testing.T) {
+	h, pm, _ := newTestHandler(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+  - name: unhealthy
+    command: sleep
+    args: ["30"]
+    healthcheck:
+      command: "false"
+  - name: broken
+    command: /bin/sh
+    args: ["-c", "sleep 0.2; exit 1"]
+    min_uptime: 5
+`)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"app", "", http.StatusOK},
+		{"app", "", http.StatusOK}, // already running
+		{"unhealthy", "timeout=300ms", http.StatusGatewayTimeout},
+		{"broken", "timeout=5s", http.StatusInternalServerError},
+		{"missing", "", http.StatusNotFound},
+		{"app", "timeout=soon", http.StatusBadRequest},
+	}
+	var pid int
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/processes/"+tt.name+"/ensure-running?"+tt.query, nil)
+		req = mux.SetURLVars(req, map[string]string{"name": tt.name})
+		rec := httptest.NewRecorder()
+		h.EnsureRunning(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("ensure-running %s?%s: status = %d, want %d: %s", tt.name, tt.query, rec.Code, tt.want, rec.Body)
+			continue
+		}
+
+		if tt.name == "app" && rec.Code == http.StatusOK {
+			var p struct {
+				Status string `json:"status"`
+				Pid    int    `json:"pid"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Status != "running" || (pid != 0 && p.Pid != pid) {
+				t.Errorf("ensure-running app = %+v, want the same running process", p)
+			}
+			pid = p.Pid
+		}
+	}
+	if p, _ := pm.GetProcess("unhealthy"); p.Status != "running" {
+		t.Errorf("unhealthy status = %s after timing out, want running", p.Status)
+	}
+}
+
+func TestSingleSettingHandlers(t *testing.T) {
+	h, _, _ := newTestHandler(t, "processes: []\n")
+
+	serve := func(method, key, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/settings/"+key, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"key": key})
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	puts := []struct {
+		key  string
+		body string
+		want int
+	}{
+		{"system_name", `{"value": "prod"}`, http.StatusOK},
+		{"refresh_interval", `{"value": "soon"}`, http.StatusBadRequest},
+		{"system_name", `{}`, http.StatusBadRequest},
+		{"system_name", `not json`, http.StatusBadRequest},
+		{"no_such_key", `{"value": "x"}`, http.StatusNotFound},
+	}
+	for _, tt := range puts {
+		if rec := serve(http.MethodPut, tt.key, tt.body, h.SetSetting); rec.Code != tt.want {
+			t.Errorf("PUT %s %s: status = %d, want %d: %s", tt.key, tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	gets := []struct {
+		key  string
+		want int
+		resp SettingResponse
+	}{
+		{"system_name", http.StatusOK, SettingResponse{Key: "system_name", Value: "prod", Set: true}},
+		{"refresh_interval", http.StatusOK, SettingResponse{Key: "refresh_interval"}},
+		{"no_such_key", http.StatusNotFound, SettingResponse{}},
+	}
+	for _, tt := range gets {
+		rec := serve(http.MethodGet, tt.key, "", h.GetSetting)
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.key, rec.Code, tt.want)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var got SettingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.resp {
+			t.Errorf("GET %s = %+v, want %+v", tt.key, got, tt.resp)
+		}
+	}
+}
+
+func TestUpdateSettingsRejectsInvalid(t *testing.T) {
+	h, _, store := newTestHandler(t, "processes: []\n")
+	if err := store.SetSetting("system_name", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"system_name": "new", "refresh_interval": "soon", "log_retention": "-1", "no_such_key": "x"}`
+	rec := httptest.NewRecorder()
+	h.UpdateSettings(rec, httptest.NewRequest(http.MethodPost, "/api/settings", strings.NewReader(body)))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+
+	var resp SettingErrorsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"refresh_interval", "log_retention", "no_such_key"} {
+		if resp.Errors[key] == "" {
+			t.Errorf("no error reported for %s: %s", key, rec.Body)
+		}
+	}
+	if len(resp.Errors) != 3 {
+		t.Errorf("errors = %v, want only the three bad keys", resp.Errors)
+	}
+	if value, _ := store.GetSetting("system_name"); value != "old" {
+		t.Errorf("system_name = %q after a rejected update, want old", value)
+	}
+}
+
+func TestProcessReadyHandler(t *testing.T) {
+	h, pm, _ := newTestHandler(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+  - name: idle
+    command: sleep
+    args: ["30"]
+`)
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"app", http.StatusOK},
+		{"idle", http.StatusServiceUnavailable},
+		{"missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/processes/"+tt.name+"/ready", nil)
+		req = mux.SetURLVars(req, map[string]string{"name": tt.name})
+		rec := httptest.NewRecorder()
+		h.ProcessReady(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("ready %s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+func TestCleanupStorageHandler(t *testing.T) {
+	h, _, _ := newTestHandler(t, "processes: []\n")
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusOK},
+		{"days=30", http.StatusOK},
+		{"days=0", http.StatusBadRequest},
+		{"days=week", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.CleanupStorage(rec, httptest.NewRequest(http.MethodPost, "/api/maintenance/cleanup?"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("cleanup?%s: status = %d, want %d: %s", tt.query, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+func TestGetProcessSummaryHandler(t *testing.T) {
+	h, pm, _ := newTestHandler(t, `
+processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+  - name: background-worker
+    command: sleep
+    args: ["30"]
+`)
+	if err := pm.StartProcess("web"); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.GetProcessSummary(rec, httptest.NewRequest(http.MethodGet, "/api/processes/summary?"+query, nil))
+		return rec
+	}
+
+	rec := serve("format=text")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("format=text: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	lines := strings.Split(strings.TrimRight(rec.Body.String(), "\n"), "\n")
+	want := []string{
+		"NAME               STATE    UPTIME  RESTARTS",
+		"background-worker  stopped  -       0",
+	}
+	if len(lines) != 3 || lines[0] != want[0] || lines[1] != want[1] || !strings.HasPrefix(lines[2], "web                running  ") {
+		t.Errorf("format=text body =\n%s\nwant header, background-worker, then web running", rec.Body)
+	}
+
+	rec = serve("")
+	var summary []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 2 || summary[1].Name != "web" || summary[1].State != "running" {
+		t.Errorf("JSON summary = %+v, want background-worker then web running", summary)
+	}
+
+	if rec := serve("format=yaml"); rec.Code != http.StatusBadRequest {
+		t.Errorf("format=yaml: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSilenceProcessHandlers(t *testing.T) {
+	h, pm, _ := newTestHandler(t, `
+processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+`)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"web", `{"duration": "30m"}`, http.StatusOK},
+		{"web", `{"duration": "0s"}`, http.StatusBadRequest},
+		{"web", `{"duration": "soon"}`, http.StatusBadRequest},
+		{"web", `{`, http.StatusBadRequest},
+		{"missing", `{"duration": "30m"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/processes/"+tt.name+"/silence", strings.NewReader(tt.body))
+		req = mux.SetURLVars(req, map[string]string{"name": tt.name})
+		rec := httptest.NewRecorder()
+		h.SilenceProcess(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("silence %s with %s: status = %d, want %d: %s", tt.name, tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	p, _ := pm.GetProcess("web")
+	until, err := time.Parse(time.RFC3339, p.SilencedUntil)
+	if !p.Silenced || err != nil || time.Until(until) < 29*time.Minute {
+		t.Errorf("after silencing for 30m: Silenced = %v, SilencedUntil = %q", p.Silenced, p.SilencedUntil)
+	}
+
+	for _, tt := range []struct {
+		name string
+		want int
+	}{
+		{"web", http.StatusOK},
+		{"web", http.StatusOK},
+		{"missing", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/processes/"+tt.name+"/silence", nil)
+		req = mux.SetURLVars(req, map[string]string{"name": tt.name})
+		rec := httptest.NewRecorder()
+		h.UnsilenceProcess(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("unsilence %s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+	if p, _ := pm.GetProcess("web"); p.Silenced || p.SilencedUntil != "" {
+		t.Errorf("after unsilencing: Silenced = %v, SilencedUntil = %q", p.Silenced, p.SilencedUntil)
+	}
+}
+
+func TestRestartProcessHandlerErrors(t *testing.T) {
+	yaml := `
+lockdir: ` + t.TempDir() + `
+processes:
+  - name: job
+    command: sleep
+    args: ["30"]
+    singleton: refuse
+  - name: blocked
+    command: sleep
+    args: ["30"]
+    pre_start_check: "false"
+    pre_start_check_attempts: 1
+`
+	_, owner, _ := newTestHandler(t, yaml)
+	if err := owner.StartProcess("job"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+	h, _, _ := newTestHandler(t, yaml)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"job", "", http.StatusConflict},
+		{"job", "force=true", http.StatusConflict},
+		{"blocked", "", http.StatusServiceUnavailable},
+		{"blocked", "force=true", http.StatusServiceUnavailable},
+		{"missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/processes/"+tt.name+"/restart?"+tt.query, nil)
+		req = mux.SetURLVars(req, map[string]string{"name": tt.name})
+		rec := httptest.NewRecorder()
+		h.RestartProcess(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("restart %s?%s: status = %d, want %d: %s", tt.name, tt.query, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	// The control channel reports the same status
+	srv := httptest.NewServer(http.HandlerFunc(h.Control))
+	defer srv.Close()
+	ws, err := dialControl(srv, srv.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	for i, tt := range tests {
+		id := strconv.Itoa(i)
+		websocket.JSON.Send(ws, ControlCommand{ID: id, Action: "restart", Process: tt.name})
+		if resp := receiveUntil(t, ws, "the restart response", isResponse(id)); resp["status"] != "error" || resp["code"] != float64(tt.want) {
+			t.Errorf("control restart %s response = %v, want an error with code %d", tt.name, resp, tt.want)
+		}
+	}
+}
@@ -5,13 +5,26 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"strconv"
+
+	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
 )
 
 type TemplateHandler struct {
 	templates *template.Template
+	basePath  string
+}
+
+// templateData is passed to every page so links and API calls carry the
+// base path the UI is served under.
+type templateData struct {
+	BasePath string
 }
 
-func NewTemplateHandler(templatesFS fs.FS) (*TemplateHandler, error) {
+// NewTemplateHandler parses the page templates. basePath is the path prefix
+// the UI is served under, "" for the root.
+func NewTemplateHandler(templatesFS fs.FS, basePath string) (*TemplateHandler, error) {
 	tmpl, err := template.ParseFS(templatesFS, "*.html")
 	if err != nil {
 		return nil, err
@@ -19,6 +32,7 @@ func NewTemplateHandler(templatesFS fs.FS) (*TemplateHandler, error) {
 
 	return &TemplateHandler{
 		templates: tmpl,
+		basePath:  basePath,
 	}, nil
 }
 
@@ -26,10 +40,70 @@ func (th *TemplateHandler) ServeTemplate(templateName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-		if err := th.templates.ExecuteTemplate(w, templateName+".html", nil); err != nil {
+		if err := th.templates.ExecuteTemplate(w, templateName+".html", templateData{BasePath: th.basePath}); err != nil {
 			log.Printf("Error executing template %s: %v", templateName, err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	}
 }
+
+// Page sizes of the crash rows partial
+const (
+	defaultCrashRows = 20
+	maxCrashRows     = 100
+)
+
+// crashRowsData is passed to the crashes_rows partial.
+type crashRowsData struct {
+	BasePath string
+	Crashes  []storage.CrashRecord
+}
+
+// ServeCrashRows renders a page of crash records, newest first, as table
+// rows for infinite scroll: ?limit= rows (default 20, at most 100) after
+// skipping ?offset=. While there may be more, the X-Next-Offset header is
+// the offset of the next page.
+func (th *TemplateHandler) ServeCrashRows(pm *service.ProcessManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset := defaultCrashRows, 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxCrashRows {
+				http.Error(w, "limit must be an integer between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		if v := r.URL.Query().Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		data := crashRowsData{BasePath: th.basePath, Crashes: []storage.CrashRecord{}}
+		if store := pm.GetStorage(); store != nil {
+			crashes, err := store.GetCrashesPage(limit, offset)
+			if err != nil {
+				log.Printf("Error getting crashes: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			data.Crashes = crashes
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if len(data.Crashes) == limit {
+			w.Header().Set("X-Next-Offset", strconv.Itoa(offset+limit))
+		}
+
+		if err := th.templates.ExecuteTemplate(w, "crashes_rows.html", data); err != nil {
+			log.Printf("Error executing template crashes_rows: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
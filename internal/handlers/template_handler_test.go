@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pupervisor/internal/storage"
+	"pupervisor/web"
+)
+
+func TestServeCrashRows(t *testing.T) {
+	_, pm, store := newTestHandler(t, "processes: []\n")
+	th, err := NewTemplateHandler(web.GetTemplatesFS(), "")
+	if err != nil {
+		t.Fatalf("NewTemplateHandler: %v", err)
+	}
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, msg := range []string{"oldest", "middle", "<script>alert(1)</script>"} {
+		crashedAt := base.Add(time.Duration(i) * time.Minute)
+		if err := store.SaveCrash(&storage.CrashRecord{ProcessName: "web", ExitCode: i + 1, ErrorMsg: msg, StartedAt: crashedAt, CrashedAt: crashedAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query      string
+		want       int
+		wantRows   int
+		wantNext   string
+		wantInBody string
+	}{
+		{"", http.StatusOK, 3, "", "oldest"},
+		{"limit=2", http.StatusOK, 2, "2", "&lt;script&gt;"},
+		{"limit=2&offset=2", http.StatusOK, 1, "", "oldest"},
+		{"offset=5", http.StatusOK, 0, "", ""},
+		{"limit=0", http.StatusBadRequest, 0, "", ""},
+		{"limit=101", http.StatusBadRequest, 0, "", ""},
+		{"offset=-1", http.StatusBadRequest, 0, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			th.ServeCrashRows(pm)(rec, httptest.NewRequest(http.MethodGet, "/partials/crashes?"+tt.query, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			body := rec.Body.String()
+			if rows := strings.Count(body, `<tr class="crash-row"`); rows != tt.wantRows {
+				t.Errorf("rows = %d, want %d", rows, tt.wantRows)
+			}
+			if next := rec.Header().Get("X-Next-Offset"); next != tt.wantNext {
+				t.Errorf("X-Next-Offset = %q, want %q", next, tt.wantNext)
+			}
+			if !strings.Contains(body, tt.wantInBody) {
+				t.Errorf("body does not contain %q:\n%s", tt.wantInBody, body)
+			}
+			if strings.Contains(body, "<script>") {
+				t.Error("crash message was not escaped")
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type actorKey struct{}
+
+// withActor returns r with actor recorded as who made it.
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorKey{}, actor))
+}
+
+// Actor returns who made the request: the subject of its JWT, "token:" and
+// the role of a static token, or without authentication the client address.
+func Actor(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
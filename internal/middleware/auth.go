@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"pupervisor/internal/config"
+)
+
+// Auth returns middleware requiring a bearer token on the API, metrics and
+// HTML partial endpoints. Static tokens are checked first; other tokens are
+// validated as JWTs when a JWKS URL is configured. Viewers may only make the
+// requests allowed in read-only mode. The UI pages, static files and health
+// checks stay public. Without tokens or a JWKS URL every request is allowed.
+func Auth(cfg config.AuthConfig) func(http.Handler) http.Handler {
+	if !cfg.Enabled() {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	var jwt *jwtValidator
+	if cfg.JWKSURL != "" {
+		jwt = newJWTValidator(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.URL.Path, "/partials/") && r.URL.Path != "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "missing token", "Send a bearer token in the Authorization header")
+				return
+			}
+
+			role := staticRole(cfg.Tokens, token)
+			actor := "token:" + role
+			if role == "" && jwt != nil {
+				var err error
+				if role, actor, err = jwt.validate(token); err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					writeError(w, http.StatusUnauthorized, err.Error(), "Invalid token")
+					return
+				}
+			}
+			if role == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "invalid token", "Invalid token")
+				return
+			}
+
+			if role != config.RoleAdmin {
+				if isMutating(r) {
+					writeError(w, http.StatusForbidden, "insufficient role", "Viewers cannot make changes")
+					return
+				}
+				r = withChangesDenied(r, "Viewers cannot make changes")
+			}
+
+			next.ServeHTTP(w, withActor(r, actor))
+		})
+	}
+}
+
+// staticRole returns the role of a static token, or "" if it is not one.
+// Every token is compared so the time taken does not reveal a match.
+func staticRole(tokens map[string]string, token string) string {
+	role := ""
+	for t, r := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			role = r
+		}
+	}
+	return role
+}
@@ -0,0 +1,378 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes of the RS, PS and ES algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched signing keys are used before
+	// the JWKS URL is asked again
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits refetches triggered by tokens signed
+	// with an unknown key
+	jwksMinRefreshInterval = time.Minute
+	// jwtLeeway allows for clock skew when checking exp and nbf
+	jwtLeeway = 30 * time.Second
+)
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errUnknownKey     = errors.New("token signed with an unknown key")
+	errBadSignature   = errors.New("invalid token signature")
+)
+
+// jwtValidator verifies JWTs against the keys of a JWKS URL and maps their
+// role claim to a config.Role*.
+type jwtValidator struct {
+	keys      *jwksCache
+	issuer    string
+	audience  string
+	roleClaim []string
+	adminRole string
+	now       func() time.Time
+}
+
+func newJWTValidator(cfg config.AuthConfig) *jwtValidator {
+	return &jwtValidator{
+		keys:      &jwksCache{url: cfg.JWKSURL, client: &http.Client{Timeout: 10 * time.Second}},
+		issuer:    cfg.Issuer,
+		audience:  cfg.Audience,
+		roleClaim: strings.Split(cfg.RoleClaim, "."),
+		adminRole: cfg.AdminRole,
+		now:       time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// validate checks the token's signature and claims and returns its role and
+// subject.
+func (v *jwtValidator) validate(token string) (string, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "", errMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", "", errMalformedToken
+	}
+
+	key, err := v.keys.key(header.Kid)
+	if err != nil {
+		return "", "", err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return "", "", err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", "", err
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return "", "", err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if slices.Contains(claimStrings(lookupClaim(claims, v.roleClaim)), v.adminRole) {
+		return config.RoleAdmin, subject, nil
+	}
+	return config.RoleViewer, subject, nil
+}
+
+func (v *jwtValidator) checkClaims(claims map[string]any) error {
+	now := v.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return fmt.Errorf("token issuer %v is not %s", claims["iss"], v.issuer)
+	}
+	if v.audience != "" && !slices.Contains(claimStrings(claims["aud"]), v.audience) {
+		return fmt.Errorf("token audience does not include %s", v.audience)
+	}
+	return nil
+}
+
+// lookupClaim follows a path of nested claim names.
+func lookupClaim(claims map[string]any, path []string) any {
+	var value any = claims
+	for _, name := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[name]
+	}
+	return value
+}
+
+// claimStrings returns a string claim or the strings of an array claim.
+func claimStrings(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errMalformedToken
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errMalformedToken
+	}
+	return nil
+}
+
+// verifySignature checks an RS*, PS* or ES* signature. Other algorithms,
+// including none and the HMAC ones, are rejected.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errBadSignature
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return errBadSignature
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errBadSignature
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errBadSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errBadSignature
+		}
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	return nil
+}
+
+// jwksCache holds the signing keys of a JWKS URL, refetched every
+// jwksRefreshInterval and when a token names an unknown key.
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// key returns the key with the given id. A token without a kid may use the
+// only key of a single-key set.
+func (c *jwksCache) key(kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetchedAt) > jwksRefreshInterval && time.Since(c.attemptedAt) > jwksMinRefreshInterval {
+		c.refresh()
+	}
+	if key := c.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	// The provider may have rotated its keys
+	if time.Since(c.attemptedAt) > jwksMinRefreshInterval {
+		c.refresh()
+		if key := c.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+	return nil, errUnknownKey
+}
+
+func (c *jwksCache) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key
+		}
+	}
+	return c.keys[kid]
+}
+
+// refresh fetches the key set. On failure the previous keys are kept.
+// Callers must hold c.mu.
+func (c *jwksCache) refresh() {
+	c.attemptedAt = time.Now()
+
+	keys, err := c.fetch()
+	if err != nil {
+		log.Printf("Failed to fetch JWKS from %s: %v", c.url, err)
+		return
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (c *jwksCache) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// jwtIssuer signs test tokens and serves its key as a JWKS.
+type jwtIssuer struct {
+	key  *rsa.PrivateKey
+	jwks *httptest.Server
+}
+
+func newJWTIssuer(t *testing.T) *jwtIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &jwtIssuer{key: key}
+	iss.jwks = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(iss.jwks.Close)
+	return iss
+}
+
+// token returns a token with the given header alg and claims, signed with
+// RS256 unless alg is something else, in which case the signature is
+// garbage.
+func (iss *jwtIssuer) token(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "none":
+	default:
+		sig = []byte("not a signature")
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuthJWT(t *testing.T) {
+	iss := newJWTIssuer(t)
+	handler := Auth(config.AuthConfig{
+		JWKSURL:   iss.jwks.URL,
+		RoleClaim: "realm_access.roles",
+		AdminRole: "supervisor-admin",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Actor(r)))
+	}))
+
+	now := time.Now()
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	admin := map[string]any{"realm_access": map[string]any{"roles": []string{"supervisor-admin"}}}
+
+	tampered := iss.token(t, "RS256", claims(admin))
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   int
+	}{
+		{"admin reads", http.MethodGet, iss.token(t, "RS256", claims(admin)), http.StatusOK},
+		{"admin changes", http.MethodPost, iss.token(t, "RS256", claims(admin)), http.StatusOK},
+		{"missing role claim reads as viewer", http.MethodGet, iss.token(t, "RS256", claims(nil)), http.StatusOK},
+		{"viewer cannot change", http.MethodPost, iss.token(t, "RS256", claims(nil)), http.StatusForbidden},
+		{"other role is viewer", http.MethodPost, iss.token(t, "RS256", claims(map[string]any{"realm_access": map[string]any{"roles": []string{"dev"}}})), http.StatusForbidden},
+		{"bad signature", http.MethodGet, tampered, http.StatusUnauthorized},
+		{"expired", http.MethodGet, iss.token(t, "RS256", claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})), http.StatusUnauthorized},
+		{"expired within leeway", http.MethodGet, iss.token(t, "RS256", claims(map[string]any{"exp": now.Add(-jwtLeeway / 2).Unix()})), http.StatusOK},
+		{"no expiry", http.MethodGet, iss.token(t, "RS256", map[string]any{"sub": "alice"}), http.StatusUnauthorized},
+		{"not valid yet", http.MethodGet, iss.token(t, "RS256", claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})), http.StatusUnauthorized},
+		{"HMAC algorithm", http.MethodGet, iss.token(t, "HS256", claims(admin)), http.StatusUnauthorized},
+		{"none algorithm", http.MethodGet, iss.token(t, "none", claims(admin)), http.StatusUnauthorized},
+		{"malformed", http.MethodGet, "not.a-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/processes/web/restart", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized && !strings.Contains(rec.Header().Get("WWW-Authenticate"), "invalid_token") {
+				t.Errorf("WWW-Authenticate = %q, want invalid_token", rec.Header().Get("WWW-Authenticate"))
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != "alice" {
+				t.Errorf("actor = %q, want the token's subject", rec.Body)
+			}
+		})
+	}
+}
+
+func TestJWTIssuerAndAudience(t *testing.T) {
+	v := &jwtValidator{issuer: "https://idp", audience: "supervisor", now: time.Now}
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		wantErr bool
+	}{
+		{"matching", map[string]any{"exp": exp, "iss": "https://idp", "aud": "supervisor"}, false},
+		{"audience in list", map[string]any{"exp": exp, "iss": "https://idp", "aud": []any{"other", "supervisor"}}, false},
+		{"wrong issuer", map[string]any{"exp": exp, "iss": "https://evil", "aud": "supervisor"}, true},
+		{"wrong audience", map[string]any{"exp": exp, "iss": "https://idp", "aud": "other"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.checkClaims(tt.claims); (err != nil) != tt.wantErr {
+				t.Errorf("checkClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// readOnlyAllowed lists the mutating routes still served in read-only mode
+// and on the public listener when an admin listener is configured,
+// as "METHOD template". Heartbeats come from the supervised processes
+// themselves, not from dashboard users, and a batch only runs GET requests.
+var readOnlyAllowed = map[string]bool{
+	"POST /api/processes/{name}/heartbeat": true,
+	"POST /api/batch":                      true,
+}
+
+// ReadOnly rejects every request that could change state with 403, except
+// for the routes in readOnlyAllowed. GET, HEAD and OPTIONS are served unless
+// listed in mutatingReads.
+func ReadOnly(next http.Handler) http.Handler {
+	return rejectMutating(next, "read-only mode", "This server is running in read-only mode")
+}
+
+// PublicOnly is ReadOnly for the public listener when mutating requests are
+// served on a separate admin listener.
+func PublicOnly(next http.Handler) http.Handler {
+	return rejectMutating(next, "admin port only", "Changes are only accepted on the admin port")
+}
+
+// safeModeAllowed lists the routes served while safe mode is active besides
+// those in readOnlyAllowed, so that it can be turned off again and alerts
+// silenced during the incident it was turned on for.
+var safeModeAllowed = map[string]bool{
+	"PUT /api/safe-mode":                   true,
+	"POST /api/processes/{name}/silence":   true,
+	"DELETE /api/processes/{name}/silence": true,
+}
+
+// SafeMode rejects requests that could change state with 423 Locked while
+// active reports true, whatever the caller's role. Reads and the routes in
+// readOnlyAllowed and safeModeAllowed are always served.
+func SafeMode(active func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !active() || !isMutating(r) || safeModeAllowed[r.Method+" "+routeTemplate(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeError(w, http.StatusLocked, "safe mode", "Safe mode is active; disable it with PUT /api/safe-mode to make changes")
+		})
+	}
+}
+
+func rejectMutating(next http.Handler, errMsg, message string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutating(r) {
+			next.ServeHTTP(w, withChangesDenied(r, message))
+			return
+		}
+		writeError(w, http.StatusForbidden, errMsg, message)
+	})
+}
+
+// mutatingReads lists the GET routes that can change state nonetheless.
+// A console writes to the process's stdin.
+var mutatingReads = map[string]bool{
+	"GET /api/processes/{name}/console": true,
+}
+
+// isMutating reports whether r could change state, i.e. is not a GET, HEAD
+// or OPTIONS request and not one of the routes in readOnlyAllowed, or is one
+// of the routes in mutatingReads.
+func isMutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return mutatingReads[r.Method+" "+routeTemplate(r)]
+	}
+
+	return !readOnlyAllowed[r.Method+" "+routeTemplate(r)]
+}
+
+type changesDeniedKey struct{}
+
+// withChangesDenied returns r noting why it may not change state, for
+// handlers that make changes over a connection opened with a GET request.
+func withChangesDenied(r *http.Request, reason string) *http.Request {
+	if ChangesDenied(r) != "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), changesDeniedKey{}, reason))
+}
+
+// ChangesDenied returns why the caller of r may not change state, i.e. why
+// a mutating request would have been rejected: the caller is a viewer, or
+// the server is read-only. It returns "" if changes are allowed. Safe mode
+// is not included as it can be turned on or off at any time; check it when
+// making the change.
+func ChangesDenied(r *http.Request) string {
+	reason, _ := r.Context().Value(changesDeniedKey{}).(string)
+	return reason
+}
+
+// routeTemplate returns the path template of the route r matched, or "".
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return ""
+}
+
+func writeError(w http.ResponseWriter, status int, errMsg, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":   errMsg,
+		"message": message,
+	})
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newSafeModeRouter(active *bool) *mux.Router {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router := mux.NewRouter()
+	router.Use(SafeMode(func() bool { return *active }))
+	router.Handle("/api/processes", ok).Methods(http.MethodGet)
+	router.Handle("/api/processes/{name}/start", ok).Methods(http.MethodPost)
+	router.Handle("/api/processes/{name}/console", ok).Methods(http.MethodGet)
+	router.Handle("/api/processes/{name}/heartbeat", ok).Methods(http.MethodPost)
+	router.Handle("/api/processes/{name}/silence", ok).Methods(http.MethodPost, http.MethodDelete)
+	router.Handle("/api/safe-mode", ok).Methods(http.MethodGet, http.MethodPut)
+	router.Handle("/api/batch", ok).Methods(http.MethodPost)
+	return router
+}
+
+func TestSafeMode(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/processes", http.StatusOK},
+		{http.MethodPost, "/api/processes/web/start", http.StatusLocked},
+		{http.MethodGet, "/api/processes/web/console", http.StatusLocked},
+		{http.MethodPost, "/api/processes/web/heartbeat", http.StatusOK},
+		{http.MethodPost, "/api/processes/web/silence", http.StatusOK},
+		{http.MethodDelete, "/api/processes/web/silence", http.StatusOK},
+		{http.MethodGet, "/api/safe-mode", http.StatusOK},
+		{http.MethodPut, "/api/safe-mode", http.StatusOK},
+		{http.MethodPost, "/api/batch", http.StatusOK},
+	}
+
+	active := true
+	router := newSafeModeRouter(&active)
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeModeInactive(t *testing.T) {
+	active := false
+	router := newSafeModeRouter(&active)
+
+	requests := []struct{ method, path string }{
+		{http.MethodPost, "/api/processes/web/start"},
+		{http.MethodGet, "/api/processes/web/console"},
+	}
+	for _, req := range requests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(req.method, req.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s status = %d, want %d", req.method, req.path, rec.Code, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Tracing starts a span per request, continuing any incoming trace context.
+// Spans are named after the matched route template, e.g.
+// "POST /api/processes/{name}/restart", and record status and latency.
+func Tracing(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					return r.Method + " " + tmpl
+				}
+			}
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
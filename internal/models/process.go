@@ -1,22 +1,120 @@
 package models
 
+import "time"
+
 // Process represents a supervised process
 type Process struct {
-	Name      string   `json:"name"`
-	Status    string   `json:"status"`
-	Pid       int      `json:"pid"`
-	Uptime    string   `json:"uptime"`
-	Memory    string   `json:"memory"`
-	CPU       string   `json:"cpu"`
-	Command   string   `json:"command"`
-	Args      []string `json:"args"`
-	Directory string   `json:"directory"`
+	Name      string            `json:"name"`
+	Status    string            `json:"status"`
+	Pid       int               `json:"pid"`
+	Uptime    string            `json:"uptime"`
+	Memory    string            `json:"memory"`
+	CPU       string            `json:"cpu"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args"`
+	Directory string            `json:"directory"`
+	Umask     string            `json:"umask,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// DisplayName is the name to show in the UI, if configured
+	DisplayName string `json:"display_name,omitempty"`
+	// LastHeartbeat is set for processes with a watchdog configured
+	LastHeartbeat string `json:"last_heartbeat,omitempty"`
+	// Health and LastHealthyAt are set for processes with a health check
+	Health        string `json:"health,omitempty"`
+	LastHealthyAt string `json:"last_healthy_at,omitempty"`
+	// NextRestartAt is when a pending automatic restart is due, jitter included
+	NextRestartAt string `json:"next_restart_at,omitempty"`
+	// BootStartAt is when an autostart delayed by boot_delay_seconds is due
+	BootStartAt string `json:"boot_start_at,omitempty"`
+	// Warnings lists detected problems, e.g. binary_missing
+	Warnings []string `json:"warnings,omitempty"`
+	// StartCondition is the last result of the start condition, if the
+	// process has one: unknown, met or unmet. StartPending is set while a
+	// start waits for it.
+	StartCondition          string `json:"start_condition,omitempty"`
+	StartConditionCheckedAt string `json:"start_condition_checked_at,omitempty"`
+	StartPending            bool   `json:"start_pending,omitempty"`
+	// PreStartCheckError is why the last pre-start check failed the start
+	PreStartCheckError string `json:"pre_start_check_error,omitempty"`
+	// Held is set while the process is held out of supervision
+	Held      bool   `json:"held"`
+	HeldSince string `json:"held_since,omitempty"`
+	// Silenced is set while the process's notifications are suppressed,
+	// until SilencedUntil
+	Silenced      bool   `json:"silenced"`
+	SilencedUntil string `json:"silenced_until,omitempty"`
+	// ExitCodes are the process's most recent exit codes, oldest first; -1
+	// stands for an exit by signal
+	ExitCodes []int `json:"exit_codes,omitempty"`
+	// StartupStderr is the first stderr output of the current or last run,
+	// set in the detail of a single process
+	StartupStderr []string `json:"startup_stderr,omitempty"`
+	// LogBufferSize and LogRetentionDays are the effective output buffer
+	// size and error log retention, set in the detail of a single process
+	LogBufferSize    int `json:"log_buffer_size,omitempty"`
+	LogRetentionDays int `json:"log_retention_days,omitempty"`
+	// Stats summarizes how long the process's starts and stops took
+	Stats *ProcessStats `json:"stats,omitempty"`
+}
+
+// ProcessSummary is the terse process status for scripts.
+type ProcessSummary struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// UptimeSeconds is 0 unless the process is running
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	// Restarts counts the starts after the first since the supervisor
+	// started, automatic or not
+	Restarts int `json:"restarts"`
+}
+
+// UsageHistory is the recent memory and CPU usage of a process.
+type UsageHistory struct {
+	Name            string        `json:"name"`
+	IntervalSeconds int           `json:"interval_seconds"`
+	Samples         []UsageSample `json:"samples"`
+}
+
+// UsageSample is the usage of a process at one point in time.
+type UsageSample struct {
+	Time        time.Time `json:"time"`
+	MemoryBytes int64     `json:"memory_bytes"`
+	CPUPercent  float64   `json:"cpu_percent"`
+}
+
+// ProcessStats are the start and stop durations of a process since the
+// supervisor started.
+type ProcessStats struct {
+	StartDuration DurationStats `json:"start_duration"`
+	StopDuration  DurationStats `json:"stop_duration"`
 }
 
+// DurationStats summarizes observed durations, in seconds.
+type DurationStats struct {
+	Count uint64  `json:"count"`
+	Last  float64 `json:"last_seconds"`
+	Mean  float64 `json:"mean_seconds"`
+	// RollingMean is the mean of the last 10 durations
+	RollingMean float64 `json:"rolling_mean_seconds"`
+	Max         float64 `json:"max_seconds"`
+}
+
+// Log entry sources
+const (
+	LogSourceOutput = "output" // a line written by a process
+	LogSourceSystem = "system" // a supervisor event
+)
+
 // LogEntry represents a log entry
 type LogEntry struct {
 	Timestamp string `json:"timestamp"`
 	Message   string `json:"message"`
 	Level     string `json:"level"`
 	Worker    string `json:"worker,omitempty"`
+	Source    string `json:"source"`
+	// CorrelationID is extracted from output lines by correlation_pattern
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// SinceStart is the time from the start of the process instance to an
+	// output line, set with log_since_start
+	SinceStart string `json:"since_start,omitempty"`
 }
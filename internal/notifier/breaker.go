@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calls to a failing target. It opens after threshold
+// consecutive failures, rejects calls for cooldown, then lets a single trial
+// call through (half-open) whose outcome closes or re-opens it.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		now:       time.Now,
+	}
+}
+
+// State returns the current breaker state.
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Allow reports whether a call may proceed. The from/to states are set when
+// the call caused a transition (open -> half-open once the cooldown elapsed).
+func (cb *CircuitBreaker) Allow() (ok bool, from, to string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return false, "", ""
+		}
+		cb.state = BreakerHalfOpen
+		return true, BreakerOpen, BreakerHalfOpen
+	case BreakerHalfOpen:
+		// A trial call is already in flight
+		return false, "", ""
+	default:
+		return true, "", ""
+	}
+}
+
+// Success records a successful call and returns the transition, if any.
+func (cb *CircuitBreaker) Success() (from, to string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	if cb.state == BreakerClosed {
+		return "", ""
+	}
+	from, cb.state = cb.state, BreakerClosed
+	return from, BreakerClosed
+}
+
+// Failure records a failed call and returns the transition, if any.
+func (cb *CircuitBreaker) Failure() (from, to string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.state == BreakerHalfOpen || (cb.state == BreakerClosed && cb.failures >= cb.threshold) {
+		from, cb.state = cb.state, BreakerOpen
+		cb.openedAt = cb.now()
+		return from, BreakerOpen
+	}
+	return "", ""
+}
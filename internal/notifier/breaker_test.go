@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"pupervisor/internal/storage"
+)
+
+// fakeTarget fails its deliveries while err is set.
+type fakeTarget struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (t *fakeTarget) Name() string {
+	if t.name == "" {
+		return "fake"
+	}
+	return t.name
+}
+
+func (t *fakeTarget) Send(ctx context.Context, event Event) error {
+	t.calls++
+	return t.err
+}
+
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	store, err := storage.New(filepath.Join(t.TempDir(), "test.db"), storage.Options{BusyTimeout: 5000})
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const cooldown = time.Minute
+	errDown := errors.New("connection refused")
+
+	type step struct {
+		wait   time.Duration // advanced before the delivery
+		err    error
+		state  string
+		called bool
+		rows   []string // notification statuses recorded by the delivery
+	}
+	opening := []step{
+		{err: errDown, state: BreakerClosed, called: true, rows: []string{"failed"}},
+		{err: errDown, state: BreakerOpen, called: true, rows: []string{"failed", "breaker_open"}},
+		{wait: cooldown / 2, state: BreakerOpen, rows: []string{"skipped"}},
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "trial success closes",
+			steps: append(slices.Clone(opening),
+				step{wait: cooldown, state: BreakerClosed, called: true, rows: []string{"breaker_half-open", "sent", "breaker_closed"}},
+				step{err: errDown, state: BreakerClosed, called: true, rows: []string{"failed"}},
+			),
+		},
+		{
+			name: "trial failure re-opens",
+			steps: append(slices.Clone(opening),
+				step{wait: cooldown, err: errDown, state: BreakerOpen, called: true, rows: []string{"breaker_half-open", "failed", "breaker_open"}},
+				step{wait: cooldown / 2, state: BreakerOpen, rows: []string{"skipped"}},
+				step{wait: cooldown, state: BreakerClosed, called: true, rows: []string{"breaker_half-open", "sent", "breaker_closed"}},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStorage(t)
+			target := &fakeTarget{}
+			n := New([]Target{target}, 2, cooldown, store)
+			gt := n.targets[0]
+
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			gt.breaker.now = func() time.Time { return now }
+
+			var seen int
+			for i, s := range tt.steps {
+				now = now.Add(s.wait)
+				target.err = s.err
+				calls := target.calls
+
+				n.deliver(gt, Event{Type: "crash", Process: "web"})
+
+				if got := gt.breaker.State(); got != s.state {
+					t.Errorf("step %d: state = %s, want %s", i, got, s.state)
+				}
+				if called := target.calls > calls; called != s.called {
+					t.Errorf("step %d: target called = %v, want %v", i, called, s.called)
+				}
+
+				rows, err := store.GetNotifications(100)
+				if err != nil {
+					t.Fatalf("GetNotifications: %v", err)
+				}
+				slices.Reverse(rows)
+				var statuses []string
+				for _, row := range rows[seen:] {
+					statuses = append(statuses, row.Status)
+				}
+				seen = len(rows)
+				if !slices.Equal(statuses, s.rows) {
+					t.Errorf("step %d: recorded %v, want %v", i, statuses, s.rows)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	now := time.Now()
+	cb := NewCircuitBreaker(1, time.Second)
+	cb.now = func() time.Time { return now }
+
+	cb.Failure()
+	now = now.Add(time.Second)
+
+	if ok, from, to := cb.Allow(); !ok || from != BreakerOpen || to != BreakerHalfOpen {
+		t.Fatalf("Allow() = %v, %q, %q, want a trial call and open -> half-open", ok, from, to)
+	}
+	if ok, _, _ := cb.Allow(); ok {
+		t.Error("second call allowed while the trial is in flight")
+	}
+}
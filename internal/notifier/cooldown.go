@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"sync"
+	"time"
+)
+
+type cooldownState struct {
+	notifiedAt time.Time
+	suppressed int
+}
+
+// cooldowns lets through at most one event per process within the event's
+// Cooldown and counts the crashes held back, which are reported on the next
+// event let through.
+type cooldowns struct {
+	mu   sync.Mutex
+	seen map[string]*cooldownState
+	now  func() time.Time
+}
+
+func newCooldowns() *cooldowns {
+	return &cooldowns{
+		seen: make(map[string]*cooldownState),
+		now:  time.Now,
+	}
+}
+
+// allow reports whether the event may be sent and, if so, how many crashes
+// were held back since the last one. Events without a Cooldown are always
+// allowed and do not start one.
+func (c *cooldowns) allow(event Event) (bool, int) {
+	if event.Cooldown <= 0 {
+		return true, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	cs, ok := c.seen[event.Process]
+	if ok && now.Sub(cs.notifiedAt) < event.Cooldown {
+		// A summary stands for the crashes it counts
+		cs.suppressed += max(event.Count, 1)
+		return false, 0
+	}
+
+	suppressed := 0
+	if ok {
+		suppressed = cs.suppressed
+	}
+	c.seen[event.Process] = &cooldownState{notifiedAt: now}
+	return true, suppressed
+}
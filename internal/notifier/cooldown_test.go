@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"pupervisor/internal/storage"
+)
+
+func TestCooldowns(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCooldowns()
+	c.now = func() time.Time { return now }
+
+	tests := []struct {
+		name           string
+		after          time.Duration
+		event          Event
+		wantOK         bool
+		wantSuppressed int
+	}{
+		{"first alert", 0, Event{Process: "web", Cooldown: time.Minute}, true, 0},
+		{"within cooldown", 10 * time.Second, Event{Process: "web", Cooldown: time.Minute}, false, 0},
+		{"summary within cooldown", 10 * time.Second, Event{Process: "web", Count: 3, Cooldown: time.Minute}, false, 0},
+		{"other process", 0, Event{Process: "worker", Cooldown: time.Minute}, true, 0},
+		{"without cooldown", 0, Event{Process: "web"}, true, 0},
+		{"after cooldown", time.Minute, Event{Process: "web", Cooldown: time.Minute}, true, 4},
+		{"cooldown restarted", 30 * time.Second, Event{Process: "web", Cooldown: time.Minute}, false, 0},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+		ok, suppressed := c.allow(tt.event)
+		if ok != tt.wantOK || suppressed != tt.wantSuppressed {
+			t.Errorf("%s: allow() = %v, %d, want %v, %d", tt.name, ok, suppressed, tt.wantOK, tt.wantSuppressed)
+		}
+	}
+}
+
+func TestNotifyCooldown(t *testing.T) {
+	target := newCaptureTarget("hook")
+	n := New([]Target{target}, 1, time.Hour, nil)
+	now := time.Now()
+	n.cooldowns.now = func() time.Time { return now }
+
+	crash := Event{Type: "crash", Process: "web", Message: "Process web crashed", Cooldown: time.Minute}
+	n.Notify(crash)
+	if event := target.next(t); event.Suppressed != 0 {
+		t.Errorf("first alert Suppressed = %d, want 0", event.Suppressed)
+	}
+
+	n.Notify(crash)
+	n.Notify(crash)
+	now = now.Add(time.Minute)
+	n.Notify(crash)
+
+	event := target.next(t)
+	if event.Suppressed != 2 || !strings.HasSuffix(event.Message, "(2 more crash(es) since the last alert)") {
+		t.Errorf("alert after the cooldown = %q with Suppressed %d, want 2 crashes reported", event.Message, event.Suppressed)
+	}
+	select {
+	case event := <-target.events:
+		t.Errorf("unexpected event sent: %+v", event)
+	default:
+	}
+}
+
+// skippedDetails waits until store holds want notifications and returns the
+// details of the skipped ones.
+func skippedDetails(t *testing.T, store *storage.Storage, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rows, err := store.GetNotifications(100)
+		if err != nil {
+			t.Fatalf("GetNotifications: %v", err)
+		}
+		if len(rows) >= want {
+			var details []string
+			for _, row := range rows {
+				if row.Status == "skipped" {
+					details = append(details, row.Detail)
+				}
+			}
+			return details
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d notifications recorded, want %d", len(rows), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNotifyCooldownRecordsSkips(t *testing.T) {
+	store := newTestStorage(t)
+	target := newCaptureTarget("hook")
+	n := New([]Target{target}, 1, time.Hour, store)
+
+	crash := Event{Type: "crash", Process: "web", Message: "Process web crashed", Cooldown: time.Minute}
+	n.Notify(crash)
+	target.next(t)
+	n.Notify(crash)
+
+	if details := skippedDetails(t, store, 2); !slices.Equal(details, []string{"notify cooldown"}) {
+		t.Errorf("skipped notifications = %q, want one for the notify cooldown", details)
+	}
+}
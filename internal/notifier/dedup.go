@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventCrashSummary reports crashes that were suppressed as duplicates.
+const EventCrashSummary = "crash_summary"
+
+type fingerprintState struct {
+	notifiedAt time.Time
+	suppressed int
+	last       Event
+}
+
+// deduplicator lets the first event of each fingerprint through and counts
+// repeats within window, which are reported later as a single summary.
+type deduplicator struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*fingerprintState
+	now    func() time.Time
+}
+
+func newDeduplicator(window time.Duration) *deduplicator {
+	return &deduplicator{
+		window: window,
+		seen:   make(map[string]*fingerprintState),
+		now:    time.Now,
+	}
+}
+
+// suppress reports whether the event repeats a fingerprint already notified
+// within the window. Events without a fingerprint are never suppressed.
+func (d *deduplicator) suppress(event Event) bool {
+	if event.Fingerprint == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	fs, ok := d.seen[event.Fingerprint]
+	if ok && now.Sub(fs.notifiedAt) < d.window {
+		fs.suppressed++
+		fs.last = event
+		return true
+	}
+
+	// Repeats from the previous window still get their summary
+	suppressed, last := 0, Event{}
+	if ok {
+		suppressed, last = fs.suppressed, fs.last
+	}
+	d.seen[event.Fingerprint] = &fingerprintState{
+		notifiedAt: now,
+		suppressed: suppressed,
+		last:       last,
+	}
+	return false
+}
+
+// summaries returns one summary event per fingerprint with suppressed
+// repeats, resets their counts and forgets fingerprints whose window has
+// passed.
+func (d *deduplicator) summaries() []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	var events []Event
+	for fingerprint, fs := range d.seen {
+		if fs.suppressed > 0 {
+			summary := fs.last
+			summary.Type = EventCrashSummary
+			summary.Count = fs.suppressed
+			summary.Message = fmt.Sprintf("Process %s crash %s seen %d more time(s)", fs.last.Process, fingerprint, fs.suppressed)
+			summary.Time = now
+			events = append(events, summary)
+			fs.suppressed = 0
+		}
+		if now.Sub(fs.notifiedAt) >= d.window {
+			delete(d.seen, fingerprint)
+		}
+	}
+	return events
+}
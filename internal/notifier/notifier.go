@@ -0,0 +1,403 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+)
+
+const redactedPlaceholder = "[REDACTED]"
+
+// Event is a notification about something that happened to a process.
+type Event struct {
+	Type     string    `json:"type"`
+	Process  string    `json:"process"`
+	Message  string    `json:"message"`
+	ExitCode int       `json:"exit_code,omitempty"`
+	Signal   string    `json:"signal,omitempty"`
+	Time     time.Time `json:"time"`
+	// Logs holds the process's last output lines, redacted before delivery
+	Logs []string `json:"logs,omitempty"`
+	// LastHealthyAt is set on health events when the process was ever healthy
+	LastHealthyAt *time.Time `json:"last_healthy_at,omitempty"`
+	// Fingerprint identifies crashes with the same cause; Count is how many
+	// were suppressed on a crash_summary event
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Count       int    `json:"count,omitempty"`
+	// Suppressed is how many crashes the process's notify cooldown held
+	// back since its previous alert
+	Suppressed int `json:"suppressed,omitempty"`
+	// Cooldown, when set, is the least time between alerts about the
+	// process; events within it are recorded as skipped instead of sent
+	Cooldown time.Duration `json:"-"`
+	// Channels names the targets to deliver to instead of the default
+	// ones, see Notifier.SetDefaultChannels
+	Channels []string `json:"-"`
+}
+
+// Target delivers events to a single destination. Send is responsible for
+// bounding its own duration.
+type Target interface {
+	Name() string
+	Send(ctx context.Context, event Event) error
+}
+
+// WebhookTarget POSTs events as JSON to a URL, retrying failed deliveries
+// according to its RetryPolicy.
+type WebhookTarget struct {
+	name   string
+	url    string
+	retry  RetryPolicy
+	client *http.Client
+}
+
+func NewWebhookTarget(name, url string, retry RetryPolicy) *WebhookTarget {
+	if name == "" {
+		name = url
+	}
+	return &WebhookTarget{
+		name:   name,
+		url:    url,
+		retry:  retry,
+		client: &http.Client{},
+	}
+}
+
+func (t *WebhookTarget) Name() string {
+	return t.name
+}
+
+func (t *WebhookTarget) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	attempts := max(t.retry.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		resp, err := t.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *webhookStatusError
+		if errors.As(err, &statusErr) && !t.retry.retryable(statusErr.status) {
+			return err
+		}
+		if attempt == attempts {
+			if attempts > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempts)
+			}
+			return err
+		}
+
+		select {
+		case <-time.After(t.retry.backoff(attempt, resp)):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry cancelled: %v)", err, ctx.Err())
+		}
+	}
+}
+
+// webhookStatusError is returned for a response with a non-2xx status.
+type webhookStatusError struct {
+	status int
+	text   string
+}
+
+func (e *webhookStatusError) Error() string {
+	return "webhook returned " + e.text
+}
+
+// post makes a single delivery attempt. On a non-2xx status the response is
+// returned, with its body closed, so its Retry-After header can be read.
+func (t *WebhookTarget) post(ctx context.Context, body []byte) (*http.Response, error) {
+	if t.retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.retry.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp, &webhookStatusError{status: resp.StatusCode, text: resp.Status}
+	}
+	return resp, nil
+}
+
+type guardedTarget struct {
+	target  Target
+	breaker *CircuitBreaker
+}
+
+// Notifier fans events out to its targets. Each target sits behind its own
+// circuit breaker so a dead endpoint is not called on every crash.
+type Notifier struct {
+	mu      sync.RWMutex
+	targets []*guardedTarget
+	// threshold and cooldown configure the breakers of new targets, retry
+	// the deliveries of webhooks set with SetWebhooks
+	threshold int
+	cooldown  time.Duration
+	retry     RetryPolicy
+	storage   *storage.Storage
+	logLines  int
+	redact    []*regexp.Regexp
+	dedup     *deduplicator
+	cooldowns *cooldowns
+	silences  *silences
+	// defaults are the targets of events without channels; empty means all
+	defaults []string
+}
+
+func New(targets []Target, threshold int, cooldown time.Duration, store *storage.Storage) *Notifier {
+	n := &Notifier{threshold: threshold, cooldown: cooldown, storage: store, cooldowns: newCooldowns(), silences: newSilences()}
+	n.SetTargets(targets)
+	return n
+}
+
+// SetTargets replaces the targets events are delivered to. A target with
+// the same name as a current one keeps its circuit breaker state.
+func (n *Notifier) SetTargets(targets []Target) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	breakers := make(map[string]*CircuitBreaker, len(n.targets))
+	for _, gt := range n.targets {
+		breakers[gt.target.Name()] = gt.breaker
+	}
+
+	guarded := make([]*guardedTarget, 0, len(targets))
+	for _, t := range targets {
+		breaker, ok := breakers[t.Name()]
+		if !ok {
+			breaker = NewCircuitBreaker(n.threshold, n.cooldown)
+		}
+		guarded = append(guarded, &guardedTarget{target: t, breaker: breaker})
+	}
+	n.targets = guarded
+}
+
+// SetWebhooks replaces the targets with the given webhooks, delivered with
+// the configured retry policy.
+func (n *Notifier) SetWebhooks(webhooks []config.WebhookConfig) {
+	if n == nil {
+		return
+	}
+	n.SetTargets(webhookTargets(webhooks, n.retry))
+}
+
+// SetDefaultChannels names the targets that get events without channels of
+// their own. With none set, or none of them among the targets, they go to
+// every target.
+func (n *Notifier) SetDefaultChannels(names []string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.defaults = names
+}
+
+func webhookTargets(webhooks []config.WebhookConfig, retry RetryPolicy) []Target {
+	var targets []Target
+	for _, wh := range webhooks {
+		targets = append(targets, NewWebhookTarget(wh.Name, wh.URL, retry))
+	}
+	return targets
+}
+
+// FromConfig builds a notifier for the configured webhooks. Redaction
+// patterns are validated when the config is loaded; invalid ones are skipped.
+func FromConfig(cfg config.NotificationConfig, store *storage.Storage) *Notifier {
+	retry := RetryPolicyFromConfig(cfg.Retry)
+	n := New(webhookTargets(cfg.Webhooks, retry), cfg.FailureThreshold, time.Duration(cfg.Cooldown)*time.Second, store)
+	n.retry = retry
+	n.defaults = cfg.Default
+	n.logLines = cfg.LogLines
+	for _, pattern := range cfg.Redact {
+		if re, err := regexp.Compile(pattern); err == nil {
+			n.redact = append(n.redact, re)
+		}
+	}
+	if cfg.DedupWindow > 0 {
+		n.dedup = newDeduplicator(time.Duration(cfg.DedupWindow) * time.Second)
+		go n.sendSummaries(time.Duration(cfg.SummaryInterval) * time.Second)
+	}
+	return n
+}
+
+// sendSummaries periodically reports crashes suppressed as duplicates.
+func (n *Notifier) sendSummaries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, event := range n.dedup.summaries() {
+			n.send(event)
+		}
+	}
+}
+
+// LogLines is how many recent output lines to attach to crash events.
+func (n *Notifier) LogLines() int {
+	if n == nil {
+		return 0
+	}
+	return n.logLines
+}
+
+// Redact masks every match of the redaction patterns in s.
+func (n *Notifier) Redact(s string) string {
+	for _, re := range n.redact {
+		s = re.ReplaceAllString(s, redactedPlaceholder)
+	}
+	return s
+}
+
+// Notify delivers the event to every target in the background. Repeats of a
+// crash fingerprint within the dedup window are held back for the next
+// summary, and events of silenced processes or within the process's notify
+// cooldown are skipped.
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if n.dedup != nil && n.dedup.suppress(event) {
+		return
+	}
+	n.send(event)
+}
+
+func (n *Notifier) send(event Event) {
+	if event.Process != "" && n.silences.active(event.Process) {
+		n.skip(event, "silenced")
+		return
+	}
+	ok, suppressed := n.cooldowns.allow(event)
+	if !ok {
+		n.skip(event, "notify cooldown")
+		return
+	}
+	if suppressed > 0 {
+		event.Suppressed = suppressed
+		event.Message += fmt.Sprintf(" (%d more crash(es) since the last alert)", suppressed)
+	}
+
+	event.Message = n.Redact(event.Message)
+	if len(event.Logs) > 0 {
+		logs := make([]string, len(event.Logs))
+		for i, line := range event.Logs {
+			logs[i] = n.Redact(line)
+		}
+		event.Logs = logs
+	}
+
+	n.mu.RLock()
+	targets := n.route(event.Channels)
+	n.mu.RUnlock()
+
+	for _, gt := range targets {
+		go n.deliver(gt, event)
+	}
+}
+
+// skip records the event as skipped for each target it would go to. Like
+// deliveries, the records are saved in the background, as Notify is called
+// with the process manager's lock held.
+func (n *Notifier) skip(event Event, reason string) {
+	n.mu.RLock()
+	targets := n.route(event.Channels)
+	n.mu.RUnlock()
+	go func() {
+		for _, gt := range targets {
+			n.record(gt.target.Name(), event, "skipped", reason)
+		}
+	}()
+}
+
+// route returns the targets named in channels, falling back to the default
+// targets and then to all of them when none of the names match, e.g. while
+// the webhook_url setting replaces the configured webhooks. Callers must
+// hold n.mu.
+func (n *Notifier) route(channels []string) []*guardedTarget {
+	for _, names := range [][]string{channels, n.defaults} {
+		var routed []*guardedTarget
+		for _, gt := range n.targets {
+			if slices.Contains(names, gt.target.Name()) {
+				routed = append(routed, gt)
+			}
+		}
+		if len(routed) > 0 {
+			return routed
+		}
+	}
+	return n.targets
+}
+
+func (n *Notifier) deliver(gt *guardedTarget, event Event) {
+	name := gt.target.Name()
+
+	ok, from, to := gt.breaker.Allow()
+	n.recordTransition(name, event, from, to)
+	if !ok {
+		n.record(name, event, "skipped", "circuit breaker open")
+		return
+	}
+
+	if err := gt.target.Send(context.Background(), event); err != nil {
+		log.Printf("Notification to %s failed: %v", name, err)
+		n.record(name, event, "failed", err.Error())
+		from, to = gt.breaker.Failure()
+		n.recordTransition(name, event, from, to)
+		return
+	}
+
+	n.record(name, event, "sent", "")
+	from, to = gt.breaker.Success()
+	n.recordTransition(name, event, from, to)
+}
+
+func (n *Notifier) recordTransition(target string, event Event, from, to string) {
+	if to == "" {
+		return
+	}
+	log.Printf("Notification circuit breaker for %s: %s -> %s", target, from, to)
+	n.record(target, event, "breaker_"+to, fmt.Sprintf("circuit breaker %s -> %s", from, to))
+}
+
+func (n *Notifier) record(target string, event Event, status, detail string) {
+	if n.storage == nil {
+		return
+	}
+	if err := n.storage.SaveNotification(&storage.Notification{
+		Target:      target,
+		EventType:   event.Type,
+		ProcessName: event.Process,
+		Status:      status,
+		Detail:      detail,
+	}); err != nil {
+		log.Printf("Failed to record notification: %v", err)
+	}
+}
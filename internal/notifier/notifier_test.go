@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// captureTarget hands every event it is sent to the test.
+type captureTarget struct {
+	name   string
+	events chan Event
+}
+
+func newCaptureTarget(name string) *captureTarget {
+	return &captureTarget{name: name, events: make(chan Event, 16)}
+}
+
+func (t *captureTarget) Name() string { return t.name }
+
+func (t *captureTarget) Send(ctx context.Context, event Event) error {
+	t.events <- event
+	return nil
+}
+
+// next returns the next event sent to the target.
+func (t *captureTarget) next(tb testing.TB) Event {
+	tb.Helper()
+	select {
+	case event := <-t.events:
+		return event
+	case <-time.After(5 * time.Second):
+		tb.Fatalf("no event sent to %s", t.name)
+		return Event{}
+	}
+}
+
+func TestNotifyRedactsMessageAndLogs(t *testing.T) {
+	n := FromConfig(config.NotificationConfig{
+		LogLines: 5,
+		Redact:   []string{`token=\S+`, `[0-9]{4}-[0-9]{4}`},
+	}, nil)
+	target := newCaptureTarget("hook")
+	n.SetTargets([]Target{target})
+
+	n.Notify(Event{
+		Type:    "crash",
+		Process: "web",
+		Message: "Process web crashed with token=abc123",
+		Logs:    []string{"connecting token=s3cret", "card 1234-5678 declined", "exit"},
+	})
+
+	event := target.next(t)
+	if want := "Process web crashed with [REDACTED]"; event.Message != want {
+		t.Errorf("Message = %q, want %q", event.Message, want)
+	}
+	want := []string{"connecting [REDACTED]", "card [REDACTED] declined", "exit"}
+	if !slices.Equal(event.Logs, want) {
+		t.Errorf("Logs = %q, want %q", event.Logs, want)
+	}
+	if got := n.LogLines(); got != 5 {
+		t.Errorf("LogLines() = %d, want 5", got)
+	}
+}
+
+func TestFromConfigSkipsInvalidRedactPatterns(t *testing.T) {
+	n := FromConfig(config.NotificationConfig{Redact: []string{`(`, `secret`}}, nil)
+	if got, want := n.Redact("a secret ("), "a [REDACTED] ("; got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+}
+
+func TestSetTargetsKeepsBreakerState(t *testing.T) {
+	down := &fakeTarget{name: "down", err: errors.New("connection refused")}
+	n := New([]Target{down}, 1, time.Hour, nil)
+	n.deliver(n.targets[0], Event{Type: "crash", Process: "web"})
+	if got := n.targets[0].breaker.State(); got != BreakerOpen {
+		t.Fatalf("breaker state = %s, want %s", got, BreakerOpen)
+	}
+
+	// The replacement of "down" keeps its open breaker; "new" starts closed
+	n.SetTargets([]Target{&fakeTarget{name: "down"}, &fakeTarget{name: "new"}})
+	want := map[string]string{"down": BreakerOpen, "new": BreakerClosed}
+	for _, gt := range n.targets {
+		if got := gt.breaker.State(); got != want[gt.target.Name()] {
+			t.Errorf("%s: breaker state = %s, want %s", gt.target.Name(), got, want[gt.target.Name()])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// RetryPolicy controls how a webhook delivery is retried.
+type RetryPolicy struct {
+	MaxAttempts int           // including the first attempt
+	Timeout     time.Duration // per attempt
+	BackoffBase time.Duration // before the first retry, doubled for each next one
+	BackoffMax  time.Duration // caps the backoff and Retry-After
+	// RetryStatus lists retryable status codes such as "429" and classes
+	// such as "5xx"
+	RetryStatus []string
+}
+
+// RetryPolicyFromConfig converts the retry settings of the config file.
+func RetryPolicyFromConfig(cfg config.WebhookRetryConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: cfg.MaxAttempts,
+		Timeout:     time.Duration(cfg.Timeout) * time.Second,
+		BackoffBase: time.Duration(cfg.BackoffBase) * time.Second,
+		BackoffMax:  time.Duration(cfg.BackoffMax) * time.Second,
+		RetryStatus: cfg.RetryStatus,
+	}
+}
+
+// retryable reports whether a response with the given status is retried.
+func (p RetryPolicy) retryable(status int) bool {
+	for _, pattern := range p.RetryStatus {
+		if len(pattern) == 3 && pattern[1:] == "xx" {
+			if status/100 == int(pattern[0]-'0') {
+				return true
+			}
+		} else if code, err := strconv.Atoi(pattern); err == nil && code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the given retry (1 for the first),
+// preferring the response's Retry-After header when it has one.
+func (p RetryPolicy) backoff(retry int, resp *http.Response) time.Duration {
+	wait := p.BackoffBase << (retry - 1)
+	if wait <= 0 || wait > p.BackoffMax { // <= 0 on overflow
+		wait = p.BackoffMax
+	}
+
+	if resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			wait = min(after, p.BackoffMax)
+		}
+	}
+	return wait
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
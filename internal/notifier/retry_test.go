@@ -0,0 +1,102 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookRetry(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 3,
+		Timeout:     time.Second,
+		BackoffBase: time.Millisecond,
+		BackoffMax:  10 * time.Millisecond,
+		RetryStatus: []string{"5xx", "429"},
+	}
+
+	tests := []struct {
+		name      string
+		statuses  []int // of successive attempts; the last one repeats
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"success", []int{200}, 1, false},
+		{"5xx retried until success", []int{503, 500, 204}, 3, false},
+		{"429 retried", []int{429, 200}, 2, false},
+		{"other 4xx not retried", []int{404}, 1, true},
+		{"400 after a retry stops", []int{502, 400}, 2, true},
+		{"stops at max attempts", []int{500}, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer srv.Close()
+
+			err := NewWebhookTarget("hook", srv.URL, policy).Send(context.Background(), Event{Type: "crash"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("attempts = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWebhookRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	policy := RetryPolicy{MaxAttempts: 2, BackoffBase: time.Millisecond, BackoffMax: 5 * time.Second, RetryStatus: []string{"429"}}
+	start := time.Now()
+	if err := NewWebhookTarget("hook", srv.URL, policy).Send(context.Background(), Event{Type: "crash"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the Retry-After of 1s", elapsed)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{BackoffBase: time.Second, BackoffMax: 10 * time.Second}
+	withHeader := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {value}}}
+	}
+
+	tests := []struct {
+		name  string
+		retry int
+		resp  *http.Response
+		want  time.Duration
+	}{
+		{"first retry", 1, nil, time.Second},
+		{"doubles", 3, nil, 4 * time.Second},
+		{"capped", 5, nil, 10 * time.Second},
+		{"overflow capped", 70, nil, 10 * time.Second},
+		{"Retry-After seconds", 1, withHeader("3"), 3 * time.Second},
+		{"Retry-After capped", 1, withHeader("60"), 10 * time.Second},
+		{"Retry-After past date", 2, withHeader("Mon, 02 Jan 2006 15:04:05 GMT"), 0},
+		{"invalid Retry-After ignored", 2, withHeader("soon"), 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.backoff(tt.retry, tt.resp); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.retry, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package notifier
+
+import (
+	"sync"
+	"time"
+)
+
+// silences hold back every event of a process until a given time, e.g.
+// during a known incident.
+type silences struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+	now   func() time.Time
+}
+
+func newSilences() *silences {
+	return &silences{
+		until: make(map[string]time.Time),
+		now:   time.Now,
+	}
+}
+
+// active reports whether events of process are silenced, forgetting a
+// silence that has ended.
+func (s *silences) active(process string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.until[process]
+	if !ok {
+		return false
+	}
+	if !s.now().Before(until) {
+		delete(s.until, process)
+		return false
+	}
+	return true
+}
+
+// Silence holds back the events of process until the given time, replacing
+// any earlier silence. Events held back are recorded as skipped.
+func (n *Notifier) Silence(process string, until time.Time) {
+	n.silences.mu.Lock()
+	n.silences.until[process] = until
+	n.silences.mu.Unlock()
+}
+
+// Unsilence lets the events of process through again.
+func (n *Notifier) Unsilence(process string) {
+	n.silences.mu.Lock()
+	delete(n.silences.until, process)
+	n.silences.mu.Unlock()
+}
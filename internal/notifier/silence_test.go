@@ -0,0 +1,70 @@
+package notifier
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSilences(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newSilences()
+	s.now = func() time.Time { return now }
+	s.until["web"] = now.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		after   time.Duration
+		process string
+		want    bool
+	}{
+		{"silenced", 0, "web", true},
+		{"other process", 0, "worker", false},
+		{"before the end", 59 * time.Second, "web", true},
+		{"at the end", time.Second, "web", false},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+		if got := s.active(tt.process); got != tt.want {
+			t.Errorf("%s: active(%q) = %v, want %v", tt.name, tt.process, got, tt.want)
+		}
+	}
+	if _, ok := s.until["web"]; ok {
+		t.Error("ended silence not forgotten")
+	}
+}
+
+func TestSilence(t *testing.T) {
+	target := newCaptureTarget("hook")
+	n := New([]Target{target}, 1, time.Hour, nil)
+
+	n.Silence("web", time.Now().Add(time.Hour))
+	n.send(Event{Type: "crash", Process: "web", Message: "Process web crashed"})
+	n.send(Event{Type: "crash", Process: "worker", Message: "Process worker crashed"})
+	if event := target.next(t); event.Process != "worker" {
+		t.Errorf("event of %q sent while web is silenced, want worker", event.Process)
+	}
+
+	n.Unsilence("web")
+	n.send(Event{Type: "crash", Process: "web", Message: "Process web crashed"})
+	if event := target.next(t); event.Process != "web" {
+		t.Errorf("event of %q sent after unsilencing, want web", event.Process)
+	}
+	select {
+	case event := <-target.events:
+		t.Errorf("unexpected event sent: %+v", event)
+	default:
+	}
+}
+
+func TestSilenceRecordsSkips(t *testing.T) {
+	store := newTestStorage(t)
+	n := New([]Target{newCaptureTarget("hook"), newCaptureTarget("pager")}, 1, time.Hour, store)
+
+	n.Silence("web", time.Now().Add(time.Hour))
+	n.Notify(Event{Type: "crash", Process: "web", Message: "Process web crashed"})
+
+	if details := skippedDetails(t, store, 2); !slices.Equal(details, []string{"silenced", "silenced"}) {
+		t.Errorf("skipped notifications = %q, want one per target for the silence", details)
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+
+	"pupervisor/internal/config"
+)
+
+// SetCommandAllowlist restricts the binaries processes may run, see
+// config.CheckCommandAllowed. It is checked before every spawn and config
+// reload.
+func (pm *ProcessManager) SetCommandAllowlist(allowlist []string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.allowlist = allowlist
+}
+
+// checkCommandAllowed checks a resolved process config against allowlist, a
+// copy of pm.allowlist, recording a denial in the error log as an audit
+// entry. Callers must not hold pm.mu, as the entry is written to storage.
+func (pm *ProcessManager) checkCommandAllowed(allowlist []string, cfg config.ProcessConfig) error {
+	err := config.CheckCommandAllowed(allowlist, cfg)
+	if err == nil {
+		return nil
+	}
+
+	pm.log("error", fmt.Sprintf("Denied spawning process %s: %v", cfg.Name, err), cfg.Name)
+	if pm.storage != nil {
+		if saveErr := pm.storage.SaveError("audit", cfg.Name, err.Error()); saveErr != nil {
+			pm.log("error", fmt.Sprintf("Failed to record denied command of %s: %v", cfg.Name, saveErr), cfg.Name)
+		}
+	}
+	return err
+}
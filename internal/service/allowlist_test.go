@@ -0,0 +1,41 @@
+package service
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestStartDeniedByAllowlist(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	pm, store := newTestManager(t, `
+processes:
+  - name: allowed
+    command: sleep
+    args: ["30"]
+  - name: denied
+    command: /bin/sh
+    args: ["-c", "sleep 30"]
+`)
+	pm.SetCommandAllowlist([]string{sleep})
+
+	if err := pm.StartProcess("allowed"); err != nil {
+		t.Errorf("StartProcess(allowed): %v", err)
+	}
+	if err := pm.StartProcess("denied"); err == nil {
+		t.Error("StartProcess(denied) succeeded")
+	}
+	if p, _ := pm.GetProcess("denied"); p.Status == "running" {
+		t.Error("denied process is running")
+	}
+
+	audit, err := store.GetErrorsByLevel("audit", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit) != 1 || audit[0].Source != "denied" {
+		t.Errorf("audit entries = %+v, want one for denied", audit)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"pupervisor/internal/archive"
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+)
+
+// archiveEnabledSetting turns uploads of rotated log segments on and off
+const archiveEnabledSetting = "archive_enabled"
+
+// archiveTimeFormat stamps the names of archived segments, precise enough
+// that segments rotated in quick succession do not overwrite each other
+const archiveTimeFormat = "20060102T150405.000000000Z"
+
+// StartArchive uploads rotated log files, and the supervisor events trimmed
+// from the log buffer, to the bucket of cfg while the archive_enabled
+// setting is on. Upload failures are logged as supervisor events. It must
+// be called before processes are started.
+func (pm *ProcessManager) StartArchive(cfg config.ArchiveConfig) (*archive.Archiver, error) {
+	a, err := archive.New(archive.Config{
+		Endpoint:  cfg.Endpoint,
+		Bucket:    cfg.Bucket,
+		Region:    cfg.Region,
+		Prefix:    cfg.Prefix,
+		AccessKey: cfg.AccessKey,
+		SecretKey: cfg.SecretKey,
+	}, func(level, message string) { pm.log(level, message, "") })
+	if err != nil {
+		return nil, err
+	}
+
+	pm.archive.Store(a)
+	pm.logs.mu.Lock()
+	pm.logs.archive = a
+	pm.logs.mu.Unlock()
+	return a, nil
+}
+
+// WatchArchiveSetting loads the stored archive_enabled setting and follows
+// changes to it. Without storage the archive stays disabled.
+func (pm *ProcessManager) WatchArchiveSetting() {
+	if pm.storage == nil || pm.archive.Load() == nil {
+		return
+	}
+
+	pm.storage.OnSettingChange(func(key, value string) {
+		if key == archiveEnabledSetting {
+			pm.applyArchiveEnabled(value)
+		}
+	})
+
+	value, err := pm.storage.GetSetting(archiveEnabledSetting)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to read %s: %v", archiveEnabledSetting, err), "")
+		return
+	}
+	pm.applyArchiveEnabled(value)
+}
+
+func (pm *ProcessManager) applyArchiveEnabled(value string) {
+	a := pm.archive.Load()
+	if a == nil {
+		return
+	}
+	enabled, _ := strconv.ParseBool(value)
+	if a.Enabled() == enabled {
+		return
+	}
+	a.SetEnabled(enabled)
+	if enabled {
+		pm.log("info", "Log archiving enabled", "")
+	} else {
+		pm.log("info", "Log archiving disabled", "")
+	}
+}
+
+// archiveEntries uploads entries as JSON lines.
+func archiveEntries(a *archive.Archiver, entries []models.LogEntry) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		_ = enc.Encode(e)
+	}
+	a.Upload("supervisor-"+time.Now().UTC().Format(archiveTimeFormat)+".jsonl", buf.Bytes())
+}
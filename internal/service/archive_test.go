@@ -0,0 +1,78 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// TestArchiveSetting checks that rotated log files are uploaded only while
+// the archive_enabled setting is on.
+func TestArchiveSetting(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		uploaded = append(uploaded, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	pm, store := newTestManager(t, `
+processes:
+  - name: app
+    command: /bin/true
+`)
+	a, err := pm.StartArchive(config.ArchiveConfig{Endpoint: srv.URL, Bucket: "logs", AccessKey: "AKID", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	pm.WatchArchiveSetting()
+
+	// Each line is 6 bytes with its newline, so every line after the first
+	// rotates the one before it
+	rf, err := openRotatingFile(filepath.Join(t.TempDir(), "app.log"), logFileOptions{maxSize: 8, archive: a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	write := func(lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			if err := rf.WriteLine(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	write("line1", "line2")
+	if err := store.SetSetting(archiveEnabledSetting, "true"); err != nil {
+		t.Fatal(err)
+	}
+	write("line3", "line4")
+	waitFor(t, "the upload", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(uploaded) == 2
+	})
+	if err := store.SetSetting(archiveEnabledSetting, "false"); err != nil {
+		t.Fatal(err)
+	}
+	write("line5", "line6")
+
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"line2\n", "line3\n"}; !slices.Equal(uploaded, want) {
+		t.Errorf("uploaded %q, want %q", uploaded, want)
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// WarningBinaryMissing is reported in a process's warnings while its command
+// cannot be found or is not executable.
+const WarningBinaryMissing = "binary_missing"
+
+// StartBinaryChecks periodically verifies that every process's command still
+// exists and is executable, so a binary removed by a deploy is reported
+// before the next restart fails on it. A non-positive interval disables it.
+func (pm *ProcessManager) StartBinaryChecks() {
+	if pm.binaryCheckInterval <= 0 {
+		return
+	}
+
+	go func() {
+		pm.checkBinaries()
+		ticker := time.NewTicker(pm.binaryCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			pm.checkBinaries()
+		}
+	}()
+}
+
+func (pm *ProcessManager) checkBinaries() {
+	pm.mu.RLock()
+	names := make([]string, 0, len(pm.processes))
+	for name, state := range pm.processes {
+		// A held process's binary is likely being replaced
+		if !state.held {
+			names = append(names, name)
+		}
+	}
+	pm.mu.RUnlock()
+
+	for _, name := range names {
+		pm.checkBinary(name)
+	}
+}
+
+func (pm *ProcessManager) checkBinary(name string) {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.RUnlock()
+		return
+	}
+	cfg := state.Config
+	pm.mu.RUnlock()
+
+	// An unresolvable secret is reported when the process is started
+	resolved, err := pm.resolveSecrets(cfg.WithInstanceVars())
+	if err != nil {
+		return
+	}
+	command, _ := resolved.Executable()
+	_, lookErr := config.ResolveCommand(command, resolved.Directory)
+
+	pm.mu.Lock()
+	// Skip a process that was removed or redefined meanwhile
+	current, ok := pm.processes[name]
+	if !ok || current != state || current.Config.Command != cfg.Command || current.Config.Directory != cfg.Directory ||
+		current.Config.Shell != cfg.Shell || current.Config.ShellPath != cfg.ShellPath {
+		pm.mu.Unlock()
+		return
+	}
+	wasMissing := state.binaryMissing
+	state.binaryMissing = lookErr != nil
+	pm.mu.Unlock()
+
+	switch {
+	case lookErr != nil && !wasMissing:
+		msg := fmt.Sprintf("Binary for process %s is missing, it will fail to start: %v", name, lookErr)
+		pm.logPersistent("error", msg, name)
+	case lookErr == nil && wasMissing:
+		pm.log("info", fmt.Sprintf("Binary for process %s is available again", name), name)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckBinary(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "app")
+	install := func(mode os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(bin, []byte("#!/bin/sh\nexec sleep 30\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(bin, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	install(0o755)
+
+	pm, store := newTestManager(t, fmt.Sprintf(`
+processes:
+  - name: app
+    command: %s
+`, bin))
+
+	missing := func() bool {
+		p, _ := pm.GetProcess("app")
+		return slices.Contains(p.Warnings, WarningBinaryMissing)
+	}
+
+	steps := []struct {
+		name    string
+		prepare func()
+		missing bool
+	}{
+		{"installed", func() {}, false},
+		{"removed", func() { os.Remove(bin) }, true},
+		{"still removed", func() {}, true},
+		{"not executable", func() { install(0o644) }, true},
+		{"reinstalled", func() { install(0o755) }, false},
+	}
+	for _, step := range steps {
+		step.prepare()
+		pm.checkBinary("app")
+		if got := missing(); got != step.missing {
+			t.Errorf("%s: binary missing = %v, want %v", step.name, got, step.missing)
+		}
+	}
+
+	// The error is persisted once, not on every check while missing
+	errs, err := store.GetErrors(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported int
+	for _, e := range errs {
+		if strings.Contains(e.Message, "Binary for process app is missing") {
+			reported += e.Count
+		}
+	}
+	if reported != 1 {
+		t.Errorf("missing binary reported %d time(s), want 1", reported)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// readLines calls fn for every line read from r. Lines longer than maxLen
+// bytes are cut to maxLen and marked with their original length, so a single
+// huge line can neither exhaust memory nor stall the reader. A maxLen of 0
+// or less disables truncation.
+func readLines(r io.Reader, maxLen int, fn func(line string)) {
+	reader := bufio.NewReader(r)
+	var line []byte
+	total := 0
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == nil {
+			chunk = bytes.TrimSuffix(chunk[:len(chunk)-1], []byte("\r"))
+		}
+
+		total += len(chunk)
+		if maxLen <= 0 {
+			line = append(line, chunk...)
+		} else if room := maxLen - len(line); room > 0 {
+			line = append(line, chunk[:min(room, len(chunk))]...)
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+
+		if total > 0 || err == nil {
+			if maxLen > 0 && total > maxLen {
+				fn(fmt.Sprintf("%s... [truncated, %d bytes]", line, total))
+			} else {
+				fn(string(line))
+			}
+		}
+		line = line[:0]
+		total = 0
+
+		if err != nil {
+			return
+		}
+	}
+}
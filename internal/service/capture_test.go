@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/storage"
+)
+
+func TestReadLines(t *testing.T) {
+	// Longer than bufio's default buffer, so it arrives in several chunks
+	huge := strings.Repeat("x", 10000)
+
+	tests := []struct {
+		name   string
+		input  string
+		maxLen int
+		want   []string
+	}{
+		{"short lines", "one\ntwo\r\nthree", 10, []string{"one", "two", "three"}},
+		{"empty lines kept", "a\n\nb\n", 10, []string{"a", "", "b"}},
+		{"at the limit", "12345\n", 5, []string{"12345"}},
+		{"over the limit", "1234567890\nok\n", 4, []string{"1234... [truncated, 10 bytes]", "ok"}},
+		{"huge line", huge + "\nok\n", 8, []string{"xxxxxxxx... [truncated, 10000 bytes]", "ok"}},
+		{"truncation disabled", huge + "\n", -1, []string{huge}},
+		{"truncated without a newline", "abcdef", 3, []string{"abc... [truncated, 6 bytes]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			readLines(strings.NewReader(tt.input), tt.maxLen, func(line string) {
+				got = append(got, line)
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("readLines(maxLen %d) = %q, want %q", tt.maxLen, shorten(got), shorten(tt.want))
+			}
+		})
+	}
+}
+
+// shorten keeps failure messages readable when lines are huge.
+func shorten(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) > 60 {
+			line = fmt.Sprintf("%s...(%d bytes)", line[:60], len(line))
+		}
+		out[i] = line
+	}
+	return out
+}
+
+// TestOutputTruncation checks that an over-long line is truncated wherever
+// the output of a process ends up: its output buffer, its log file and the
+// crash record.
+func TestOutputTruncation(t *testing.T) {
+	// The crash record is taken when the process is reaped, so it exits
+	// only once its output has been read
+	dir := t.TempDir()
+	pm, store := newTestManager(t, `
+logdir: `+dir+`
+processes:
+  - name: app
+    command: /bin/sh
+    args: ["-c", "echo out-0123456789; echo err-0123456789 >&2; sleep 0.2; exit 1"]
+    maxlinelength: 8
+`)
+
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+
+	var crashes []storage.CrashRecord
+	waitFor(t, "the crash record", func() bool {
+		crashes, _ = store.GetCrashesByProcess("app", 10)
+		return len(crashes) > 0
+	})
+
+	const stdout = "out-0123... [truncated, 14 bytes]"
+	const stderr = "err-0123... [truncated, 14 bytes]"
+
+	pm.mu.RLock()
+	lines := pm.processes["app"].outputBuffer.GetLastLines(10)
+	pm.mu.RUnlock()
+	if !slices.Contains(lines, stdout) || !slices.Contains(lines, stderr) {
+		t.Errorf("output buffer = %q, want %q and %q", lines, stdout, stderr)
+	}
+
+	if file := readFile(t, filepath.Join(dir, "app.log")); !strings.Contains(file, "[stdout] "+stdout+"\n") || !strings.Contains(file, "[stderr] "+stderr+"\n") {
+		t.Errorf("app.log = %q, want %q and %q", file, stdout, stderr)
+	}
+
+	if crashes[0].Stdout != stdout {
+		t.Errorf("crash stdout = %q, want %q", crashes[0].Stdout, stdout)
+	}
+	if crashes[0].Stderr != stderr {
+		t.Errorf("crash stderr = %q, want %q", crashes[0].Stderr, stderr)
+	}
+}
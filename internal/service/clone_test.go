@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"pupervisor/internal/config"
+)
+
+func TestCloneProcess(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+`)
+	sleep, err := config.ResolveCommand("sleep", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.SetCommandAllowlist([]string{sleep})
+
+	tests := []struct {
+		name      string
+		newName   string
+		overrides map[string]any
+		wantErr   bool
+	}{
+		{"plain", "web-copy", nil, false},
+		{"invalid name", "web copy", nil, true},
+		{"shell in umask", "web-umask", map[string]any{"umask": "022; touch /tmp/x #"}, true},
+		{"invalid healthcheck", "web-hc", map[string]any{"healthcheck": map[string]any{"interval": 5}}, true},
+		{"command not allowed", "web-true", map[string]any{"command": "true"}, true},
+		{"healthcheck", "web-checked", map[string]any{"healthcheck": map[string]any{"command": "true"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pm.CloneProcess("web", tt.newName, tt.overrides)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CloneProcess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := pm.GetProcess(tt.newName); ok == tt.wantErr {
+				t.Errorf("clone registered = %v, want %v", ok, !tt.wantErr)
+			}
+		})
+	}
+	if err := pm.CloneProcess("missing", "copy", nil); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("CloneProcess(missing) error = %v, want %v", err, ErrProcessNotFound)
+	}
+
+	// A cloned health check gets the defaults of one in the config file
+	pm.mu.RLock()
+	hc := pm.processes["web-checked"].Config.HealthCheck
+	pm.mu.RUnlock()
+	if hc.Timeout != 5 || hc.Interval != 10 || hc.Retries != 3 {
+		t.Errorf("cloned healthcheck = %+v, want the defaults", hc)
+	}
+}
+
+func TestUmask(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: masked
+    command: umask
+    shell: true
+    umask: "027"
+`)
+	if err := pm.StartProcess("masked"); err != nil {
+		t.Fatal(err)
+	}
+	pm.mu.RLock()
+	ob := pm.processes["masked"].outputBuffer
+	pm.mu.RUnlock()
+	waitFor(t, "the umask to be printed", func() bool {
+		return slices.Equal(ob.GetLastLines(10), []string{"0027"})
+	})
+}
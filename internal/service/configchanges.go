@@ -0,0 +1,83 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+)
+
+// recordSettingChanges records the settings in values whose value differs
+// from old, which has the values they had before and whether they were set.
+func (pm *ProcessManager) recordSettingChanges(old map[string]*string, values map[string]string, actor string) {
+	var changes []storage.ConfigChange
+	for key, value := range values {
+		change := storage.ConfigChange{Kind: storage.ConfigChangeSetting, Key: key, NewValue: pm.maskValue(value), Actor: actor}
+		if prev := old[key]; prev != nil {
+			if *prev == value {
+				continue
+			}
+			change.OldValue = pm.maskValue(*prev)
+		}
+		changes = append(changes, change)
+	}
+	pm.recordConfigChanges(changes)
+}
+
+// settingValues returns the current value of each of keys, nil for those
+// that are not set.
+func (pm *ProcessManager) settingValues(keys ...string) (map[string]*string, error) {
+	values := make(map[string]*string, len(keys))
+	for _, key := range keys {
+		value, ok, err := pm.storage.LookupSetting(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values[key] = &value
+		}
+	}
+	return values, nil
+}
+
+// processChange returns the change of a process's config from old to cfg,
+// either of which may be nil for an added or removed process. The configs
+// are recorded as JSON with secrets masked.
+func (pm *ProcessManager) processChange(name string, old, cfg *config.ProcessConfig, actor string) storage.ConfigChange {
+	change := storage.ConfigChange{Kind: storage.ConfigChangeProcess, Key: name, Actor: actor}
+	if old != nil {
+		change.OldValue = pm.processConfigJSON(*old)
+	}
+	if cfg != nil {
+		change.NewValue = pm.processConfigJSON(*cfg)
+	}
+	return change
+}
+
+func (pm *ProcessManager) processConfigJSON(cfg config.ProcessConfig) string {
+	options, err := pm.redactedConfig(cfg)
+	if err != nil {
+		return ""
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// recordConfigChanges saves changes, logging rather than returning a
+// failure so that it never undoes the change itself.
+func (pm *ProcessManager) recordConfigChanges(changes []storage.ConfigChange) {
+	if pm.storage == nil || len(changes) == 0 {
+		return
+	}
+	now := pm.now()
+	for i := range changes {
+		changes[i].CreatedAt = now
+	}
+	if err := pm.storage.SaveConfigChanges(changes); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to record config changes: %v", err), "")
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrConsoleNotAllowed is returned when attaching a console to a process
+// without allow_console.
+var ErrConsoleNotAllowed = errors.New("console not allowed for this process")
+
+// consoleBuffer is how many output lines a console may fall behind before
+// lines are dropped for it.
+const consoleBuffer = 256
+
+// ConsoleLine is a line of process output sent to attached consoles.
+type ConsoleLine struct {
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+// outputFeed fans out a process's output lines to attached consoles. It
+// outlives restarts, so a console stays attached while the process restarts.
+type outputFeed struct {
+	mu   sync.Mutex
+	subs map[chan ConsoleLine]struct{}
+}
+
+// publish sends line to every console, dropping it for consoles that are
+// too far behind rather than blocking the output reader.
+func (f *outputFeed) publish(stream, line string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- ConsoleLine{Stream: stream, Line: line}:
+		default:
+		}
+	}
+}
+
+func (f *outputFeed) subscribe() (chan ConsoleLine, func()) {
+	ch := make(chan ConsoleLine, consoleBuffer)
+
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan ConsoleLine]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subs, ch)
+			f.mu.Unlock()
+		})
+	}
+}
+
+// AttachConsole subscribes to the output of a process with allow_console.
+// Lines arrive on the returned channel until detach is called; the process
+// need not be running.
+func (pm *ProcessManager) AttachConsole(name string) (lines <-chan ConsoleLine, detach func(), err error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	state, ok := pm.processes[name]
+	if !ok {
+		return nil, nil, ErrProcessNotFound
+	}
+	if !state.Config.AllowConsole {
+		return nil, nil, ErrConsoleNotAllowed
+	}
+	if state.console == nil {
+		state.console = &outputFeed{}
+	}
+
+	ch, detach := state.console.subscribe()
+	return ch, detach, nil
+}
+
+// WriteStdin writes data to the standard input of a running process with
+// allow_console.
+func (pm *ProcessManager) WriteStdin(name string, data []byte) error {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var allowed bool
+	var stdin *stdinWriter
+	if ok {
+		allowed = state.Config.AllowConsole
+		stdin = state.stdin
+	}
+	pm.mu.RUnlock()
+
+	switch {
+	case !ok:
+		return ErrProcessNotFound
+	case !allowed:
+		return ErrConsoleNotAllowed
+	case stdin == nil:
+		return ErrProcessNotRunning
+	}
+	return stdin.write(data)
+}
+
+// stdinWriter serializes writes from several consoles to a process's stdin
+// pipe, outside of pm.mu since a process not reading its input blocks them.
+type stdinWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *stdinWriter) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(data)
+	return err
+}
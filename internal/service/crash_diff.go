@@ -0,0 +1,93 @@
+package service
+
+import (
+	"strings"
+
+	"pupervisor/internal/storage"
+)
+
+// DiffLine is a single line of a line-based diff.
+type DiffLine struct {
+	Op   string `json:"op"` // "equal", "removed" (only in a) or "added" (only in b)
+	Text string `json:"text"`
+}
+
+// CrashComparison holds two crash records and the differences between them.
+type CrashComparison struct {
+	A                storage.CrashRecord `json:"a"`
+	B                storage.CrashRecord `json:"b"`
+	Identical        bool                `json:"identical"`
+	ExitCodeChanged  bool                `json:"exit_code_changed"`
+	SignalChanged    bool                `json:"signal_changed"`
+	StderrDiff       []DiffLine          `json:"stderr_diff"`
+	ErrorMessageDiff []DiffLine          `json:"error_message_diff"`
+}
+
+// CompareCrashes diffs the exit status, stderr and error message of two crashes.
+func CompareCrashes(a, b storage.CrashRecord) CrashComparison {
+	cmp := CrashComparison{
+		A:                a,
+		B:                b,
+		ExitCodeChanged:  a.ExitCode != b.ExitCode,
+		SignalChanged:    a.Signal != b.Signal,
+		StderrDiff:       DiffLines(a.Stderr, b.Stderr),
+		ErrorMessageDiff: DiffLines(a.ErrorMsg, b.ErrorMsg),
+	}
+	cmp.Identical = !cmp.ExitCodeChanged && !cmp.SignalChanged &&
+		a.Stderr == b.Stderr && a.ErrorMsg == b.ErrorMsg
+	return cmp
+}
+
+// DiffLines computes a line diff of a and b based on their longest common
+// subsequence. Crash output is capped, so the quadratic table stays small.
+func DiffLines(a, b string) []DiffLine {
+	la := splitLines(a)
+	lb := splitLines(b)
+
+	// lcs[i][j] is the LCS length of la[i:] and lb[j:]
+	lcs := make([][]int, len(la)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lb)+1)
+	}
+	for i := len(la) - 1; i >= 0; i-- {
+		for j := len(lb) - 1; j >= 0; j-- {
+			if la[i] == lb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, max(len(la), len(lb)))
+	i, j := 0, 0
+	for i < len(la) && j < len(lb) {
+		switch {
+		case la[i] == lb[j]:
+			diff = append(diff, DiffLine{Op: "equal", Text: la[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "removed", Text: la[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "added", Text: lb[j]})
+			j++
+		}
+	}
+	for ; i < len(la); i++ {
+		diff = append(diff, DiffLine{Op: "removed", Text: la[i]})
+	}
+	for ; j < len(lb); j++ {
+		diff = append(diff, DiffLine{Op: "added", Text: lb[j]})
+	}
+
+	return diff
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"pupervisor/internal/storage"
+)
+
+func TestCompareCrashes(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      storage.CrashRecord
+		identical bool
+		diff      []DiffLine
+	}{
+		{
+			name:      "identical",
+			a:         storage.CrashRecord{ExitCode: 1, Stderr: "boom\nexit"},
+			b:         storage.CrashRecord{ExitCode: 1, Stderr: "boom\nexit"},
+			identical: true,
+			diff:      []DiffLine{{Op: "equal", Text: "boom"}, {Op: "equal", Text: "exit"}},
+		},
+		{
+			name: "disjoint",
+			a:    storage.CrashRecord{ExitCode: 1, Stderr: "a1\na2"},
+			b:    storage.CrashRecord{ExitCode: 1, Stderr: "b1"},
+			diff: []DiffLine{{Op: "removed", Text: "a1"}, {Op: "removed", Text: "a2"}, {Op: "added", Text: "b1"}},
+		},
+		{
+			name: "interleaved",
+			a:    storage.CrashRecord{ExitCode: 1, Stderr: "start\nold\nmiddle\nend"},
+			b:    storage.CrashRecord{ExitCode: 1, Stderr: "start\nmiddle\nnew\nend"},
+			diff: []DiffLine{
+				{Op: "equal", Text: "start"},
+				{Op: "removed", Text: "old"},
+				{Op: "equal", Text: "middle"},
+				{Op: "added", Text: "new"},
+				{Op: "equal", Text: "end"},
+			},
+		},
+		{
+			name: "one side empty",
+			a:    storage.CrashRecord{ExitCode: 1},
+			b:    storage.CrashRecord{ExitCode: 1, Stderr: "panic"},
+			diff: []DiffLine{{Op: "added", Text: "panic"}},
+		},
+		{
+			name: "same stderr, different exit code",
+			a:    storage.CrashRecord{ExitCode: 1, Stderr: "boom"},
+			b:    storage.CrashRecord{ExitCode: 2, Stderr: "boom"},
+			diff: []DiffLine{{Op: "equal", Text: "boom"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp := CompareCrashes(tt.a, tt.b)
+			if cmp.Identical != tt.identical {
+				t.Errorf("Identical = %v, want %v", cmp.Identical, tt.identical)
+			}
+			if cmp.ExitCodeChanged != (tt.a.ExitCode != tt.b.ExitCode) {
+				t.Errorf("ExitCodeChanged = %v", cmp.ExitCodeChanged)
+			}
+			if !slices.Equal(cmp.StderrDiff, tt.diff) {
+				t.Errorf("StderrDiff = %v, want %v", cmp.StderrDiff, tt.diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"gopkg.in/yaml.v3"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+)
+
+// Bounds of the history sections of a process description
+const (
+	describeCrashes     = 10
+	describeTransitions = 20
+	describeLogs        = 50
+)
+
+// ProcessDescription is everything known about a single process. Config is
+// the effective config, keyed by the YAML option names, with secrets masked;
+// the history sections are newest first and bounded.
+type ProcessDescription struct {
+	Config      map[string]any        `json:"config"`
+	State       models.Process        `json:"state"`
+	Metrics     ProcessMetrics        `json:"metrics"`
+	Crashes     []storage.CrashRecord `json:"crashes"`
+	Transitions []storage.Transition  `json:"transitions"`
+	Logs        []models.LogEntry     `json:"logs"`
+}
+
+// Describe returns the description of the named process, or
+// ErrProcessNotFound.
+func (pm *ProcessManager) Describe(name string) (ProcessDescription, error) {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var cfg config.ProcessConfig
+	if ok {
+		cfg = state.Config
+	}
+	pm.mu.RUnlock()
+	if !ok {
+		return ProcessDescription{}, ErrProcessNotFound
+	}
+
+	desc := ProcessDescription{
+		Crashes:     []storage.CrashRecord{},
+		Transitions: []storage.Transition{},
+		Logs:        []models.LogEntry{},
+	}
+
+	var err error
+	if desc.Config, err = pm.redactedConfig(effectiveConfig(cfg)); err != nil {
+		return ProcessDescription{}, err
+	}
+	desc.State, _ = pm.GetProcess(name)
+
+	metrics, err := pm.CollectMetrics()
+	if err != nil {
+		return ProcessDescription{}, err
+	}
+	for _, m := range metrics {
+		if m.Name == name {
+			desc.Metrics = m
+		}
+	}
+
+	if pm.storage != nil {
+		crashes, err := pm.storage.GetCrashesByProcess(name, describeCrashes)
+		if err != nil {
+			return ProcessDescription{}, err
+		}
+		if crashes != nil {
+			desc.Crashes = crashes
+		}
+		// Include the transitions still being saved
+		pm.transitions.wait()
+		if desc.Transitions, err = pm.storage.GetTransitionsByProcess(name, describeTransitions); err != nil {
+			return ProcessDescription{}, err
+		}
+	}
+
+	logs := pm.GetLogsByProcess(name, describeLogs)
+	for i := len(logs) - 1; i >= 0; i-- {
+		desc.Logs = append(desc.Logs, logs[i])
+	}
+
+	return desc, nil
+}
+
+// effectiveConfig returns cfg as the next spawn uses it, short of resolving
+// secrets: with the global defaults and any runtime changes it already
+// carries, a replica's ${INSTANCE} and ${PORT} substituted and unset options
+// that have a fixed default filled in.
+func effectiveConfig(cfg config.ProcessConfig) config.ProcessConfig {
+	cfg = cfg.WithInstanceVars()
+	if cfg.LogPrefix == nil {
+		prefix := config.DefaultLogPrefix
+		cfg.LogPrefix = &prefix
+	}
+	return cfg
+}
+
+// redactedConfig returns cfg as a map of its YAML options, with the values
+// that are or may be secrets masked as in ExportShell.
+func (pm *ProcessManager) redactedConfig(cfg config.ProcessConfig) (map[string]any, error) {
+	cfg.Command = pm.maskValue(cfg.Command)
+	args := make([]string, len(cfg.Args))
+	for i, arg := range cfg.Args {
+		args[i] = pm.maskValue(arg)
+	}
+	cfg.Args = args
+	env := make(map[string]string, len(cfg.Environment))
+	for key, value := range cfg.Environment {
+		env[key] = pm.maskEnvValue(key, value)
+	}
+	cfg.Environment = env
+	cfg.CanRestart = pm.maskValue(cfg.CanRestart)
+	cfg.StartCondition = pm.maskValue(cfg.StartCondition)
+	if hc := cfg.HealthCheck; hc != nil {
+		masked := *hc
+		masked.Command = pm.maskValue(masked.Command)
+		masked.HTTP = pm.maskValue(masked.HTTP)
+		cfg.HealthCheck = &masked
+	}
+	if sc := cfg.StopCheck; sc != nil {
+		masked := *sc
+		masked.HTTP = pm.maskValue(masked.HTTP)
+		cfg.StopCheck = &masked
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var options map[string]any
+	if err := yaml.Unmarshal(data, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: web
+    command: /bin/sh
+    args: ["-c", "exec sleep 30", "--token=${secret:api_token}", "--port=${PORT}"]
+    replicas: 1
+    port_base: 9000
+    environment:
+      DB_PASSWORD: hunter2
+      MODE: production
+`)
+	pm.secrets = fakeSecrets{"api_token": "s3cret"}
+	name := "web-0"
+
+	if err := pm.StartProcess(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.StopProcess(name); err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := pm.Describe(name)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+
+	args, _ := desc.Config["args"].([]any)
+	if len(args) != 4 || args[2] != "--token=***" || args[3] != "--port=9000" {
+		t.Errorf("config args = %v, want the secret masked and ${PORT} substituted", args)
+	}
+	env, _ := desc.Config["environment"].(map[string]any)
+	if env["DB_PASSWORD"] != "***" || env["MODE"] != "production" {
+		t.Errorf("config environment = %v, want only DB_PASSWORD masked", env)
+	}
+	if desc.Config["logprefix"] == nil {
+		t.Error("config has no logprefix, want the default filled in")
+	}
+
+	if desc.State.Name != name || desc.State.Status != "stopped" {
+		t.Errorf("state = %s %s, want %s stopped", desc.State.Name, desc.State.Status, name)
+	}
+	if len(desc.Transitions) != 2 || desc.Transitions[0].ToState != "stopped" {
+		t.Errorf("transitions = %+v, want running then stopped, newest first", desc.Transitions)
+	}
+	if len(desc.Logs) == 0 || desc.Crashes == nil {
+		t.Errorf("logs = %d entries, crashes = %v, want logs and an empty crash list", len(desc.Logs), desc.Crashes)
+	}
+	for i := 1; i < len(desc.Logs); i++ {
+		if desc.Logs[i].Timestamp > desc.Logs[i-1].Timestamp {
+			t.Errorf("logs are not newest first: %q after %q", desc.Logs[i].Timestamp, desc.Logs[i-1].Timestamp)
+		}
+	}
+
+	if _, err := pm.Describe("missing"); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("Describe(missing) error = %v, want %v", err, ErrProcessNotFound)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"pupervisor/internal/notifier"
+)
+
+// escalationRulesSetting holds the warning escalation rules as a JSON array
+// of EscalationRule.
+const escalationRulesSetting = "escalation_rules"
+
+// EventWarningEscalated is sent when an escalation rule fires.
+const EventWarningEscalated = "warning_escalated"
+
+// EscalationRule escalates a warning to an error and a notification when
+// more than Count warnings from Source whose message matches Pattern are
+// logged within Window seconds. It then rests for Window seconds, so a flood
+// of warnings escalates once per window.
+type EscalationRule struct {
+	// Source is the process name the warnings are about; "" matches any
+	// process and supervisor-wide warnings
+	Source  string `json:"source,omitempty"`
+	Pattern string `json:"pattern"`
+	Count   int    `json:"count"`
+	Window  int    `json:"window"`
+}
+
+type compiledRule struct {
+	EscalationRule
+	re *regexp.Regexp
+}
+
+// parseEscalationRules parses and validates the escalation_rules setting.
+func parseEscalationRules(value string) ([]compiledRule, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var rules []EscalationRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, errors.New("must be a JSON array of rules with pattern, count and window")
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid pattern %q: %v", i, rule.Pattern, err)
+		}
+		if rule.Count < 1 || rule.Window < 1 {
+			return nil, fmt.Errorf("rule %d: count and window must be positive", i)
+		}
+		compiled = append(compiled, compiledRule{EscalationRule: rule, re: re})
+	}
+	return compiled, nil
+}
+
+func checkEscalationRules(value string) error {
+	_, err := parseEscalationRules(value)
+	return err
+}
+
+// escalator counts the warnings matching each rule per source.
+type escalator struct {
+	mu    sync.Mutex
+	rules []compiledRule
+	// seen holds the times of recent matching warnings by rule and source,
+	// resting until when rules that fired count again
+	seen    map[escalationKey][]time.Time
+	resting map[escalationKey]time.Time
+}
+
+type escalationKey struct {
+	rule   int
+	source string
+}
+
+// setRules replaces the rules, forgetting the warnings counted so far.
+func (e *escalator) setRules(rules []compiledRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	e.seen = make(map[escalationKey][]time.Time)
+	e.resting = make(map[escalationKey]time.Time)
+}
+
+// observe counts a warning and returns the first rule it takes over its
+// count, with how many warnings that makes. A rule that fired ignores the
+// warnings of its window that follow, then counts from zero.
+func (e *escalator) observe(source, message string, now time.Time) (EscalationRule, int, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, rule := range e.rules {
+		if (rule.Source != "" && rule.Source != source) || !rule.re.MatchString(message) {
+			continue
+		}
+
+		key := escalationKey{rule: i, source: source}
+		if now.Before(e.resting[key]) {
+			continue
+		}
+		cutoff := now.Add(-time.Duration(rule.Window) * time.Second)
+		times := e.seen[key]
+		for len(times) > 0 && !times[0].After(cutoff) {
+			times = times[1:]
+		}
+		times = append(times, now)
+
+		if len(times) > rule.Count {
+			delete(e.seen, key)
+			e.resting[key] = now.Add(time.Duration(rule.Window) * time.Second)
+			return rule.EscalationRule, len(times), true
+		}
+		e.seen[key] = times
+	}
+	return EscalationRule{}, 0, false
+}
+
+// WatchEscalationRules loads the stored escalation rules and follows changes
+// to the setting.
+func (pm *ProcessManager) WatchEscalationRules() {
+	if pm.storage == nil {
+		return
+	}
+
+	pm.storage.OnSettingChange(func(key, value string) {
+		if key == escalationRulesSetting {
+			pm.applyEscalationRules(value)
+		}
+	})
+
+	value, err := pm.storage.GetSetting(escalationRulesSetting)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to read %s: %v", escalationRulesSetting, err), "")
+		return
+	}
+	pm.applyEscalationRules(value)
+}
+
+func (pm *ProcessManager) applyEscalationRules(value string) {
+	rules, err := parseEscalationRules(value)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Ignoring invalid %s: %v", escalationRulesSetting, err), "")
+		rules = nil
+	}
+	pm.escalations.setRules(rules)
+}
+
+// checkEscalation counts a logged warning against the escalation rules and
+// escalates it when one fires. log calls it for every warning, including
+// those saved to the error log by logPersistent. The escalation runs in the
+// background as callers may hold pm.mu.
+func (pm *ProcessManager) checkEscalation(source, message string) {
+	now := pm.now()
+	rule, count, ok := pm.escalations.observe(source, message, now)
+	if !ok {
+		return
+	}
+	go pm.escalate(rule, source, message, count, now)
+}
+
+func (pm *ProcessManager) escalate(rule EscalationRule, source, message string, count int, now time.Time) {
+	escalated := fmt.Sprintf("Warning logged %d times within %ds, escalated: %s", count, rule.Window, message)
+	pm.logPersistent("error", escalated, source)
+	pm.notifier.Notify(notifier.Event{
+		Type:    EventWarningEscalated,
+		Process: source,
+		Message: escalated,
+		Count:   count,
+		Time:    now,
+	})
+}
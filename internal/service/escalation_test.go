@@ -0,0 +1,125 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEscalatorFiresOncePerWindow(t *testing.T) {
+	var e escalator
+	e.setRules([]compiledRule{{
+		EscalationRule: EscalationRule{Source: "worker", Pattern: "hung", Count: 3, Window: 60},
+		re:             regexp.MustCompile("hung"),
+	}})
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at      time.Duration
+		source  string
+		message string
+		fires   bool
+	}{
+		{0, "worker", "worker is hung", false},
+		{10 * time.Second, "worker", "worker is hung", false},
+		{15 * time.Second, "worker", "slow response", false}, // no match
+		{16 * time.Second, "api", "api is hung", false},      // other source
+		{20 * time.Second, "worker", "worker is hung", false},
+		{30 * time.Second, "worker", "worker is hung", true},
+		// Resting for the window after firing
+		{31 * time.Second, "worker", "worker is hung", false},
+		{40 * time.Second, "worker", "worker is hung", false},
+		{50 * time.Second, "worker", "worker is hung", false},
+		{89 * time.Second, "worker", "worker is hung", false},
+		// Counting from zero again
+		{90 * time.Second, "worker", "worker is hung", false},
+		{91 * time.Second, "worker", "worker is hung", false},
+		{92 * time.Second, "worker", "worker is hung", false},
+		{93 * time.Second, "worker", "worker is hung", true},
+	}
+	for i, tt := range tests {
+		rule, count, fired := e.observe(tt.source, tt.message, start.Add(tt.at))
+		if fired != tt.fires {
+			t.Fatalf("warning %d at %s: fired = %v, want %v", i, tt.at, fired, tt.fires)
+		}
+		if fired && (count != 4 || rule.Source != "worker") {
+			t.Errorf("warning %d: fired %+v with count %d, want the worker rule with 4", i, rule, count)
+		}
+	}
+}
+
+func TestEscalatorWindowExpires(t *testing.T) {
+	var e escalator
+	e.setRules([]compiledRule{{
+		EscalationRule: EscalationRule{Pattern: ".", Count: 1, Window: 10},
+		re:             regexp.MustCompile("."),
+	}})
+
+	start := time.Now()
+	e.observe("", "warn", start)
+	if _, _, fired := e.observe("", "warn", start.Add(11*time.Second)); fired {
+		t.Error("fired for warnings further apart than the window")
+	}
+	if _, _, fired := e.observe("", "warn", start.Add(12*time.Second)); !fired {
+		t.Error("did not fire for two warnings within the window")
+	}
+}
+
+func TestPersistedWarningsEscalate(t *testing.T) {
+	pm, store := newTestManager(t, "processes: []\n")
+	var mu sync.Mutex
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pm.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	pm.WatchEscalationRules()
+	if err := store.SetSetting(escalationRulesSetting, `[{"source": "worker", "pattern": "is hung", "count": 2, "window": 600}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	escalations := func() int {
+		errs, err := store.GetErrorsByLevel("error", 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, e := range errs {
+			if strings.Contains(e.Message, "escalated") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// The watchdog saves its warnings to the error log
+	for range 3 {
+		pm.logPersistent("warning", "Process worker is hung: no heartbeat for 30s, restarting", "worker")
+	}
+	waitFor(t, "the escalation", func() bool { return escalations() == 1 })
+
+	// Resting: more warnings within the window do not escalate again
+	for range 5 {
+		pm.logPersistent("warning", "Process worker is hung: no heartbeat for 30s, restarting", "worker")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := escalations(); n != 1 {
+		t.Fatalf("escalations while resting = %d, want 1", n)
+	}
+
+	mu.Lock()
+	now = now.Add(601 * time.Second)
+	mu.Unlock()
+	for range 3 {
+		pm.log("warning", "Process worker is hung: no heartbeat for 30s, restarting", "worker")
+	}
+	waitFor(t, "the second escalation", func() bool { return escalations() == 2 })
+
+	if warnings, _ := store.GetErrorsByLevel("warning", 100); len(warnings) != 8 {
+		t.Errorf("persisted warnings = %d, want 8", len(warnings))
+	}
+}
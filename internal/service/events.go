@@ -0,0 +1,81 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"pupervisor/internal/models"
+)
+
+// eventBuffer is how many events a subscriber may fall behind before events
+// are dropped for it.
+const eventBuffer = 256
+
+// Event types
+const (
+	EventStatus = "status"
+	EventLog    = "log"
+)
+
+// Event is a status change of a process or a new log entry, pushed to
+// subscribers as it happens.
+type Event struct {
+	Type    string `json:"type"`
+	Process string `json:"process,omitempty"`
+	// From, To and Reason describe a status change
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Log is the entry of a log event
+	Log  *models.LogEntry `json:"log,omitempty"`
+	Time time.Time        `json:"time"`
+}
+
+// eventFeed fans out events to subscribers, like outputFeed does for
+// console lines.
+type eventFeed struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// publish sends event to every subscriber, dropping it for subscribers that
+// are too far behind rather than blocking the caller, which may hold pm.mu.
+func (f *eventFeed) publish(event Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents returns a channel receiving every status change and log
+// entry from now on, until unsubscribe is called.
+func (pm *ProcessManager) SubscribeEvents() (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event, eventBuffer)
+
+	f := &pm.events
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan Event]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subs, ch)
+			f.mu.Unlock()
+		})
+	}
+}
+
+// publishLog pushes a log entry to event subscribers.
+func (pm *ProcessManager) publishLog(entry models.LogEntry) {
+	pm.events.publish(Event{Type: EventLog, Process: entry.Worker, Log: &entry, Time: pm.now()})
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+const maskedValue = "***"
+
+// sensitiveEnvKey matches environment variable names whose values are masked
+// in exports.
+var sensitiveEnvKey = regexp.MustCompile(`(?i)pass|secret|token|key|credential`)
+
+// shellName matches the environment variable names a shell can export.
+var shellName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ExportShell renders a POSIX shell script that launches every process the
+// way the supervisor does, in start order: working directory, umask,
+// environment and command. Values that are or may be secrets are masked, so
+// the script documents the setup but may need editing before it runs.
+func (pm *ProcessManager) ExportShell() string {
+	pm.mu.RLock()
+	names := pm.orderedNames(func(*ProcessState) bool { return true })
+	configs := make([]config.ProcessConfig, len(names))
+	for i, name := range names {
+		configs[i] = pm.processes[name].Config
+	}
+	pm.mu.RUnlock()
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Generated by pupervisor at %s.\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "# Secret values are masked as %s.\n", maskedValue)
+
+	for _, cfg := range configs {
+		fmt.Fprintf(&b, "\n# %s\n", cfg.Name)
+		if cfg.User != "" {
+			fmt.Fprintf(&b, "# runs as user %s\n", cfg.User)
+		}
+		b.WriteString("(\n")
+		if cfg.Directory != "" {
+			fmt.Fprintf(&b, "  cd %s || exit 1\n", shellQuote(cfg.Directory))
+		}
+		if cfg.Umask != "" {
+			fmt.Fprintf(&b, "  umask %s\n", cfg.Umask)
+		}
+
+		keys := make([]string, 0, len(cfg.Environment))
+		for key := range cfg.Environment {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !shellName.MatchString(key) {
+				fmt.Fprintf(&b, "  # skipped environment variable %q: not a shell variable name\n", key)
+				continue
+			}
+			fmt.Fprintf(&b, "  export %s=%s\n", key, shellQuote(pm.maskEnvValue(key, cfg.Environment[key])))
+		}
+
+		command, args := cfg.Executable()
+		words := []string{shellQuote(pm.maskValue(command))}
+		for _, arg := range args {
+			words = append(words, shellQuote(pm.maskValue(arg)))
+		}
+		fmt.Fprintf(&b, "  exec %s\n", strings.Join(words, " "))
+		b.WriteString(") &\n")
+	}
+
+	b.WriteString("\nwait\n")
+	return b.String()
+}
+
+func (pm *ProcessManager) maskEnvValue(key, value string) string {
+	if sensitiveEnvKey.MatchString(key) {
+		return maskedValue
+	}
+	return pm.maskValue(value)
+}
+
+// maskValue masks ${secret:key} references and matches of the notification
+// redaction patterns.
+func (pm *ProcessManager) maskValue(value string) string {
+	value = secretRefPattern.ReplaceAllString(value, maskedValue)
+	if pm.notifier != nil {
+		value = pm.notifier.Redact(value)
+	}
+	return value
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./=:,+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
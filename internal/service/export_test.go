@@ -0,0 +1,51 @@
+package service
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExportShell(t *testing.T) {
+	dir := t.TempDir() + "/work dir"
+	pm, _ := newTestManager(t, `
+processes:
+  - name: web
+    command: /usr/bin/server
+    args: ["--token=${secret:api_token}", "it's here"]
+    directory: "`+dir+`"
+    umask: "022"
+    environment:
+      DB_PASSWORD: hunter2
+      MODE: production
+      GREETING: "it's $(date)"
+      "BAD;touch /tmp/pwned": x
+      "1ST": y
+`)
+	script := pm.ExportShell()
+
+	for _, want := range []string{
+		"  cd '" + dir + "' || exit 1\n",
+		"  umask 022\n",
+		"  export DB_PASSWORD='***'\n",
+		"  export MODE=production\n",
+		`  export GREETING='it'\''s $(date)'` + "\n",
+		`  # skipped environment variable "1ST": not a shell variable name` + "\n",
+		`  # skipped environment variable "BAD;touch /tmp/pwned": not a shell variable name` + "\n",
+		`  exec /usr/bin/server '--token=***' 'it'\''s here'` + "\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "hunter2") {
+		t.Errorf("script contains the DB_PASSWORD value:\n%s", script)
+	}
+
+	// The script parses
+	cmd := exec.Command("sh", "-n")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("sh -n: %v: %s", err, out)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"pupervisor/internal/config"
+)
+
+// reloadDebounce is how long a watched file must stay quiet before its
+// processes are reloaded, so one save that writes several times or a
+// deploy that replaces several files triggers a single reload.
+const reloadDebounce = 500 * time.Millisecond
+
+// fileWatch restarts or signals processes when the files listed in their
+// reload_on_change change. Directories are watched rather than the files
+// themselves, so files that editors and deploy tools replace by renaming
+// keep being followed.
+type fileWatch struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	// files maps each watched file to the processes listing it, dirs the
+	// watched directories to how many files in them are watched
+	files  map[string][]string
+	dirs   map[string]int
+	timers map[string]*time.Timer
+}
+
+// StartFileWatches begins watching the reload_on_change files of all
+// processes. ApplyConfig updates the watched files on reload.
+func (pm *ProcessManager) StartFileWatches() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	pm.fileWatch.mu.Lock()
+	pm.fileWatch.watcher = watcher
+	pm.fileWatch.dirs = make(map[string]int)
+	pm.fileWatch.timers = make(map[string]*time.Timer)
+	pm.fileWatch.mu.Unlock()
+
+	pm.updateFileWatches()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+					pm.fileChanged(filepath.Clean(event.Name))
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				pm.log("error", fmt.Sprintf("File watch error: %v", err), "")
+			}
+		}
+	}()
+	return nil
+}
+
+// watchedFiles resolves the reload_on_change files of every process,
+// relative paths against the process's directory.
+func watchedFiles(configs []config.ProcessConfig) map[string][]string {
+	files := make(map[string][]string)
+	for _, cfg := range configs {
+		for _, file := range cfg.ReloadOnChange {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(cfg.Directory, file)
+			}
+			if abs, err := filepath.Abs(file); err == nil {
+				file = abs
+			}
+			files[file] = append(files[file], cfg.Name)
+		}
+	}
+	return files
+}
+
+// updateFileWatches watches the directories of the current processes'
+// reload_on_change files and stops watching those no longer needed.
+func (pm *ProcessManager) updateFileWatches() {
+	pm.mu.RLock()
+	configs := make([]config.ProcessConfig, 0, len(pm.processes))
+	for _, state := range pm.processes {
+		configs = append(configs, state.Config)
+	}
+	pm.mu.RUnlock()
+
+	fw := &pm.fileWatch
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.watcher == nil {
+		return
+	}
+
+	fw.files = watchedFiles(configs)
+	dirs := make(map[string]int)
+	for file := range fw.files {
+		dirs[filepath.Dir(file)]++
+	}
+
+	for dir := range dirs {
+		if fw.dirs[dir] > 0 {
+			continue
+		}
+		if err := fw.watcher.Add(dir); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to watch %s for reload_on_change: %v", dir, err), "")
+			delete(dirs, dir)
+		}
+	}
+	for dir := range fw.dirs {
+		if dirs[dir] == 0 {
+			_ = fw.watcher.Remove(dir)
+		}
+	}
+	fw.dirs = dirs
+}
+
+// fileChanged schedules the reload of the processes watching file once
+// changes to it have settled.
+func (pm *ProcessManager) fileChanged(file string) {
+	fw := &pm.fileWatch
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for _, name := range fw.files[file] {
+		if timer, ok := fw.timers[name]; ok {
+			timer.Reset(reloadDebounce)
+			continue
+		}
+		fw.timers[name] = time.AfterFunc(reloadDebounce, func() {
+			fw.mu.Lock()
+			delete(fw.timers, name)
+			fw.mu.Unlock()
+			pm.reloadOnChange(name, file)
+		})
+	}
+}
+
+// reloadOnChange sends the process its reload_signal, or restarts it if it
+// has none. Processes that are not running or are held are left alone.
+func (pm *ProcessManager) reloadOnChange(name, file string) {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	if !ok || state.Status != "running" || state.held {
+		pm.mu.RUnlock()
+		return
+	}
+	signal := state.Config.ReloadSignal
+	process := state.Cmd.Process
+	pm.mu.RUnlock()
+
+	if signal == "" {
+		pm.log("info", fmt.Sprintf("Restarting process %s: %s changed", name, file), name)
+		if err := pm.RestartProcess(name); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to restart %s after %s changed: %v", name, file, err), name)
+		}
+		return
+	}
+
+	sig, err := signalByName(signal)
+	if err == nil {
+		err = process.Signal(sig)
+	}
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to send %s to %s after %s changed: %v", signal, name, file, err), name)
+		return
+	}
+	pm.log("info", fmt.Sprintf("Sent %s to process %s: %s changed", signal, name, file), name)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"pupervisor/internal/config"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	got := watchedFiles([]config.ProcessConfig{
+		{Name: "web", Directory: "/srv/web", ReloadOnChange: []string{"app.conf", "/etc/shared.conf"}},
+		{Name: "worker", ReloadOnChange: []string{"/etc/shared.conf"}},
+		{Name: "cron"},
+	})
+	want := map[string][]string{
+		"/srv/web/app.conf": {"web"},
+		"/etc/shared.conf":  {"web", "worker"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("watchedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"restart.conf", "signal.conf"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("v1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pm, _ := newTestManager(t, `
+processes:
+  - name: restarted
+    command: sleep
+    args: ["30"]
+    directory: `+dir+`
+    reload_on_change: [restart.conf]
+  - name: signaled
+    command: /bin/sh
+    args: ["-c", "trap 'echo reloaded' HUP; while true; do sleep 0.1; done"]
+    directory: `+dir+`
+    reload_on_change: [signal.conf]
+    reload_signal: SIGHUP
+`)
+	for _, name := range []string{"restarted", "signaled"} {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatalf("StartProcess(%s) error = %v", name, err)
+		}
+	}
+	if err := pm.StartFileWatches(); err != nil {
+		t.Fatalf("StartFileWatches() error = %v", err)
+	}
+
+	restarted, _ := pm.GetProcess("restarted")
+	signaled, _ := pm.GetProcess("signaled")
+
+	for _, name := range []string{"restart.conf", "signal.conf"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("v2"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "restarted to get a new PID", func() bool {
+		p, _ := pm.GetProcess("restarted")
+		return p.Status == "running" && p.Pid != restarted.Pid
+	})
+	waitFor(t, "signaled to handle SIGHUP", func() bool {
+		pm.mu.RLock()
+		defer pm.mu.RUnlock()
+		return slices.Contains(pm.processes["signaled"].outputBuffer.GetLastLines(10), "reloaded")
+	})
+	if p, _ := pm.GetProcess("signaled"); p.Pid != signaled.Pid {
+		t.Errorf("signaled PID = %d, want it still running as %d", p.Pid, signaled.Pid)
+	}
+}
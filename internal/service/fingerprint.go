@@ -0,0 +1,29 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// volatileTokens matches the parts of an error line that differ between
+// otherwise identical crashes: addresses, ids, timestamps, line numbers.
+var volatileTokens = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+
+// CrashFingerprint identifies crashes with the same cause: the same process
+// exiting the same way with the same last error line, ignoring numbers.
+func CrashFingerprint(name string, exitCode int, signal, stderr string) string {
+	lastLine := ""
+	lines := strings.Split(stderr, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			lastLine = volatileTokens.ReplaceAllString(line, "N")
+			break
+		}
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s\x00%s", name, exitCode, signal, lastLine)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/notifier"
+)
+
+// Health states
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+const healthCheckTick = time.Second
+
+// StartHealthChecks probes running processes that have a health check
+// configured, each at its own interval. With health_check_concurrency set,
+// at most that many probes run at once and the others wait their turn.
+func (pm *ProcessManager) StartHealthChecks() {
+	go func() {
+		ticker := time.NewTicker(healthCheckTick)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, name := range pm.dueHealthChecks() {
+				go pm.checkHealth(name)
+			}
+		}
+	}()
+}
+
+// dueHealthChecks marks and returns the processes whose next check is due.
+func (pm *ProcessManager) dueHealthChecks() []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	now := time.Now()
+	var due []string
+	for name, state := range pm.processes {
+		hc := state.Config.HealthCheck
+		if hc == nil || state.Status != "running" || state.healthChecking || state.held {
+			continue
+		}
+		if now.Sub(state.lastHealthCheck) < time.Duration(hc.Interval)*time.Second {
+			continue
+		}
+		state.healthChecking = true
+		state.lastHealthCheck = now
+		due = append(due, name)
+	}
+	return due
+}
+
+// checkHealth probes a process once a health check slot is free. Its next
+// check is scheduled from when the probe starts, so time spent queued does
+// not bunch up later checks.
+func (pm *ProcessManager) checkHealth(name string) {
+	if pm.healthSlots != nil {
+		pm.healthSlots <- struct{}{}
+		defer func() { <-pm.healthSlots }()
+	}
+
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.Unlock()
+		return
+	}
+	// The process may have stopped or been held while the check was queued
+	if state.Status != "running" || state.held || state.Config.HealthCheck == nil {
+		state.healthChecking = false
+		pm.mu.Unlock()
+		return
+	}
+	hc := *state.Config.HealthCheck
+	state.lastHealthCheck = time.Now()
+	pm.mu.Unlock()
+
+	err := RunHealthCheck(hc)
+
+	pm.mu.Lock()
+	state.healthChecking = false
+	// The process was held while the probe ran
+	if state.held {
+		pm.mu.Unlock()
+		return
+	}
+	previous := state.Health
+
+	if err == nil {
+		state.healthFailures = 0
+		state.Health = HealthHealthy
+		state.LastHealthyAt = time.Now()
+		pm.recordStartIfReady(state)
+	} else {
+		state.healthFailures++
+		if state.healthFailures >= hc.Retries {
+			state.Health = HealthUnhealthy
+		}
+	}
+
+	current := state.Health
+	lastHealthyAt := state.LastHealthyAt
+	channels := state.Config.Notify
+	pm.updateReadiness(name, state)
+	pm.mu.Unlock()
+
+	if current == previous {
+		return
+	}
+
+	event := notifier.Event{
+		Type:     current,
+		Process:  name,
+		Time:     time.Now(),
+		Channels: channels,
+	}
+	if !lastHealthyAt.IsZero() {
+		event.LastHealthyAt = &lastHealthyAt
+	}
+
+	switch current {
+	case HealthHealthy:
+		pm.log("info", fmt.Sprintf("Process %s is healthy", name), name)
+		if previous != HealthUnhealthy {
+			return
+		}
+		event.Message = fmt.Sprintf("Process %s recovered", name)
+	case HealthUnhealthy:
+		event.Message = fmt.Sprintf("Process %s is unhealthy: %v", name, err)
+		if !lastHealthyAt.IsZero() {
+			event.Message += fmt.Sprintf(" (last healthy %s ago)", formatDuration(time.Since(lastHealthyAt)))
+		}
+		pm.log("warning", event.Message, name)
+	}
+
+	pm.notifier.Notify(event)
+}
+
+// ErrNoHealthCheck is returned when testing the health check of a process
+// without one.
+var ErrNoHealthCheck = errors.New("no health check configured")
+
+// healthBodySnippet is how much of a probe's response body or command
+// output a HealthCheckResult keeps.
+const healthBodySnippet = 1024
+
+// HealthCheckResult is the outcome of a single probe run by
+// TestHealthCheck.
+type HealthCheckResult struct {
+	Probe      string  `json:"probe"` // command, http or tcp
+	Passed     bool    `json:"passed"`
+	Latency    float64 `json:"latency_seconds"`
+	StatusCode int     `json:"status_code,omitempty"` // http probes only
+	Body       string  `json:"body,omitempty"`        // start of the response body or command output
+	Error      string  `json:"error,omitempty"`
+}
+
+// TestHealthCheck runs the health probe of a process once and returns the
+// result. The process's health state, failure count and schedule are left
+// as they are.
+func (pm *ProcessManager) TestHealthCheck(name string) (HealthCheckResult, error) {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var hc *config.HealthCheckConfig
+	if ok {
+		hc = state.Config.HealthCheck
+	}
+	pm.mu.RUnlock()
+
+	if !ok {
+		return HealthCheckResult{}, ErrProcessNotFound
+	}
+	if hc == nil {
+		return HealthCheckResult{}, ErrNoHealthCheck
+	}
+	return probeHealth(*hc), nil
+}
+
+// RunHealthCheck runs a single probe and returns nil if the process is healthy.
+func RunHealthCheck(hc config.HealthCheckConfig) error {
+	if result := probeHealth(hc); !result.Passed {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+func probeHealth(hc config.HealthCheckConfig) HealthCheckResult {
+	timeout := time.Duration(hc.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var result HealthCheckResult
+	start := time.Now()
+	err := func() error {
+		switch {
+		case hc.Command != "":
+			result.Probe = "command"
+			output, err := exec.CommandContext(ctx, "sh", "-c", hc.Command).CombinedOutput()
+			result.Body = snippet(output)
+			return err
+
+		case hc.HTTP != "":
+			result.Probe = "http"
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.HTTP, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			result.StatusCode = resp.StatusCode
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, healthBodySnippet))
+			result.Body = snippet(body)
+			if resp.StatusCode >= 400 {
+				return fmt.Errorf("health check returned %s", resp.Status)
+			}
+			return nil
+
+		case hc.TCP != "":
+			result.Probe = "tcp"
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", hc.TCP)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+		return fmt.Errorf("no health check probe configured")
+	}()
+
+	result.Latency = time.Since(start).Seconds()
+	result.Passed = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// snippet returns the start of a probe's output, at most healthBodySnippet
+// bytes.
+func snippet(output []byte) string {
+	if len(output) > healthBodySnippet {
+		output = output[:healthBodySnippet]
+	}
+	return strings.ToValidUTF8(string(output), "")
+}
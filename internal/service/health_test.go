@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+func TestProbeHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			http.Error(w, "database unreachable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		hc         config.HealthCheckConfig
+		probe      string
+		passed     bool
+		statusCode int
+		body       string
+	}{
+		{"command passes", config.HealthCheckConfig{Command: "echo fine"}, "command", true, 0, "fine\n"},
+		{"command fails", config.HealthCheckConfig{Command: "echo broken; exit 1"}, "command", false, 0, "broken\n"},
+		{"http passes", config.HealthCheckConfig{HTTP: srv.URL + "/up"}, "http", true, 200, "ok"},
+		{"http error status", config.HealthCheckConfig{HTTP: srv.URL + "/down"}, "http", false, 503, "database unreachable\n"},
+		{"tcp connects", config.HealthCheckConfig{TCP: ln.Addr().String()}, "tcp", true, 0, ""},
+		{"tcp refused", config.HealthCheckConfig{TCP: closed.Addr().String()}, "tcp", false, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.hc.Timeout = 5
+			result := probeHealth(tt.hc)
+			if result.Probe != tt.probe || result.Passed != tt.passed {
+				t.Errorf("probeHealth() = %s probe passed %v, want %s probe passed %v (error %q)", result.Probe, result.Passed, tt.probe, tt.passed, result.Error)
+			}
+			if result.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", result.StatusCode, tt.statusCode)
+			}
+			if result.Body != tt.body {
+				t.Errorf("Body = %q, want %q", result.Body, tt.body)
+			}
+			if (result.Error == "") != tt.passed {
+				t.Errorf("Error = %q with passed %v", result.Error, result.Passed)
+			}
+			if err := RunHealthCheck(tt.hc); (err == nil) != tt.passed {
+				t.Errorf("RunHealthCheck() = %v, want passed %v", err, tt.passed)
+			}
+		})
+	}
+}
+
+// TestCheckHealthRetries checks that a process turns unhealthy only after
+// the configured number of consecutive failures, and keeps when it was
+// last healthy.
+func TestCheckHealthRetries(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "healthy")
+	pm, _ := newTestManager(t, fmt.Sprintf(`
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+    healthcheck:
+      command: test -f %s
+      retries: 2
+`, marker))
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+
+	health := func() (string, string) {
+		p, ok := pm.GetProcess("app")
+		if !ok {
+			t.Fatal("process app not found")
+		}
+		return p.Health, p.LastHealthyAt
+	}
+
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pm.checkHealth("app")
+	state, lastHealthy := health()
+	if state != HealthHealthy || lastHealthy == "" {
+		t.Fatalf("after a passing check: health %q, last healthy %q, want healthy with a time", state, lastHealthy)
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	steps := []string{HealthHealthy, HealthUnhealthy}
+	for i, want := range steps {
+		pm.checkHealth("app")
+		got, at := health()
+		if got != want {
+			t.Errorf("after %d failed check(s): health = %q, want %q", i+1, got, want)
+		}
+		if at != lastHealthy {
+			t.Errorf("after %d failed check(s): last healthy = %q, want %q", i+1, at, lastHealthy)
+		}
+	}
+}
+
+func TestHealthCheckConfigDefaults(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: app
+    command: sleep
+    healthcheck:
+      tcp: 127.0.0.1:80
+`)
+	if _, err := pm.TestHealthCheck("missing"); err != ErrProcessNotFound {
+		t.Errorf("TestHealthCheck(missing) error = %v, want %v", err, ErrProcessNotFound)
+	}
+	pm.mu.RLock()
+	hc := *pm.processes["app"].Config.HealthCheck
+	pm.mu.RUnlock()
+	if hc.Interval != 10 || hc.Timeout != 5 || hc.Retries != 3 {
+		t.Errorf("defaults = interval %d, timeout %d, retries %d, want 10, 5, 3", hc.Interval, hc.Timeout, hc.Retries)
+	}
+}
+
+func TestHealthCheckConcurrency(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		want        int64
+	}{
+		{2, 2},
+		{0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.concurrency), func(t *testing.T) {
+			var inFlight, most atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					m := most.Load()
+					if n <= m || most.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(200 * time.Millisecond)
+			}))
+			defer srv.Close()
+
+			yaml := fmt.Sprintf("health_check_concurrency: %d\nprocesses:\n", tt.concurrency)
+			names := []string{"a", "b", "c", "d"}
+			for _, name := range names {
+				yaml += fmt.Sprintf("  - name: %s\n    command: sleep\n    args: [\"30\"]\n    healthcheck:\n      http: %s\n", name, srv.URL)
+			}
+			pm, _ := newTestManager(t, yaml)
+
+			var wg sync.WaitGroup
+			for _, name := range names {
+				if err := pm.StartProcess(name); err != nil {
+					t.Fatal(err)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					pm.checkHealth(name)
+				}()
+			}
+			wg.Wait()
+
+			if got := most.Load(); got != tt.want {
+				t.Errorf("at most %d probes ran at once, want %d", got, tt.want)
+			}
+			for _, name := range names {
+				if p, _ := pm.GetProcess(name); p.Health != HealthHealthy {
+					t.Errorf("%s health = %s, want %s", name, p.Health, HealthHealthy)
+				}
+			}
+		})
+	}
+}
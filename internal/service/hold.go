@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrProcessHeld is returned when starting a process that is held.
+var ErrProcessHeld = errors.New("process is held")
+
+// HoldProcess stops the process if it is running and keeps it stopped until
+// ReleaseProcess: it cannot be started and no automatic restart, health
+// check, watchdog or binary check touches it. Holding a held process only
+// makes sure it is stopped.
+func (pm *ProcessManager) HoldProcess(name string) error {
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.Unlock()
+		return ErrProcessNotFound
+	}
+	wasHeld := state.held
+	if !wasHeld {
+		state.held = true
+		state.heldSince = time.Now()
+	}
+	// Cancel a pending automatic restart, deferred start or delayed autostart
+	state.startPending = false
+	state.bootStartAt = time.Time{}
+	if state.Status != "running" && state.cancel != nil {
+		state.cancel()
+		state.cancel = nil
+		state.NextRestartAt = time.Time{}
+	}
+	pm.mu.Unlock()
+
+	if !wasHeld {
+		pm.log("info", fmt.Sprintf("Process %s held", name), name)
+	}
+
+	// Starts are refused from here on, so the process stays stopped
+	if err := pm.StopProcess(name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+		return err
+	}
+	return nil
+}
+
+// ReleaseProcess returns a held process to normal supervision. It is left
+// stopped; start it to run it again.
+func (pm *ProcessManager) ReleaseProcess(name string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	state, ok := pm.processes[name]
+	if !ok {
+		return ErrProcessNotFound
+	}
+	if !state.held {
+		return nil
+	}
+
+	state.held = false
+	state.heldSince = time.Time{}
+	pm.log("info", fmt.Sprintf("Process %s released", name), name)
+	return nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// canRestartRetryInterval is how long a deferred restart waits before
+// asking the CanRestart hook again.
+const canRestartRetryInterval = 10 * time.Second
+
+// runCanRestartHook runs the process's CanRestart command and reports whether
+// the automatic restart may proceed. Processes without a hook always may.
+func (pm *ProcessManager) runCanRestartHook(name string, cfg config.ProcessConfig) bool {
+	if cfg.CanRestart == "" {
+		return true
+	}
+
+	// The hook sees the environment the process will be started with
+	resolved, err := pm.resolveSecrets(cfg.WithInstanceVars())
+	if err == nil {
+		err = runCheckCommand(cfg.CanRestart, resolved.Directory, resolved.Environment, time.Duration(cfg.CanRestartTimeout)*time.Second)
+	}
+	if err != nil {
+		pm.log("warning", fmt.Sprintf("CanRestart hook for %s failed (%v), restart deferred", name, err), name)
+		return false
+	}
+
+	pm.log("info", fmt.Sprintf("CanRestart hook for %s passed", name), name)
+	return true
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// SeedRestartJitter makes the restart jitter sequence deterministic.
+func (pm *ProcessManager) SeedRestartJitter(seed uint64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.jitterRand = rand.New(rand.NewPCG(seed, seed))
+}
+
+// jitter spreads base uniformly over base ± restartJitter*base and adds a
+// random delay of up to maxExtra, so processes crashing together do not all
+// restart at the same moment. Callers must hold pm.mu.
+func (pm *ProcessManager) jitter(base, maxExtra time.Duration) time.Duration {
+	delay := base
+	if pm.restartJitter > 0 && base > 0 {
+		offset := pm.restartJitter * (2*pm.jitterRand.Float64() - 1)
+		delay += time.Duration(offset * float64(base))
+	}
+	if maxExtra > 0 {
+		delay += time.Duration(pm.jitterRand.Int64N(int64(maxExtra)))
+	}
+	return delay
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterBounds(t *testing.T) {
+	const base, maxExtra = 2 * time.Second, 3 * time.Second
+
+	tests := []struct {
+		name     string
+		fraction float64
+		min, max time.Duration
+	}{
+		{"max extra only", 0, base, base + maxExtra},
+		{"with restart_jitter", 0.5, base / 2, base*3/2 + maxExtra},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &ProcessManager{restartJitter: tt.fraction}
+			pm.SeedRestartJitter(1)
+			for range 1000 {
+				if d := pm.jitter(base, maxExtra); d < tt.min || d >= tt.max {
+					t.Fatalf("jitter() = %s, want within [%s, %s)", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// restartManager returns a manager whose automatic restart waits are
+// recorded in delays instead of slept, with a fixed clock.
+func restartManager(t *testing.T, yaml string) (*ProcessManager, *ProcessState, time.Time, chan time.Duration) {
+	t.Helper()
+	pm, _ := newTestManager(t, yaml)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pm.now = func() time.Time { return now }
+
+	delays := make(chan time.Duration, 10)
+	pm.sleep = func(d time.Duration) { delays <- d }
+	return pm, pm.processes["app"], now, delays
+}
+
+func TestAutoRestartDelay(t *testing.T) {
+	const config = `
+processes:
+  - name: app
+    command: /bin/true
+    autorestart: true
+    startsecs: 2
+    restart_jitter_max: 3
+`
+	var first time.Duration
+	for seed := range uint64(10) {
+		pm, state, now, delays := restartManager(t, config)
+		pm.SeedRestartJitter(seed)
+
+		// Without a cancel func the restart is no longer pending after the wait
+		pm.autoRestart("app", state)
+		delay := <-delays
+
+		if delay < 2*time.Second || delay > 5*time.Second {
+			t.Fatalf("seed %d: delay = %s, want within [StartSecs, StartSecs+RestartJitterMax]", seed, delay)
+		}
+		if !state.NextRestartAt.Equal(now.Add(delay)) {
+			t.Errorf("seed %d: NextRestartAt = %s, want %s", seed, state.NextRestartAt, now.Add(delay))
+		}
+
+		if seed == 0 {
+			first = delay
+			// The same seed gives the same delay
+			pm.SeedRestartJitter(seed)
+			pm.autoRestart("app", state)
+			if again := <-delays; again != first {
+				t.Errorf("seed 0 repeated: delay = %s, want %s", again, first)
+			}
+		}
+	}
+}
+
+func TestAutoRestartCanRestartRetry(t *testing.T) {
+	pm, state, now, delays := restartManager(t, `
+processes:
+  - name: app
+    command: /bin/true
+    autorestart: true
+    startsecs: 2
+    canrestart: "exit 1"
+`)
+	pm.mu.Lock()
+	state.cancel = func() {}
+	pm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pm.autoRestart("app", state)
+	}()
+
+	if d := <-delays; d != 2*time.Second {
+		t.Errorf("first delay = %s, want 2s", d)
+	}
+	if d := <-delays; d != canRestartRetryInterval {
+		t.Errorf("retry delay = %s, want %s", d, canRestartRetryInterval)
+	}
+
+	// Stopping the process ends the retries after the current wait
+	pm.mu.Lock()
+	next := state.NextRestartAt
+	state.cancel = nil
+	pm.mu.Unlock()
+	<-done
+
+	if want := now.Add(canRestartRetryInterval); !next.Equal(want) {
+		t.Errorf("NextRestartAt = %s, want %s", next, want)
+	}
+}
+
+// TestCanRestartHookEnvironment checks that the CanRestart hook runs with
+// the environment of the process, including the supervisor's base
+// environment and resolved secrets.
+func TestCanRestartHookEnvironment(t *testing.T) {
+	pm, _ := newTestManager(t, `
+environment:
+  REGION: eu
+processes:
+  - name: app
+    command: /bin/true
+    environment:
+      TOKEN: ${secret:token}
+    canrestart: 'test "$REGION" = eu && test "$TOKEN" = s3cret'
+`)
+	pm.mu.RLock()
+	cfg := pm.processes["app"].Config
+	pm.mu.RUnlock()
+
+	pm.secrets = fakeSecrets{"token": "s3cret"}
+	if !pm.runCanRestartHook("app", cfg) {
+		t.Error("hook failed with the process environment")
+	}
+
+	pm.secrets = fakeSecrets{"token": "rotated"}
+	if pm.runCanRestartHook("app", cfg) {
+		t.Error("hook passed with a different secret")
+	}
+
+	pm.secrets = fakeSecrets{}
+	if pm.runCanRestartHook("app", cfg) {
+		t.Error("hook passed with an unresolvable secret")
+	}
+}
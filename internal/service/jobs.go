@@ -0,0 +1,188 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// maxJobs is how many finished jobs are kept for progress lookups.
+const maxJobs = 100
+
+// JobResult is the outcome of a bulk operation for a single process.
+type JobResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // "ok" or "failed"
+	Error  string `json:"error,omitempty"`
+}
+
+// Job tracks the progress of a bulk operation running in the background.
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Status     string      `json:"status"` // "running" or "completed"
+	Total      int         `json:"total"`
+	Restarted  int         `json:"restarted"`
+	Failed     int         `json:"failed"`
+	Results    []JobResult `json:"results"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	// MaxUnavailable is the limit a rolling restart of replicas observed
+	MaxUnavailable int `json:"max_unavailable,omitempty"`
+}
+
+type jobRegistry struct {
+	mu    sync.RWMutex
+	jobs  map[string]*Job
+	order []string
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*Job)}
+}
+
+func (jr *jobRegistry) create(jobType string, total int) *Job {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	job := &Job{
+		ID:        hex.EncodeToString(id),
+		Type:      jobType,
+		Status:    "running",
+		Total:     total,
+		Results:   []JobResult{},
+		StartedAt: time.Now(),
+	}
+
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	jr.jobs[job.ID] = job
+	jr.order = append(jr.order, job.ID)
+
+	return job
+}
+
+// evict forgets the oldest finished jobs beyond maxJobs. Running jobs are
+// kept however many there are. Callers must hold jr.mu.
+func (jr *jobRegistry) evict() {
+	finished := 0
+	for _, id := range jr.order {
+		if jr.jobs[id].Status != "running" {
+			finished++
+		}
+	}
+
+	kept := jr.order[:0]
+	for _, id := range jr.order {
+		if finished > maxJobs && jr.jobs[id].Status != "running" {
+			delete(jr.jobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	jr.order = kept
+}
+
+// setMaxUnavailable records the limit a rolling restart of replicas
+// observes.
+func (jr *jobRegistry) setMaxUnavailable(job *Job, n int) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	job.MaxUnavailable = n
+}
+
+func (jr *jobRegistry) report(job *Job, name string, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	result := JobResult{Name: name, Status: "ok"}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		job.Failed++
+	} else {
+		job.Restarted++
+	}
+	job.Results = append(job.Results, result)
+}
+
+func (jr *jobRegistry) finish(job *Job) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	now := time.Now()
+	job.Status = "completed"
+	job.FinishedAt = &now
+	job.Total = len(job.Results)
+	jr.evict()
+}
+
+// get returns a copy of the job so callers can read it without locking.
+func (jr *jobRegistry) get(id string) (Job, bool) {
+	jr.mu.RLock()
+	defer jr.mu.RUnlock()
+
+	job, ok := jr.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	snapshot := *job
+	snapshot.Results = make([]JobResult, len(job.Results))
+	copy(snapshot.Results, job.Results)
+	return snapshot, true
+}
+
+// GetJob returns the current progress of a background bulk operation.
+func (pm *ProcessManager) GetJob(id string) (Job, error) {
+	job, ok := pm.jobs.get(id)
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// RestartAllAsync restarts all running processes in the background and
+// returns the job tracking its progress.
+func (pm *ProcessManager) RestartAllAsync() Job {
+	job := pm.jobs.create("restart-all", pm.countRunning())
+	go func() {
+		pm.restartAll(func(name string, err error) { pm.jobs.report(job, name, err) })
+		pm.jobs.finish(job)
+	}()
+
+	snapshot, _ := pm.jobs.get(job.ID)
+	return snapshot
+}
+
+// RestartSelectedAsync restarts the named processes in the background and
+// returns the job tracking its progress.
+func (pm *ProcessManager) RestartSelectedAsync(names []string) Job {
+	job := pm.jobs.create("restart-selected", len(names))
+	go func() {
+		pm.restartSelected(names, func(name string, err error) { pm.jobs.report(job, name, err) })
+		pm.jobs.finish(job)
+	}()
+
+	snapshot, _ := pm.jobs.get(job.ID)
+	return snapshot
+}
+
+func (pm *ProcessManager) countRunning() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	count := 0
+	for _, state := range pm.processes {
+		if state.Status == "running" {
+			count++
+		}
+	}
+	return count
+}
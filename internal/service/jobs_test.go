@@ -0,0 +1,29 @@
+package service
+
+import "testing"
+
+func TestJobEviction(t *testing.T) {
+	jr := newJobRegistry()
+	running := jr.create("restart", 1)
+
+	finished := make([]*Job, maxJobs+1)
+	for i := range finished {
+		finished[i] = jr.create("restart", 1)
+		jr.finish(finished[i])
+	}
+
+	if _, ok := jr.get(running.ID); !ok {
+		t.Error("running job evicted")
+	}
+	if _, ok := jr.get(finished[0].ID); ok {
+		t.Error("oldest finished job kept beyond maxJobs")
+	}
+	for _, job := range finished[1:] {
+		if _, ok := jr.get(job.ID); !ok {
+			t.Fatalf("finished job %s evicted, want the last %d kept", job.ID, maxJobs)
+		}
+	}
+	if len(jr.order) != maxJobs+1 {
+		t.Errorf("%d jobs kept, want %d finished and the running one", len(jr.order), maxJobs)
+	}
+}
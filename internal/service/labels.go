@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSelector = errors.New("invalid label selector")
+	ErrRollingHalted   = errors.New("rolling restart halted after a failure")
+)
+
+// Restart strategies for RestartMatching
+const (
+	StrategyAll     = "all"
+	StrategyRolling = "rolling"
+)
+
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+type requirement struct {
+	key    string
+	value  string
+	negate bool
+}
+
+// Selector matches processes by label. It is a comma-separated list of
+// key=value and key!=value requirements that must all hold.
+type Selector []requirement
+
+// ParseSelector parses a selector such as "tier=critical,env!=staging".
+func ParseSelector(s string) (Selector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("%w: empty selector", ErrInvalidSelector)
+	}
+
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		req := requirement{}
+		key, value, ok := strings.Cut(part, "!=")
+		if ok {
+			req.negate = true
+		} else if key, value, ok = strings.Cut(part, "="); !ok {
+			return nil, fmt.Errorf("%w: %q must be key=value or key!=value", ErrInvalidSelector, part)
+		}
+
+		req.key = strings.TrimSpace(key)
+		req.value = strings.TrimSpace(value)
+		if !labelPattern.MatchString(req.key) {
+			return nil, fmt.Errorf("%w: invalid key %q", ErrInvalidSelector, req.key)
+		}
+		if req.value != "" && !labelPattern.MatchString(req.value) {
+			return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidSelector, req.value)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement. A missing label
+// satisfies key!=value but not key=value.
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, req := range sel {
+		value, ok := labels[req.key]
+		if req.negate {
+			if ok && value == req.value {
+				return false
+			}
+		} else if !ok || value != req.value {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchingProcesses returns the names of processes whose labels match sel,
+// in start order.
+func (pm *ProcessManager) MatchingProcesses(sel Selector) []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return pm.orderedNames(func(state *ProcessState) bool {
+		return sel.Matches(state.Config.Labels)
+	})
+}
+
+// RestartMatching restarts (or starts) the named processes and returns the
+// outcome for each. With StrategyRolling each process must stay up for its
+// startsecs before the next one is restarted; after a failure the remaining
+// processes are left alone and reported as failed with ErrRollingHalted.
+func (pm *ProcessManager) RestartMatching(names []string, strategy string) []JobResult {
+	results := []JobResult{}
+	pm.restartMatching(names, strategy, func(name string, err error) {
+		result := JobResult{Name: name, Status: "ok"}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	})
+	return results
+}
+
+// RestartMatchingAsync runs RestartMatching in the background and returns
+// the job tracking its progress.
+func (pm *ProcessManager) RestartMatchingAsync(names []string, strategy string) Job {
+	jobType := "restart-label"
+	if strategy == StrategyRolling {
+		jobType = "restart-rolling"
+	}
+	job := pm.jobs.create(jobType, len(names))
+	go func() {
+		pm.restartMatching(names, strategy, func(name string, err error) { pm.jobs.report(job, name, err) })
+		pm.jobs.finish(job)
+	}()
+
+	snapshot, _ := pm.jobs.get(job.ID)
+	return snapshot
+}
+
+func (pm *ProcessManager) restartMatching(names []string, strategy string, report func(name string, err error)) {
+	if strategy != StrategyRolling {
+		pm.restartSelected(names, report)
+		return
+	}
+
+	pm.log("info", fmt.Sprintf("Rolling restart initiated for %d processes", len(names)), "")
+
+	halted := false
+	for _, name := range names {
+		if halted {
+			report(name, ErrRollingHalted)
+			continue
+		}
+
+		err := pm.restartOrStart(name)
+		if err == nil {
+			err = pm.waitStarted(name)
+		}
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Rolling restart halted at %s: %v", name, err), name)
+			halted = true
+		}
+		report(name, err)
+	}
+
+	if !halted {
+		pm.log("info", "Rolling restart completed", "")
+	}
+}
+
+// waitStarted waits out the process's startsecs and checks it is still running.
+func (pm *ProcessManager) waitStarted(name string) error {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var startSecs int
+	if ok {
+		startSecs = state.Config.StartSecs
+	}
+	pm.mu.RUnlock()
+	if !ok {
+		return ErrProcessNotFound
+	}
+
+	time.Sleep(time.Duration(startSecs) * time.Second)
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if state := pm.processes[name]; state == nil || state.Status != "running" {
+		return fmt.Errorf("process %s did not stay up for %ds", name, startSecs)
+	}
+	return nil
+}
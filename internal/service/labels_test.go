@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		labels   map[string]string
+		want     bool
+		wantErr  bool
+	}{
+		{"tier=critical", map[string]string{"tier": "critical"}, true, false},
+		{"tier=critical", map[string]string{"tier": "batch"}, false, false},
+		{"tier=critical", nil, false, false},
+		{"env!=staging", nil, true, false},
+		{"env!=staging", map[string]string{"env": "staging"}, false, false},
+		{" tier = critical , env != staging ", map[string]string{"tier": "critical", "env": "prod"}, true, false},
+		{"tier=critical,env!=staging", map[string]string{"tier": "critical", "env": "staging"}, false, false},
+		{"app.kubernetes.io/name=web", map[string]string{"app.kubernetes.io/name": "web"}, true, false},
+		{"", nil, false, true},
+		{"tier", nil, false, true},
+		{"=critical", nil, false, true},
+		{"tier=crit ical", nil, false, true},
+		{"tier=critical,", nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSelector) {
+					t.Errorf("ParseSelector(%q) error = %v, want %v", tt.selector, err, ErrInvalidSelector)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSelector(%q): %v", tt.selector, err)
+			}
+			if got := sel.Matches(tt.labels); got != tt.want {
+				t.Errorf("Matches(%v) = %v, want %v", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartMatching(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: api
+    command: sleep
+    args: ["30"]
+    priority: 2
+    labels: {tier: critical}
+  - name: broken
+    command: /bin/sh
+    args: ["-c", "exit 1"]
+    priority: 1
+    labels: {tier: critical}
+  - name: worker
+    command: sleep
+    args: ["30"]
+    labels: {tier: batch}
+`)
+	sel, err := ParseSelector("tier=critical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := pm.MatchingProcesses(sel)
+	if want := []string{"broken", "api"}; !slices.Equal(names, want) {
+		t.Fatalf("MatchingProcesses() = %q, want %q", names, want)
+	}
+
+	// broken exits before its startsecs, so the rest are left alone
+	results := pm.RestartMatching(names, StrategyRolling)
+	if len(results) != 2 {
+		t.Fatalf("RestartMatching() = %+v, want 2 results", results)
+	}
+	if results[0].Name != "broken" || results[0].Status != "failed" {
+		t.Errorf("first result = %+v, want broken failed", results[0])
+	}
+	if results[1].Name != "api" || results[1].Error != ErrRollingHalted.Error() {
+		t.Errorf("second result = %+v, want api halted", results[1])
+	}
+	if p, _ := pm.GetProcess("api"); p.Status == "running" {
+		t.Error("api started after the rolling restart halted")
+	}
+	for _, entry := range pm.GetLogs(100) {
+		if entry.Message == "Rolling restart completed" {
+			t.Error("halted rolling restart logged as completed")
+		}
+	}
+
+	// A process removed during the rollout fails it rather than panicking
+	if err := pm.waitStarted("removed"); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("waitStarted(removed) error = %v, want %v", err, ErrProcessNotFound)
+	}
+
+	results = pm.RestartMatching([]string{"api"}, StrategyAll)
+	if len(results) != 1 || results[0].Status != "ok" {
+		t.Errorf("RestartMatching(all) = %+v, want api ok", results)
+	}
+	if p, _ := pm.GetProcess("worker"); p.Status == "running" {
+		t.Error("worker restarted without matching the selector")
+	}
+}
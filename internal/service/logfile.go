@@ -0,0 +1,260 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pupervisor/internal/archive"
+	"pupervisor/internal/config"
+)
+
+// logFileOptions are the rotation and durability settings of process log
+// files.
+type logFileOptions struct {
+	maxSize int64
+	backups int
+	// fsync is a config.LogFsync* policy; with config.LogFsyncInterval
+	// written data is synced every fsyncInterval
+	fsync         string
+	fsyncInterval time.Duration
+	// archive, if set and enabled, receives each rotated file
+	archive *archive.Archiver
+}
+
+// rotatingFile is a process log file that is renamed to path.1 (shifting
+// older backups up to path.<backups>) once it would grow beyond maxSize.
+type rotatingFile struct {
+	mu    sync.Mutex
+	path  string
+	opts  logFileOptions
+	file  *os.File
+	size  int64
+	dirty bool // written since the last sync
+	stop  chan struct{}
+}
+
+func openRotatingFile(path string, opts logFileOptions) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, opts: opts}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	if opts.fsync == config.LogFsyncInterval && opts.fsyncInterval > 0 {
+		rf.stop = make(chan struct{})
+		go rf.syncLoop()
+	}
+	return rf, nil
+}
+
+// syncLoop syncs data written since the last tick until the file is closed.
+func (rf *rotatingFile) syncLoop() {
+	ticker := time.NewTicker(rf.opts.fsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rf.stop:
+			return
+		case <-ticker.C:
+			rf.mu.Lock()
+			if rf.file != nil && rf.dirty {
+				_ = rf.file.Sync()
+				rf.dirty = false
+			}
+			rf.mu.Unlock()
+		}
+	}
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+// WriteLine appends a line, rotating first if it would exceed maxSize.
+func (rf *rotatingFile) WriteLine(line string) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return os.ErrClosed
+	}
+
+	data := line + "\n"
+	if rf.opts.maxSize > 0 && rf.size > 0 && rf.size+int64(len(data)) > rf.opts.maxSize {
+		if err := rf.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := rf.file.WriteString(data)
+	rf.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if rf.opts.fsync == config.LogFsyncAlways {
+		return rf.file.Sync()
+	}
+	rf.dirty = true
+	return nil
+}
+
+// sync flushes unsynced data unless the policy is none. Callers must hold
+// rf.mu.
+func (rf *rotatingFile) sync() {
+	if rf.dirty && rf.opts.fsync != config.LogFsyncNone {
+		_ = rf.file.Sync()
+	}
+	rf.dirty = false
+}
+
+func (rf *rotatingFile) rotate() error {
+	rf.sync()
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+	rf.archiveSegment()
+
+	if rf.opts.backups <= 0 {
+		if err := os.Remove(rf.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return rf.open()
+	}
+
+	for i := rf.opts.backups - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", rf.path, i)
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", rf.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+// archiveSegment queues the closed file for upload, named after it and the
+// time of rotation. Callers must hold rf.mu.
+func (rf *rotatingFile) archiveSegment() {
+	a := rf.opts.archive
+	if a == nil || !a.Enabled() {
+		return
+	}
+	data, err := os.ReadFile(rf.path)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	a.Upload(filepath.Base(rf.path)+"-"+time.Now().UTC().Format(archiveTimeFormat), data)
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	if rf.stop != nil {
+		close(rf.stop)
+	}
+	rf.sync()
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// processLogs are the files a process's output is written to. In the
+// default combined mode stdout and stderr are the same file and each line
+// is tagged with its stream.
+type processLogs struct {
+	stdout   *rotatingFile
+	stderr   *rotatingFile
+	combined bool
+}
+
+// openProcessLogs opens <name>.log in dir, or <name>.out.log and
+// <name>.err.log if split is set.
+func openProcessLogs(dir, name string, split bool, opts logFileOptions) (*processLogs, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// Names come from the API too; keep them inside dir
+	base := filepath.Join(dir, strings.NewReplacer("/", "_", `\`, "_").Replace(name))
+
+	if !split {
+		f, err := openRotatingFile(base+".log", opts)
+		if err != nil {
+			return nil, err
+		}
+		return &processLogs{stdout: f, stderr: f, combined: true}, nil
+	}
+
+	stdout, err := openRotatingFile(base+".out.log", opts)
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := openRotatingFile(base+".err.log", opts)
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	return &processLogs{stdout: stdout, stderr: stderr}, nil
+}
+
+func (pl *processLogs) WriteStdout(line string) {
+	pl.write(pl.stdout, "stdout", line)
+}
+
+func (pl *processLogs) WriteStderr(line string) {
+	pl.write(pl.stderr, "stderr", line)
+}
+
+// write drops the line on error; it is still kept in the output buffer.
+func (pl *processLogs) write(f *rotatingFile, stream, line string) {
+	ts := time.Now().Format(time.RFC3339)
+	if pl.combined {
+		_ = f.WriteLine(fmt.Sprintf("%s [%s] %s", ts, stream, line))
+		return
+	}
+	_ = f.WriteLine(ts + " " + line)
+}
+
+func (pl *processLogs) Close() {
+	pl.stdout.Close()
+	if !pl.combined {
+		pl.stderr.Close()
+	}
+}
+
+// logFileOptions returns the log file settings for a process, which may
+// override the fsync policy.
+func (pm *ProcessManager) logFileOptions(procCfg config.ProcessConfig) logFileOptions {
+	opts := logFileOptions{
+		maxSize:       pm.logMaxSize,
+		backups:       pm.logBackups,
+		fsync:         pm.logFsync,
+		fsyncInterval: pm.logFsyncInterval,
+		archive:       pm.archive.Load(),
+	}
+	switch procCfg.LogFsyncPolicy {
+	case config.LogFsyncNone, config.LogFsyncInterval, config.LogFsyncAlways:
+		opts.fsync = procCfg.LogFsyncPolicy
+	}
+	return opts
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := openRotatingFile(path, logFileOptions{maxSize: 10, backups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	// Each line is 6 bytes with its newline, so every second one rotates
+	for _, line := range []string{"line1", "line2", "line3", "line4", "line5"} {
+		if err := rf.WriteLine(line); err != nil {
+			t.Fatalf("WriteLine(%s): %v", line, err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "line5\n",
+		path + ".1": "line4\n",
+		path + ".2": "line3\n",
+	}
+	for file, content := range want {
+		if got := readFile(t, file); got != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("a third backup was kept: %v", err)
+	}
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.WriteLine("late"); err != os.ErrClosed {
+		t.Errorf("WriteLine after Close = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := openRotatingFile(path, logFileOptions{maxSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for _, line := range []string{"first", "second"} {
+		if err := rf.WriteLine(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("log = %q, want only the line after rotation", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("a backup was kept with backups 0: %v", err)
+	}
+}
+
+func TestProcessLogs(t *testing.T) {
+	line := regexp.MustCompile(`^\S+ (.*)$`)
+	content := func(path string) []string {
+		var lines []string
+		for _, l := range strings.Split(strings.TrimSuffix(readFile(t, path), "\n"), "\n") {
+			m := line.FindStringSubmatch(l)
+			if m == nil {
+				t.Fatalf("%s: line %q has no timestamp", filepath.Base(path), l)
+			}
+			lines = append(lines, m[1])
+		}
+		return lines
+	}
+
+	t.Run("combined", func(t *testing.T) {
+		dir := t.TempDir()
+		pl, err := openProcessLogs(dir, "web/1", false, logFileOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pl.WriteStdout("listening")
+		pl.WriteStderr("warning")
+		pl.Close()
+
+		got := content(filepath.Join(dir, "web_1.log"))
+		if want := []string{"[stdout] listening", "[stderr] warning"}; !slices.Equal(got, want) {
+			t.Errorf("web_1.log = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		dir := t.TempDir()
+		pl, err := openProcessLogs(dir, "web", true, logFileOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pl.WriteStdout("listening")
+		pl.WriteStderr("warning")
+		pl.Close()
+
+		if got := content(filepath.Join(dir, "web.out.log")); len(got) != 1 || got[0] != "listening" {
+			t.Errorf("web.out.log = %q, want the stdout line", got)
+		}
+		if got := content(filepath.Join(dir, "web.err.log")); len(got) != 1 || got[0] != "warning" {
+			t.Errorf("web.err.log = %q, want the stderr line", got)
+		}
+	})
+}
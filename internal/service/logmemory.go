@@ -0,0 +1,181 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"pupervisor/internal/config"
+)
+
+// defaultOutputBufferSize is how many output lines per stream a process
+// keeps in memory when no log_buffer_size is configured.
+const defaultOutputBufferSize = 500
+
+// logBudget caps the bytes held by all output buffers together.
+type logBudget struct {
+	limit int64 // bytes; 0 means no limit
+	used  atomic.Int64
+	// evicting is held by the one goroutine bringing used back under limit
+	evicting sync.Mutex
+}
+
+func (b *logBudget) over() bool {
+	return b.limit > 0 && b.used.Load() > b.limit
+}
+
+// resize adds delta bytes to the buffer's size. Callers must hold ob.mu.
+func (ob *OutputBuffer) resize(delta int) {
+	ob.size += delta
+	if ob.budget != nil {
+		ob.budget.used.Add(int64(delta))
+	}
+}
+
+// Size returns the number of bytes of output the buffer holds.
+func (ob *OutputBuffer) Size() int {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.size
+}
+
+// evict drops the oldest lines until at least n bytes are freed or the
+// buffer is empty, and returns the bytes freed.
+func (ob *OutputBuffer) evict(n int) int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	var stdoutInAll, stderrInAll int
+	for _, line := range ob.all {
+		if line.stderr {
+			stderrInAll++
+		} else {
+			stdoutInAll++
+		}
+	}
+
+	freed := 0
+	for freed < n && ob.size-freed > 0 {
+		switch {
+		// Lines that already left the combined output are the oldest
+		case len(ob.stdout) > stdoutInAll:
+			freed += len(ob.stdout[0])
+			ob.stdout = ob.stdout[1:]
+		case len(ob.stderr) > stderrInAll:
+			freed += len(ob.stderr[0])
+			ob.stderr = ob.stderr[1:]
+		default:
+			line := ob.all[0]
+			ob.all = ob.all[1:]
+			if line.stderr {
+				ob.stderr = ob.stderr[1:]
+				stderrInAll--
+			} else {
+				ob.stdout = ob.stdout[1:]
+				stdoutInAll--
+			}
+			freed += len(line.text)
+		}
+	}
+	ob.resize(-freed)
+	return freed
+}
+
+// release stops counting the buffer against its budget, once it is no
+// longer a process's current buffer.
+func (ob *OutputBuffer) release() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.budget != nil {
+		ob.budget.used.Add(-int64(ob.size))
+		ob.budget = nil
+	}
+}
+
+// newOutputBuffer replaces the process's output buffer with an empty one
+// counted against the log memory budget. Callers must hold pm.mu.
+func (pm *ProcessManager) newOutputBuffer(state *ProcessState) {
+	if state.outputBuffer != nil {
+		state.outputBuffer.release()
+	}
+	state.outputBuffer = NewOutputBuffer(pm.outputBufferSize(state.Config))
+	state.outputBuffer.budget = &pm.logMemory
+}
+
+// outputBufferSize is how many lines per stream the output buffer of a
+// process keeps: its log_buffer_size, or the global one.
+func (pm *ProcessManager) outputBufferSize(cfg config.ProcessConfig) int {
+	switch {
+	case cfg.LogBufferSize > 0:
+		return cfg.LogBufferSize
+	case pm.logBufferSize > 0:
+		return pm.logBufferSize
+	}
+	return defaultOutputBufferSize
+}
+
+// enforceLogMemory evicts output once all buffers together exceed
+// log_memory_limit: the oldest lines of the largest buffer go first, so a
+// few chatty processes cannot push out everyone else's output.
+func (pm *ProcessManager) enforceLogMemory() {
+	if !pm.logMemory.over() || !pm.logMemory.evicting.TryLock() {
+		return
+	}
+	defer pm.logMemory.evicting.Unlock()
+
+	pm.mu.RLock()
+	buffers := make([]*OutputBuffer, 0, len(pm.processes))
+	for _, state := range pm.processes {
+		if state.outputBuffer != nil {
+			buffers = append(buffers, state.outputBuffer)
+		}
+	}
+	pm.mu.RUnlock()
+
+	for pm.logMemory.over() {
+		var largest *OutputBuffer
+		largestSize, secondSize := 0, 0
+		for _, ob := range buffers {
+			size := ob.Size()
+			if size > largestSize {
+				largest, largestSize, secondSize = ob, size, largestSize
+			} else if size > secondSize {
+				secondSize = size
+			}
+		}
+		if largest == nil {
+			return
+		}
+		// Shrink the largest buffer at most down to the next largest
+		excess := int(pm.logMemory.used.Load() - pm.logMemory.limit)
+		if largest.evict(max(min(excess, largestSize-secondSize), 1)) == 0 {
+			return
+		}
+	}
+}
+
+// LogMemoryUsage is the memory held by process output buffers.
+type LogMemoryUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	LimitBytes int64 `json:"limit_bytes"` // 0 if there is no limit
+	// Processes maps process names to the bytes their buffer holds
+	Processes map[string]int `json:"processes"`
+}
+
+// LogMemoryUsage reports the bytes held by the output buffers of all
+// processes against log_memory_limit.
+func (pm *ProcessManager) LogMemoryUsage() LogMemoryUsage {
+	usage := LogMemoryUsage{
+		UsedBytes:  pm.logMemory.used.Load(),
+		LimitBytes: pm.logMemory.limit,
+		Processes:  make(map[string]int),
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	for name, state := range pm.processes {
+		if state.outputBuffer != nil {
+			usage.Processes[name] = state.outputBuffer.Size()
+		}
+	}
+	return usage
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputBufferEvict(t *testing.T) {
+	ob := NewOutputBuffer(10)
+	ob.AddStdout("out 1")
+	ob.AddStderr("err 1")
+	ob.AddStdout("out 2")
+	ob.AddStderr("err 2")
+
+	if got := ob.Size(); got != 20 {
+		t.Fatalf("Size() = %d, want 20", got)
+	}
+	if freed := ob.evict(6); freed != 10 {
+		t.Errorf("evict(6) = %d, want 10", freed)
+	}
+	if got, want := ob.GetLastLines(10), []string{"out 2", "err 2"}; !slices.Equal(got, want) {
+		t.Errorf("GetLastLines() = %q, want %q", got, want)
+	}
+	if ob.GetStdout() != "out 2" || ob.GetStderr() != "err 2" {
+		t.Errorf("streams = %q, %q, want the newest line of each", ob.GetStdout(), ob.GetStderr())
+	}
+	if got := ob.Size(); got != 10 {
+		t.Errorf("Size() after evicting = %d, want 10", got)
+	}
+}
+
+func TestEnforceLogMemory(t *testing.T) {
+	pm, _ := newTestManager(t, `
+log_memory_limit: 1
+processes:
+  - name: chatty
+    command: sleep
+    args: ["30"]
+  - name: quiet
+    command: sleep
+    args: ["30"]
+`)
+
+	pm.mu.Lock()
+	chatty, quiet := pm.processes["chatty"], pm.processes["quiet"]
+	pm.newOutputBuffer(chatty)
+	pm.newOutputBuffer(quiet)
+	pm.mu.Unlock()
+
+	line := strings.Repeat("x", 4<<10)
+	for range 25 {
+		quiet.outputBuffer.AddStdout(line)
+	}
+	for i := range 400 {
+		chatty.outputBuffer.AddStdout(fmt.Sprintf("%05d %s", i, line))
+	}
+	pm.enforceLogMemory()
+
+	usage := pm.LogMemoryUsage()
+	if usage.LimitBytes != 1<<20 {
+		t.Errorf("LimitBytes = %d, want %d", usage.LimitBytes, 1<<20)
+	}
+	if usage.UsedBytes > usage.LimitBytes {
+		t.Errorf("UsedBytes = %d, want at most the limit %d", usage.UsedBytes, usage.LimitBytes)
+	}
+	if got, want := usage.Processes["quiet"], 25*len(line); got != want {
+		t.Errorf("quiet buffer = %d bytes, want all %d kept", got, want)
+	}
+	if last := chatty.outputBuffer.GetLastLines(1); len(last) != 1 || !strings.HasPrefix(last[0], "00399 ") {
+		t.Error("the newest line of the chatty process was evicted")
+	}
+
+	// A replaced buffer no longer counts against the limit
+	pm.mu.Lock()
+	pm.newOutputBuffer(chatty)
+	pm.mu.Unlock()
+	if got := pm.LogMemoryUsage().UsedBytes; got != int64(25*len(line)) {
+		t.Errorf("UsedBytes after replacing a buffer = %d, want %d", got, 25*len(line))
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// logSampleSummaryInterval is how often a sampled process logs how many of
+// its lines were kept.
+const logSampleSummaryInterval = 10 * time.Second
+
+// logSampler decides which output lines of a sampled process reach the log
+// view. Both output streams share one sampler.
+type logSampler struct {
+	sampling config.LogSampling
+
+	mu   sync.Mutex
+	seen int
+	kept int
+	next int // lines until the next kept line with sampling.Every
+}
+
+func newLogSampler(sampling *config.LogSampling) *logSampler {
+	if sampling == nil {
+		return nil
+	}
+	return &logSampler{sampling: *sampling}
+}
+
+// keep reports whether the next line should be logged. A nil sampler keeps
+// every line.
+func (s *logSampler) keep() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seen++
+	var keep bool
+	if s.sampling.Every > 0 {
+		keep = s.next == 0
+		s.next = (s.next + 1) % s.sampling.Every
+	} else {
+		keep = rand.Float64() < s.sampling.Rate
+	}
+	if keep {
+		s.kept++
+	}
+	return keep
+}
+
+// take returns the lines seen and kept since the last call.
+func (s *logSampler) take() (seen, kept int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen, kept = s.seen, s.kept
+	s.seen, s.kept = 0, 0
+	return seen, kept
+}
+
+// reportSampling logs a "sampled X of Y lines" entry for name every
+// logSampleSummaryInterval in which it wrote output, and a last one once its
+// output is drained.
+func (pm *ProcessManager) reportSampling(name string, sampler *logSampler, drained <-chan struct{}) {
+	ticker := time.NewTicker(logSampleSummaryInterval)
+	defer ticker.Stop()
+
+	report := func() {
+		if seen, kept := sampler.take(); seen > 0 {
+			pm.log("info", fmt.Sprintf("Sampled %d of %d output lines from %s", kept, seen, name), name)
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			report()
+		case <-drained:
+			report()
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+)
+
+func TestLogSampler(t *testing.T) {
+	keeps := func(s *logSampler, n int) []bool {
+		var got []bool
+		for range n {
+			got = append(got, s.keep())
+		}
+		return got
+	}
+
+	every := newLogSampler(&config.LogSampling{Every: 3})
+	if got, want := keeps(every, 7), []bool{true, false, false, true, false, false, true}; !slices.Equal(got, want) {
+		t.Errorf("1 in 3 keep() = %v, want %v", got, want)
+	}
+	if seen, kept := every.take(); seen != 7 || kept != 3 {
+		t.Errorf("take() = %d, %d, want 7, 3", seen, kept)
+	}
+	if seen, kept := every.take(); seen != 0 || kept != 0 {
+		t.Errorf("take() again = %d, %d, want 0, 0", seen, kept)
+	}
+
+	all := newLogSampler(&config.LogSampling{Rate: 1})
+	if got := keeps(all, 5); slices.Contains(got, false) {
+		t.Errorf("rate 1 keep() = %v, want every line kept", got)
+	}
+
+	none := newLogSampler(nil)
+	if !none.keep() {
+		t.Error("keep() without sampling = false, want true")
+	}
+}
+
+func TestSampledOutput(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: chatty
+    command: /bin/sh
+    args: ["-c", "for i in 1 2 3 4 5 6 7 8 9 10; do echo line $i; done"]
+    sample_rate: 1 in 5
+`)
+	if err := pm.StartProcess("chatty"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the sampling summary", func() bool {
+		return hasLog(pm, "chatty", "info", "Sampled 2 of 10 output lines from chatty")
+	})
+
+	var lines []string
+	for _, entry := range pm.GetLogsByProcess("chatty", 100) {
+		if entry.Source != models.LogSourceSystem {
+			lines = append(lines, entry.Message)
+		}
+	}
+	if want := []string{"[chatty] line 1", "[chatty] line 6"}; !slices.Equal(lines, want) {
+		t.Errorf("logged output = %q, want %q", lines, want)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+)
+
+const (
+	storageMaintenanceInterval = time.Minute
+	storageTrimBatch           = 500
+)
+
+// StartStorageMaintenance periodically deletes crashes, error logs and state
+// transitions older than their retention and, while the database exceeds its
+// configured maximum size, the oldest crashes, error logs, notifications and
+// transitions.
+func (pm *ProcessManager) StartStorageMaintenance() {
+	if pm.storage == nil {
+		return
+	}
+
+	go func() {
+		pm.maintainStorage()
+		ticker := time.NewTicker(storageMaintenanceInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			pm.maintainStorage()
+		}
+	}()
+}
+
+func (pm *ProcessManager) maintainStorage() {
+	if _, err := pm.CleanupStorage(0); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to delete old records: %v", err), "")
+	}
+
+	deleted, err := pm.storage.TrimToSize(storageTrimBatch)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to trim database to its size limit: %v", err), "")
+	}
+	if deleted > 0 {
+		pm.log("info", fmt.Sprintf("Deleted %d old records to keep the database under %d bytes", deleted, pm.storage.MaxSize()), "")
+	}
+}
+
+// CleanupStorage deletes crashes, error logs and state transitions older
+// than days, or older than their configured retention if days is 0, and
+// returns the number deleted per table. Error logs of processes with
+// log_retention_days are kept that many days instead. Tables and processes
+// whose retention is -1 are left alone unless days is given.
+func (pm *ProcessManager) CleanupStorage(days int) (map[string]int64, error) {
+	if pm.storage == nil {
+		return nil, errors.New("storage not available")
+	}
+
+	tables := []struct {
+		name      string
+		retention int
+		clear     func(int) (int64, error)
+	}{
+		{"crashes", pm.retention, pm.storage.ClearOldCrashes},
+		{"transitions", pm.transitionRetention, pm.storage.ClearOldTransitions},
+	}
+
+	deleted := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		keep := table.retention
+		if days > 0 {
+			keep = days
+		}
+		if keep <= 0 {
+			continue
+		}
+		n, err := table.clear(keep)
+		if err != nil {
+			return deleted, fmt.Errorf("%s: %w", table.name, err)
+		}
+		deleted[table.name] = n
+	}
+
+	n, swept, err := pm.clearOldErrors(days)
+	if err != nil {
+		return deleted, fmt.Errorf("error_logs: %w", err)
+	}
+	if swept {
+		deleted["error_logs"] = n
+	}
+	return deleted, nil
+}
+
+// clearOldErrors deletes error logs older than days or, if days is 0, older
+// than the retention of the process they belong to. swept reports whether
+// any retention applied.
+func (pm *ProcessManager) clearOldErrors(days int) (deleted int64, swept bool, err error) {
+	if days > 0 {
+		deleted, err = pm.storage.ClearOldErrors(days)
+		return deleted, true, err
+	}
+
+	// Processes keeping their error logs longer or shorter than the global
+	// retention are swept on their own
+	pm.mu.RLock()
+	overrides := make(map[string]int)
+	for name, state := range pm.processes {
+		if keep := pm.logRetention(state.Config); keep != pm.retention {
+			overrides[name] = keep
+		}
+	}
+	pm.mu.RUnlock()
+
+	if pm.retention > 0 {
+		n, err := pm.storage.ClearOldErrors(pm.retention, slices.Collect(maps.Keys(overrides))...)
+		if err != nil {
+			return deleted, true, err
+		}
+		deleted += n
+		swept = true
+	}
+	for name, keep := range overrides {
+		if keep <= 0 {
+			continue
+		}
+		n, err := pm.storage.ClearOldProcessErrors(name, keep)
+		if err != nil {
+			return deleted, true, fmt.Errorf("%s: %w", name, err)
+		}
+		deleted += n
+		swept = true
+	}
+	return deleted, swept, nil
+}
+
+// logRetention is how many days the error logs of a process are kept: its
+// log_retention_days, or the global retention.
+func (pm *ProcessManager) logRetention(cfg config.ProcessConfig) int {
+	if cfg.LogRetentionDays != 0 {
+		return cfg.LogRetentionDays
+	}
+	return pm.retention
+}
+
+// MigrateStorage applies the schema migrations the database has not run yet
+// and returns them with the schema version it is at afterwards.
+func (pm *ProcessManager) MigrateStorage() ([]storage.Migration, int, error) {
+	if pm.storage == nil {
+		return nil, 0, errors.New("storage not available")
+	}
+
+	applied, err := pm.storage.Migrate()
+	for _, m := range applied {
+		pm.log("info", fmt.Sprintf("Applied database migration %d (%s)", m.Version, m.Name), "")
+	}
+	if err != nil {
+		return applied, 0, err
+	}
+	version, err := pm.storage.SchemaVersion()
+	return applied, version, err
+}
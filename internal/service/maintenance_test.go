@@ -0,0 +1,81 @@
+package service
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"pupervisor/internal/storage"
+)
+
+func TestCleanupStorage(t *testing.T) {
+	pm, store := newTestManager(t, `
+retention: 7
+processes: []
+`)
+
+	now := time.Now().UTC()
+	for _, age := range []int{10, 1} {
+		crashedAt := now.AddDate(0, 0, -age)
+		if err := store.SaveCrash(&storage.CrashRecord{ProcessName: "web", StartedAt: crashedAt, CrashedAt: crashedAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, age := range []int{40, 10, 1} {
+		if err := store.SaveTransition(&storage.Transition{
+			ProcessName: "web",
+			FromState:   "running",
+			ToState:     "crashed",
+			CreatedAt:   now.AddDate(0, 0, -age),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		days int
+		want map[string]int64
+	}{
+		// Transitions are kept for the default 30 days
+		{"configured retention", 0, map[string]int64{"crashes": 1, "error_logs": 0, "transitions": 1}},
+		{"again", 0, map[string]int64{"crashes": 0, "error_logs": 0, "transitions": 0}},
+		{"days given", 5, map[string]int64{"crashes": 0, "error_logs": 0, "transitions": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pm.CleanupStorage(tt.days)
+			if err != nil {
+				t.Fatalf("CleanupStorage(%d) error = %v", tt.days, err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("CleanupStorage(%d) = %v, want %v", tt.days, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanupStorageKeepsUnlimitedRetention(t *testing.T) {
+	pm, store := newTestManager(t, "processes: []\n")
+
+	crashedAt := time.Now().UTC().AddDate(-1, 0, 0)
+	if err := store.SaveCrash(&storage.CrashRecord{ProcessName: "web", StartedAt: crashedAt, CrashedAt: crashedAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := pm.CleanupStorage(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["crashes"]; ok {
+		t.Errorf("CleanupStorage(0) = %v, want crashes left alone without a retention", got)
+	}
+
+	crashes, err := store.GetCrashes(10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crashes) != 1 {
+		t.Errorf("%d crashes left, want 1", len(crashes))
+	}
+}
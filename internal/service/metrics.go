@@ -0,0 +1,293 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+)
+
+// DurationBuckets are the histogram upper bounds, in seconds, used for
+// uptime and restart interval distributions: 1s up to one day.
+var DurationBuckets = []float64{1, 5, 10, 30, 60, 300, 900, 3600, 21600, 86400}
+
+// OperationBuckets are the histogram upper bounds, in seconds, used for
+// start and stop durations: 100ms up to two minutes.
+var OperationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Histogram is a cumulative histogram in the Prometheus sense: Counts[i] is
+// the number of observations less than or equal to Buckets[i].
+type Histogram struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Sum     float64   `json:"sum"`
+	Count   uint64    `json:"count"`
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		Buckets: buckets,
+		Counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	for i, upper := range h.Buckets {
+		if v <= upper {
+			h.Counts[i]++
+		}
+	}
+	h.Sum += v
+	h.Count++
+}
+
+func (h *Histogram) clone() *Histogram {
+	c := *h
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return &c
+}
+
+// rollingWindow is how many recent operations the rolling mean covers.
+const rollingWindow = 10
+
+// operationTimes records how long a process's starts or its stops took.
+// The zero value is ready to use; it is guarded by pm.mu.
+type operationTimes struct {
+	hist   *Histogram
+	last   float64
+	max    float64
+	recent []float64 // the last rollingWindow durations, oldest first
+}
+
+func (t *operationTimes) observe(d time.Duration) {
+	if t.hist == nil {
+		t.hist = NewHistogram(OperationBuckets)
+	}
+	seconds := d.Seconds()
+	t.hist.Observe(seconds)
+	t.last = seconds
+	t.max = max(t.max, seconds)
+	t.recent = append(t.recent, seconds)
+	if len(t.recent) > rollingWindow {
+		t.recent = t.recent[1:]
+	}
+}
+
+func (t *operationTimes) count() uint64 {
+	if t.hist == nil {
+		return 0
+	}
+	return t.hist.Count
+}
+
+func (t *operationTimes) histogram() *Histogram {
+	if t.hist == nil {
+		return NewHistogram(OperationBuckets)
+	}
+	return t.hist.clone()
+}
+
+func (t *operationTimes) stats() models.DurationStats {
+	n := t.count()
+	if n == 0 {
+		return models.DurationStats{}
+	}
+	var recent float64
+	for _, d := range t.recent {
+		recent += d
+	}
+	return models.DurationStats{
+		Count:       n,
+		Last:        t.last,
+		Mean:        t.hist.Sum / float64(n),
+		RollingMean: recent / float64(len(t.recent)),
+		Max:         t.max,
+	}
+}
+
+// crashCounts are the crash metrics of a single process.
+type crashCounts struct {
+	crashes   int
+	uptime    *Histogram
+	interval  *Histogram
+	lastStart time.Time
+}
+
+// crashMetrics counts the crashes of every process as they are saved,
+// starting from the crash records stored when the supervisor started.
+// Unlike the stored records, which are deleted, trimmed and cleaned up,
+// the counts never go down, as Prometheus expects of counters. The zero
+// value is ready to use.
+type crashMetrics struct {
+	mu        sync.Mutex
+	byProcess map[string]*crashCounts
+}
+
+// seed counts the stored crashes, ordered by process and crash time.
+func (c *crashMetrics) seed(timings []storage.CrashTiming) {
+	for _, t := range timings {
+		c.observe(t.ProcessName, t.StartedAt, t.CrashedAt)
+	}
+}
+
+// observe counts a crash of the process, observing how long it ran and, if
+// it crashed before, the time between the two starts.
+func (c *crashMetrics) observe(name string, startedAt, crashedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byProcess == nil {
+		c.byProcess = make(map[string]*crashCounts)
+	}
+	counts, ok := c.byProcess[name]
+	if !ok {
+		counts = &crashCounts{uptime: NewHistogram(DurationBuckets), interval: NewHistogram(DurationBuckets)}
+		c.byProcess[name] = counts
+	}
+
+	counts.crashes++
+	if !startedAt.IsZero() && !crashedAt.IsZero() {
+		counts.uptime.Observe(crashedAt.Sub(startedAt).Seconds())
+	}
+	if !startedAt.IsZero() && !counts.lastStart.IsZero() {
+		counts.interval.Observe(startedAt.Sub(counts.lastStart).Seconds())
+	}
+	counts.lastStart = startedAt
+}
+
+// snapshot returns a copy of the counts of every process that crashed.
+func (c *crashMetrics) snapshot() map[string]crashCounts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]crashCounts, len(c.byProcess))
+	for name, cc := range c.byProcess {
+		counts[name] = crashCounts{crashes: cc.crashes, uptime: cc.uptime.clone(), interval: cc.interval.clone()}
+	}
+	return counts
+}
+
+// ProcessMetrics is a point-in-time metrics snapshot of a single process.
+type ProcessMetrics struct {
+	Name    string `json:"name"`
+	Up      bool   `json:"up"`
+	Crashes int    `json:"crashes"`
+	// Restarts counts starts after the first since the supervisor started
+	Restarts int `json:"restarts"`
+	// UptimeSeconds, MemoryBytes and CPUPercent are set while the process
+	// runs; usage is the latest sample, or read on the spot when sampling
+	// is disabled
+	UptimeSeconds     float64    `json:"uptime_seconds"`
+	MemoryBytes       int64      `json:"memory_bytes"`
+	CPUPercent        float64    `json:"cpu_percent"`
+	UptimeBeforeCrash *Histogram `json:"uptime_before_crash_seconds"`
+	RestartInterval   *Histogram `json:"restart_interval_seconds"`
+	// StartDuration is spawn to ready, StopDuration stop signal to exit of
+	// graceful stops; both since the supervisor started
+	StartDuration *Histogram `json:"start_duration_seconds"`
+	StopDuration  *Histogram `json:"stop_duration_seconds"`
+}
+
+// CollectMetrics builds metrics for every configured process, plus any process
+// that only appears in the crash history. Crash counts and histograms start
+// from the crash records stored when the supervisor started and, like start
+// and stop durations, are kept in memory.
+func (pm *ProcessManager) CollectMetrics() ([]ProcessMetrics, error) {
+	byName := make(map[string]*ProcessMetrics)
+	get := func(name string) *ProcessMetrics {
+		m, ok := byName[name]
+		if !ok {
+			m = &ProcessMetrics{
+				Name:              name,
+				UptimeBeforeCrash: NewHistogram(DurationBuckets),
+				RestartInterval:   NewHistogram(DurationBuckets),
+				StartDuration:     NewHistogram(OperationBuckets),
+				StopDuration:      NewHistogram(OperationBuckets),
+			}
+			byName[name] = m
+		}
+		return m
+	}
+
+	pids := make(map[string]int)
+	pm.mu.RLock()
+	for name, state := range pm.processes {
+		m := get(name)
+		m.Up = state.Status == "running"
+		m.Restarts = max(state.starts-1, 0)
+		m.StartDuration = state.startTimes.histogram()
+		m.StopDuration = state.stopTimes.histogram()
+		if !m.Up {
+			continue
+		}
+		if !state.StartTime.IsZero() {
+			m.UptimeSeconds = pm.now().Sub(state.StartTime).Seconds()
+		}
+		if n := len(state.usage); n > 0 && pm.usageInterval > 0 {
+			m.MemoryBytes = state.usage[n-1].MemoryBytes
+			m.CPUPercent = state.usage[n-1].CPUPercent
+		} else if state.Pid > 0 {
+			pids[name] = state.Pid
+		}
+	}
+	pm.mu.RUnlock()
+
+	// ps is run without holding the lock
+	for name, pid := range pids {
+		if memory, cpu, err := readUsage(pid); err == nil {
+			byName[name].MemoryBytes = memory
+			byName[name].CPUPercent = cpu
+		}
+	}
+
+	for name, counts := range pm.crashMetrics.snapshot() {
+		m := get(name)
+		m.Crashes = counts.crashes
+		m.UptimeBeforeCrash = counts.uptime
+		m.RestartInterval = counts.interval
+	}
+
+	result := make([]ProcessMetrics, 0, len(byName))
+	for _, m := range byName {
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+// MetricsSnapshot is every metric of the supervisor at one point in time,
+// the data behind both the Prometheus and the JSON metrics endpoints.
+type MetricsSnapshot struct {
+	Time      time.Time        `json:"time"`
+	Total     int              `json:"total"`
+	Running   int              `json:"running"`
+	Crashes   int              `json:"crashes"`
+	Restarts  int              `json:"restarts"`
+	Processes []ProcessMetrics `json:"processes"`
+}
+
+// CollectMetricsSnapshot collects the metrics of every process, see
+// CollectMetrics, with supervisor-wide totals. Total and Running only count
+// configured processes.
+func (pm *ProcessManager) CollectMetricsSnapshot() (MetricsSnapshot, error) {
+	metrics, err := pm.CollectMetrics()
+	if err != nil {
+		return MetricsSnapshot{}, err
+	}
+
+	pm.mu.RLock()
+	snapshot := MetricsSnapshot{Time: time.Now(), Total: len(pm.processes), Processes: metrics}
+	pm.mu.RUnlock()
+
+	for _, m := range metrics {
+		if m.Up {
+			snapshot.Running++
+		}
+		snapshot.Crashes += m.Crashes
+		snapshot.Restarts += m.Restarts
+	}
+	return snapshot, nil
+}
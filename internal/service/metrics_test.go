@@ -0,0 +1,141 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+)
+
+func TestHistogramBucketBoundaries(t *testing.T) {
+	h := NewHistogram([]float64{1, 5, 10})
+
+	// An observation equal to a bound falls in that bucket
+	for _, v := range []float64{0, 1, 1.0001, 5, 10, 10.5} {
+		h.Observe(v)
+	}
+
+	if want := []uint64{2, 4, 5}; !slices.Equal(h.Counts, want) {
+		t.Errorf("Counts = %v, want %v", h.Counts, want)
+	}
+	if h.Count != 6 {
+		t.Errorf("Count = %d, want 6", h.Count)
+	}
+	if h.Sum != 27.5001 {
+		t.Errorf("Sum = %v, want 27.5001", h.Sum)
+	}
+}
+
+func TestHistogramClone(t *testing.T) {
+	h := NewHistogram(OperationBuckets)
+	h.Observe(0.2)
+	c := h.clone()
+	h.Observe(0.2)
+
+	if c.Count != 1 || c.Counts[1] != 1 {
+		t.Errorf("clone changed with the original: %+v", c)
+	}
+}
+
+func TestOperationTimesStats(t *testing.T) {
+	var ot operationTimes
+	if got := ot.stats(); got != (models.DurationStats{}) {
+		t.Errorf("stats() before any observation = %+v, want zero", got)
+	}
+
+	// 12 observations of 1s..12s; the rolling mean covers the last 10
+	for i := 1; i <= rollingWindow+2; i++ {
+		ot.observe(time.Duration(i) * time.Second)
+	}
+	want := models.DurationStats{Count: 12, Last: 12, Mean: 6.5, RollingMean: 7.5, Max: 12}
+	if got := ot.stats(); got != want {
+		t.Errorf("stats() = %+v, want %+v", got, want)
+	}
+	if h := ot.histogram(); h.Count != 12 || h.Counts[len(h.Counts)-1] != 12 {
+		t.Errorf("histogram() = %+v, want 12 observations", h)
+	}
+}
+
+func TestStartStopDurationsRecorded(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+`)
+	for range 2 {
+		if err := pm.StartProcess("app"); err != nil {
+			t.Fatalf("StartProcess: %v", err)
+		}
+		if err := pm.StopProcess("app"); err != nil {
+			t.Fatalf("StopProcess: %v", err)
+		}
+	}
+
+	p, _ := pm.GetProcess("app")
+	if p.Stats == nil {
+		t.Fatal("no stats reported")
+	}
+	if p.Stats.StartDuration.Count != 2 || p.Stats.StopDuration.Count != 2 {
+		t.Errorf("stats = %+v, want 2 starts and 2 stops", *p.Stats)
+	}
+	if p.Stats.StopDuration.Max > 5 {
+		t.Errorf("longest stop took %vs, want it well under the stop timeout", p.Stats.StopDuration.Max)
+	}
+}
+
+// TestCrashMetricsNeverDecrease checks that crash counts start from the
+// stored crashes and are not lowered when crash records are deleted.
+func TestCrashMetricsNeverDecrease(t *testing.T) {
+	_, store := newTestManager(t, "processes: []\n")
+	started := time.Now().Add(-time.Hour)
+	for i := range 2 {
+		start := started.Add(time.Duration(i) * time.Minute)
+		if err := store.SaveCrash(&storage.CrashRecord{ProcessName: "old", ExitCode: 1, StartedAt: start, CrashedAt: start.Add(30 * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pm := NewProcessManager(&config.SupervisorConfig{
+		Processes: []config.ProcessConfig{{Name: "app", Command: "false", StopTimeout: 10}},
+	}, store)
+	t.Cleanup(pm.StopAll)
+
+	crashes, err := store.GetCrashesByProcess("old", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, crash := range crashes {
+		if err := store.DeleteCrash(crash.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatal(err)
+	}
+
+	var byName map[string]ProcessMetrics
+	waitFor(t, "the crash of app to be counted", func() bool {
+		metrics, err := pm.CollectMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		byName = make(map[string]ProcessMetrics)
+		for _, m := range metrics {
+			byName[m.Name] = m
+		}
+		return byName["app"].Crashes == 1
+	})
+
+	old := byName["old"]
+	if old.Crashes != 2 || old.UptimeBeforeCrash.Count != 2 || old.RestartInterval.Count != 1 {
+		t.Errorf("old metrics = %d crashes, %d uptimes, %d intervals, want 2, 2 and 1",
+			old.Crashes, old.UptimeBeforeCrash.Count, old.RestartInterval.Count)
+	}
+	if app := byName["app"]; app.UptimeBeforeCrash.Count != 1 {
+		t.Errorf("app uptime before crash count = %d, want 1", app.UptimeBeforeCrash.Count)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+
+	"pupervisor/internal/config"
+)
+
+// webhookURLSetting, while set, replaces the webhooks of the config file
+// with this single URL, so the notification target can be changed through
+// the settings API.
+const webhookURLSetting = "webhook_url"
+
+// WatchNotificationSettings applies the stored notification settings and
+// re-applies them whenever one is saved, without a restart.
+func (pm *ProcessManager) WatchNotificationSettings() {
+	if pm.storage == nil {
+		return
+	}
+
+	pm.storage.OnSettingChange(func(key, value string) {
+		if key != webhookURLSetting {
+			return
+		}
+		pm.mu.Lock()
+		pm.webhookURL = value
+		pm.mu.Unlock()
+		pm.applyWebhooks()
+		pm.log("info", "Notification webhooks updated from settings", "")
+	})
+
+	url, err := pm.storage.GetSetting(webhookURLSetting)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to read %s: %v", webhookURLSetting, err), "")
+		return
+	}
+	pm.mu.Lock()
+	pm.webhookURL = url
+	pm.mu.Unlock()
+	pm.applyWebhooks()
+}
+
+// applyWebhooks points the notifier at the webhook_url setting if set, or
+// at the webhooks of the config file.
+func (pm *ProcessManager) applyWebhooks() {
+	pm.mu.RLock()
+	webhooks := pm.fileWebhooks
+	if pm.webhookURL != "" {
+		webhooks = []config.WebhookConfig{{URL: pm.webhookURL}}
+	}
+	pm.mu.RUnlock()
+
+	pm.notifier.SetWebhooks(webhooks)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pupervisor/internal/notifier"
+)
+
+// webhookServer returns a server handing the events posted to it to the
+// test.
+func webhookServer(t *testing.T) (*httptest.Server, chan notifier.Event) {
+	t.Helper()
+	events := make(chan notifier.Event, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notifier.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, events
+}
+
+func TestWebhookSettingAppliedLive(t *testing.T) {
+	fileHook, fileEvents := webhookServer(t)
+	settingHook, settingEvents := webhookServer(t)
+
+	pm, store := newTestManager(t, fmt.Sprintf(`
+notifications:
+  webhooks:
+    - name: file
+      url: %s
+processes:
+  - name: first
+    command: /bin/sh
+    args: ["-c", "exit 1"]
+  - name: second
+    command: /bin/sh
+    args: ["-c", "exit 1"]
+`, fileHook.URL))
+	pm.WatchNotificationSettings()
+
+	crash := func(name string, events, quiet chan notifier.Event) {
+		t.Helper()
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatalf("StartProcess(%s): %v", name, err)
+		}
+		select {
+		case event := <-events:
+			if event.Process != name {
+				t.Errorf("notified of %s, want %s", event.Process, name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("crash of %s not delivered", name)
+		}
+		select {
+		case event := <-quiet:
+			t.Errorf("crash of %s also delivered to the replaced webhook", event.Process)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if err := store.SetSetting(webhookURLSetting, settingHook.URL); err != nil {
+		t.Fatal(err)
+	}
+	crash("first", settingEvents, fileEvents)
+
+	// Clearing the setting goes back to the webhooks of the config file
+	if err := store.SetSetting(webhookURLSetting, ""); err != nil {
+		t.Fatal(err)
+	}
+	crash("second", fileEvents, settingEvents)
+}
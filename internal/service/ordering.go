@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// startOrder sorts the named processes so that every process comes after the
+// processes it depends on. Among processes whose dependencies are satisfied,
+// lower Priority starts first, then name. Dependencies outside names are
+// ignored. If the dependencies form a cycle the affected processes are
+// appended in priority order and an error describing them is returned.
+func startOrder(configs map[string]config.ProcessConfig, names []string) ([]string, error) {
+	inSet := make(map[string]bool, len(names))
+	for _, name := range names {
+		inSet[name] = true
+	}
+
+	pending := make(map[string]int, len(names)) // unsatisfied dependency count
+	dependents := make(map[string][]string)
+	for _, name := range names {
+		for _, dep := range configs[name].DependsOn {
+			if !inSet[dep] || dep == name {
+				continue
+			}
+			pending[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	less := func(a, b string) bool {
+		pa, pb := configs[a].Priority, configs[b].Priority
+		if pa != pb {
+			return pa < pb
+		}
+		return a < b
+	}
+
+	var ready []string
+	for _, name := range names {
+		if pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	order := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		next := ready[0]
+		ready = ready[1:]
+
+		order = append(order, next)
+		done[next] = true
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) == len(names) {
+		return order, nil
+	}
+
+	var cyclic []string
+	for _, name := range names {
+		if !done[name] {
+			cyclic = append(cyclic, name)
+		}
+	}
+	sort.Slice(cyclic, func(i, j int) bool { return less(cyclic[i], cyclic[j]) })
+
+	return append(order, cyclic...), fmt.Errorf("dependency cycle between processes: %s", strings.Join(cyclic, ", "))
+}
+
+// stopOrder returns the names in start order, reversed, with the processes
+// listed in first moved to the front in that order.
+func stopOrder(startOrder []string, first []string) []string {
+	order := slices.Clone(startOrder)
+	slices.Reverse(order)
+	if len(first) == 0 {
+		return order
+	}
+
+	rank := make(map[string]int, len(first))
+	for i, name := range first {
+		rank[name] = i
+	}
+	slices.SortStableFunc(order, func(a, b string) int {
+		ra, okA := rank[a]
+		rb, okB := rank[b]
+		switch {
+		case okA && okB:
+			return ra - rb
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+		return 0
+	})
+	return order
+}
+
+// orderedNames returns the names of processes matching filter in start order.
+// Callers must hold pm.mu.
+func (pm *ProcessManager) orderedNames(filter func(*ProcessState) bool) []string {
+	configs := make(map[string]config.ProcessConfig, len(pm.processes))
+	var names []string
+	for name, state := range pm.processes {
+		configs[name] = state.Config
+		if filter(state) {
+			names = append(names, name)
+		}
+	}
+
+	order, err := startOrder(configs, names)
+	if err != nil {
+		pm.log("warning", err.Error(), "")
+	}
+	return order
+}
+
+// ErrDependencyNotReady is returned when a dependency of a process is not
+// ready within the dependency_wait_timeout.
+var ErrDependencyNotReady = errors.New("dependency not ready")
+
+// waitForDependencies waits up to the dependency_wait_timeout for every
+// dependency of name to be running and ready, see isReady. It returns at once
+// without a timeout.
+func (pm *ProcessManager) waitForDependencies(name string) error {
+	pm.mu.RLock()
+	timeout := pm.dependencyWait
+	var deps []string
+	if state, ok := pm.processes[name]; ok {
+		for _, dep := range state.Config.DependsOn {
+			if _, known := pm.processes[dep]; known && dep != name {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	pm.mu.RUnlock()
+
+	if timeout <= 0 || len(deps) == 0 {
+		return nil
+	}
+
+	pm.log("info", fmt.Sprintf("Waiting up to %s for dependencies of %s: %s", timeout, name, strings.Join(deps, ", ")), name)
+
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(ensurePollInterval)
+	defer ticker.Stop()
+
+	for _, dep := range deps {
+		for {
+			pm.mu.RLock()
+			state := pm.processes[dep]
+			ready := state != nil && state.Status == "running" && pm.isReady(state)
+			pm.mu.RUnlock()
+			if ready {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%w: %s not ready after %s", ErrDependencyNotReady, dep, timeout)
+			}
+			<-ticker.C
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"pupervisor/internal/config"
+)
+
+func TestStartOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []config.ProcessConfig
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "priority then name breaks ties",
+			configs: []config.ProcessConfig{
+				{Name: "b", Priority: 10},
+				{Name: "a", Priority: 10},
+				{Name: "c", Priority: 5},
+				{Name: "d"},
+			},
+			want: []string{"d", "c", "a", "b"},
+		},
+		{
+			name: "dependency outranks priority",
+			configs: []config.ProcessConfig{
+				{Name: "api", Priority: -10, DependsOn: []string{"db"}},
+				{Name: "db", Priority: 100},
+				{Name: "cron", Priority: 50},
+			},
+			want: []string{"cron", "db", "api"},
+		},
+		{
+			name: "diamond",
+			configs: []config.ProcessConfig{
+				{Name: "app", DependsOn: []string{"left", "right"}},
+				{Name: "left", DependsOn: []string{"base"}},
+				{Name: "right", Priority: -1, DependsOn: []string{"base"}},
+				{Name: "base"},
+			},
+			want: []string{"base", "right", "left", "app"},
+		},
+		{
+			name: "unknown and self dependencies ignored",
+			configs: []config.ProcessConfig{
+				{Name: "a", DependsOn: []string{"a", "missing"}},
+				{Name: "b", DependsOn: []string{"a"}},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "cycle appended and reported",
+			configs: []config.ProcessConfig{
+				{Name: "free"},
+				{Name: "x", DependsOn: []string{"y"}},
+				{Name: "y", Priority: -1, DependsOn: []string{"x"}},
+				{Name: "after", DependsOn: []string{"free"}},
+			},
+			want:    []string{"free", "after", "y", "x"},
+			wantErr: "dependency cycle between processes: y, x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs := make(map[string]config.ProcessConfig)
+			var names []string
+			for _, cfg := range tt.configs {
+				configs[cfg.Name] = cfg
+				names = append(names, cfg.Name)
+			}
+
+			got, err := startOrder(configs, names)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("startOrder() = %v, want %v", got, tt.want)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("startOrder() error = %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("startOrder() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStopOrder(t *testing.T) {
+	configs := map[string]config.ProcessConfig{
+		"db":     {Name: "db"},
+		"cache":  {Name: "cache"},
+		"api":    {Name: "api", DependsOn: []string{"db", "cache"}},
+		"worker": {Name: "worker", DependsOn: []string{"db"}},
+	}
+	names := []string{"api", "cache", "db", "worker"}
+
+	start, err := startOrder(configs, names)
+	if err != nil {
+		t.Fatalf("startOrder: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		first []string
+		want  []string
+	}{
+		{
+			name: "reverse dependency order without stop_order",
+			want: []string{"worker", "api", "db", "cache"},
+		},
+		{
+			name:  "stop_order entries first, in their order",
+			first: []string{"db", "api"},
+			want:  []string{"db", "api", "worker", "cache"},
+		},
+		{
+			name:  "a single entry keeps the rest in reverse start order",
+			first: []string{"cache"},
+			want:  []string{"cache", "worker", "api", "db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stopOrder(start, tt.first)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stopOrder(%v, %v) = %v, want %v", start, tt.first, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopOrderDoesNotModifyStartOrder(t *testing.T) {
+	start := []string{"a", "b", "c"}
+	stopOrder(start, []string{"b"})
+	if !slices.Equal(start, []string{"a", "b", "c"}) {
+		t.Errorf("start order modified: %v", start)
+	}
+}
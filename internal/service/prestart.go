@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// ErrPreStartCheckFailed is returned when a process's pre_start_check did not
+// pass within its attempts.
+var ErrPreStartCheckFailed = errors.New("pre-start check failed")
+
+// Defaults of the pre-start check for processes that do not set them
+const (
+	defaultPreStartCheckTimeout  = 10 * time.Second
+	defaultPreStartCheckAttempts = 3
+	defaultPreStartCheckInterval = 2 * time.Second
+)
+
+// runPreStartCheck runs the process's PreStartCheck command until it exits
+// zero, up to PreStartCheckAttempts times, and records the outcome. It
+// returns ErrPreStartCheckFailed with the last failure otherwise. Processes
+// without a check always pass.
+func (pm *ProcessManager) runPreStartCheck(name string, state *ProcessState, cfg config.ProcessConfig) error {
+	if cfg.PreStartCheck == "" {
+		return nil
+	}
+
+	timeout := time.Duration(cfg.PreStartCheckTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultPreStartCheckTimeout
+	}
+	attempts := cfg.PreStartCheckAttempts
+	if attempts <= 0 {
+		attempts = defaultPreStartCheckAttempts
+	}
+	interval := time.Duration(cfg.PreStartCheckInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultPreStartCheckInterval
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(interval)
+		}
+		if err = runCheckCommand(cfg.PreStartCheck, cfg.Directory, nil, timeout); err == nil {
+			break
+		}
+		pm.log("warning", fmt.Sprintf("Pre-start check for %s failed (attempt %d/%d): %v", name, attempt, attempts, err), name)
+	}
+
+	pm.mu.Lock()
+	state.preStartError = ""
+	if err != nil {
+		err = fmt.Errorf("%w after %d attempts: %v", ErrPreStartCheckFailed, attempts, err)
+		state.preStartError = err.Error()
+	}
+	pm.mu.Unlock()
+
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Start of %s failed: %v", name, err), name)
+	}
+	return err
+}
+
+// runCheckCommand runs command with sh in dir, failing if it exits non-zero
+// or runs longer than timeout. env is added to the supervisor's environment.
+func runCheckCommand(command, dir string, env map[string]string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
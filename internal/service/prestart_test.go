@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreStartCheck(t *testing.T) {
+	dir := t.TempDir()
+	pm, _ := newTestManager(t, `
+processes:
+  - name: retried
+    command: sleep
+    args: ["30"]
+    directory: `+dir+`
+    pre_start_check: 'n=$(cat attempts 2>/dev/null || echo 0); echo $((n+1)) > attempts; [ $n -ge 1 ]'
+    pre_start_check_interval: 1
+  - name: blocked
+    command: sleep
+    args: ["30"]
+    directory: `+dir+`
+    pre_start_check: test -f ready
+    pre_start_check_attempts: 1
+  - name: slow
+    command: sleep
+    args: ["30"]
+    pre_start_check: sleep 5
+    pre_start_check_timeout: 1
+    pre_start_check_attempts: 1
+`)
+
+	// Passes on the second attempt
+	if err := pm.StartProcess("retried"); err != nil {
+		t.Errorf("StartProcess(retried) error = %v", err)
+	}
+	if p, _ := pm.GetProcess("retried"); p.Status != "running" || p.PreStartCheckError != "" {
+		t.Errorf("retried = %s with check error %q, want running", p.Status, p.PreStartCheckError)
+	}
+
+	err := pm.StartProcess("blocked")
+	if !errors.Is(err, ErrPreStartCheckFailed) {
+		t.Fatalf("StartProcess(blocked) error = %v, want %v", err, ErrPreStartCheckFailed)
+	}
+	p, _ := pm.GetProcess("blocked")
+	if p.Status == "running" || p.PreStartCheckError != err.Error() {
+		t.Errorf("blocked = %s with check error %q, want not started with %q", p.Status, p.PreStartCheckError, err)
+	}
+
+	// The error is cleared once the check passes
+	if err := os.WriteFile(filepath.Join(dir, "ready"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.StartProcess("blocked"); err != nil {
+		t.Fatalf("StartProcess(blocked) once ready error = %v", err)
+	}
+	if p, _ := pm.GetProcess("blocked"); p.PreStartCheckError != "" {
+		t.Errorf("PreStartCheckError = %q after the check passed, want none", p.PreStartCheckError)
+	}
+
+	err = pm.StartProcess("slow")
+	if !errors.Is(err, ErrPreStartCheckFailed) || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("StartProcess(slow) error = %v, want a timeout", err)
+	}
+}
@@ -1,46 +1,135 @@
 package service
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
 	"os/exec"
+	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"pupervisor/internal/archive"
 	"pupervisor/internal/config"
 	"pupervisor/internal/models"
+	"pupervisor/internal/notifier"
 	"pupervisor/internal/storage"
+	"pupervisor/internal/syslog"
 )
 
 var (
 	ErrProcessNotFound       = errors.New("process not found")
 	ErrProcessAlreadyRunning = errors.New("process already running")
 	ErrProcessNotRunning     = errors.New("process not running")
+	ErrProcessExists         = errors.New("process already exists")
+	ErrInvalidProcessName    = errors.New("invalid process name")
+
+	errUnexpectedExit = errors.New("exited with code 0 but is expected to keep running")
 )
 
+// deployVersionSetting is the setting the deploy pipeline updates with the
+// release being rolled out. Crash records are tagged with its value.
+const deployVersionSetting = "deploy_version"
+
 type ProcessState struct {
-	Config       config.ProcessConfig
-	Cmd          *exec.Cmd
-	Status       string
-	Pid          int
-	StartTime    time.Time
-	ExitCode     int
-	cancel       context.CancelFunc
-	outputBuffer *OutputBuffer
+	Config    config.ProcessConfig
+	Cmd       *exec.Cmd
+	Status    string
+	Pid       int
+	StartTime time.Time
+	ExitCode  int
+	// LastHeartbeat is the last time the watchdog heard from the process,
+	// via the heartbeat API or its heartbeat file
+	LastHeartbeat time.Time
+	// NextRestartAt is when a pending automatic restart is due
+	NextRestartAt time.Time
+	// bootStartAt is when an autostart delayed by boot_delay_seconds is due
+	bootStartAt time.Time
+	// restartSeq is incremented to cancel a pending automatic restart
+	restartSeq int
+	// starts counts the times the process was started
+	starts int
+	// usage holds the samples of the last usageWindow, oldest first
+	usage []models.UsageSample
+	// Health is the result of the configured health check and LastHealthyAt
+	// the last time it passed. LastHealthyAt survives failures and restarts.
+	Health          string
+	LastHealthyAt   time.Time
+	healthFailures  int
+	healthChecking  bool
+	lastHealthCheck time.Time
+	cancel          context.CancelFunc
+	exited          chan struct{} // closed once the current Cmd has been reaped
+	binaryMissing   bool          // set by the binary check
+	// console receives the output for attached consoles and stdin takes
+	// their input, for processes with allow_console
+	console *outputFeed
+	stdin   *stdinWriter
+	// spawnedAt is when the current start began; startTimed is set once its
+	// start duration has been recorded
+	spawnedAt  time.Time
+	startTimed bool
+	startTimes operationTimes
+	stopTimes  operationTimes
+	// startPending is set while a start waits for the start condition, whose
+	// last result is conditionMet as of conditionCheckedAt
+	startPending       bool
+	startWaiter        int // identifies the goroutine waiting for the condition
+	conditionMet       bool
+	conditionCheckedAt time.Time
+	// preStartError is why the last pre-start check failed, "" once it
+	// passes
+	preStartError string
+	// held keeps the process stopped and out of supervision, see HoldProcess
+	held      bool
+	heldSince time.Time
+	// silencedUntil is when the notifications of the process resume, see
+	// SilenceProcess
+	silencedUntil time.Time
+	outputBuffer  *OutputBuffer
+	// draining is set while the process is being stopped, see Readiness
+	draining bool
+	// exitCodes are the codes of the last exits not requested by the
+	// supervisor, oldest first
+	exitCodes []int
 }
 
 type OutputBuffer struct {
 	mu      sync.RWMutex
 	stdout  []string
 	stderr  []string
+	all     []outputLine // stdout and stderr interleaved in arrival order
 	maxSize int
+	// size is the number of bytes held, counted against budget if set
+	size   int
+	budget *logBudget
+	// startup keeps the first stderr lines of the run, up to startupLines
+	// and until startupUntil, see captureStartup
+	startup      []string
+	startupLines int
+	startupUntil time.Time
+}
+
+// outputLine is a line of the combined output. Lines in all are also the
+// most recent ones of their stream.
+type outputLine struct {
+	text   string
+	stderr bool
 }
 
 func NewOutputBuffer(maxSize int) *OutputBuffer {
@@ -54,18 +143,39 @@ func NewOutputBuffer(maxSize int) *OutputBuffer {
 func (ob *OutputBuffer) AddStdout(line string) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
-	ob.stdout = append(ob.stdout, line)
-	if len(ob.stdout) > ob.maxSize {
-		ob.stdout = ob.stdout[len(ob.stdout)-ob.maxSize:]
-	}
+	ob.stdout = ob.addLine(ob.stdout, line)
+	ob.addCombined(outputLine{text: line})
 }
 
 func (ob *OutputBuffer) AddStderr(line string) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
-	ob.stderr = append(ob.stderr, line)
-	if len(ob.stderr) > ob.maxSize {
-		ob.stderr = ob.stderr[len(ob.stderr)-ob.maxSize:]
+	if len(ob.startup) < ob.startupLines && time.Now().Before(ob.startupUntil) {
+		ob.startup = append(ob.startup, line)
+	}
+	ob.stderr = ob.addLine(ob.stderr, line)
+	ob.addCombined(outputLine{text: line, stderr: true})
+}
+
+// addLine appends line to a stream, dropping its oldest line beyond
+// maxSize. Callers must hold ob.mu.
+func (ob *OutputBuffer) addLine(lines []string, line string) []string {
+	lines = append(lines, line)
+	grown := len(line)
+	if len(lines) > ob.maxSize {
+		for _, dropped := range lines[:len(lines)-ob.maxSize] {
+			grown -= len(dropped)
+		}
+		lines = lines[len(lines)-ob.maxSize:]
+	}
+	ob.resize(grown)
+	return lines
+}
+
+func (ob *OutputBuffer) addCombined(line outputLine) {
+	ob.all = append(ob.all, line)
+	if len(ob.all) > ob.maxSize {
+		ob.all = ob.all[len(ob.all)-ob.maxSize:]
 	}
 }
 
@@ -81,6 +191,22 @@ func (ob *OutputBuffer) GetStderr() string {
 	return strings.Join(ob.stderr, "\n")
 }
 
+// GetLastLines returns up to n of the most recent stdout and stderr lines
+// in the order they were written.
+func (ob *OutputBuffer) GetLastLines(n int) []string {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	start := 0
+	if len(ob.all) > n {
+		start = len(ob.all) - n
+	}
+	lines := make([]string, 0, len(ob.all)-start)
+	for _, line := range ob.all[start:] {
+		lines = append(lines, line.text)
+	}
+	return lines
+}
+
 func (ob *OutputBuffer) GetLastStderr(n int) string {
 	ob.mu.RLock()
 	defer ob.mu.RUnlock()
@@ -91,17 +217,125 @@ func (ob *OutputBuffer) GetLastStderr(n int) string {
 	return strings.Join(ob.stderr[start:], "\n")
 }
 
+// captureStartup keeps up to lines stderr lines written within window from
+// now apart from the rolling output, where later output would push them
+// out.
+func (ob *OutputBuffer) captureStartup(lines int, window time.Duration) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.startupLines = lines
+	ob.startupUntil = time.Now().Add(window)
+}
+
+// GetStartupStderr returns the stderr lines kept by captureStartup.
+func (ob *OutputBuffer) GetStartupStderr() []string {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return slices.Clone(ob.startup)
+}
+
 type ProcessManager struct {
 	mu        sync.RWMutex
 	processes map[string]*ProcessState
 	logs      *LogBuffer
 	storage   *storage.Storage
+	secrets   SecretProvider
+	notifier  *notifier.Notifier
+	jobs      *jobRegistry
+	// syslog, if set, also receives every supervisor event
+	syslog atomic.Pointer[syslog.Writer]
+	// archive, if set, receives rotated log segments, see SetArchiver
+	archive atomic.Pointer[archive.Archiver]
+	// fileWebhooks are the webhooks of the config file, replaced by
+	// webhookURL while that setting is not empty
+	fileWebhooks []config.WebhookConfig
+	webhookURL   string
+	// configPath is the file Reload reads process definitions from
+	configPath string
+	// settings are the resolved server and supervisor settings with sources
+	settings []config.Setting
+	// binaryCheckInterval is how often StartBinaryChecks verifies commands
+	binaryCheckInterval time.Duration
+	// crashReplay allows re-running a crashed command through ReplayCommand
+	crashReplay bool
+	// logDir, if set, receives process output files rotated at logMaxSize
+	// bytes with logBackups old files kept
+	logDir     string
+	logMaxSize int64
+	logBackups int
+	// logFsync and logFsyncInterval are the default log_fsync_policy
+	logFsync         string
+	logFsyncInterval time.Duration
+	// lockDir holds the lock files of singleton processes
+	lockDir string
+	// healthSlots limits how many health probes run at once; nil does not
+	// limit them
+	healthSlots chan struct{}
+	// usageInterval is how often process usage is sampled and usageWindow
+	// how long samples are kept
+	usageInterval time.Duration
+	usageWindow   time.Duration
+	// dependencyWait is how long StartAll waits for a process's
+	// dependencies to be ready, dependencyPolicy what it does after that
+	dependencyWait   time.Duration
+	dependencyPolicy string
+	// restartJitter randomizes restart delays by up to this fraction, drawn
+	// from jitterRand
+	restartJitter float64
+	jitterRand    *rand.Rand
+	// retention is how many days crashes and error logs are kept and
+	// transitionRetention how many days state transitions are; -1 keeps them
+	retention           int
+	transitionRetention int
+	// logBufferSize is the default log_buffer_size
+	logBufferSize int
+	// allowlist restricts the binaries processes may run; empty allows any
+	allowlist []string
+	// now is the clock start and stop durations are measured with, and
+	// sleep waits out automatic restart delays
+	now   func() time.Time
+	sleep func(time.Duration)
+	// slowStopThreshold is the default slow_stop_threshold in seconds
+	slowStopThreshold int
+	// exitCodeHistory is how many exit codes are kept per process
+	exitCodeHistory int
+	// crashOutputMaxBytes caps the output stored with crash records; -1
+	// and 0 store it in full
+	crashOutputMaxBytes int
+	// stopOrder lists the processes StopAll stops first
+	stopOrder []string
+	// crashMetrics counts crashes for the metrics endpoints
+	crashMetrics crashMetrics
+	// defaults is the loaded config, which validates and fills in the
+	// options of processes added later, see CloneProcess
+	defaults *config.SupervisorConfig
+	// readiness maps process names to why they are not ready for traffic,
+	// "" if they are, see updateReadiness
+	readiness sync.Map
+	// escalations turns repeated warnings into errors, see
+	// WatchEscalationRules
+	escalations escalator
+
+	// safeMode rejects every change through the API, see WatchSafeMode
+	safeMode atomic.Bool
+	// logMemory caps the output held by all processes' buffers together
+	logMemory logBudget
+	// fileWatch follows the reload_on_change files, see StartFileWatches
+	fileWatch fileWatch
+	// events pushes status changes and log entries to subscribers
+	events eventFeed
+	// transitions saves status changes to storage, see setStatus
+	transitions transitionLog
 }
 
 type LogBuffer struct {
 	mu         sync.RWMutex
 	entries    []models.LogEntry
 	maxEntries int
+	// archive, if set and enabled, receives each maxEntries entries
+	// trimmed from the buffer, collected in evicted
+	archive *archive.Archiver
+	evicted []models.LogEntry
 }
 
 func NewLogBuffer(maxEntries int) *LogBuffer {
@@ -113,11 +347,23 @@ func NewLogBuffer(maxEntries int) *LogBuffer {
 
 func (lb *LogBuffer) Add(entry models.LogEntry) {
 	lb.mu.Lock()
-	defer lb.mu.Unlock()
-
 	lb.entries = append(lb.entries, entry)
+	var batch []models.LogEntry
 	if len(lb.entries) > lb.maxEntries {
-		lb.entries = lb.entries[len(lb.entries)-lb.maxEntries:]
+		trimmed := len(lb.entries) - lb.maxEntries
+		if lb.archive != nil && lb.archive.Enabled() {
+			lb.evicted = append(lb.evicted, lb.entries[:trimmed]...)
+			if len(lb.evicted) >= lb.maxEntries {
+				batch, lb.evicted = lb.evicted, nil
+			}
+		}
+		lb.entries = lb.entries[trimmed:]
+	}
+	a := lb.archive
+	lb.mu.Unlock()
+
+	if batch != nil {
+		archiveEntries(a, batch)
 	}
 }
 
@@ -139,6 +385,21 @@ func (lb *LogBuffer) GetLast(n int) []models.LogEntry {
 	return result
 }
 
+// GetByCorrelation returns the entries with the given correlation id, oldest
+// first.
+func (lb *LogBuffer) GetByCorrelation(id string) []models.LogEntry {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	filtered := []models.LogEntry{}
+	for _, e := range lb.entries {
+		if e.CorrelationID == id {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
 func (lb *LogBuffer) GetByLevel(level string, n int) []models.LogEntry {
 	lb.mu.RLock()
 	defer lb.mu.RUnlock()
@@ -167,6 +428,52 @@ func NewProcessManager(cfg *config.SupervisorConfig, store *storage.Storage) *Pr
 		processes: make(map[string]*ProcessState),
 		logs:      NewLogBuffer(1000),
 		storage:   store,
+		notifier:  notifier.FromConfig(cfg.Notifications, store),
+		jobs:      newJobRegistry(),
+		settings:  cfg.Settings,
+		now:       time.Now,
+		sleep:     time.Sleep,
+
+		fileWebhooks: cfg.Notifications.Webhooks,
+		stopOrder:    cfg.StopOrder,
+		defaults:     cfg,
+
+		binaryCheckInterval: time.Duration(cfg.BinaryCheckInterval) * time.Second,
+		slowStopThreshold:   cfg.SlowStopThreshold,
+		exitCodeHistory:     cfg.ExitCodeHistory,
+		crashOutputMaxBytes: cfg.CrashOutputMaxBytes,
+		logDir:              cfg.LogDir,
+		lockDir:             cfg.LockDir,
+		usageInterval:       time.Duration(cfg.UsageSampleInterval) * time.Second,
+		usageWindow:         time.Duration(cfg.UsageWindow) * time.Second,
+		logMaxSize:          int64(cfg.LogMaxSize) << 20,
+		logBackups:          cfg.LogBackups,
+		logFsync:            cfg.LogFsyncPolicy,
+		logFsyncInterval:    time.Duration(cfg.LogFsyncInterval) * time.Millisecond,
+		restartJitter:       cfg.RestartJitter,
+		dependencyWait:      time.Duration(cfg.DependencyWaitTimeout) * time.Second,
+		dependencyPolicy:    cfg.DependencyWaitPolicy,
+		jitterRand:          rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		retention:           cfg.Retention,
+		transitionRetention: cfg.TransitionRetention,
+		logBufferSize:       cfg.LogBufferSize,
+	}
+
+	pm.logMemory.limit = int64(cfg.LogMemoryLimit) << 20
+	if cfg.HealthCheckConcurrency > 0 {
+		pm.healthSlots = make(chan struct{}, cfg.HealthCheckConcurrency)
+	}
+
+	if cfg.SecretsFile != "" {
+		pm.secrets = NewEnvFileSecretProvider(cfg.SecretsFile)
+	}
+
+	if store != nil {
+		timings, err := store.GetCrashTimings()
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to read crash history for metrics: %v", err), "")
+		}
+		pm.crashMetrics.seed(timings)
 	}
 
 	for _, procCfg := range cfg.Processes {
@@ -179,193 +486,769 @@ func NewProcessManager(cfg *config.SupervisorConfig, store *storage.Storage) *Pr
 	return pm
 }
 
+// AddProcess registers a new process definition in the stopped state.
+func (pm *ProcessManager) AddProcess(cfg config.ProcessConfig) error {
+	if !config.ValidProcessName(cfg.Name) {
+		return ErrInvalidProcessName
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if _, exists := pm.processes[cfg.Name]; exists {
+		return ErrProcessExists
+	}
+
+	pm.processes[cfg.Name] = &ProcessState{
+		Config: cfg,
+		Status: "stopped",
+	}
+	pm.log("info", fmt.Sprintf("Process %s registered", cfg.Name), cfg.Name)
+	return nil
+}
+
+// CloneProcess registers a copy of an existing process definition under a new
+// name, with the given config overrides applied. The copy is validated and
+// its unset options filled in like those of the config file, and its command
+// must be on the allowlist. The clone is not started. As it is not in the
+// config file, the next reload removes it.
+func (pm *ProcessManager) CloneProcess(name, newName string, overrides map[string]any) error {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var cfg config.ProcessConfig
+	if ok {
+		cfg = state.Config
+	}
+	defaults, allowlist := pm.defaults, pm.allowlist
+	pm.mu.RUnlock()
+
+	if !ok {
+		return ErrProcessNotFound
+	}
+
+	cloned, err := config.ApplyOverrides(cfg, overrides)
+	if err != nil {
+		return err
+	}
+	cloned.Name = newName
+	if !config.ValidProcessName(newName) {
+		return ErrInvalidProcessName
+	}
+	if err := defaults.SetProcessDefaults(&cloned); err != nil {
+		return err
+	}
+	if err := config.CheckCommandAllowed(allowlist, cloned); err != nil {
+		return err
+	}
+
+	return pm.AddProcess(cloned)
+}
+
 func (pm *ProcessManager) GetStorage() *storage.Storage {
 	return pm.storage
 }
 
+// log records a supervisor event in the log buffer and syslog. Warnings are
+// counted against the escalation rules; those worth keeping past the buffer
+// go through logPersistent, so they are counted here too.
 func (pm *ProcessManager) log(level, message string, processName string) {
-	entry := models.LogEntry{
+	pm.addLog(level, message, processName, models.LogSourceSystem)
+	if level == "warning" {
+		pm.checkEscalation(processName, message)
+	}
+	if w := pm.syslog.Load(); w != nil {
+		w.Send(level, processName, message, time.Now())
+	}
+}
+
+// logPersistent logs a message and saves it to the error log as well.
+func (pm *ProcessManager) logPersistent(level, message, processName string) {
+	pm.log(level, message, processName)
+	if pm.storage == nil {
+		return
+	}
+	if err := pm.storage.SaveError(level, processName, message); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to record %s in the error log: %v", level, err), processName)
+	}
+}
+
+// SetSyslog sends every supervisor event to w as well, in addition to the
+// log buffer. Process output is not sent.
+func (pm *ProcessManager) SetSyslog(w *syslog.Writer) {
+	pm.syslog.Store(w)
+}
+
+// logOutput records a line of process output, prefixed per its logprefix and
+// with the correlation id the correlation pattern, if any, finds in it. A
+// non-zero startedAt adds the time elapsed since then.
+func (pm *ProcessManager) logOutput(level, line string, prefix *template.Template, correlation *regexp.Regexp, data config.LogPrefixData, startedAt time.Time) {
+	var b strings.Builder
+	if err := prefix.Execute(&b, data); err != nil {
+		b.Reset()
+	}
+	b.WriteString(line)
+
+	entry := newLogEntry(level, b.String(), data.Name, models.LogSourceOutput)
+	entry.CorrelationID = correlationID(correlation, line)
+	if !startedAt.IsZero() {
+		entry.SinceStart = pm.now().Sub(startedAt).Round(time.Millisecond).String()
+	}
+	pm.logs.Add(entry)
+	pm.publishLog(entry)
+}
+
+func (pm *ProcessManager) addLog(level, message, processName, source string) {
+	entry := newLogEntry(level, message, processName, source)
+	pm.logs.Add(entry)
+	pm.publishLog(entry)
+}
+
+func newLogEntry(level, message, processName, source string) models.LogEntry {
+	return models.LogEntry{
 		Timestamp: time.Now().Format(time.RFC3339),
 		Level:     level,
 		Message:   message,
 		Worker:    processName,
+		Source:    source,
 	}
-	pm.logs.Add(entry)
 }
 
+// correlationID returns the first capture group of re in line, or the whole
+// match if re has no groups. It is "" without a match or a pattern.
+func correlationID(re *regexp.Regexp, line string) string {
+	if re == nil {
+		return ""
+	}
+	match := re.FindStringSubmatch(line)
+	switch {
+	case match == nil:
+		return ""
+	case len(match) > 1:
+		return match[1]
+	}
+	return match[0]
+}
+
+// StartProcess starts a stopped process. With a start condition that does not
+// hold, the start is deferred and ErrStartDeferred returned; the process is
+// started once the condition holds. A pre-start check that does not pass
+// fails the start with ErrPreStartCheckFailed.
 func (pm *ProcessManager) StartProcess(name string) error {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+	return pm.StartProcessContext(context.Background(), name)
+}
 
+// StartProcessContext is StartProcess recording a process.start span as a
+// child of any span in ctx. ctx does not cancel the start.
+func (pm *ProcessManager) StartProcessContext(ctx context.Context, name string) (err error) {
+	_, span := startSpan(ctx, "start", name)
+	defer func() {
+		if errors.Is(err, ErrStartDeferred) {
+			span.SetAttributes(attribute.Bool("process.start_deferred", true))
+			endSpan(span, nil)
+			return
+		}
+		endSpan(span, err)
+	}()
+
+	pm.mu.RLock()
 	state, ok := pm.processes[name]
-	if !ok {
+	var cfg config.ProcessConfig
+	var running, held bool
+	if ok {
+		cfg = state.Config
+		running = state.Status == "running"
+		held = state.held
+	}
+	pm.mu.RUnlock()
+
+	switch {
+	case !ok:
 		return ErrProcessNotFound
+	case running:
+		return ErrProcessAlreadyRunning
+	case held:
+		return ErrProcessHeld
+	}
+
+	if cfg.StartCondition != "" && !pm.checkStartCondition(name, state, cfg) {
+		pm.deferStart(name, state)
+		return ErrStartDeferred
+	}
+	if err := pm.runPreStartCheck(name, state, cfg); err != nil {
+		return err
+	}
+	if err := pm.spawn(name); err != nil {
+		return err
+	}
+
+	pm.mu.RLock()
+	span.SetAttributes(attribute.Int("process.pid", state.Pid))
+	pm.mu.RUnlock()
+	return nil
+}
+
+// spawn starts the process's command and the goroutines reading its output
+// and waiting for it to exit.
+func (pm *ProcessManager) spawn(name string) error {
+	// Secret providers may be slow or remote, so secrets are resolved and
+	// the command checked without pm.mu held, starting over if the process
+	// or the allowlist changes meanwhile
+	var state *ProcessState
+	var procCfg config.ProcessConfig
+	for {
+		pm.mu.RLock()
+		current, ok := pm.processes[name]
+		var cfg config.ProcessConfig
+		if ok {
+			cfg = current.Config
+		}
+		allowlist := pm.allowlist
+		pm.mu.RUnlock()
+		if !ok {
+			return ErrProcessNotFound
+		}
+
+		resolved, err := pm.resolveSecrets(cfg.WithInstanceVars())
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
+			return err
+		}
+		if err := pm.checkCommandAllowed(allowlist, resolved); err != nil {
+			return err
+		}
+
+		pm.mu.Lock()
+		if pm.processes[name] == current && reflect.DeepEqual(current.Config, cfg) && slices.Equal(pm.allowlist, allowlist) {
+			state, procCfg = current, resolved
+			break
+		}
+		pm.mu.Unlock()
 	}
+	defer pm.mu.Unlock()
 
 	if state.Status == "running" {
 		return ErrProcessAlreadyRunning
 	}
+	if state.held {
+		return ErrProcessHeld
+	}
+
+	prefix, err := config.ParseLogPrefix(procCfg.LogPrefix)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
+		return err
+	}
+	correlation, err := config.ParseCorrelationPattern(procCfg.CorrelationPattern)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
+		return err
+	}
+	sampling, err := config.ParseLogSampleRate(procCfg.SampleRate)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
+		return err
+	}
+
+	// The lock passes to the process, which holds it for as long as it runs
+	var lock *os.File
+	if procCfg.Singleton != "" {
+		var owner int
+		lock, owner, err = pm.lockSingleton(name)
+		if errors.Is(err, errLockHeld) {
+			if procCfg.Singleton == config.SingletonAdopt && owner > 0 {
+				return pm.adopt(name, state, owner)
+			}
+			err = fmt.Errorf("%w with PID %d", ErrSingletonRunning, owner)
+		}
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
+			return err
+		}
+		defer lock.Close()
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	state.cancel = cancel
 
-	cmd := exec.CommandContext(ctx, state.Config.Command, state.Config.Args...)
+	cmd := newCommand(ctx, procCfg)
+	if lock != nil {
+		cmd.ExtraFiles = []*os.File{lock}
+	}
 
-	if state.Config.Directory != "" {
-		cmd.Dir = state.Config.Directory
+	if procCfg.Directory != "" {
+		cmd.Dir = procCfg.Directory
 	}
 
-	if len(state.Config.Environment) > 0 {
+	if procCfg.User != "" {
+		if err := setUser(cmd, procCfg.User); err != nil {
+			cancel()
+			pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
+			return err
+		}
+	}
+
+	if len(procCfg.Environment) > 0 {
 		cmd.Env = os.Environ()
-		for k, v := range state.Config.Environment {
+		for k, v := range procCfg.Environment {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 		}
 	}
 
-	stdout, err := cmd.StdoutPipe()
+	// Unlike with cmd.StdoutPipe, Wait does not close the read ends, so
+	// output a process wrote just before exiting is still read once it has
+	// been reaped. The readers close them at EOF.
+	stdout, stdoutW, err := os.Pipe()
 	if err != nil {
 		pm.log("error", fmt.Sprintf("Failed to create stdout pipe for %s: %v", name, err), name)
 		return err
 	}
 
-	stderr, err := cmd.StderrPipe()
+	stderr, stderrW, err := os.Pipe()
 	if err != nil {
+		stdout.Close()
+		stdoutW.Close()
 		pm.log("error", fmt.Sprintf("Failed to create stderr pipe for %s: %v", name, err), name)
 		return err
 	}
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+
+	// The process has its own copies of the write ends
+	started := false
+	defer func() {
+		stdoutW.Close()
+		stderrW.Close()
+		if !started {
+			stdout.Close()
+			stderr.Close()
+		}
+	}()
+
+	var stdin io.WriteCloser
+	if procCfg.AllowConsole {
+		stdin, err = cmd.StdinPipe()
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to create stdin pipe for %s: %v", name, err), name)
+			return err
+		}
+		if state.console == nil {
+			state.console = &outputFeed{}
+		}
+	}
+	console := state.console
 
+	var logs *processLogs
+	if pm.logDir != "" {
+		logs, err = openProcessLogs(pm.logDir, name, procCfg.SplitLogs, pm.logFileOptions(procCfg))
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to open log files for %s: %v", name, err), name)
+			return err
+		}
+	}
+
+	spawnedAt := pm.now()
 	if err := cmd.Start(); err != nil {
+		if logs != nil {
+			logs.Close()
+		}
 		pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
 		return err
 	}
+	started = true
+
+	if lock != nil {
+		if err := writeLockPid(lock, cmd.Process.Pid); err != nil {
+			pm.log("warning", fmt.Sprintf("Failed to record PID of %s in its lock file: %v", name, err), name)
+		}
+	}
 
 	state.Cmd = cmd
-	state.Status = "running"
+	state.exited = make(chan struct{})
+	state.starts++
+	state.stdin = nil
+	if stdin != nil {
+		state.stdin = &stdinWriter{w: stdin}
+	}
+	pm.setStatus(name, state, "running", "started")
+	state.NextRestartAt = time.Time{}
+	state.bootStartAt = time.Time{}
 	state.Pid = cmd.Process.Pid
-	state.StartTime = time.Now()
+	state.StartTime = spawnedAt
 	state.ExitCode = 0
-	state.outputBuffer = NewOutputBuffer(500) // Keep last 500 lines
+	state.LastHeartbeat = time.Time{}
+	state.healthFailures = 0
+	state.lastHealthCheck = time.Now() // first check after one interval
+	if state.Config.HealthCheck != nil {
+		state.Health = HealthUnknown
+	}
+	state.draining = false
+	pm.updateReadiness(name, state)
+	pm.newOutputBuffer(state)
+	state.outputBuffer.captureStartup(procCfg.StartupStderrLines, time.Duration(procCfg.StartupStderrWindow)*time.Second)
+	state.spawnedAt = spawnedAt
+	state.startTimed = false
+	state.startPending = false
+	pm.recordStartIfReady(state)
 
 	pm.log("info", fmt.Sprintf("Process %s started with PID %d", name, state.Pid), name)
 
+	var readers sync.WaitGroup
+	readers.Add(2)
+
+	sampler := newLogSampler(sampling)
+
+	// Each instance counts from its own start
+	var sinceStart time.Time
+	if procCfg.LogSinceStart {
+		sinceStart = spawnedAt
+	}
+
 	// Read stdout in goroutine
+	stdoutData := config.LogPrefixData{Name: name, Stream: "stdout", Pid: state.Pid}
 	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
+		defer readers.Done()
+		defer stdout.Close()
+		readLines(stdout, procCfg.MaxLineLength, func(line string) {
 			state.outputBuffer.AddStdout(line)
-			pm.log("info", fmt.Sprintf("[%s] %s", name, line), name)
-		}
+			pm.enforceLogMemory()
+			if logs != nil {
+				logs.WriteStdout(line)
+			}
+			if console != nil {
+				console.publish("stdout", line)
+			}
+			if sampler.keep() {
+				pm.logOutput("info", line, prefix, correlation, stdoutData, sinceStart)
+			}
+		})
 	}()
 
 	// Read stderr in goroutine
+	stderrData := config.LogPrefixData{Name: name, Stream: "stderr", Pid: state.Pid}
 	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
+		defer readers.Done()
+		defer stderr.Close()
+		readLines(stderr, procCfg.MaxLineLength, func(line string) {
 			state.outputBuffer.AddStderr(line)
-			pm.log("error", fmt.Sprintf("[%s] %s", name, line), name)
-		}
+			pm.enforceLogMemory()
+			if logs != nil {
+				logs.WriteStderr(line)
+			}
+			if console != nil {
+				console.publish("stderr", line)
+			}
+			if sampler.keep() {
+				pm.logOutput("error", line, prefix, correlation, stderrData, sinceStart)
+			}
+		})
+	}()
+
+	drained := make(chan struct{})
+	go func() {
+		readers.Wait()
+		close(drained)
 	}()
+	go closeOutput(state.exited, drained, stdout, stderr)
+
+	// Close the log files once both streams are drained
+	if logs != nil {
+		go func() {
+			<-drained
+			logs.Close()
+		}()
+	}
+
+	if sampler != nil {
+		go pm.reportSampling(name, sampler, drained)
+	}
 
 	// Monitor process in goroutine
-	go pm.monitorProcess(name, state)
+	go pm.monitorProcess(name, state, cmd, spawnedAt, state.exited)
+
+	if state.Config.MinUptime > 0 {
+		go pm.watchMinUptime(name, state, cmd, state.exited, time.Duration(state.Config.MinUptime)*time.Second)
+	}
 
 	return nil
 }
 
-func (pm *ProcessManager) monitorProcess(name string, state *ProcessState) {
-	if state.Cmd == nil {
-		return
+// outputDrainTimeout is how long the output of a process that has exited is
+// still read. Children it left running may hold its pipes open for longer.
+const outputDrainTimeout = time.Second
+
+// closeOutput closes the read ends of a process's output pipes if they are
+// not drained within outputDrainTimeout of the process exiting.
+func closeOutput(exited, drained <-chan struct{}, pipes ...*os.File) {
+	<-exited
+	select {
+	case <-drained:
+	case <-time.After(outputDrainTimeout):
+		for _, pipe := range pipes {
+			pipe.Close()
+		}
 	}
+}
 
-	startTime := state.StartTime
-	err := state.Cmd.Wait()
-	crashTime := time.Now()
+// monitorProcess is the only caller of cmd.Wait. It closes exited once the
+// process has been reaped so StopProcess can wait for it. It must not take
+// pm.mu before then, since StopProcess holds it while waiting.
+func (pm *ProcessManager) monitorProcess(name string, state *ProcessState, cmd *exec.Cmd, startTime time.Time, exited chan struct{}) {
+	err := cmd.Wait()
+	crashTime := pm.now()
+	close(exited)
 
 	pm.mu.Lock()
 
+	// The process was stopped and started again before we got the lock
+	if state.Cmd != cmd {
+		pm.mu.Unlock()
+		return
+	}
+
+	// Wait has closed the stdin pipe
+	state.stdin = nil
+
 	exitCode := 0
 	if state.Cmd.ProcessState != nil {
 		exitCode = state.Cmd.ProcessState.ExitCode()
 	}
 	state.ExitCode = exitCode
+	if state.cancel != nil {
+		pm.recordExitCode(state, exitCode)
+	}
+
+	// Crash records are saved once pm.mu is released
+	var crashes []*storage.CrashRecord
 
 	// Save crash info if process exited abnormally
 	if err != nil || exitCode != 0 {
-		pm.saveCrashRecord(name, state, startTime, crashTime, err)
+		crashes = append(crashes, pm.crashRecord(name, state, startTime, crashTime, err))
+		var stderr string
+		if state.outputBuffer != nil {
+			stderr = state.outputBuffer.GetLastStderr(1)
+		}
+		pm.notifier.Notify(notifier.Event{
+			Type:        "crash",
+			Process:     name,
+			Message:     fmt.Sprintf("Process %s crashed with exit code %d", name, exitCode),
+			ExitCode:    exitCode,
+			Signal:      exitSignal(state),
+			Time:        crashTime,
+			Logs:        pm.recentOutput(state),
+			Fingerprint: CrashFingerprint(name, exitCode, exitSignal(state), stderr),
+			Channels:    state.Config.Notify,
+			Cooldown:    time.Duration(state.Config.NotifyCooldown) * time.Second,
+		})
+	}
+
+	// A clean exit of a daemon that was not asked to stop is an anomaly
+	unexpectedExit := err == nil && exitCode == 0 && state.Config.ExpectLongRunning && state.cancel != nil
+	if unexpectedExit {
+		crashes = append(crashes, pm.crashRecord(name, state, startTime, crashTime, errUnexpectedExit))
+		pm.notifier.Notify(notifier.Event{
+			Type:     "unexpected_exit",
+			Process:  name,
+			Message:  fmt.Sprintf("Process %s exited with code 0 after %s but is expected to keep running", name, formatDuration(crashTime.Sub(startTime))),
+			Time:     crashTime,
+			Logs:     pm.recentOutput(state),
+			Channels: state.Config.Notify,
+			Cooldown: time.Duration(state.Config.NotifyCooldown) * time.Second,
+		})
 	}
 
-	state.Status = "stopped"
+	reason := "exited normally"
+	switch {
+	case state.cancel == nil:
+		reason = "stopped"
+	case exitSignal(state) != "":
+		reason = "killed by " + exitSignal(state)
+	case exitCode != 0:
+		reason = fmt.Sprintf("crashed with exit code %d", exitCode)
+	case err != nil:
+		reason = "crashed: " + err.Error()
+	case unexpectedExit:
+		reason = "exited unexpectedly"
+	}
+	pm.setStatus(name, state, "stopped", reason)
 	state.Pid = 0
 
 	if err != nil {
 		pm.log("warning", fmt.Sprintf("Process %s exited with error: %v", name, err), name)
+	} else if unexpectedExit {
+		pm.log("warning", fmt.Sprintf("Process %s exited unexpectedly with code 0", name), name)
 	} else {
 		pm.log("info", fmt.Sprintf("Process %s exited normally", name), name)
 	}
 
-	// Auto-restart if configured
-	if state.Config.AutoRestart && state.cancel != nil {
-		select {
-		case <-time.After(time.Duration(state.Config.StartSecs) * time.Second):
-			pm.mu.Unlock()
-			pm.log("info", fmt.Sprintf("Auto-restarting process %s", name), name)
-			if err := pm.StartProcess(name); err != nil {
-				pm.log("error", fmt.Sprintf("Failed to auto-restart process %s: %v", name, err), name)
-			}
-			pm.mu.Lock()
-		default:
-		}
-	}
+	autoRestart := state.Config.AutoRestart && state.cancel != nil && !state.held
 
 	pm.mu.Unlock()
+
+	for _, crash := range crashes {
+		pm.saveCrashRecord(crash)
+	}
+
+	if autoRestart {
+		pm.autoRestart(name, state)
+	}
 }
 
-func (pm *ProcessManager) saveCrashRecord(name string, state *ProcessState, startTime, crashTime time.Time, err error) {
-	if pm.storage == nil {
+// recordExitCode adds an exit code to the process's history, keeping the
+// last exitCodeHistory. Callers must hold pm.mu.
+func (pm *ProcessManager) recordExitCode(state *ProcessState, exitCode int) {
+	state.exitCodes = append(state.exitCodes, exitCode)
+	if len(state.exitCodes) > pm.exitCodeHistory {
+		state.exitCodes = state.exitCodes[len(state.exitCodes)-pm.exitCodeHistory:]
+	}
+}
+
+// autoRestart waits StartSecs, with restart jitter applied, and restarts the
+// process, unless it was stopped or started manually in the meantime. A
+// failing CanRestart hook defers the restart until the hook succeeds.
+func (pm *ProcessManager) autoRestart(name string, state *ProcessState) {
+	pm.mu.Lock()
+	delay := pm.jitter(time.Duration(state.Config.StartSecs)*time.Second,
+		time.Duration(max(state.Config.RestartJitterMax, 0))*time.Second)
+	state.NextRestartAt = pm.now().Add(delay)
+	seq := state.restartSeq
+	pm.mu.Unlock()
+
+	for {
+		pm.sleep(delay)
+
+		pm.mu.RLock()
+		pending := state.cancel != nil && state.Status != "running" && !state.held && state.restartSeq == seq
+		cfg := state.Config
+		pm.mu.RUnlock()
+
+		if !pending {
+			return
+		}
+
+		if !pm.runCanRestartHook(name, cfg) {
+			delay = canRestartRetryInterval
+			pm.mu.Lock()
+			state.NextRestartAt = pm.now().Add(delay)
+			pm.mu.Unlock()
+			continue
+		}
+
+		pm.log("info", fmt.Sprintf("Auto-restarting process %s", name), name)
+		if err := pm.StartProcess(name); err != nil && !errors.Is(err, ErrStartDeferred) {
+			pm.log("error", fmt.Sprintf("Failed to auto-restart process %s: %v", name, err), name)
+		}
 		return
 	}
+}
 
+// crashRecord describes a crash of the process for saveCrashRecord. The
+// command line has instance variables filled in but keeps secret
+// references. Callers must hold pm.mu.
+func (pm *ProcessManager) crashRecord(name string, state *ProcessState, startTime, crashTime time.Time, err error) *storage.CrashRecord {
 	var errMsg string
 	if err != nil {
 		errMsg = err.Error()
 	}
 
-	var stdout, stderr string
+	var stdout, stderr, startupStderr string
 	if state.outputBuffer != nil {
 		stdout = state.outputBuffer.GetStdout()
 		stderr = state.outputBuffer.GetLastStderr(50) // Last 50 lines of stderr
+		startupStderr = strings.Join(state.outputBuffer.GetStartupStderr(), "\n")
+	}
+
+	command, args := state.Config.WithInstanceVars().Executable()
+	return &storage.CrashRecord{
+		ProcessName:   name,
+		ExitCode:      state.ExitCode,
+		Signal:        exitSignal(state),
+		ErrorMsg:      errMsg,
+		Stdout:        truncateHead(stdout, pm.crashOutputMaxBytes),
+		Stderr:        truncateHead(stderr, pm.crashOutputMaxBytes),
+		StartedAt:     startTime,
+		CrashedAt:     crashTime,
+		Uptime:        formatDuration(crashTime.Sub(startTime)),
+		CommandLine:   append([]string{command}, args...),
+		Fingerprint:   CrashFingerprint(name, state.ExitCode, exitSignal(state), stderr),
+		StartupStderr: truncateHead(startupStderr, pm.crashOutputMaxBytes),
 	}
+}
 
-	// Extract signal if killed by signal
-	signal := ""
+// saveCrashRecord counts a crash for the metrics and stores it with the
+// current deploy version. It does database I/O, so callers must not hold
+// pm.mu.
+func (pm *ProcessManager) saveCrashRecord(crash *storage.CrashRecord) {
+	pm.crashMetrics.observe(crash.ProcessName, crash.StartedAt, crash.CrashedAt)
+	if pm.storage == nil {
+		return
+	}
+
+	version, err := pm.storage.GetSetting(deployVersionSetting)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to read %s for crash of %s: %v", deployVersionSetting, crash.ProcessName, err), crash.ProcessName)
+	}
+	crash.Version = version
+
+	if err := pm.storage.SaveCrash(crash); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to save crash record for %s: %v", crash.ProcessName, err), crash.ProcessName)
+	}
+}
+
+// truncateHead cuts the start of output so that at most max bytes of it
+// remain, since the output just before a crash says the most about it. A
+// marker line with the number of bytes cut replaces them. max <= 0 keeps
+// the output in full.
+func truncateHead(output string, max int) string {
+	if max <= 0 || len(output) <= max {
+		return output
+	}
+
+	cut := len(output) - max
+	// Do not split a UTF-8 sequence
+	for cut < len(output) && !utf8.RuneStart(output[cut]) {
+		cut++
+	}
+	return fmt.Sprintf("[... %d bytes truncated]\n", cut) + output[cut:]
+}
+
+// recentOutput returns the process's last output lines to attach to a
+// notification. Callers must hold pm.mu.
+func (pm *ProcessManager) recentOutput(state *ProcessState) []string {
+	n := pm.notifier.LogLines()
+	if n <= 0 || state.outputBuffer == nil {
+		return nil
+	}
+	return state.outputBuffer.GetLastLines(n)
+}
+
+// exitSignal returns the name of the signal that killed the process, if any.
+func exitSignal(state *ProcessState) string {
 	if state.Cmd != nil && state.Cmd.ProcessState != nil {
 		if ws, ok := state.Cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
 			if ws.Signaled() {
-				signal = ws.Signal().String()
+				return ws.Signal().String()
 			}
 		}
 	}
+	return ""
+}
 
-	crash := &storage.CrashRecord{
-		ProcessName: name,
-		ExitCode:    state.ExitCode,
-		Signal:      signal,
-		ErrorMsg:    errMsg,
-		Stdout:      stdout,
-		Stderr:      stderr,
-		StartedAt:   startTime,
-		CrashedAt:   crashTime,
-		Uptime:      formatDuration(crashTime.Sub(startTime)),
-	}
+func (pm *ProcessManager) StopProcess(name string) error {
+	return pm.StopProcessContext(context.Background(), name)
+}
 
-	if saveErr := pm.storage.SaveCrash(crash); saveErr != nil {
-		pm.log("error", fmt.Sprintf("Failed to save crash record for %s: %v", name, saveErr), name)
-	}
+// StopProcessContext is StopProcess recording a process.stop span as a child
+// of any span in ctx.
+func (pm *ProcessManager) StopProcessContext(ctx context.Context, name string) error {
+	_, span := startSpan(ctx, "stop", name)
+	err := pm.stopProcess(name, span)
+	endSpan(span, err)
+	return err
 }
 
-func (pm *ProcessManager) StopProcess(name string) error {
+// stopProcess signals the process and waits for it to exit, killing it
+// after its stop timeout. The signal and whether it was killed are added
+// to span.
+func (pm *ProcessManager) stopProcess(name string, span trace.Span) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -375,13 +1258,21 @@ func (pm *ProcessManager) StopProcess(name string) error {
 	}
 
 	if state.Status != "running" || state.Cmd == nil || state.Cmd.Process == nil {
+		if state.startPending {
+			state.startPending = false
+			pm.log("info", fmt.Sprintf("Deferred start of %s cancelled", name), name)
+			return nil
+		}
 		return ErrProcessNotRunning
 	}
 
-	// Cancel context to stop auto-restart
+	// Stop auto-restart. The context is cancelled only on return since that
+	// kills the process, which must first get a chance to exit on its stop
+	// signal.
 	if state.cancel != nil {
-		state.cancel()
+		defer state.cancel()
 		state.cancel = nil
+		state.NextRestartAt = time.Time{}
 	}
 
 	// Send signal
@@ -395,35 +1286,62 @@ func (pm *ProcessManager) StopProcess(name string) error {
 		sig = syscall.SIGTERM
 	}
 
+	// Take the process out of traffic before it gets the signal
+	state.draining = true
+	pm.updateReadiness(name, state)
+
 	pm.log("info", fmt.Sprintf("Sending %s to process %s (PID %d)", state.Config.StopSignal, name, state.Pid), name)
 
+	span.SetAttributes(attribute.String("process.stop_signal", state.Config.StopSignal), attribute.Int("process.pid", state.Pid))
+	signaledAt := pm.now()
 	if err := state.Cmd.Process.Signal(sig); err != nil {
 		pm.log("error", fmt.Sprintf("Failed to send signal to %s: %v", name, err), name)
+		state.draining = false
+		pm.updateReadiness(name, state)
 		return err
 	}
 
 	// Wait for process to stop with timeout
-	done := make(chan struct{})
-	go func() {
-		_ = state.Cmd.Wait()
-		close(done)
-	}()
-
 	select {
-	case <-done:
+	case <-state.exited:
+		took := pm.now().Sub(signaledAt)
+		state.stopTimes.observe(took)
 		pm.log("info", fmt.Sprintf("Process %s stopped", name), name)
+		threshold := state.Config.SlowStopThreshold
+		if threshold == 0 {
+			threshold = pm.slowStopThreshold
+		}
+		if threshold > 0 && took > time.Duration(threshold)*time.Second {
+			pm.log("warning", fmt.Sprintf("Process %s took %s to stop after %s, more than slow_stop_threshold %ds",
+				name, took.Round(time.Millisecond), state.Config.StopSignal, threshold), name)
+		}
 	case <-time.After(time.Duration(state.Config.StopTimeout) * time.Second):
 		pm.log("warning", fmt.Sprintf("Process %s did not stop in time, killing", name), name)
+		span.SetAttributes(attribute.Bool("process.killed", true))
 		_ = state.Cmd.Process.Kill()
 	}
 
-	state.Status = "stopped"
+	pm.setStatus(name, state, "stopped", "stopped")
 	state.Pid = 0
 
+	if sc := state.Config.StopCheck; sc != nil {
+		go pm.verifyStopped(name, *sc)
+	}
+
 	return nil
 }
 
 func (pm *ProcessManager) RestartProcess(name string) error {
+	return pm.RestartProcessContext(context.Background(), name)
+}
+
+// RestartProcessContext is RestartProcess recording a process.restart span,
+// with the stop and start spans as its children, as a child of any span in
+// ctx.
+func (pm *ProcessManager) RestartProcessContext(ctx context.Context, name string) (err error) {
+	ctx, span := startSpan(ctx, "restart", name)
+	defer func() { endSpan(span, err) }()
+
 	pm.mu.RLock()
 	state, ok := pm.processes[name]
 	isRunning := ok && state.Status == "running"
@@ -434,13 +1352,36 @@ func (pm *ProcessManager) RestartProcess(name string) error {
 	}
 
 	if isRunning {
-		if err := pm.StopProcess(name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+		if err := pm.StopProcessContext(ctx, name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
 			return err
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	return pm.StartProcess(name)
+	return pm.StartProcessContext(ctx, name)
+}
+
+// ForceRestartProcess restarts the process like RestartProcessContext and
+// cancels its pending automatic restart, so neither the remaining delay nor
+// a canrestart hook deferring it applies anymore. The restart is logged as
+// forced by an operator.
+func (pm *ProcessManager) ForceRestartProcess(ctx context.Context, name string) error {
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.Unlock()
+		return ErrProcessNotFound
+	}
+	state.restartSeq++
+	msg := fmt.Sprintf("Restart of process %s forced by operator", name)
+	if !state.NextRestartAt.IsZero() {
+		msg += fmt.Sprintf(", skipping the automatic restart due in %s", state.NextRestartAt.Sub(pm.now()).Round(time.Second))
+		state.NextRestartAt = time.Time{}
+	}
+	pm.log("info", msg, name)
+	pm.mu.Unlock()
+
+	return pm.RestartProcessContext(ctx, name)
 }
 
 func (pm *ProcessManager) GetProcesses() []models.Process {
@@ -449,34 +1390,34 @@ func (pm *ProcessManager) GetProcesses() []models.Process {
 
 	result := make([]models.Process, 0, len(pm.processes))
 	for name, state := range pm.processes {
-		uptime := "N/A"
-		if state.Status == "running" && !state.StartTime.IsZero() {
-			uptime = formatDuration(time.Since(state.StartTime))
-		}
-
-		memory := "N/A"
-		cpu := "N/A"
-		if state.Status == "running" && state.Pid > 0 {
-			memory = getProcessMemory(state.Pid)
-			cpu = getProcessCPU(state.Pid)
-		}
-
-		result = append(result, models.Process{
-			Name:      name,
-			Status:    state.Status,
-			Pid:       state.Pid,
-			Uptime:    uptime,
-			Memory:    memory,
-			CPU:       cpu,
-			Command:   state.Config.Command,
-			Args:      state.Config.Args,
-			Directory: state.Config.Directory,
-		})
+		result = append(result, toModel(name, state))
 	}
 
 	return result
 }
 
+// Summary returns the name, state, uptime and restart count of every
+// process, sorted by name.
+func (pm *ProcessManager) Summary() []models.ProcessSummary {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	summary := make([]models.ProcessSummary, 0, len(pm.processes))
+	for name, state := range pm.processes {
+		s := models.ProcessSummary{
+			Name:     name,
+			State:    state.Status,
+			Restarts: max(state.starts-1, 0),
+		}
+		if state.Status == "running" && !state.StartTime.IsZero() {
+			s.UptimeSeconds = int64(time.Since(state.StartTime) / time.Second)
+		}
+		summary = append(summary, s)
+	}
+	slices.SortFunc(summary, func(a, b models.ProcessSummary) int { return strings.Compare(a.Name, b.Name) })
+	return summary
+}
+
 func (pm *ProcessManager) GetProcess(name string) (models.Process, bool) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
@@ -486,6 +1427,18 @@ func (pm *ProcessManager) GetProcess(name string) (models.Process, bool) {
 		return models.Process{}, false
 	}
 
+	p := toModel(name, state)
+	if state.outputBuffer != nil {
+		p.StartupStderr = state.outputBuffer.GetStartupStderr()
+	}
+	p.LogBufferSize = pm.outputBufferSize(state.Config)
+	p.LogRetentionDays = pm.logRetention(state.Config)
+	return p, true
+}
+
+// toModel converts process state to its API representation.
+// Callers must hold pm.mu.
+func toModel(name string, state *ProcessState) models.Process {
 	uptime := "N/A"
 	if state.Status == "running" && !state.StartTime.IsZero() {
 		uptime = formatDuration(time.Since(state.StartTime))
@@ -498,17 +1451,72 @@ func (pm *ProcessManager) GetProcess(name string) (models.Process, bool) {
 		cpu = getProcessCPU(state.Pid)
 	}
 
-	return models.Process{
-		Name:      name,
-		Status:    state.Status,
-		Pid:       state.Pid,
-		Uptime:    uptime,
-		Memory:    memory,
-		CPU:       cpu,
-		Command:   state.Config.Command,
-		Args:      state.Config.Args,
-		Directory: state.Config.Directory,
-	}, true
+	p := models.Process{
+		Name:        name,
+		DisplayName: state.Config.DisplayName,
+		Status:      state.Status,
+		Pid:         state.Pid,
+		Uptime:      uptime,
+		Memory:      memory,
+		CPU:         cpu,
+		Command:     state.Config.Command,
+		Args:        state.Config.Args,
+		Directory:   state.Config.Directory,
+		Umask:       state.Config.Umask,
+		Labels:      state.Config.Labels,
+		ExitCodes:   slices.Clone(state.exitCodes),
+	}
+
+	if !state.LastHeartbeat.IsZero() {
+		p.LastHeartbeat = state.LastHeartbeat.Format(time.RFC3339)
+	}
+
+	if state.Config.HealthCheck != nil {
+		p.Health = state.Health
+		if p.Health == "" {
+			p.Health = HealthUnknown
+		}
+	}
+	if !state.LastHealthyAt.IsZero() {
+		p.LastHealthyAt = state.LastHealthyAt.Format(time.RFC3339)
+	}
+	if !state.NextRestartAt.IsZero() {
+		p.NextRestartAt = state.NextRestartAt.Format(time.RFC3339Nano)
+	}
+	if !state.bootStartAt.IsZero() {
+		p.BootStartAt = state.bootStartAt.Format(time.RFC3339)
+	}
+	if state.binaryMissing {
+		p.Warnings = append(p.Warnings, WarningBinaryMissing)
+	}
+	if state.Config.StartCondition != "" {
+		p.StartCondition = StartConditionUnknown
+		if !state.conditionCheckedAt.IsZero() {
+			p.StartCondition = StartConditionUnmet
+			if state.conditionMet {
+				p.StartCondition = StartConditionMet
+			}
+			p.StartConditionCheckedAt = state.conditionCheckedAt.Format(time.RFC3339)
+		}
+		p.StartPending = state.startPending
+	}
+	p.PreStartCheckError = state.preStartError
+	if state.held {
+		p.Held = true
+		p.HeldSince = state.heldSince.Format(time.RFC3339)
+	}
+	if time.Now().Before(state.silencedUntil) {
+		p.Silenced = true
+		p.SilencedUntil = state.silencedUntil.Format(time.RFC3339)
+	}
+	if state.startTimes.count() > 0 || state.stopTimes.count() > 0 {
+		p.Stats = &models.ProcessStats{
+			StartDuration: state.startTimes.stats(),
+			StopDuration:  state.stopTimes.stats(),
+		}
+	}
+
+	return p
 }
 
 func (pm *ProcessManager) GetLogs(limit int) []models.LogEntry {
@@ -530,32 +1538,76 @@ func (pm *ProcessManager) GetLogsByProcess(processName string, limit int) []mode
 	return filtered
 }
 
+// GetLogsByCorrelation returns the buffered output lines of every process
+// with the given correlation id, in the order they were logged.
+func (pm *ProcessManager) GetLogsByCorrelation(id string) []models.LogEntry {
+	return pm.logs.GetByCorrelation(id)
+}
+
 func (pm *ProcessManager) StartAll() {
 	pm.mu.RLock()
-	var toStart []string
-	for name, state := range pm.processes {
-		if state.Config.AutoStart {
-			toStart = append(toStart, name)
-		}
-	}
+	toStart := pm.orderedNames(func(state *ProcessState) bool {
+		return state.Config.AutoStart
+	})
 	pm.mu.RUnlock()
 
 	for _, name := range toStart {
-		pm.log("info", fmt.Sprintf("Auto-starting process %s", name), name)
-		if err := pm.StartProcess(name); err != nil {
-			pm.log("error", fmt.Sprintf("Failed to auto-start %s: %v", name, err), name)
+		pm.mu.Lock()
+		state := pm.processes[name]
+		delay := time.Duration(state.Config.BootDelaySeconds) * time.Second
+		if delay > 0 {
+			state.bootStartAt = pm.now().Add(delay)
+			go pm.delayedAutoStart(name, state, state.bootStartAt)
+		}
+		pm.mu.Unlock()
+
+		if delay > 0 {
+			pm.log("info", fmt.Sprintf("Auto-start of process %s delayed by %s", name, delay), name)
+			continue
 		}
+		pm.autoStart(name)
 	}
 }
 
-func (pm *ProcessManager) StopAll() {
-	pm.mu.RLock()
-	var toStop []string
-	for name, state := range pm.processes {
-		if state.Status == "running" {
-			toStop = append(toStop, name)
+// delayedAutoStart autostarts a process at the time its boot delay ends,
+// unless it was started or held in the meantime.
+func (pm *ProcessManager) delayedAutoStart(name string, state *ProcessState, at time.Time) {
+	pm.sleep(at.Sub(pm.now()))
+
+	pm.mu.Lock()
+	due := state.bootStartAt.Equal(at)
+	state.bootStartAt = time.Time{}
+	pm.mu.Unlock()
+
+	if due {
+		pm.autoStart(name)
+	}
+}
+
+// autoStart starts a process on supervisor startup, once its dependencies
+// are ready or the dependency_wait_timeout has passed.
+func (pm *ProcessManager) autoStart(name string) {
+	if err := pm.waitForDependencies(name); err != nil {
+		if pm.dependencyPolicy == config.DependencyWaitStrict {
+			pm.log("error", fmt.Sprintf("Not starting %s: %v", name, err), name)
+			return
 		}
+		pm.log("warning", fmt.Sprintf("Starting %s anyway: %v", name, err), name)
+	}
+	pm.log("info", fmt.Sprintf("Auto-starting process %s", name), name)
+	if err := pm.StartProcess(name); err != nil && !errors.Is(err, ErrStartDeferred) {
+		pm.log("error", fmt.Sprintf("Failed to auto-start %s: %v", name, err), name)
 	}
+}
+
+func (pm *ProcessManager) StopAll() {
+	pm.mu.RLock()
+	running := pm.orderedNames(func(state *ProcessState) bool {
+		return state.Status == "running"
+	})
+	// Stop in reverse start order so dependents go down before dependencies,
+	// unless stop_order says otherwise
+	toStop := stopOrder(running, pm.stopOrder)
 	pm.mu.RUnlock()
 
 	for _, name := range toStop {
@@ -564,9 +1616,17 @@ func (pm *ProcessManager) StopAll() {
 			pm.log("error", fmt.Sprintf("Failed to stop %s: %v", name, err), name)
 		}
 	}
+	// Save the transitions before the caller closes the store
+	pm.transitions.wait()
 }
 
 func (pm *ProcessManager) RestartAll() (restarted int, failed int) {
+	return pm.restartAll(nil)
+}
+
+// restartAll restarts every running process, calling report (if set) with
+// the outcome for each process as it completes.
+func (pm *ProcessManager) restartAll(report func(name string, err error)) (restarted int, failed int) {
 	pm.mu.RLock()
 	var toRestart []string
 	for name, state := range pm.processes {
@@ -580,12 +1640,16 @@ func (pm *ProcessManager) RestartAll() (restarted int, failed int) {
 
 	for _, name := range toRestart {
 		pm.log("info", fmt.Sprintf("Restarting process %s", name), name)
-		if err := pm.RestartProcess(name); err != nil {
+		err := pm.RestartProcess(name)
+		if err != nil {
 			pm.log("error", fmt.Sprintf("Failed to restart %s: %v", name, err), name)
 			failed++
 		} else {
 			restarted++
 		}
+		if report != nil {
+			report(name, err)
+		}
 	}
 
 	pm.log("info", fmt.Sprintf("Bulk restart completed: %d restarted, %d failed", restarted, failed), "")
@@ -593,43 +1657,57 @@ func (pm *ProcessManager) RestartAll() (restarted int, failed int) {
 }
 
 func (pm *ProcessManager) RestartSelected(names []string) (restarted int, failed int) {
+	return pm.restartSelected(names, nil)
+}
+
+// restartSelected restarts the named processes, starting those that are not
+// running, and calls report (if set) with the outcome for each process.
+func (pm *ProcessManager) restartSelected(names []string, report func(name string, err error)) (restarted int, failed int) {
 	pm.log("info", fmt.Sprintf("Selective restart initiated for %d processes", len(names)), "")
 
 	for _, name := range names {
-		pm.mu.RLock()
-		state, ok := pm.processes[name]
-		pm.mu.RUnlock()
-
-		if !ok {
-			pm.log("warning", fmt.Sprintf("Process %s not found, skipping", name), name)
-			failed++
-			continue
-		}
-
-		if state.Status != "running" {
-			pm.log("info", fmt.Sprintf("Process %s is not running, starting", name), name)
-			if err := pm.StartProcess(name); err != nil {
-				pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
-				failed++
-			} else {
-				restarted++
-			}
-			continue
-		}
-
-		pm.log("info", fmt.Sprintf("Restarting process %s", name), name)
-		if err := pm.RestartProcess(name); err != nil {
-			pm.log("error", fmt.Sprintf("Failed to restart %s: %v", name, err), name)
+		err := pm.restartOrStart(name)
+		if err != nil {
 			failed++
 		} else {
 			restarted++
 		}
+		if report != nil {
+			report(name, err)
+		}
 	}
 
 	pm.log("info", fmt.Sprintf("Selective restart completed: %d restarted, %d failed", restarted, failed), "")
 	return restarted, failed
 }
 
+func (pm *ProcessManager) restartOrStart(name string) error {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	pm.mu.RUnlock()
+
+	if !ok {
+		pm.log("warning", fmt.Sprintf("Process %s not found, skipping", name), name)
+		return ErrProcessNotFound
+	}
+
+	if state.Status != "running" {
+		pm.log("info", fmt.Sprintf("Process %s is not running, starting", name), name)
+		if err := pm.StartProcess(name); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
+			return err
+		}
+		return nil
+	}
+
+	pm.log("info", fmt.Sprintf("Restarting process %s", name), name)
+	if err := pm.RestartProcess(name); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to restart %s: %v", name, err), name)
+		return err
+	}
+	return nil
+}
+
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
 
@@ -0,0 +1,480 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+	"pupervisor/internal/notifier"
+	"pupervisor/internal/storage"
+)
+
+// newTestManager loads a process manager from the given config file
+// contents, with a fresh database, and stops its processes when the test
+// ends.
+func newTestManager(t *testing.T, yaml string) (*ProcessManager, *storage.Storage) {
+	t.Helper()
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "pupervisor.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadProcessConfig(path)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig: %v", err)
+	}
+
+	store, err := storage.New(filepath.Join(dir, "test.db"), storage.Options{BusyTimeout: 5000})
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+
+	pm := NewProcessManager(cfg, store)
+	t.Cleanup(func() {
+		pm.StopAll()
+		store.Close()
+	})
+	return pm, store
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRestartTimesUseManagerClock checks that crash times, from which restart
+// intervals are computed, and the next restart time come from pm.now.
+func TestRestartTimesUseManagerClock(t *testing.T) {
+	pm, store := newTestManager(t, `
+processes:
+  - name: app
+    command: /bin/sh
+    args: ["-c", "exit 1"]
+    autorestart: true
+    startsecs: 30
+`)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pm.now = func() time.Time { return now }
+
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+
+	var crashes []storage.CrashRecord
+	waitFor(t, "the crash record", func() bool {
+		crashes, _ = store.GetCrashesByProcess("app", 10)
+		return len(crashes) > 0
+	})
+	if !crashes[0].StartedAt.Equal(now) || !crashes[0].CrashedAt.Equal(now) {
+		t.Errorf("crash started at %s and crashed at %s, want %s", crashes[0].StartedAt, crashes[0].CrashedAt, now)
+	}
+
+	want := now.Add(30 * time.Second).Format(time.RFC3339Nano)
+	waitFor(t, "the pending restart", func() bool {
+		p, _ := pm.GetProcess("app")
+		return p.NextRestartAt != ""
+	})
+	if p, _ := pm.GetProcess("app"); p.NextRestartAt != want {
+		t.Errorf("NextRestartAt = %s, want %s", p.NextRestartAt, want)
+	}
+}
+
+// TestStopRightAfterStart checks that a process stopped as soon as it has
+// started goes down on its stop signal rather than at its stop timeout.
+func TestStopRightAfterStart(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+    stoptimeout: 10
+`)
+	for i := range 5 {
+		if err := pm.StartProcess("app"); err != nil {
+			t.Fatalf("StartProcess: %v", err)
+		}
+		start := time.Now()
+		if err := pm.StopProcess("app"); err != nil {
+			t.Fatalf("StopProcess: %v", err)
+		}
+		if took := time.Since(start); took > 5*time.Second {
+			t.Fatalf("stop %d took %s, want well under the stop timeout", i, took)
+		}
+	}
+}
+
+func TestOutputBufferLastLines(t *testing.T) {
+	ob := NewOutputBuffer(3)
+	ob.AddStdout("out 1")
+	ob.AddStderr("err 1")
+	ob.AddStdout("out 2")
+	ob.AddStderr("err 2")
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{2, []string{"out 2", "err 2"}},
+		{3, []string{"err 1", "out 2", "err 2"}},
+		{10, []string{"err 1", "out 2", "err 2"}},
+	}
+	for _, tt := range tests {
+		if got := ob.GetLastLines(tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("GetLastLines(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// notifyTarget hands the notifications sent by a process manager to the
+// test.
+type notifyTarget struct {
+	events chan notifier.Event
+}
+
+// captureNotifications replaces the notification targets of pm.
+func captureNotifications(pm *ProcessManager) *notifyTarget {
+	target := &notifyTarget{events: make(chan notifier.Event, 16)}
+	pm.notifier.SetTargets([]notifier.Target{target})
+	return target
+}
+
+func (t *notifyTarget) Name() string { return "test" }
+
+func (t *notifyTarget) Send(ctx context.Context, event notifier.Event) error {
+	t.events <- event
+	return nil
+}
+
+// next returns the next notification sent.
+func (t *notifyTarget) next(tb testing.TB) notifier.Event {
+	tb.Helper()
+	select {
+	case event := <-t.events:
+		return event
+	case <-time.After(5 * time.Second):
+		tb.Fatal("no notification sent")
+		return notifier.Event{}
+	}
+}
+
+func TestUnexpectedCleanExit(t *testing.T) {
+	pm, store := newTestManager(t, `
+processes:
+  - name: daemon
+    command: "true"
+    expect_long_running: true
+  - name: job
+    command: "true"
+`)
+	notifications := captureNotifications(pm)
+
+	for _, name := range []string{"job", "daemon"} {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatalf("StartProcess(%s): %v", name, err)
+		}
+	}
+
+	event := notifications.next(t)
+	if event.Type != "unexpected_exit" || event.Process != "daemon" {
+		t.Errorf("notification = %s for %s, want unexpected_exit for daemon", event.Type, event.Process)
+	}
+
+	var crashes []storage.CrashRecord
+	waitFor(t, "the crash record", func() bool {
+		crashes, _ = store.GetCrashesByProcess("daemon", 10)
+		return len(crashes) > 0
+	})
+	if crashes[0].ExitCode != 0 || crashes[0].ErrorMsg != errUnexpectedExit.Error() {
+		t.Errorf("crash = exit code %d, error %q, want 0 and %q", crashes[0].ExitCode, crashes[0].ErrorMsg, errUnexpectedExit)
+	}
+
+	waitFor(t, "job to exit", func() bool {
+		p, _ := pm.GetProcess("job")
+		return p.Status == "stopped"
+	})
+	if crashes, _ := store.GetCrashesByProcess("job", 10); len(crashes) != 0 {
+		t.Errorf("clean exit of job recorded as %d crash(es)", len(crashes))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: worker
+    command: sleep
+    args: ["30"]
+  - name: api
+    command: sleep
+    args: ["30"]
+`)
+	if err := pm.StartProcess("api"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.RestartProcess("api"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.RestartProcess("api"); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := pm.Summary()
+	if len(summary) != 2 {
+		t.Fatalf("Summary() = %+v, want 2 processes", summary)
+	}
+	api, worker := summary[0], summary[1]
+	if api.Name != "api" || worker.Name != "worker" {
+		t.Errorf("Summary() names = %s, %s, want sorted by name", api.Name, worker.Name)
+	}
+	if api.State != "running" || api.Restarts != 2 {
+		t.Errorf("api = %+v, want running with 2 restarts", api)
+	}
+	if worker.State != "stopped" || worker.Restarts != 0 || worker.UptimeSeconds != 0 {
+		t.Errorf("worker = %+v, want stopped with no restarts or uptime", worker)
+	}
+}
+
+// TestOutputReadAfterExit checks that output a process writes right before
+// exiting is kept even when the process is reaped before it is read.
+func TestOutputReadAfterExit(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: quick
+    command: /bin/sh
+    args: ["-c", "echo one; echo two; echo three >&2"]
+`)
+	for range 10 {
+		if err := pm.StartProcess("quick"); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "quick to exit", func() bool {
+			p, _ := pm.GetProcess("quick")
+			return p.Status != "running"
+		})
+
+		pm.mu.RLock()
+		ob := pm.processes["quick"].outputBuffer
+		pm.mu.RUnlock()
+		waitFor(t, "all output to be read", func() bool {
+			return len(ob.GetLastLines(10)) == 3
+		})
+	}
+}
+
+// TestOutputOfLeftoverChild checks that the output of an exited process is
+// drained soon even when a child it left running still holds its pipes.
+func TestOutputOfLeftoverChild(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: parent
+    command: /bin/sh
+    args: ["-c", "sleep 3 & echo started"]
+    sample_rate: "1"
+`)
+	if err := pm.StartProcess("parent"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last sampling summary is logged once the output is drained
+	start := time.Now()
+	waitFor(t, "the output to be drained", func() bool {
+		return hasLog(pm, "parent", "info", "Sampled 1 of 1 output lines from parent")
+	})
+	if elapsed := time.Since(start); elapsed > outputDrainTimeout+time.Second {
+		t.Errorf("output drained after %s, want about %s", elapsed, outputDrainTimeout)
+	}
+}
+
+func TestLogSinceStart(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: timed
+    command: /bin/sh
+    args: ["-c", "sleep 0.5; echo ready"]
+    log_since_start: true
+  - name: plain
+    command: /bin/sh
+    args: ["-c", "echo ready"]
+`)
+	started := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	now := started
+	pm.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	for _, name := range []string{"timed", "plain"} {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The timed process writes its line after this
+	mu.Lock()
+	now = started.Add(1500 * time.Millisecond)
+	mu.Unlock()
+
+	output := func(name string) (models.LogEntry, bool) {
+		for _, entry := range pm.GetLogsByProcess(name, 100) {
+			if entry.Source == models.LogSourceOutput {
+				return entry, true
+			}
+		}
+		return models.LogEntry{}, false
+	}
+	waitFor(t, "the output of both processes", func() bool {
+		_, timed := output("timed")
+		_, plain := output("plain")
+		return timed && plain
+	})
+
+	timed, _ := output("timed")
+	plain, _ := output("plain")
+	if timed.SinceStart != "1.5s" {
+		t.Errorf("timed SinceStart = %q, want %q", timed.SinceStart, "1.5s")
+	}
+	if plain.SinceStart != "" {
+		t.Errorf("plain SinceStart = %q, want none", plain.SinceStart)
+	}
+
+	// A restart resets the elapsed time to count from the new instance
+	restarted := started.Add(time.Hour)
+	mu.Lock()
+	now = restarted
+	mu.Unlock()
+	if err := pm.RestartProcess("timed"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	now = restarted.Add(2 * time.Second)
+	mu.Unlock()
+
+	var elapsed []string
+	waitFor(t, "the output of the restarted process", func() bool {
+		elapsed = nil
+		for _, entry := range pm.GetLogsByProcess("timed", 100) {
+			if entry.Source == models.LogSourceOutput {
+				elapsed = append(elapsed, entry.SinceStart)
+			}
+		}
+		return len(elapsed) == 2
+	})
+	slices.Sort(elapsed)
+	if want := []string{"1.5s", "2s"}; !slices.Equal(elapsed, want) {
+		t.Errorf("timed SinceStart over both instances = %q, want %q", elapsed, want)
+	}
+}
+
+func TestCrashRecordCommandLine(t *testing.T) {
+	pm, store := newTestManager(t, `
+processes:
+  - name: web
+    command: /bin/sh
+    args: ["-c", "exit 2", "sh", "--port=${PORT}", "--token=${secret:token}"]
+    replicas: 2
+    port_base: 8000
+`)
+	pm.SetSecretProvider(fakeSecrets{"token": "s3cret"})
+	if err := store.SetSetting(deployVersionSetting, "v42"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pm.StartProcess("web-1"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+
+	var crashes []storage.CrashRecord
+	waitFor(t, "the crash record", func() bool {
+		crashes, _ = store.GetCrashesByProcess("web-1", 10)
+		return len(crashes) > 0
+	})
+
+	want := []string{"/bin/sh", "-c", "exit 2", "sh", "--port=8001", "--token=${secret:token}"}
+	if !slices.Equal(crashes[0].CommandLine, want) {
+		t.Errorf("CommandLine = %q, want %q", crashes[0].CommandLine, want)
+	}
+	if crashes[0].Version != "v42" {
+		t.Errorf("Version = %q, want v42", crashes[0].Version)
+	}
+}
+
+// TestBootDelay checks that a delayed autostart happens once its delay is
+// over, unless the process was started or held in the meantime.
+func TestBootDelay(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: delayed
+    command: sleep
+    args: ["30"]
+    autostart: true
+    boot_delay_seconds: 10
+  - name: started
+    command: sleep
+    args: ["30"]
+    autostart: true
+    boot_delay_seconds: 10
+  - name: held
+    command: sleep
+    args: ["30"]
+    autostart: true
+    boot_delay_seconds: 10
+`)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pm.now = func() time.Time { return now }
+	delays := make(chan time.Duration, 3)
+	release := make(chan struct{})
+	pm.sleep = func(d time.Duration) {
+		delays <- d
+		<-release
+	}
+
+	pm.StartAll()
+	for range 3 {
+		if d := <-delays; d != 10*time.Second {
+			t.Errorf("boot delay wait = %s, want 10s", d)
+		}
+	}
+	want := now.Add(10 * time.Second).Format(time.RFC3339)
+	for _, name := range []string{"delayed", "started", "held"} {
+		if p, _ := pm.GetProcess(name); p.Status != "stopped" || p.BootStartAt != want {
+			t.Errorf("%s = %s due at %q during the delay, want stopped due at %s", name, p.Status, p.BootStartAt, want)
+		}
+	}
+
+	// Starting or holding the process cancels its delayed start
+	if err := pm.StartProcess("started"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+	if err := pm.StopProcess("started"); err != nil {
+		t.Fatalf("StopProcess: %v", err)
+	}
+	if err := pm.HoldProcess("held"); err != nil {
+		t.Fatalf("HoldProcess: %v", err)
+	}
+
+	close(release)
+	waitFor(t, "the delayed autostart", func() bool {
+		p, _ := pm.GetProcess("delayed")
+		return p.Status == "running"
+	})
+	time.Sleep(200 * time.Millisecond)
+	for _, name := range []string{"started", "held"} {
+		if p, _ := pm.GetProcess(name); p.Status != "stopped" || p.BootStartAt != "" {
+			t.Errorf("%s = %s due at %q after the delay, want stopped and not due", name, p.Status, p.BootStartAt)
+		}
+	}
+}
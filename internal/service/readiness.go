@@ -0,0 +1,54 @@
+package service
+
+// Reasons a process is not ready for traffic
+const (
+	NotReadyStopped       = "not running"
+	NotReadyDraining      = "stopping"
+	NotReadyUnhealthy     = "unhealthy"
+	NotReadyHealthUnknown = "health unknown"
+)
+
+// readiness returns "" if the process should receive traffic, or why not.
+// A process is ready while it runs, is not being stopped and, if it has a
+// health check, has passed it. Callers must hold pm.mu.
+func readiness(state *ProcessState) string {
+	switch {
+	case state.Status != "running":
+		return NotReadyStopped
+	case state.draining:
+		return NotReadyDraining
+	case state.Config.HealthCheck == nil:
+		return ""
+	case state.Health == HealthHealthy:
+		return ""
+	case state.Health == HealthUnhealthy:
+		return NotReadyUnhealthy
+	}
+	return NotReadyHealthUnknown
+}
+
+// updateReadiness publishes the readiness of a process for Readiness, which
+// must not wait for pm.mu: stopping a process holds it until the process has
+// exited. Callers must hold pm.mu.
+func (pm *ProcessManager) updateReadiness(name string, state *ProcessState) {
+	pm.readiness.Store(name, readiness(state))
+}
+
+// Readiness reports whether a process should receive traffic and, if not,
+// why. It answers without waiting for a process being stopped.
+func (pm *ProcessManager) Readiness(name string) (ready bool, reason string, err error) {
+	if v, ok := pm.readiness.Load(name); ok {
+		reason := v.(string)
+		return reason == "", reason, nil
+	}
+
+	// Never started since it was registered
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	state, ok := pm.processes[name]
+	if !ok {
+		return false, "", ErrProcessNotFound
+	}
+	reason = readiness(state)
+	return reason == "", reason, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: plain
+    command: sleep
+    args: ["30"]
+  - name: healthy
+    command: sleep
+    args: ["30"]
+    healthcheck:
+      command: "true"
+  - name: unhealthy
+    command: sleep
+    args: ["30"]
+    healthcheck:
+      command: "false"
+      retries: 1
+`)
+
+	reason := func(name string) string {
+		t.Helper()
+		_, reason, err := pm.Readiness(name)
+		if err != nil {
+			t.Fatalf("Readiness(%s) error = %v", name, err)
+		}
+		return reason
+	}
+
+	if got := reason("plain"); got != NotReadyStopped {
+		t.Errorf("never started: reason = %q, want %q", got, NotReadyStopped)
+	}
+	if _, _, err := pm.Readiness("missing"); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("Readiness(missing) error = %v, want %v", err, ErrProcessNotFound)
+	}
+
+	for _, name := range []string{"plain", "healthy", "unhealthy"} {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatalf("StartProcess(%s) error = %v", name, err)
+		}
+	}
+
+	if got := reason("plain"); got != "" {
+		t.Errorf("running without a health check: reason = %q, want ready", got)
+	}
+	if got := reason("healthy"); got != NotReadyHealthUnknown {
+		t.Errorf("before its first check: reason = %q, want %q", got, NotReadyHealthUnknown)
+	}
+
+	pm.checkHealth("healthy")
+	pm.checkHealth("unhealthy")
+	if got := reason("healthy"); got != "" {
+		t.Errorf("after passing its check: reason = %q, want ready", got)
+	}
+	if got := reason("unhealthy"); got != NotReadyUnhealthy {
+		t.Errorf("after failing its check: reason = %q, want %q", got, NotReadyUnhealthy)
+	}
+
+	if err := pm.StopProcess("plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := reason("plain"); got != NotReadyStopped {
+		t.Errorf("after stopping: reason = %q, want %q", got, NotReadyStopped)
+	}
+}
+
+func TestReadinessWhileStopping(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: stubborn
+    command: /bin/sh
+    args: ["-c", "trap '' TERM; while true; do sleep 0.1; done"]
+    stoptimeout: 2
+`)
+	if err := pm.StartProcess("stubborn"); err != nil {
+		t.Fatal(err)
+	}
+	// Let the shell install its trap
+	time.Sleep(200 * time.Millisecond)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- pm.StopProcess("stubborn") }()
+
+	// Readiness answers while StopProcess holds pm.mu waiting for the exit
+	waitFor(t, "the process to be draining", func() bool {
+		_, reason, _ := pm.Readiness("stubborn")
+		return reason == NotReadyDraining
+	})
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("StopProcess() error = %v", err)
+	}
+	if _, reason, _ := pm.Readiness("stubborn"); reason != NotReadyStopped {
+		t.Errorf("after stopping: reason = %q, want %q", reason, NotReadyStopped)
+	}
+}
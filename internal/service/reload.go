@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+)
+
+var ErrNoConfigPath = errors.New("no config file to reload from")
+
+// ReloadResult lists what a config reload did to each process.
+type ReloadResult struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Restarted []string `json:"restarted"`
+	Updated   []string `json:"updated"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// SetConfigPath sets the file Reload reads process definitions from.
+func (pm *ProcessManager) SetConfigPath(path string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.configPath = path
+}
+
+// Reload re-reads the config file and applies it, recording the process
+// config changes as made by actor.
+func (pm *ProcessManager) Reload(actor string) (ReloadResult, error) {
+	pm.mu.RLock()
+	path := pm.configPath
+	pm.mu.RUnlock()
+
+	if path == "" {
+		return ReloadResult{}, ErrNoConfigPath
+	}
+
+	cfg, err := config.LoadProcessConfig(path)
+	if err != nil {
+		return ReloadResult{}, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	pm.mu.RLock()
+	allowlist := pm.allowlist
+	pm.mu.RUnlock()
+	if err := cfg.CheckCommands(allowlist); err != nil {
+		return ReloadResult{}, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	return pm.ApplyConfig(cfg, actor), nil
+}
+
+// ApplyConfig brings the managed processes in line with cfg. Only processes
+// whose spawn parameters changed are restarted; everything else keeps its
+// output buffer, uptime and health state, with new options applied in place.
+// Processes not in cfg are stopped and removed, including those added by
+// CloneProcess. The notification webhooks are replaced as well. Added, removed and changed
+// processes are recorded as config changes made by actor.
+func (pm *ProcessManager) ApplyConfig(cfg *config.SupervisorConfig, actor string) ReloadResult {
+	result := ReloadResult{
+		Added:     []string{},
+		Removed:   []string{},
+		Restarted: []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+	}
+
+	wanted := make(map[string]config.ProcessConfig, len(cfg.Processes))
+	for _, procCfg := range cfg.Processes {
+		wanted[procCfg.Name] = procCfg
+	}
+
+	var toStart, toRestart, toStop []string
+	var changes []storage.ConfigChange
+
+	pm.mu.Lock()
+	for name, state := range pm.processes {
+		if _, ok := wanted[name]; !ok {
+			result.Removed = append(result.Removed, name)
+			changes = append(changes, pm.processChange(name, &state.Config, nil, actor))
+			if state.Status == "running" {
+				toStop = append(toStop, name)
+			}
+		}
+	}
+
+	for name, procCfg := range wanted {
+		state, ok := pm.processes[name]
+		switch {
+		case !ok:
+			pm.processes[name] = &ProcessState{Config: procCfg, Status: "stopped"}
+			result.Added = append(result.Added, name)
+			changes = append(changes, pm.processChange(name, nil, &procCfg, actor))
+			if procCfg.AutoStart {
+				toStart = append(toStart, name)
+			}
+		case reflect.DeepEqual(state.Config, procCfg):
+			result.Unchanged = append(result.Unchanged, name)
+		case state.Status == "running" && config.RequiresRestart(state.Config, procCfg):
+			changes = append(changes, pm.processChange(name, &state.Config, &procCfg, actor))
+			state.Config = procCfg
+			result.Restarted = append(result.Restarted, name)
+			toRestart = append(toRestart, name)
+		default:
+			changes = append(changes, pm.processChange(name, &state.Config, &procCfg, actor))
+			state.Config = procCfg
+			pm.updateReadiness(name, state)
+			result.Updated = append(result.Updated, name)
+		}
+	}
+	pm.mu.Unlock()
+
+	pm.recordConfigChanges(changes)
+
+	for _, name := range toStop {
+		if err := pm.StopProcess(name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+			pm.log("error", fmt.Sprintf("Failed to stop removed process %s: %v", name, err), name)
+		}
+	}
+
+	pm.mu.Lock()
+	for _, name := range result.Removed {
+		if ob := pm.processes[name].outputBuffer; ob != nil {
+			ob.release()
+		}
+		delete(pm.processes, name)
+		pm.readiness.Delete(name)
+	}
+	pm.fileWebhooks = cfg.Notifications.Webhooks
+	pm.stopOrder = cfg.StopOrder
+	pm.defaults = cfg
+	pm.dependencyWait = time.Duration(cfg.DependencyWaitTimeout) * time.Second
+	pm.dependencyPolicy = cfg.DependencyWaitPolicy
+	pm.mu.Unlock()
+
+	pm.applyWebhooks()
+	pm.notifier.SetDefaultChannels(cfg.Notifications.Default)
+	pm.updateFileWatches()
+
+	for _, name := range toRestart {
+		if err := pm.RestartProcess(name); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to restart %s after reload: %v", name, err), name)
+		}
+	}
+
+	for _, name := range toStart {
+		if err := pm.StartProcess(name); err != nil && !errors.Is(err, ErrStartDeferred) {
+			pm.log("error", fmt.Sprintf("Failed to start %s after reload: %v", name, err), name)
+		}
+	}
+
+	for _, names := range [][]string{result.Added, result.Removed, result.Restarted, result.Updated, result.Unchanged} {
+		sort.Strings(names)
+	}
+
+	pm.log("info", fmt.Sprintf("Config reloaded: %d added, %d removed, %d restarted, %d updated, %d unchanged",
+		len(result.Added), len(result.Removed), len(result.Restarted), len(result.Updated), len(result.Unchanged)), "")
+
+	return result
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReloadRestartsOnlyChangedSpawnParameters(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: changed
+    command: sleep
+    args: ["30"]
+  - name: tuned
+    command: sleep
+    args: ["30"]
+  - name: same
+    command: sleep
+    args: ["30"]
+  - name: removed
+    command: sleep
+    args: ["30"]
+`)
+	for _, name := range []string{"changed", "tuned", "same", "removed"} {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatalf("StartProcess(%s): %v", name, err)
+		}
+	}
+	pids := make(map[string]int)
+	for _, p := range pm.GetProcesses() {
+		pids[p.Name] = p.Pid
+	}
+
+	path := filepath.Join(t.TempDir(), "pupervisor.yaml")
+	if err := os.WriteFile(path, []byte(`
+processes:
+  - name: changed
+    command: sleep
+    args: ["31"]
+  - name: tuned
+    command: sleep
+    args: ["30"]
+    autorestart: true
+  - name: same
+    command: sleep
+    args: ["30"]
+  - name: added
+    command: sleep
+    args: ["30"]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pm.SetConfigPath(path)
+
+	result, err := pm.Reload("test")
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := ReloadResult{
+		Added:     []string{"added"},
+		Removed:   []string{"removed"},
+		Restarted: []string{"changed"},
+		Updated:   []string{"tuned"},
+		Unchanged: []string{"same"},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Reload() = %+v, want %+v", result, want)
+	}
+
+	for name, keeps := range map[string]bool{"changed": false, "tuned": true, "same": true} {
+		p, ok := pm.GetProcess(name)
+		if !ok || p.Status != "running" {
+			t.Errorf("%s: status %q after reload, want running", name, p.Status)
+			continue
+		}
+		if (p.Pid == pids[name]) != keeps {
+			t.Errorf("%s: PID %d after reload, was %d; want kept %v", name, p.Pid, pids[name], keeps)
+		}
+	}
+	if _, ok := pm.GetProcess("removed"); ok {
+		t.Error("removed process still managed after reload")
+	}
+	pm.mu.RLock()
+	autoRestart := pm.processes["tuned"].Config.AutoRestart
+	pm.mu.RUnlock()
+	if !autoRestart {
+		t.Error("tuned: autorestart not applied in place")
+	}
+}
+
+func TestReloadWithoutConfigPath(t *testing.T) {
+	pm, _ := newTestManager(t, "processes: []\n")
+	if _, err := pm.Reload("test"); err != ErrNoConfigPath {
+		t.Errorf("Reload() error = %v, want %v", err, ErrNoConfigPath)
+	}
+}
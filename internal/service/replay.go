@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"pupervisor/internal/config"
+)
+
+var (
+	ErrReplayDisabled = errors.New("crash replay is disabled")
+	ErrNoCommandLine  = errors.New("crash has no recorded command line")
+)
+
+// SetCrashReplay enables ReplayCommand. It is off by default because it
+// runs arbitrary recorded commands on request.
+func (pm *ProcessManager) SetCrashReplay(enabled bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.crashReplay = enabled
+}
+
+// ReplayCommand builds, without starting it, a one-off command that re-runs
+// the command line recorded with a crash. If the process is still defined
+// its directory, environment, user and umask are applied. The command is not
+// registered as a managed process and is killed when ctx is done.
+func (pm *ProcessManager) ReplayCommand(ctx context.Context, id int64) (*exec.Cmd, error) {
+	pm.mu.RLock()
+	enabled := pm.crashReplay
+	pm.mu.RUnlock()
+
+	if !enabled {
+		return nil, ErrReplayDisabled
+	}
+	if pm.storage == nil {
+		return nil, errors.New("storage not available")
+	}
+
+	crash, err := pm.storage.GetCrashByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(crash.CommandLine) == 0 {
+		return nil, ErrNoCommandLine
+	}
+
+	procCfg := config.ProcessConfig{Name: crash.ProcessName}
+	pm.mu.RLock()
+	if state, ok := pm.processes[crash.ProcessName]; ok {
+		procCfg = state.Config
+	}
+	pm.mu.RUnlock()
+	// The recorded command line already includes the shell of a shell process
+	procCfg.Command = crash.CommandLine[0]
+	procCfg.Args = crash.CommandLine[1:]
+	procCfg.Shell = false
+
+	procCfg, err = pm.resolveSecrets(procCfg.WithInstanceVars())
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	allowlist := pm.allowlist
+	pm.mu.RUnlock()
+	if err := pm.checkCommandAllowed(allowlist, procCfg); err != nil {
+		return nil, err
+	}
+
+	cmd := newCommand(ctx, procCfg)
+	cmd.Dir = procCfg.Directory
+	if procCfg.User != "" {
+		if err := setUser(cmd, procCfg.User); err != nil {
+			return nil, err
+		}
+	}
+	if len(procCfg.Environment) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range procCfg.Environment {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	pm.log("warning", fmt.Sprintf("Replaying command of crash %d of process %s", id, crash.ProcessName), crash.ProcessName)
+	return cmd, nil
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoReplicas is returned for a rolling restart of a name that has no
+// replicas.
+var ErrNoReplicas = errors.New("process has no replicas")
+
+// Replicas returns the names of the replicas of base in instance order.
+func (pm *ProcessManager) Replicas(base string) []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.replicas(base)
+}
+
+// replicas is Replicas for callers that hold pm.mu.
+func (pm *ProcessManager) replicas(base string) []string {
+	instances := make(map[string]int)
+	var names []string
+	for name, state := range pm.processes {
+		instance := state.Config.Instance
+		if instance == nil || name != fmt.Sprintf("%s-%d", base, *instance) {
+			continue
+		}
+		instances[name] = *instance
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return instances[names[i]] < instances[names[j]] })
+	return names
+}
+
+// ReplicaMaxUnavailable returns how many replicas of base a rolling restart
+// may have down at once: the max_unavailable of its replicas, at least 1 and
+// at most the number of replicas.
+func (pm *ProcessManager) ReplicaMaxUnavailable(base string) int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	names := pm.replicas(base)
+	if len(names) == 0 {
+		return 0
+	}
+	n := pm.processes[names[0]].Config.MaxUnavailable
+	return min(max(n, 1), len(names))
+}
+
+// RollingRestartReplicas restarts (or starts) the replicas of base, at most
+// max_unavailable at a time. Each must become ready, up for its min_uptime
+// and passing its health check, within timeout. Replicas that are not ready
+// for other reasons count against max_unavailable too, so at least the rest
+// stay ready throughout. The first replica is the canary and is restarted
+// on its own: after any failure the replicas not yet restarted are left
+// alone and reported as failed with ErrRollingHalted.
+func (pm *ProcessManager) RollingRestartReplicas(base string, timeout time.Duration) ([]JobResult, error) {
+	names := pm.Replicas(base)
+	if len(names) == 0 {
+		return nil, ErrNoReplicas
+	}
+
+	results := []JobResult{}
+	pm.rollingRestartReplicas(base, names, timeout, func(name string, err error) {
+		result := JobResult{Name: name, Status: "ok"}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	})
+	return results, nil
+}
+
+// RollingRestartReplicasAsync runs RollingRestartReplicas in the background
+// and returns the job tracking its progress.
+func (pm *ProcessManager) RollingRestartReplicasAsync(base string, timeout time.Duration) (Job, error) {
+	names := pm.Replicas(base)
+	if len(names) == 0 {
+		return Job{}, ErrNoReplicas
+	}
+
+	job := pm.jobs.create("restart-replicas", len(names))
+	pm.jobs.setMaxUnavailable(job, pm.ReplicaMaxUnavailable(base))
+	go func() {
+		pm.rollingRestartReplicas(base, names, timeout, func(name string, err error) { pm.jobs.report(job, name, err) })
+		pm.jobs.finish(job)
+	}()
+
+	snapshot, _ := pm.jobs.get(job.ID)
+	return snapshot, nil
+}
+
+// ErrTooManyUnavailable is returned for a replica a rolling restart could
+// not take down without exceeding max_unavailable in time.
+var ErrTooManyUnavailable = errors.New("too many replicas unavailable")
+
+func (pm *ProcessManager) rollingRestartReplicas(base string, names []string, timeout time.Duration, report func(name string, err error)) {
+	maxUnavailable := pm.ReplicaMaxUnavailable(base)
+	pm.log("info", fmt.Sprintf("Rolling restart of %d replicas of %s initiated, canary %s, at most %d unavailable", len(names), base, names[0], maxUnavailable), "")
+
+	// Replicas are reported from several goroutines past the canary
+	var reportMu sync.Mutex
+	report = func(report func(string, error)) func(string, error) {
+		return func(name string, err error) {
+			reportMu.Lock()
+			defer reportMu.Unlock()
+			report(name, err)
+		}
+	}(report)
+
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]bool)
+		halted   bool
+		done     = make(chan struct{}, len(names))
+		running  int
+	)
+	restart := func(i int, name string) {
+		defer func() { done <- struct{}{} }()
+
+		err := pm.restartOrStart(name)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			_, err = pm.EnsureRunning(ctx, name)
+			cancel()
+		}
+
+		mu.Lock()
+		delete(inFlight, name)
+		if err != nil {
+			halted = true
+		}
+		mu.Unlock()
+
+		switch {
+		case err != nil && i == 0:
+			pm.log("error", fmt.Sprintf("Rolling restart of %s aborted, canary %s did not become healthy: %v", base, name, err), name)
+		case err != nil:
+			pm.log("error", fmt.Sprintf("Rolling restart of %s halted at %s: %v", base, name, err), name)
+		default:
+			pm.log("info", fmt.Sprintf("Replica %s healthy", name), name)
+		}
+		report(name, err)
+	}
+
+	for i, name := range names {
+		// The canary goes alone, the others as soon as the budget allows
+		limit := maxUnavailable
+		if i <= 1 {
+			limit = 1
+		}
+		for running >= limit {
+			<-done
+			running--
+		}
+
+		mu.Lock()
+		stop := halted
+		mu.Unlock()
+		if stop {
+			report(name, ErrRollingHalted)
+			continue
+		}
+
+		err := pm.awaitUnavailableBudget(names, name, maxUnavailable, inFlight, &mu, &halted, timeout)
+		mu.Lock()
+		stop = halted
+		if err == nil && !stop {
+			inFlight[name] = true
+		}
+		mu.Unlock()
+		if stop {
+			report(name, ErrRollingHalted)
+			continue
+		}
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Rolling restart of %s halted at %s: %v", base, name, err), name)
+			mu.Lock()
+			halted = true
+			mu.Unlock()
+			report(name, err)
+			continue
+		}
+
+		running++
+		go restart(i, name)
+	}
+	for ; running > 0; running-- {
+		<-done
+	}
+
+	if !halted {
+		pm.log("info", fmt.Sprintf("Rolling restart of %s completed", base), "")
+	}
+}
+
+// awaitUnavailableBudget waits up to timeout until next can be taken down
+// with at most maxUnavailable of names unavailable: being restarted (in
+// inFlight, guarded by mu) or not running and ready. next itself counts as
+// unavailable either way. It gives up early, returning nil, once *halted,
+// also guarded by mu, is set.
+func (pm *ProcessManager) awaitUnavailableBudget(names []string, next string, maxUnavailable int, inFlight map[string]bool, mu *sync.Mutex, halted *bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(ensurePollInterval)
+	defer ticker.Stop()
+
+	for {
+		mu.Lock()
+		if *halted {
+			mu.Unlock()
+			return nil
+		}
+		pm.mu.RLock()
+		unavailable := 1 // next
+		for _, name := range names {
+			if name == next {
+				continue
+			}
+			state := pm.processes[name]
+			if inFlight[name] || state == nil || state.Status != "running" || !pm.isReady(state) {
+				unavailable++
+			}
+		}
+		pm.mu.RUnlock()
+		mu.Unlock()
+
+		if unavailable <= maxUnavailable {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %d other replicas still not ready after %s, max_unavailable is %d", ErrTooManyUnavailable, unavailable-1, timeout, maxUnavailable)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replicaConfig is a config file with three replicas of web.
+func replicaConfig(maxUnavailable int) string {
+	return fmt.Sprintf(`
+processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+    replicas: 3
+    min_uptime: 1
+    max_unavailable: %d
+`, maxUnavailable)
+}
+
+// startReplicas starts the replicas of web and waits until they are ready.
+func startReplicas(t *testing.T, pm *ProcessManager) []string {
+	t.Helper()
+	names := pm.Replicas("web")
+	for _, name := range names {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "replicas ready", func() bool {
+		pm.mu.RLock()
+		defer pm.mu.RUnlock()
+		for _, name := range names {
+			if state := pm.processes[name]; state.Status != "running" || !pm.isReady(state) {
+				return false
+			}
+		}
+		return true
+	})
+	return names
+}
+
+func TestReplicaMaxUnavailable(t *testing.T) {
+	tests := []struct {
+		maxUnavailable int
+		want           int
+	}{
+		{0, 1},
+		{2, 2},
+		{5, 3},
+	}
+	for _, tt := range tests {
+		pm, _ := newTestManager(t, replicaConfig(tt.maxUnavailable))
+		if got := pm.ReplicaMaxUnavailable("web"); got != tt.want {
+			t.Errorf("max_unavailable %d: ReplicaMaxUnavailable() = %d, want %d", tt.maxUnavailable, got, tt.want)
+		}
+		if got := pm.ReplicaMaxUnavailable("missing"); got != 0 {
+			t.Errorf("ReplicaMaxUnavailable(missing) = %d, want 0", got)
+		}
+	}
+}
+
+func TestRollingRestartMaxUnavailable(t *testing.T) {
+	for _, maxUnavailable := range []int{1, 2} {
+		t.Run(fmt.Sprint(maxUnavailable), func(t *testing.T) {
+			pm, _ := newTestManager(t, replicaConfig(maxUnavailable))
+			names := startReplicas(t, pm)
+
+			// Sample how many replicas are down while the restart runs
+			var (
+				most int
+				wg   sync.WaitGroup
+			)
+			done := make(chan struct{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					case <-time.After(5 * time.Millisecond):
+					}
+					pm.mu.RLock()
+					down := 0
+					for _, name := range names {
+						if state := pm.processes[name]; state.Status != "running" || !pm.isReady(state) {
+							down++
+						}
+					}
+					pm.mu.RUnlock()
+					most = max(most, down)
+				}
+			}()
+
+			results, err := pm.RollingRestartReplicas("web", 5*time.Second)
+			close(done)
+			wg.Wait()
+			if err != nil {
+				t.Fatalf("RollingRestartReplicas() error = %v", err)
+			}
+
+			var restarted []string
+			for _, result := range results {
+				if result.Status != "ok" {
+					t.Errorf("%s: status = %s, error %q", result.Name, result.Status, result.Error)
+				}
+				restarted = append(restarted, result.Name)
+			}
+			slices.Sort(restarted)
+			if !slices.Equal(restarted, names) {
+				t.Errorf("restarted %v, want %v", restarted, names)
+			}
+			if most != maxUnavailable {
+				t.Errorf("at most %d replicas were down at once, want %d", most, maxUnavailable)
+			}
+		})
+	}
+}
+
+func TestRollingRestartHaltsAfterCanary(t *testing.T) {
+	for _, maxUnavailable := range []int{1, 2} {
+		t.Run(fmt.Sprint(maxUnavailable), func(t *testing.T) {
+			// The canary exits at once after the restart once broken exists
+			broken := filepath.Join(t.TempDir(), "broken")
+			pm, _ := newTestManager(t, fmt.Sprintf(`
+processes:
+  - name: web
+    command: /bin/sh
+    args: ["-c", "if [ -e $0 ] && [ ${INSTANCE} = 0 ]; then exit 1; fi; exec sleep 30", %q]
+    replicas: 3
+    min_uptime: 1
+    max_unavailable: %d
+`, broken, maxUnavailable))
+			names := startReplicas(t, pm)
+			if err := os.WriteFile(broken, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The others must not wait for the failed canary to be available
+			const timeout = 3 * time.Second
+			began := time.Now()
+			results, err := pm.RollingRestartReplicas("web", timeout)
+			if err != nil {
+				t.Fatalf("RollingRestartReplicas() error = %v", err)
+			}
+			if elapsed := time.Since(began); elapsed >= timeout {
+				t.Errorf("RollingRestartReplicas() took %s to halt after the canary failed", elapsed)
+			}
+			if len(results) != len(names) {
+				t.Fatalf("RollingRestartReplicas() returned %d results, want %d", len(results), len(names))
+			}
+			if results[0].Name != names[0] || results[0].Status != "failed" {
+				t.Errorf("canary result = %+v, want %s failed", results[0], names[0])
+			}
+			for _, result := range results[1:] {
+				if result.Status != "failed" || result.Error != ErrRollingHalted.Error() {
+					t.Errorf("%s: status = %s, error %q, want halted", result.Name, result.Status, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRollingRestartWithoutReplicas(t *testing.T) {
+	pm, _ := newTestManager(t, replicaConfig(1))
+	if _, err := pm.RollingRestartReplicas("missing", time.Second); !errors.Is(err, ErrNoReplicas) {
+		t.Errorf("RollingRestartReplicas(missing) error = %v, want %v", err, ErrNoReplicas)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// safeModeSetting persists safe mode across restarts.
+const safeModeSetting = "safe_mode"
+
+// WatchSafeMode loads the stored safe mode and follows changes to the
+// setting made through SetSafeMode.
+func (pm *ProcessManager) WatchSafeMode() {
+	if pm.storage == nil {
+		return
+	}
+
+	pm.storage.OnSettingChange(func(key, value string) {
+		if key == safeModeSetting {
+			pm.applySafeMode(value)
+		}
+	})
+
+	value, err := pm.storage.GetSetting(safeModeSetting)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to read %s: %v", safeModeSetting, err), "")
+		return
+	}
+	pm.applySafeMode(value)
+}
+
+func (pm *ProcessManager) applySafeMode(value string) {
+	enabled, _ := strconv.ParseBool(value)
+
+	changed := pm.safeMode.Swap(enabled) != enabled
+
+	switch {
+	case changed && enabled:
+		pm.log("warning", "Safe mode enabled, changes are rejected until it is disabled", "")
+	case changed:
+		pm.log("info", "Safe mode disabled", "")
+	}
+}
+
+// SafeMode reports whether safe mode is active. It is checked on every
+// request, so it does not wait for pm.mu.
+func (pm *ProcessManager) SafeMode() bool {
+	return pm.safeMode.Load()
+}
+
+// SetSafeMode turns safe mode on or off. It is persisted, and recorded as
+// changed by actor, when storage is available.
+func (pm *ProcessManager) SetSafeMode(enabled bool, actor string) error {
+	value := strconv.FormatBool(enabled)
+	if pm.storage == nil {
+		pm.applySafeMode(value)
+		return nil
+	}
+
+	old, err := pm.settingValues(safeModeSetting)
+	if err != nil {
+		return err
+	}
+	// The setting listener applies it
+	if err := pm.storage.SetSetting(safeModeSetting, value); err != nil {
+		return err
+	}
+	pm.recordSettingChanges(old, map[string]string{safeModeSetting: value}, actor)
+	return nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+const safeModeYAML = `
+processes:
+  - name: web
+    command: sleep
+    args: ["60"]
+`
+
+func TestSafeModePersisted(t *testing.T) {
+	pm, store := newTestManager(t, safeModeYAML)
+	pm.WatchSafeMode()
+
+	if pm.SafeMode() {
+		t.Fatal("SafeMode() = true before it was enabled")
+	}
+	if err := pm.SetSafeMode(true, "alice"); err != nil {
+		t.Fatalf("SetSafeMode() error = %v", err)
+	}
+	if !pm.SafeMode() {
+		t.Error("SafeMode() = false after SetSafeMode(true)")
+	}
+
+	value, err := store.GetSetting(safeModeSetting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "true" {
+		t.Errorf("stored %s = %q, want %q", safeModeSetting, value, "true")
+	}
+
+	// The settings API cannot change it
+	if err := pm.SetSettingValue(safeModeSetting, "false", "bob"); !errors.Is(err, ErrUnknownSetting) {
+		t.Errorf("SetSettingValue(%s) error = %v, want %v", safeModeSetting, err, ErrUnknownSetting)
+	}
+	if err := pm.SetSettingValues(map[string]string{safeModeSetting: "false"}, "bob"); !errors.Is(err, ErrInvalidSetting) {
+		t.Errorf("SetSettingValues(%s) error = %v, want %v", safeModeSetting, err, ErrInvalidSetting)
+	}
+	if !pm.SafeMode() {
+		t.Error("SafeMode() = false after the settings API tried to disable it")
+	}
+
+	// A change to the stored setting is followed
+	if err := store.SetSetting(safeModeSetting, "false"); err != nil {
+		t.Fatal(err)
+	}
+	if pm.SafeMode() {
+		t.Error("SafeMode() = true after the setting was set to false")
+	}
+}
+
+func TestSafeModeLoadedOnStart(t *testing.T) {
+	pm, store := newTestManager(t, safeModeYAML)
+	if err := store.SetSetting(safeModeSetting, "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	pm.WatchSafeMode()
+	if !pm.SafeMode() {
+		t.Error("SafeMode() = false, want the stored value true")
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"pupervisor/internal/config"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// secretRefPattern matches ${secret:key} references in config values.
+var secretRefPattern = regexp.MustCompile(`\$\{secret:([^}]+)\}`)
+
+// SecretProvider looks up secret values by key. Implementations back onto
+// Vault, a cloud secret manager or, by default, a local env file.
+type SecretProvider interface {
+	GetSecret(key string) (string, error)
+}
+
+// EnvFileSecretProvider reads secrets from a KEY=VALUE file. The file is
+// re-read on every lookup so rotated secrets are picked up on the next start.
+type EnvFileSecretProvider struct {
+	path string
+}
+
+func NewEnvFileSecretProvider(path string) *EnvFileSecretProvider {
+	return &EnvFileSecretProvider{path: path}
+}
+
+func (p *EnvFileSecretProvider) GetSecret(key string) (string, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(v), `"'`), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", ErrSecretNotFound
+}
+
+// SetSecretProvider replaces the provider used to resolve ${secret:key}
+// references when processes are spawned.
+func (pm *ProcessManager) SetSecretProvider(p SecretProvider) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.secrets = p
+}
+
+// resolveSecrets returns a copy of cfg with every ${secret:key} reference in
+// the command, args, directory and environment replaced by its value.
+// The stored config keeps the references so secrets never reach the API.
+// Providers may be slow, so callers must not hold pm.mu.
+func (pm *ProcessManager) resolveSecrets(cfg config.ProcessConfig) (config.ProcessConfig, error) {
+	pm.mu.RLock()
+	secrets := pm.secrets
+	pm.mu.RUnlock()
+
+	var resolveErr error
+	resolve := func(value string) string {
+		if resolveErr != nil || !strings.Contains(value, "${secret:") {
+			return value
+		}
+		return secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+			if resolveErr != nil {
+				return ref
+			}
+			key := secretRefPattern.FindStringSubmatch(ref)[1]
+			if secrets == nil {
+				resolveErr = fmt.Errorf("secret %q referenced but no secret provider configured", key)
+				return ref
+			}
+			secret, err := secrets.GetSecret(key)
+			if err != nil {
+				resolveErr = fmt.Errorf("failed to resolve secret %q: %w", key, err)
+				return ref
+			}
+			return secret
+		})
+	}
+
+	resolved := cfg
+	resolved.Command = resolve(cfg.Command)
+	resolved.Directory = resolve(cfg.Directory)
+
+	if len(cfg.Args) > 0 {
+		resolved.Args = make([]string, len(cfg.Args))
+		for i, arg := range cfg.Args {
+			resolved.Args[i] = resolve(arg)
+		}
+	}
+
+	if len(cfg.Environment) > 0 {
+		resolved.Environment = make(map[string]string, len(cfg.Environment))
+		for k, v := range cfg.Environment {
+			resolved.Environment[k] = resolve(v)
+		}
+	}
+
+	if resolveErr != nil {
+		return cfg, resolveErr
+	}
+	return resolved, nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+)
+
+// fakeSecrets serves secrets from a map and fails lookups of other keys.
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) GetSecret(key string) (string, error) {
+	if v, ok := f[key]; ok {
+		return v, nil
+	}
+	return "", errors.New("vault sealed")
+}
+
+func TestResolveSecrets(t *testing.T) {
+	pm := &ProcessManager{secrets: fakeSecrets{"token": "s3cret", "user": "svc"}}
+	cfg := config.ProcessConfig{
+		Name:        "app",
+		Command:     "/opt/${secret:user}/bin/app",
+		Args:        []string{"--token=${secret:token}", "--plain"},
+		Directory:   "/home/${secret:user}",
+		Environment: map[string]string{"TOKEN": "${secret:token}", "DSN": "pg://${secret:user}:${secret:token}@db"},
+	}
+
+	resolved, err := pm.resolveSecrets(cfg)
+	if err != nil {
+		t.Fatalf("resolveSecrets: %v", err)
+	}
+	if resolved.Command != "/opt/svc/bin/app" {
+		t.Errorf("Command = %q", resolved.Command)
+	}
+	if !slices.Equal(resolved.Args, []string{"--token=s3cret", "--plain"}) {
+		t.Errorf("Args = %q", resolved.Args)
+	}
+	if resolved.Directory != "/home/svc" {
+		t.Errorf("Directory = %q", resolved.Directory)
+	}
+	if resolved.Environment["TOKEN"] != "s3cret" || resolved.Environment["DSN"] != "pg://svc:s3cret@db" {
+		t.Errorf("Environment = %q", resolved.Environment)
+	}
+
+	// The config passed in keeps its references
+	if cfg.Args[0] != "--token=${secret:token}" || cfg.Environment["TOKEN"] != "${secret:token}" {
+		t.Errorf("input config modified: %q %q", cfg.Args, cfg.Environment)
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets SecretProvider
+		want    string
+	}{
+		{"provider error", fakeSecrets{}, `failed to resolve secret "token": vault sealed`},
+		{"no provider", nil, `secret "token" referenced but no secret provider configured`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &ProcessManager{secrets: tt.secrets}
+			cfg := config.ProcessConfig{Name: "app", Command: "app", Environment: map[string]string{"TOKEN": "${secret:token}"}}
+			if _, err := pm.resolveSecrets(cfg); err == nil || err.Error() != tt.want {
+				t.Errorf("resolveSecrets() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartFailsOnSecretError(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: app
+    command: /bin/sh
+    args: ["-c", "sleep 10"]
+    environment:
+      TOKEN: ${secret:missing}
+`)
+	pm.SetSecretProvider(fakeSecrets{})
+
+	err := pm.StartProcess("app")
+	if err == nil || !strings.Contains(err.Error(), "vault sealed") {
+		t.Fatalf("StartProcess() error = %v, want the provider's error", err)
+	}
+	if p, _ := pm.GetProcess("app"); p.Status == "running" {
+		t.Error("process started despite the unresolved secret")
+	}
+}
+
+func TestSecretsStayOutOfConfigCrashesAndAPI(t *testing.T) {
+	const secret = "s3cret-value"
+	pm, store := newTestManager(t, `
+processes:
+  - name: app
+    command: /bin/sh
+    args: ["-c", 'test "$TOKEN" = "$1" && test ${#1} -eq `+strconv.Itoa(len(secret))+` && exit 3; exit 4', "sh", "${secret:token}"]
+    environment:
+      TOKEN: ${secret:token}
+`)
+	pm.SetSecretProvider(fakeSecrets{"token": secret})
+
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+
+	var crashes []storage.CrashRecord
+	waitFor(t, "the crash record", func() bool {
+		crashes, _ = store.GetCrashesByProcess("app", 10)
+		return len(crashes) > 0
+	})
+
+	// Exit code 3 means the process saw the resolved secret
+	if crashes[0].ExitCode != 3 {
+		t.Fatalf("exit code = %d, want 3", crashes[0].ExitCode)
+	}
+
+	record, _ := json.Marshal(crashes[0])
+	if strings.Contains(string(record), secret) {
+		t.Errorf("crash record contains the secret: %s", record)
+	}
+	if !slices.Contains(crashes[0].CommandLine, "${secret:token}") {
+		t.Errorf("crash command line = %q, want the reference", crashes[0].CommandLine)
+	}
+
+	p, _ := pm.GetProcess("app")
+	model, _ := json.Marshal(p)
+	if strings.Contains(string(model), secret) {
+		t.Errorf("API model contains the secret: %s", model)
+	}
+
+	pm.mu.RLock()
+	cfg := pm.processes["app"].Config
+	pm.mu.RUnlock()
+	stored, _ := json.Marshal(cfg)
+	if strings.Contains(string(stored), secret) {
+		t.Errorf("stored config contains the secret: %s", stored)
+	}
+}
+
+// slowSecrets serves every secret once release is closed.
+type slowSecrets struct {
+	asked   chan struct{}
+	release chan struct{}
+}
+
+func (s slowSecrets) GetSecret(key string) (string, error) {
+	s.asked <- struct{}{}
+	<-s.release
+	return "30", nil
+}
+
+// TestSlowSecretProvider checks that the manager is not locked while a
+// process's secrets are resolved.
+func TestSlowSecretProvider(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["${secret:duration}"]
+`)
+	provider := slowSecrets{asked: make(chan struct{}), release: make(chan struct{})}
+	pm.SetSecretProvider(provider)
+
+	started := make(chan error)
+	go func() { started <- pm.StartProcess("app") }()
+	<-provider.asked
+
+	read := make(chan struct{})
+	go func() {
+		pm.GetProcesses()
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Error("GetProcesses() blocked while a secret was resolved")
+	}
+
+	close(provider.release)
+	if err := <-started; err != nil {
+		t.Fatalf("StartProcess() error = %v", err)
+	}
+	if p, _ := pm.GetProcess("app"); p.Status != "running" {
+		t.Errorf("status = %s, want running", p.Status)
+	}
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// Setting value types
+const (
+	SettingString   = "string"
+	SettingInt      = "int"
+	SettingBool     = "bool"
+	SettingDuration = "duration"
+)
+
+var (
+	// ErrUnknownSetting is returned for a settings key that is neither in
+	// the schema nor stored.
+	ErrUnknownSetting = errors.New("unknown setting")
+	// ErrInvalidSetting is returned for a value that does not parse as its
+	// setting's type or is outside its range or allowed values.
+	ErrInvalidSetting = errors.New("invalid setting")
+)
+
+// settingSpec describes the values a settings table key accepts.
+type settingSpec struct {
+	kind string
+	// min and max, when set, bound int values and duration values in seconds
+	min, max *int
+	// values, when set, are the only values allowed
+	values []string
+	// check, when set, validates values further
+	check func(value string) error
+}
+
+func bound(n int) *int { return &n }
+
+// settingSchema is the spec of each settings table key writable through
+// SetSettingValue. Values are stored as strings; TypedSettings coerces them
+// to the spec's type. safe_mode is left out, as only SetSafeMode changes it.
+var settingSchema = map[string]settingSpec{
+	deployVersionSetting:   {kind: SettingString},
+	webhookURLSetting:      {kind: SettingString},
+	archiveEnabledSetting:  {kind: SettingBool},
+	escalationRulesSetting: {kind: SettingString, check: checkEscalationRules},
+	"system_name":          {kind: SettingString},
+	"refresh_interval":     {kind: SettingDuration, min: bound(1), max: bound(3600)},
+	"log_retention":        {kind: SettingInt, min: bound(0), max: bound(36500)},
+	"log_buffer_size":      {kind: SettingInt, min: bound(1), max: bound(1000000)},
+	"email_notifications":  {kind: SettingBool},
+	"push_notifications":   {kind: SettingBool},
+	"critical_alerts":      {kind: SettingBool},
+	"process_events":       {kind: SettingBool},
+}
+
+// SettingErrors maps each rejected settings key to why it was rejected.
+type SettingErrors map[string]string
+
+func (e SettingErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("%s: %s", ErrInvalidSetting, strings.Join(keys, ", "))
+}
+
+func (e SettingErrors) Is(target error) bool {
+	return target == ErrInvalidSetting
+}
+
+// SetServerSettings adds the resolved server settings to those reported by
+// EffectiveSettings.
+func (pm *ProcessManager) SetServerSettings(settings []config.Setting) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.settings = append(settings, pm.settings...)
+}
+
+// EffectiveSettings returns every setting's resolved value and the layer it
+// came from: default, file, env or db. Server settings come from the
+// environment, supervisor settings from the config file and UI settings from
+// the settings table.
+func (pm *ProcessManager) EffectiveSettings() ([]config.Setting, error) {
+	pm.mu.RLock()
+	settings := make([]config.Setting, len(pm.settings))
+	copy(settings, pm.settings)
+	pm.mu.RUnlock()
+
+	if pm.storage == nil {
+		return settings, nil
+	}
+
+	stored, err := pm.storage.GetAllSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(stored))
+	for key := range stored {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		settings = append(settings, config.Setting{Key: key, Value: stored[key], Source: config.SourceDB})
+	}
+
+	return settings, nil
+}
+
+// TypedSettings returns the settings table with each value coerced to its
+// schema type: ints as numbers, bools as booleans and durations in Go
+// duration format. Unknown keys and values that do not parse as their type
+// are returned as strings.
+func (pm *ProcessManager) TypedSettings() (map[string]any, error) {
+	typed := make(map[string]any)
+	if pm.storage == nil {
+		return typed, nil
+	}
+
+	stored, err := pm.storage.GetAllSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range stored {
+		typed[key] = coerceSetting(settingSchema[key].kind, value)
+	}
+	return typed, nil
+}
+
+func coerceSetting(kind, value string) any {
+	switch kind {
+	case SettingInt:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case SettingBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case SettingDuration:
+		// A bare number is taken as seconds
+		if n, err := strconv.Atoi(value); err == nil {
+			return (time.Duration(n) * time.Second).String()
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return d.String()
+		}
+	}
+	return value
+}
+
+// Setting returns a settings table value and whether it is set. Keys in the
+// schema that are not set return "" and false; other keys that are not set
+// return ErrUnknownSetting.
+func (pm *ProcessManager) Setting(key string) (string, bool, error) {
+	if pm.storage == nil {
+		return "", false, errors.New("storage not available")
+	}
+
+	value, ok, err := pm.storage.LookupSetting(key)
+	if err != nil {
+		return "", false, err
+	}
+	if _, known := settingSchema[key]; !ok && !known {
+		return "", false, ErrUnknownSetting
+	}
+	return value, ok, nil
+}
+
+// SetSettingValue saves a single setting in the schema after checking that
+// value is valid for it, recording the change as made by actor. Keys outside
+// the schema return ErrUnknownSetting.
+func (pm *ProcessManager) SetSettingValue(key, value, actor string) error {
+	if pm.storage == nil {
+		return errors.New("storage not available")
+	}
+
+	spec, ok := settingSchema[key]
+	if !ok {
+		return ErrUnknownSetting
+	}
+	if err := spec.validate(value); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrInvalidSetting, key, err)
+	}
+
+	old, err := pm.settingValues(key)
+	if err != nil {
+		return err
+	}
+	if err := pm.storage.SetSetting(key, value); err != nil {
+		return err
+	}
+	pm.recordSettingChanges(old, map[string]string{key: value}, actor)
+	return nil
+}
+
+// SetSettingValues validates every setting before saving any, then saves
+// them all in one transaction, recording the changes as made by actor. If
+// some are unknown or invalid it saves nothing and returns SettingErrors
+// listing each of them.
+func (pm *ProcessManager) SetSettingValues(settings map[string]string, actor string) error {
+	if pm.storage == nil {
+		return errors.New("storage not available")
+	}
+
+	invalid := SettingErrors{}
+	for key, value := range settings {
+		spec, ok := settingSchema[key]
+		if !ok {
+			invalid[key] = ErrUnknownSetting.Error()
+			continue
+		}
+		if err := spec.validate(value); err != nil {
+			invalid[key] = err.Error()
+		}
+	}
+	if len(invalid) > 0 {
+		return invalid
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	old, err := pm.settingValues(keys...)
+	if err != nil {
+		return err
+	}
+	if err := pm.storage.SetSettings(settings); err != nil {
+		return err
+	}
+	pm.recordSettingChanges(old, settings, actor)
+	return nil
+}
+
+// validate reports whether value parses as the spec's type, the way
+// coerceSetting reads it, and is within its range and allowed values.
+func (spec settingSpec) validate(value string) error {
+	if len(spec.values) > 0 && !slices.Contains(spec.values, value) {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(spec.values, ", "))
+	}
+	if spec.check != nil {
+		if err := spec.check(value); err != nil {
+			return err
+		}
+	}
+
+	var n int
+	switch spec.kind {
+	case SettingInt:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		n = i
+	case SettingBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		return nil
+	case SettingDuration:
+		if i, err := strconv.Atoi(value); err == nil {
+			n = i
+			break
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number of seconds or a duration such as 30s", value)
+		}
+		n = int(d / time.Second)
+	default:
+		return nil
+	}
+
+	if spec.min != nil && n < *spec.min {
+		return fmt.Errorf("%s is below the minimum of %d", value, *spec.min)
+	}
+	if spec.max != nil && n > *spec.max {
+		return fmt.Errorf("%s is above the maximum of %d", value, *spec.max)
+	}
+	return nil
+}
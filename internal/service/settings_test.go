@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+
+	"pupervisor/internal/config"
+)
+
+func TestEffectiveSettings(t *testing.T) {
+	pm, store := newTestManager(t, `
+notifications:
+  cooldown: 60
+processes: []
+`)
+	pm.SetServerSettings([]config.Setting{{Key: "SERVER_ADDRESS", Value: ":8080", Source: config.SourceDefault}})
+	if err := store.SetSetting("system_name", "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := pm.EffectiveSettings()
+	if err != nil {
+		t.Fatalf("EffectiveSettings: %v", err)
+	}
+
+	// Server settings come first and settings table values last
+	if first := settings[0]; first.Key != "SERVER_ADDRESS" {
+		t.Errorf("first setting = %s, want SERVER_ADDRESS", first.Key)
+	}
+	want := config.Setting{Key: "system_name", Value: "prod", Source: config.SourceDB}
+	if last := settings[len(settings)-1]; !reflect.DeepEqual(last, want) {
+		t.Errorf("last setting = %+v, want %+v", last, want)
+	}
+	found := false
+	for _, s := range settings {
+		if s.Key == "notifications.cooldown" {
+			found = true
+			if s.Value != 60 || s.Source != config.SourceFile {
+				t.Errorf("notifications.cooldown = %v from %s, want 60 from file", s.Value, s.Source)
+			}
+		}
+	}
+	if !found {
+		t.Error("notifications.cooldown not reported")
+	}
+}
+
+func TestSetting(t *testing.T) {
+	pm, store := newTestManager(t, "processes: []\n")
+	if err := store.SetSetting("legacy_key", "kept"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key       string
+		wantValue string
+		wantSet   bool
+		wantErr   error
+	}{
+		{"system_name", "", false, nil},
+		{"legacy_key", "kept", true, nil},
+		{"no_such_key", "", false, ErrUnknownSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, set, err := pm.Setting(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Setting() error = %v, want %v", err, tt.wantErr)
+			}
+			if value != tt.wantValue || set != tt.wantSet {
+				t.Errorf("Setting() = %q, %v, want %q, %v", value, set, tt.wantValue, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestSetSettingValue(t *testing.T) {
+	pm, store := newTestManager(t, "processes: []\n")
+
+	tests := []struct {
+		key     string
+		value   string
+		wantErr error
+	}{
+		{"system_name", "prod", nil},
+		{"refresh_interval", "30s", nil},
+		{"refresh_interval", "15", nil},
+		{"refresh_interval", "soon", ErrInvalidSetting},
+		{"refresh_interval", "2h", ErrInvalidSetting},
+		{"log_retention", "-1", ErrInvalidSetting},
+		{"email_notifications", "maybe", ErrInvalidSetting},
+		{"legacy_key", "x", ErrUnknownSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			err := pm.SetSettingValue(tt.key, tt.value, "alice")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetSettingValue() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, _ := store.GetSetting(tt.key)
+			if tt.wantErr == nil && stored != tt.value {
+				t.Errorf("stored %s = %q, want %q", tt.key, stored, tt.value)
+			}
+			if tt.wantErr != nil && stored == tt.value {
+				t.Errorf("rejected value %q was stored", tt.value)
+			}
+		})
+	}
+}
+
+// TestSetSettingValuesAllOrNothing checks that a batch with any unknown or
+// invalid key saves nothing and reports every rejected key.
+func TestSetSettingValuesAllOrNothing(t *testing.T) {
+	pm, store := newTestManager(t, "processes: []\n")
+	if err := store.SetSetting("system_name", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := pm.SetSettingValues(map[string]string{
+		"system_name":         "new",
+		"refresh_interval":    "2h",
+		"log_retention":       "forever",
+		"email_notifications": "maybe",
+		"no_such_key":         "x",
+	}, "alice")
+	var invalid SettingErrors
+	if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidSetting) {
+		t.Fatalf("SetSettingValues() error = %v, want SettingErrors", err)
+	}
+	keys := slices.Sorted(maps.Keys(invalid))
+	if want := []string{"email_notifications", "log_retention", "no_such_key", "refresh_interval"}; !slices.Equal(keys, want) {
+		t.Errorf("rejected keys = %v, want %v", keys, want)
+	}
+
+	if value, _ := store.GetSetting("system_name"); value != "old" {
+		t.Errorf("system_name = %q after a rejected batch, want old", value)
+	}
+	if value, _ := store.GetSetting("refresh_interval"); value != "" {
+		t.Errorf("refresh_interval = %q after a rejected batch, want unset", value)
+	}
+
+	if err := pm.SetSettingValues(map[string]string{"system_name": "new", "log_retention": "7"}, "alice"); err != nil {
+		t.Fatalf("SetSettingValues() with valid settings: %v", err)
+	}
+	if value, _ := store.GetSetting("system_name"); value != "new" {
+		t.Errorf("system_name = %q, want new", value)
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShellProcess(t *testing.T) {
+	pm, _ := newTestManager(t, `
+environment:
+  MODE: production
+  GREETING: hi
+processes:
+  - name: greeter
+    command: echo "$0 $1 $GREETING $MODE"
+    args: ["world"]
+    shell: true
+    environment:
+      GREETING: hello
+`)
+	if err := pm.StartProcess("greeter"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "greeter to exit", func() bool {
+		p, _ := pm.GetProcess("greeter")
+		return p.Status != "running"
+	})
+
+	pm.mu.RLock()
+	ob := pm.processes["greeter"].outputBuffer
+	pm.mu.RUnlock()
+	want := []string{"greeter world hello production"}
+	waitFor(t, "the output to be read", func() bool {
+		return slices.Equal(ob.GetLastLines(10), want)
+	})
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"pupervisor/internal/config"
+)
+
+// ShutdownStep is one process in a ShutdownPlan, with why it is stopped at
+// that point.
+type ShutdownStep struct {
+	Position    int      `json:"position"`
+	Name        string   `json:"name"`
+	Status      string   `json:"status"`
+	Priority    int      `json:"priority"`
+	StopSignal  string   `json:"stop_signal"`
+	StopTimeout int      `json:"stop_timeout"`
+	DependsOn   []string `json:"depends_on"`
+	// Dependents are the planned processes depending on this one
+	Dependents []string `json:"dependents"`
+	Reason     string   `json:"reason"`
+}
+
+// ShutdownPlan is the order StopAll stops processes in. Warnings point out
+// dependency cycles and stop_order entries that stop a process before one of
+// its dependents.
+type ShutdownPlan struct {
+	Steps    []ShutdownStep `json:"steps"`
+	Warnings []string       `json:"warnings"`
+}
+
+// ShutdownPlan returns the order a graceful shutdown would stop the running
+// processes in, or every process if all is set, without stopping anything.
+func (pm *ProcessManager) ShutdownPlan(all bool) ShutdownPlan {
+	pm.mu.RLock()
+	configs := make(map[string]config.ProcessConfig, len(pm.processes))
+	statuses := make(map[string]string, len(pm.processes))
+	var names []string
+	for name, state := range pm.processes {
+		configs[name] = state.Config
+		statuses[name] = state.Status
+		if all || state.Status == "running" {
+			names = append(names, name)
+		}
+	}
+	first := slices.Clone(pm.stopOrder)
+	pm.mu.RUnlock()
+
+	plan := ShutdownPlan{Steps: []ShutdownStep{}, Warnings: []string{}}
+
+	start, cycleErr := startOrder(configs, names)
+	if cycleErr != nil {
+		plan.Warnings = append(plan.Warnings, cycleErr.Error()+"; they stop in reverse priority order")
+	}
+	order := stopOrder(start, first)
+
+	planned := make(map[string]bool, len(order))
+	for _, name := range order {
+		planned[name] = true
+	}
+	dependents := make(map[string][]string)
+	for _, name := range order {
+		for _, dep := range configs[name].DependsOn {
+			if planned[dep] && dep != name {
+				dependents[dep] = append(dependents[dep], name)
+			}
+		}
+	}
+
+	position := make(map[string]int, len(order))
+	for i, name := range order {
+		position[name] = i + 1
+	}
+
+	for i, name := range order {
+		cfg := configs[name]
+		step := ShutdownStep{
+			Position:    i + 1,
+			Name:        name,
+			Status:      statuses[name],
+			Priority:    cfg.Priority,
+			StopSignal:  cfg.StopSignal,
+			StopTimeout: cfg.StopTimeout,
+			DependsOn:   []string{},
+			Dependents:  []string{},
+		}
+		for _, dep := range cfg.DependsOn {
+			if planned[dep] && dep != name {
+				step.DependsOn = append(step.DependsOn, dep)
+			}
+		}
+		slices.Sort(dependents[name])
+		step.Dependents = append(step.Dependents, dependents[name]...)
+
+		var reasons []string
+		if rank := slices.Index(first, name); rank >= 0 {
+			reasons = append(reasons, fmt.Sprintf("listed at position %d of stop_order", rank+1))
+		}
+		var after, before []string
+		for _, dependent := range step.Dependents {
+			if position[dependent] < step.Position {
+				after = append(after, dependent)
+			} else {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("stop_order stops %s before its dependent %s", name, dependent))
+			}
+		}
+		for _, dep := range step.DependsOn {
+			if position[dep] > step.Position {
+				before = append(before, dep)
+			}
+		}
+		if len(after) > 0 {
+			reasons = append(reasons, "after its dependents "+strings.Join(after, ", "))
+		}
+		if len(before) > 0 {
+			reasons = append(reasons, "before its dependencies "+strings.Join(before, ", "))
+		}
+		reasons = append(reasons, fmt.Sprintf("priority %d", cfg.Priority))
+		step.Reason = strings.Join(reasons, "; ")
+
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan
+}
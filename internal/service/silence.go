@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// SilenceProcess suppresses the notifications of a process for d, replacing
+// any earlier silence, and returns when they resume. Crashes and state
+// changes are still recorded and logged; only alerts are held back.
+func (pm *ProcessManager) SilenceProcess(name string, d time.Duration) (time.Time, error) {
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.Unlock()
+		return time.Time{}, ErrProcessNotFound
+	}
+	until := pm.now().Add(d)
+	state.silencedUntil = until
+	pm.notifier.Silence(name, until)
+	pm.mu.Unlock()
+
+	pm.log("info", fmt.Sprintf("Notifications for %s silenced for %s, until %s", name, formatDuration(d), until.Format(time.RFC3339)), name)
+	return until, nil
+}
+
+// UnsilenceProcess ends the silence of a process early, if it has one.
+func (pm *ProcessManager) UnsilenceProcess(name string) error {
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.Unlock()
+		return ErrProcessNotFound
+	}
+	wasSilenced := pm.now().Before(state.silencedUntil)
+	state.silencedUntil = time.Time{}
+	pm.notifier.Unsilence(name)
+	pm.mu.Unlock()
+
+	if wasSilenced {
+		pm.log("info", fmt.Sprintf("Notifications for %s resumed", name), name)
+	}
+	return nil
+}
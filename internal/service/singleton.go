@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSingletonRunning is returned when starting a singleton process whose
+// lock is held by an instance that is still running.
+var ErrSingletonRunning = errors.New("another instance of the process is running")
+
+var errLockHeld = errors.New("lock is held")
+
+// adoptedPollInterval is how often an adopted instance is checked for
+// having exited.
+const adoptedPollInterval = time.Second
+
+func (pm *ProcessManager) singletonLockPath(name string) string {
+	return filepath.Join(pm.lockDir, name+".lock")
+}
+
+// lockSingleton takes the singleton lock of a process about to be started.
+// If an instance holds it, it returns errLockHeld with that instance's PID,
+// 0 if it is not known.
+func (pm *ProcessManager) lockSingleton(name string) (*os.File, int, error) {
+	if err := os.MkdirAll(pm.lockDir, 0o755); err != nil {
+		return nil, 0, err
+	}
+
+	path := pm.singletonLockPath(name)
+	lock, err := lockFile(path)
+	if errors.Is(err, errLockHeld) {
+		data, _ := os.ReadFile(path)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		return nil, pid, err
+	}
+	return lock, 0, err
+}
+
+// writeLockPid records the PID of the instance holding a singleton lock, so
+// a later supervisor can adopt it.
+func writeLockPid(lock *os.File, pid int) error {
+	if err := lock.Truncate(0); err != nil {
+		return err
+	}
+	_, err := lock.WriteAt([]byte(strconv.Itoa(pid)+"\n"), 0)
+	return err
+}
+
+// adopt supervises an instance of the process that holds its singleton lock
+// but was not started by this supervisor. Its output cannot be captured and
+// its exit code is not known; it counts as exited once the lock is free.
+// Callers must hold pm.mu.
+func (pm *ProcessManager) adopt(name string, state *ProcessState, pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	cmd := &exec.Cmd{Process: process}
+	// There is no context to cancel, stopProcess signals the instance
+	state.cancel = func() {}
+	state.Cmd = cmd
+	state.exited = make(chan struct{})
+	state.stdin = nil
+	pm.setStatus(name, state, "running", "adopted")
+	state.NextRestartAt = time.Time{}
+	state.Pid = pid
+	state.StartTime = pm.now()
+	state.ExitCode = 0
+	state.LastHeartbeat = time.Time{}
+	state.healthFailures = 0
+	state.lastHealthCheck = time.Now()
+	if state.Config.HealthCheck != nil {
+		state.Health = HealthUnknown
+	}
+	state.draining = false
+	pm.updateReadiness(name, state)
+	pm.newOutputBuffer(state)
+	state.startPending = false
+
+	pm.log("info", fmt.Sprintf("Adopted running instance of %s with PID %d", name, pid), name)
+
+	go pm.monitorAdopted(name, state, cmd, state.exited)
+	return nil
+}
+
+// monitorAdopted waits for an adopted instance to release its singleton
+// lock and then handles its exit like monitorProcess does.
+func (pm *ProcessManager) monitorAdopted(name string, state *ProcessState, cmd *exec.Cmd, exited chan struct{}) {
+	path := pm.singletonLockPath(name)
+	for {
+		time.Sleep(adoptedPollInterval)
+		lock, err := lockFile(path)
+		if errors.Is(err, errLockHeld) {
+			continue
+		}
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to check adopted instance of %s: %v", name, err), name)
+			continue
+		}
+		lock.Close()
+		break
+	}
+	close(exited)
+
+	pm.mu.Lock()
+	if state.Cmd != cmd {
+		pm.mu.Unlock()
+		return
+	}
+
+	reason := "adopted instance exited"
+	if state.cancel == nil {
+		reason = "stopped"
+	}
+	pm.setStatus(name, state, "stopped", reason)
+	state.Pid = 0
+	pm.log("warning", fmt.Sprintf("Adopted instance of %s exited, its exit code is not known", name), name)
+
+	autoRestart := state.Config.AutoRestart && state.cancel != nil && !state.held
+	pm.mu.Unlock()
+
+	if autoRestart {
+		pm.autoRestart(name, state)
+	}
+}
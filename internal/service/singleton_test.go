@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// singletonYAML configures a singleton process with the given mode and lock
+// directory, so several managers can stand in for supervisor restarts.
+func singletonYAML(lockDir, mode string) string {
+	return `
+lockdir: ` + lockDir + `
+processes:
+  - name: job
+    command: sleep
+    args: ["30"]
+    singleton: ` + mode + "\n"
+}
+
+func TestSingleton(t *testing.T) {
+	lockDir := t.TempDir()
+
+	first, _ := newTestManager(t, singletonYAML(lockDir, "refuse"))
+	if err := first.StartProcess("job"); err != nil {
+		t.Fatalf("StartProcess() error = %v", err)
+	}
+	running, _ := first.GetProcess("job")
+
+	// The lock stays with the process, not the supervisor that started it
+	if _, err := lockFile(first.singletonLockPath("job")); !errors.Is(err, errLockHeld) {
+		t.Fatalf("lockFile() error = %v, want %v", err, errLockHeld)
+	}
+
+	refusing, _ := newTestManager(t, singletonYAML(lockDir, "refuse"))
+	if err := refusing.StartProcess("job"); !errors.Is(err, ErrSingletonRunning) {
+		t.Errorf("StartProcess() with refuse error = %v, want %v", err, ErrSingletonRunning)
+	}
+
+	adopting, _ := newTestManager(t, singletonYAML(lockDir, "adopt"))
+	if err := adopting.StartProcess("job"); err != nil {
+		t.Fatalf("StartProcess() with adopt error = %v", err)
+	}
+	if p, _ := adopting.GetProcess("job"); p.Status != "running" || p.Pid != running.Pid {
+		t.Errorf("adopted process = %s with PID %d, want running with PID %d", p.Status, p.Pid, running.Pid)
+	}
+
+	// The adopted instance counts as exited once it releases the lock
+	if err := first.StopProcess("job"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the adopted instance to be stopped", func() bool {
+		p, _ := adopting.GetProcess("job")
+		return p.Status == "stopped"
+	})
+
+	if err := refusing.StartProcess("job"); err != nil {
+		t.Errorf("StartProcess() after the lock was released error = %v", err)
+	}
+}
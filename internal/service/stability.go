@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"pupervisor/internal/models"
+	"pupervisor/internal/notifier"
+)
+
+// ErrUnstableStart is returned to a caller waiting for a process to become
+// stable when it exits before its min_uptime.
+var ErrUnstableStart = errors.New("process exited before min_uptime")
+
+// watchMinUptime sends a started_successfully event once cmd has been
+// running for the process's min_uptime, unless it exits or is replaced by
+// another start first.
+func (pm *ProcessManager) watchMinUptime(name string, state *ProcessState, cmd *exec.Cmd, exited chan struct{}, minUptime time.Duration) {
+	timer := time.NewTimer(minUptime)
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+		return
+	case <-timer.C:
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if state.Cmd != cmd || state.Status != "running" {
+		return
+	}
+	pm.recordStartIfReady(state)
+
+	message := fmt.Sprintf("Process %s started successfully, up for %s", name, formatDuration(minUptime))
+	pm.log("info", message, name)
+	pm.notifier.Notify(notifier.Event{
+		Type:     "started_successfully",
+		Process:  name,
+		Message:  message,
+		Time:     time.Now(),
+		Channels: state.Config.Notify,
+	})
+}
+
+// StartProcessStable starts a process and waits until it has been running
+// for its min_uptime. A process exiting before then returns ErrUnstableStart
+// with its exit code. Processes without min_uptime return once started.
+func (pm *ProcessManager) StartProcessStable(ctx context.Context, name string) error {
+	if err := pm.StartProcessContext(ctx, name); err != nil {
+		return err
+	}
+
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	if !ok {
+		pm.mu.RUnlock()
+		return ErrProcessNotFound
+	}
+	cmd := state.Cmd
+	exited := state.exited
+	startTime := state.StartTime
+	minUptime := time.Duration(state.Config.MinUptime) * time.Second
+	pm.mu.RUnlock()
+
+	if minUptime <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(minUptime)
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+		// cmd.Wait has returned, so ProcessState is set
+		return fmt.Errorf("%w: exit code %d after %s", ErrUnstableStart, cmd.ProcessState.ExitCode(),
+			formatDuration(time.Since(startTime)))
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ErrNotReady is returned by EnsureRunning when the process is still not
+// ready at the deadline.
+var ErrNotReady = errors.New("process not ready before timeout")
+
+// ensurePollInterval is how often EnsureRunning checks a starting process.
+const ensurePollInterval = 100 * time.Millisecond
+
+// EnsureRunning starts the process unless it is running and waits until it
+// is ready: up for its min_uptime and, with a health check, healthy. A ready
+// process returns at once. It returns the process's final state, with
+// ErrUnstableStart if it exited while waiting or ErrNotReady if ctx ends first.
+func (pm *ProcessManager) EnsureRunning(ctx context.Context, name string) (models.Process, error) {
+	err := pm.StartProcessContext(ctx, name)
+	if err != nil && !errors.Is(err, ErrProcessAlreadyRunning) {
+		process, _ := pm.GetProcess(name)
+		return process, err
+	}
+
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var cmd *exec.Cmd
+	if ok {
+		cmd = state.Cmd
+	}
+	pm.mu.RUnlock()
+	if !ok {
+		return models.Process{}, ErrProcessNotFound
+	}
+
+	ticker := time.NewTicker(ensurePollInterval)
+	defer ticker.Stop()
+
+	for {
+		pm.mu.RLock()
+		process := toModel(name, state)
+		running := state.Cmd == cmd && state.Status == "running"
+		ready := running && pm.isReady(state)
+		exitCode := state.ExitCode
+		pm.mu.RUnlock()
+
+		switch {
+		case ready:
+			return process, nil
+		case !running:
+			return process, fmt.Errorf("%w: exit code %d", ErrUnstableStart, exitCode)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return process, ErrNotReady
+		}
+	}
+}
+
+// isReady reports whether a running process has been up for its min_uptime
+// and passed its health check, if it has one. Callers must hold pm.mu.
+func (pm *ProcessManager) isReady(state *ProcessState) bool {
+	minUptime := time.Duration(state.Config.MinUptime) * time.Second
+	if time.Since(state.StartTime) < minUptime {
+		return false
+	}
+	return state.Config.HealthCheck == nil || state.Health == HealthHealthy
+}
+
+// recordStartIfReady records the start duration of a running process the
+// first time it is ready. It is called wherever readiness may change: at
+// spawn, when min_uptime passes and when a health check passes. Callers must
+// hold pm.mu.
+func (pm *ProcessManager) recordStartIfReady(state *ProcessState) {
+	if state.startTimed || state.Status != "running" || !pm.isReady(state) {
+		return
+	}
+	state.startTimed = true
+	state.startTimes.observe(pm.now().Sub(state.spawnedAt))
+}
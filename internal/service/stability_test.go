@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartProcessStable(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: stable
+    command: sleep
+    args: ["30"]
+    min_uptime: 1
+  - name: flaky
+    command: /bin/sh
+    args: ["-c", "sleep 0.2; exit 3"]
+    min_uptime: 5
+  - name: plain
+    command: sleep
+    args: ["30"]
+`)
+	notifications := captureNotifications(pm)
+
+	start := time.Now()
+	if err := pm.StartProcessStable(context.Background(), "stable"); err != nil {
+		t.Fatalf("StartProcessStable(stable): %v", err)
+	}
+	if took := time.Since(start); took < time.Second {
+		t.Errorf("StartProcessStable(stable) returned after %s, before min_uptime", took)
+	}
+	event := notifications.next(t)
+	if event.Type != "started_successfully" || event.Process != "stable" {
+		t.Errorf("notification = %s for %s, want started_successfully for stable", event.Type, event.Process)
+	}
+
+	err := pm.StartProcessStable(context.Background(), "flaky")
+	if !errors.Is(err, ErrUnstableStart) || !strings.Contains(err.Error(), "exit code 3") {
+		t.Errorf("StartProcessStable(flaky) error = %v, want %v with exit code 3", err, ErrUnstableStart)
+	}
+
+	start = time.Now()
+	if err := pm.StartProcessStable(context.Background(), "plain"); err != nil {
+		t.Fatalf("StartProcessStable(plain): %v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("StartProcessStable(plain) took %s without min_uptime", took)
+	}
+}
+
+func TestStartProcessStableCancelled(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: slow
+    command: sleep
+    args: ["30"]
+    min_uptime: 60
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := pm.StartProcessStable(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("StartProcessStable() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if p, _ := pm.GetProcess("slow"); p.Status != "running" {
+		t.Errorf("status = %s after the caller gave up, want running", p.Status)
+	}
+}
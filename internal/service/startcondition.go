@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// Start condition states reported in a process's start_condition
+const (
+	StartConditionUnknown = "unknown"
+	StartConditionMet     = "met"
+	StartConditionUnmet   = "unmet"
+)
+
+// ErrStartDeferred is returned when a start waits for the process's start
+// condition to hold.
+var ErrStartDeferred = errors.New("start deferred until the start condition holds")
+
+// defaultStartConditionSeconds is the timeout and check interval of start
+// conditions of processes that were not loaded from a config file.
+const defaultStartConditionSeconds = 10
+
+// checkStartCondition runs the process's StartCondition command, records the
+// result and reports whether it exited zero. Changes of the result are
+// logged.
+func (pm *ProcessManager) checkStartCondition(name string, state *ProcessState, cfg config.ProcessConfig) bool {
+	timeout := time.Duration(cfg.StartConditionTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultStartConditionSeconds * time.Second
+	}
+	err := runCheckCommand(cfg.StartCondition, cfg.Directory, nil, timeout)
+	met := err == nil
+
+	pm.mu.Lock()
+	changed := state.conditionCheckedAt.IsZero() || state.conditionMet != met
+	state.conditionMet = met
+	state.conditionCheckedAt = time.Now()
+	pm.mu.Unlock()
+
+	switch {
+	case !changed:
+	case met:
+		pm.log("info", fmt.Sprintf("Start condition for %s holds", name), name)
+	default:
+		pm.log("info", fmt.Sprintf("Start condition for %s does not hold (%v), start deferred", name, err), name)
+	}
+	return met
+}
+
+// deferStart marks the process as waiting for its start condition and,
+// unless one is already waiting, starts a goroutine that checks the
+// condition every StartConditionInterval and starts the process once it
+// holds. Stopping or holding the process cancels the wait.
+func (pm *ProcessManager) deferStart(name string, state *ProcessState) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if state.startPending {
+		return
+	}
+	state.startPending = true
+	// A waiter of an earlier, cancelled deferral may still be asleep
+	state.startWaiter++
+	go pm.awaitStartCondition(name, state, state.startWaiter)
+}
+
+func (pm *ProcessManager) awaitStartCondition(name string, state *ProcessState, waiter int) {
+	for {
+		pm.mu.RLock()
+		interval := time.Duration(state.Config.StartConditionInterval) * time.Second
+		pm.mu.RUnlock()
+		if interval <= 0 {
+			interval = defaultStartConditionSeconds * time.Second
+		}
+		time.Sleep(interval)
+
+		pm.mu.RLock()
+		pending := state.startPending && state.startWaiter == waiter && state.Status != "running" && pm.processes[name] == state
+		cfg := state.Config
+		pm.mu.RUnlock()
+
+		if !pending {
+			return
+		}
+		if cfg.StartCondition != "" && !pm.checkStartCondition(name, state, cfg) {
+			continue
+		}
+
+		pm.log("info", fmt.Sprintf("Starting deferred process %s", name), name)
+		err := pm.runPreStartCheck(name, state, cfg)
+		if err == nil {
+			err = pm.spawn(name)
+		}
+		if err != nil && !errors.Is(err, ErrProcessAlreadyRunning) {
+			pm.log("error", fmt.Sprintf("Failed to start deferred process %s: %v", name, err), name)
+			pm.mu.Lock()
+			state.startPending = false
+			pm.mu.Unlock()
+		}
+		return
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// stopCheckInterval is how often a stopped process's service is probed
+// until it is down.
+const stopCheckInterval = 500 * time.Millisecond
+
+// verifyStopped probes the service of a process that has just exited until
+// it stops answering. If it still answers after the stop check's timeout,
+// something else, most likely a child the process detached, keeps serving
+// and a warning is logged.
+func (pm *ProcessManager) verifyStopped(name string, sc config.StopCheckConfig) {
+	deadline := time.Now().Add(time.Duration(sc.Timeout) * time.Second)
+	for {
+		if !serviceUp(sc) {
+			pm.log("info", fmt.Sprintf("Confirmed that process %s is down", name), name)
+			return
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(stopCheckInterval)
+	}
+
+	target := sc.TCP
+	if sc.HTTP != "" {
+		target = sc.HTTP
+	}
+	pm.log("warning", fmt.Sprintf("Process %s exited but %s still answers after %ds, an orphaned child may still be running",
+		name, target, sc.Timeout), name)
+}
+
+// serviceUp reports whether the stop check's target still answers. An HTTP
+// response of any status counts, since something is still serving.
+func serviceUp(sc config.StopCheckConfig) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), stopCheckInterval)
+	defer cancel()
+
+	if sc.HTTP != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sc.HTTP, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", sc.TCP)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/config"
+)
+
+// closedAddr returns the address of a TCP port nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestServiceUp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Any status means something still serves
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		sc   config.StopCheckConfig
+		want bool
+	}{
+		{"tcp listening", config.StopCheckConfig{TCP: ln.Addr().String()}, true},
+		{"tcp closed", config.StopCheckConfig{TCP: closedAddr(t)}, false},
+		{"http answering", config.StopCheckConfig{HTTP: srv.URL}, true},
+		{"http closed", config.StopCheckConfig{HTTP: "http://" + closedAddr(t)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceUp(tt.sc); got != tt.want {
+				t.Errorf("serviceUp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// hasLog reports whether a log entry of level for the process contains text.
+func hasLog(pm *ProcessManager, name, level, text string) bool {
+	for _, entry := range pm.GetLogsByProcess(name, 100) {
+		if entry.Level == level && strings.Contains(entry.Message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerifyStoppedWarnsWhileUp(t *testing.T) {
+	pm, _ := newTestManager(t, "processes: []\n")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	pm.verifyStopped("web", config.StopCheckConfig{TCP: ln.Addr().String(), Timeout: 1})
+	if !hasLog(pm, "web", "warning", "still answers after 1s") {
+		t.Error("no warning logged for a service that is still up")
+	}
+}
+
+func TestStopCheckAfterStop(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+    stopcheck:
+      tcp: `+closedAddr(t)+`
+`)
+	if err := pm.StartProcess("web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.StopProcess("web"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the stop check to confirm web is down", func() bool {
+		return hasLog(pm, "web", "info", "Confirmed that process web is down")
+	})
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+
+	"pupervisor/internal/config"
+)
+
+// newCommand builds the command for a process. There is no umask on this
+// platform, so a configured one is ignored.
+func newCommand(ctx context.Context, cfg config.ProcessConfig) *exec.Cmd {
+	command, args := cfg.Executable()
+	return exec.CommandContext(ctx, command, args...)
+}
+
+func setUser(cmd *exec.Cmd, name string) error {
+	return errors.New("running processes as another user is not supported on this platform")
+}
+
+func signalByName(name string) (os.Signal, error) {
+	return nil, errors.New("sending signals is not supported on this platform")
+}
+
+func lockFile(path string) (*os.File, error) {
+	return nil, errors.New("singleton processes are not supported on this platform")
+}
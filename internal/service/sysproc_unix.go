@@ -0,0 +1,93 @@
+//go:build unix
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"pupervisor/internal/config"
+)
+
+// newCommand builds the command for a process. Go cannot run code in the
+// child between fork and exec, so a umask is applied by a shell that sets it
+// and then execs the real command in its place. The umask is passed as an
+// argument rather than part of the script, so it is never run as shell code.
+func newCommand(ctx context.Context, cfg config.ProcessConfig) *exec.Cmd {
+	command, commandArgs := cfg.Executable()
+	if cfg.Umask == "" {
+		return exec.CommandContext(ctx, command, commandArgs...)
+	}
+
+	args := append([]string{"-c", `umask "$1" && shift && exec "$@"`, "sh", cfg.Umask, command}, commandArgs...)
+	return exec.CommandContext(ctx, "/bin/sh", args...)
+}
+
+// setUser makes the command run as the given user name or numeric uid.
+func setUser(cmd *exec.Cmd, name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		u, err = user.LookupId(name)
+		if err != nil {
+			return fmt.Errorf("unknown user %q", name)
+		}
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// signalByName returns the signal with the given name, e.g. SIGHUP.
+func signalByName(name string) (os.Signal, error) {
+	sig, ok := signals[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal %s", name)
+	}
+	return sig, nil
+}
+
+// lockFile opens path and takes an exclusive flock on it, returning
+// errLockHeld if another open file holds it. The lock lasts until every
+// descriptor of the returned file, including those inherited by child
+// processes, is closed.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLockHeld
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"pupervisor/internal/config"
+)
+
+// stateColors are the fill colors of process states in TopologyDOT.
+var stateColors = map[string]string{
+	"running":   "palegreen",
+	"stopped":   "lightgray",
+	"failed":    "lightcoral",
+	"completed": "lightblue",
+}
+
+// TopologyDOT renders the dependency graph in Graphviz DOT format, for
+// example for `dot -Tpng`. Each process is a node filled with the color of
+// its current state and each depends_on entry an edge from the process to
+// its dependency. Cycles are drawn like any other edges; dependencies on
+// processes that do not exist are dashed nodes.
+func (pm *ProcessManager) TopologyDOT() string {
+	pm.mu.RLock()
+	configs := make(map[string]config.ProcessConfig, len(pm.processes))
+	names := make([]string, 0, len(pm.processes))
+	statuses := make(map[string]string, len(pm.processes))
+	held := make(map[string]bool)
+	for name, state := range pm.processes {
+		configs[name] = state.Config
+		names = append(names, name)
+		statuses[name] = state.Status
+		held[name] = state.held
+	}
+	pm.mu.RUnlock()
+
+	order, cycleErr := startOrder(configs, names)
+
+	var b strings.Builder
+	b.WriteString("digraph pupervisor {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=filled, fontname=\"Helvetica\"];\n")
+	if cycleErr != nil {
+		fmt.Fprintf(&b, "  // %s\n", cycleErr)
+	}
+
+	for _, name := range order {
+		label := name
+		if display := configs[name].DisplayName; display != "" {
+			label = display
+		}
+		label += "\n" + statuses[name]
+		style := "filled"
+		if held[name] {
+			label += " (held)"
+			style = "filled,dashed"
+		}
+		color, ok := stateColors[statuses[name]]
+		if !ok {
+			color = "white"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, style=%q, fillcolor=%q];\n", dotID(name), dotID(label), style, color)
+	}
+
+	missing := make(map[string]bool)
+	for _, name := range order {
+		for _, dep := range configs[name].DependsOn {
+			if _, ok := configs[dep]; !ok && !missing[dep] {
+				missing[dep] = true
+				fmt.Fprintf(&b, "  %s [label=%s, style=\"dashed\"];\n", dotID(dep), dotID(dep+"\nmissing"))
+			}
+			fmt.Fprintf(&b, "  %s -> %s;\n", dotID(name), dotID(dep))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotID quotes s as a DOT identifier. Newlines become DOT line breaks.
+func dotID(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDotID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"web", `"web"`},
+		{"web\nrunning", `"web\nrunning"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\app`, `"C:\\app"`},
+	}
+	for _, tt := range tests {
+		if got := dotID(tt.in); got != tt.want {
+			t.Errorf("dotID(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTopologyDOT(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: db
+    command: sleep
+    args: ["30"]
+  - name: web
+    display_name: Web Frontend
+    command: sleep
+    args: ["30"]
+    depends_on: [db]
+`)
+	if err := pm.StartProcess("db"); err != nil {
+		t.Fatal(err)
+	}
+	// A dependency removed from the config is drawn as missing
+	pm.mu.Lock()
+	pm.processes["web"].Config.DependsOn = append(pm.processes["web"].Config.DependsOn, "cache")
+	pm.mu.Unlock()
+
+	dot := pm.TopologyDOT()
+
+	for _, want := range []string{
+		"digraph pupervisor {\n",
+		`  "db" [label="db\nrunning", style="filled", fillcolor="palegreen"];`,
+		`  "web" [label="Web Frontend\nstopped", style="filled", fillcolor="lightgray"];`,
+		`  "web" -> "db";`,
+		`  "cache" [label="cache\nmissing", style="dashed"];`,
+		`  "web" -> "cache";`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("TopologyDOT() does not contain %q:\n%s", want, dot)
+		}
+	}
+
+	// Dependencies come before the processes depending on them
+	if strings.Index(dot, `  "db" [`) > strings.Index(dot, `  "web" [`) {
+		t.Errorf("db is not listed before web:\n%s", dot)
+	}
+}
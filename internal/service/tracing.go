@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of process operations. It uses the global tracer
+// provider, so spans are only recorded once tracing.Setup has installed one.
+var tracer = otel.Tracer("pupervisor/internal/service")
+
+// startSpan starts a "process.<op>" span for an operation on a process,
+// as a child of any span in ctx.
+func startSpan(ctx context.Context, op, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "process."+op, trace.WithAttributes(attribute.String("process.name", name)))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spansOnce sync.Once
+	spans     *tracetest.SpanRecorder
+)
+
+// recordSpans installs a global tracer provider recording every span. The
+// global tracer binds to the first provider installed, so it is shared by
+// all tests; filter the spans by process name.
+func recordSpans() *tracetest.SpanRecorder {
+	spansOnce.Do(func() {
+		spans = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	})
+	return spans
+}
+
+// processSpans returns the ended spans of operations on name by span name.
+func processSpans(rec *tracetest.SpanRecorder, name string) map[string]sdktrace.ReadOnlySpan {
+	found := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range rec.Ended() {
+		for _, attr := range span.Attributes() {
+			if attr.Key == "process.name" && attr.Value.AsString() == name {
+				found[span.Name()] = span
+			}
+		}
+	}
+	return found
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestRestartSpans(t *testing.T) {
+	rec := recordSpans()
+	pm, _ := newTestManager(t, `
+processes:
+  - name: traced
+    command: sleep
+    args: ["60"]
+`)
+
+	if err := pm.StartProcess("traced"); err != nil {
+		t.Fatalf("StartProcess() error = %v", err)
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	if err := pm.RestartProcessContext(ctx, "traced"); err != nil {
+		t.Fatalf("RestartProcessContext() error = %v", err)
+	}
+	parent.End()
+
+	found := processSpans(rec, "traced")
+	restart, ok := found["process.restart"]
+	if !ok {
+		t.Fatal("no process.restart span recorded")
+	}
+	if restart.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("process.restart is not a child of the request span")
+	}
+
+	for _, name := range []string{"process.stop", "process.start"} {
+		span, ok := found[name]
+		if !ok {
+			t.Fatalf("no %s span recorded", name)
+		}
+		if span.Parent().SpanID() != restart.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of process.restart", name)
+		}
+		if _, ok := spanAttr(span, "process.pid"); !ok {
+			t.Errorf("%s has no process.pid attribute", name)
+		}
+		if span.Status().Code == codes.Error {
+			t.Errorf("%s status = %v, want no error", name, span.Status())
+		}
+	}
+
+	if signal, _ := spanAttr(found["process.stop"], "process.stop_signal"); signal.AsString() != "SIGTERM" {
+		t.Errorf("process.stop_signal = %q, want %q", signal.AsString(), "SIGTERM")
+	}
+}
+
+func TestStartSpanRecordsError(t *testing.T) {
+	rec := recordSpans()
+	pm, _ := newTestManager(t, `
+processes:
+  - name: other
+    command: sleep
+    args: ["60"]
+`)
+
+	if err := pm.StartProcessContext(context.Background(), "missing"); err == nil {
+		t.Fatal("StartProcessContext() error = nil, want an error for an unknown process")
+	}
+
+	span, ok := processSpans(rec, "missing")["process.start"]
+	if !ok {
+		t.Fatal("no process.start span recorded")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want %v", span.Status().Code, codes.Error)
+	}
+	if len(span.Events()) == 0 {
+		t.Error("error not recorded as a span event")
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"pupervisor/internal/storage"
+)
+
+// setStatus changes a process's status and, if it differs from the current
+// one, records the transition with its reason and pushes it to event
+// subscribers. Callers must hold pm.mu.
+func (pm *ProcessManager) setStatus(name string, state *ProcessState, status, reason string) {
+	from := state.Status
+	state.Status = status
+	pm.updateReadiness(name, state)
+	if from == status {
+		return
+	}
+	now := pm.now()
+	pm.events.publish(Event{Type: EventStatus, Process: name, From: from, To: status, Reason: reason, Time: now})
+	if pm.storage == nil {
+		return
+	}
+
+	pm.transitions.add(&storage.Transition{
+		ProcessName: name,
+		FromState:   from,
+		ToState:     status,
+		Reason:      reason,
+		CreatedAt:   now,
+	}, pm.saveTransition)
+}
+
+// saveTransition stores a transition. It does database I/O, so callers must
+// not hold pm.mu.
+func (pm *ProcessManager) saveTransition(t *storage.Transition) {
+	if err := pm.storage.SaveTransition(t); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to record state transition of %s: %v", t.ProcessName, err), t.ProcessName)
+	}
+}
+
+// transitionLog saves transitions in the background, as they are recorded
+// with pm.mu held. A single goroutine at a time drains the queue, so they
+// are saved in the order they happened.
+type transitionLog struct {
+	mu       sync.Mutex
+	pending  []*storage.Transition
+	draining bool
+	// drained is closed when the running drain goroutine returns
+	drained chan struct{}
+}
+
+// add queues t to be passed to save, starting a goroutine to drain the
+// queue unless one is running.
+func (l *transitionLog) add(t *storage.Transition, save func(*storage.Transition)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = append(l.pending, t)
+	if l.draining {
+		return
+	}
+	l.draining = true
+	l.drained = make(chan struct{})
+	go l.drain(save)
+}
+
+// wait returns once every transition queued so far has been saved.
+func (l *transitionLog) wait() {
+	l.mu.Lock()
+	draining, drained := l.draining, l.drained
+	l.mu.Unlock()
+	if draining {
+		<-drained
+	}
+}
+
+func (l *transitionLog) drain(save func(*storage.Transition)) {
+	for {
+		l.mu.Lock()
+		batch := l.pending
+		l.pending = nil
+		if len(batch) == 0 {
+			l.draining = false
+			close(l.drained)
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+
+		for _, t := range batch {
+			save(t)
+		}
+	}
+}
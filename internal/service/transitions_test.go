@@ -0,0 +1,76 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransitionsRecorded(t *testing.T) {
+	// The first run of flaky crashes, its automatic restart keeps running
+	marker := filepath.Join(t.TempDir(), "crashed")
+	pm, store := newTestManager(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+  - name: flaky
+    command: /bin/sh
+    args: ["-c", "if [ -e `+marker+` ]; then exec sleep 30; fi; touch `+marker+`; exit 3"]
+    autorestart: true
+`)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pm.now = func() time.Time { return now }
+	pm.sleep = func(time.Duration) {}
+
+	for _, name := range []string{"app", "flaky"} {
+		if err := pm.StartProcess(name); err != nil {
+			t.Fatalf("StartProcess(%s): %v", name, err)
+		}
+	}
+	waitFor(t, "the automatic restart", func() bool {
+		crashes, _ := store.GetCrashesByProcess("flaky", 10)
+		p, _ := pm.GetProcess("flaky")
+		return len(crashes) > 0 && p.Status == "running"
+	})
+	for _, name := range []string{"app", "flaky"} {
+		if err := pm.StopProcess(name); err != nil {
+			t.Fatalf("StopProcess(%s): %v", name, err)
+		}
+	}
+	pm.transitions.wait()
+
+	type step struct{ from, to, reason string }
+	tests := []struct {
+		process string
+		want    []step
+	}{
+		{"app", []step{
+			{"running", "stopped", "stopped"},
+			{"stopped", "running", "started"},
+		}},
+		{"flaky", []step{
+			{"running", "stopped", "stopped"},
+			{"stopped", "running", "started"},
+			{"running", "stopped", "crashed with exit code 3"},
+			{"stopped", "running", "started"},
+		}},
+	}
+	for _, tt := range tests {
+		transitions, err := store.GetTransitionsByProcess(tt.process, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transitions) != len(tt.want) {
+			t.Fatalf("%s: got %d transitions, want %d: %+v", tt.process, len(transitions), len(tt.want), transitions)
+		}
+		for i, tr := range transitions {
+			if got := (step{tr.FromState, tr.ToState, tr.Reason}); got != tt.want[i] {
+				t.Errorf("%s: transition %d = %+v, want %+v", tt.process, i, got, tt.want[i])
+			}
+			if !tr.CreatedAt.Equal(now) {
+				t.Errorf("%s: transition %d created at %s, want %s", tt.process, i, tr.CreatedAt, now)
+			}
+		}
+	}
+}
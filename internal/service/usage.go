@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"pupervisor/internal/models"
+)
+
+// StartUsageSampling records the memory and CPU usage of every running
+// process each usage_sample_interval, keeping the samples of the last
+// usage_window for UsageHistory.
+func (pm *ProcessManager) StartUsageSampling() {
+	if pm.usageInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(pm.usageInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			pm.sampleUsage()
+		}
+	}()
+}
+
+func (pm *ProcessManager) sampleUsage() {
+	pm.mu.RLock()
+	pids := make(map[string]int)
+	for name, state := range pm.processes {
+		if state.Status == "running" && state.Pid > 0 {
+			pids[name] = state.Pid
+		}
+	}
+	pm.mu.RUnlock()
+
+	// ps is run without holding the lock
+	now := time.Now()
+	samples := make(map[string]models.UsageSample, len(pids))
+	for name, pid := range pids {
+		memory, cpu, err := readUsage(pid)
+		if err != nil {
+			continue
+		}
+		samples[name] = models.UsageSample{Time: now, MemoryBytes: memory, CPUPercent: cpu}
+	}
+
+	cutoff := now.Add(-pm.usageWindow)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for name, state := range pm.processes {
+		if sample, ok := samples[name]; ok && state.Pid == pids[name] {
+			state.usage = append(state.usage, sample)
+		}
+		drop := 0
+		for drop < len(state.usage) && state.usage[drop].Time.Before(cutoff) {
+			drop++
+		}
+		state.usage = state.usage[drop:]
+	}
+}
+
+// readUsage returns the resident memory in bytes and the CPU percentage of
+// a process, as reported by ps.
+func readUsage(pid int) (int64, float64, error) {
+	output, err := exec.Command("ps", "-o", "rss=,%cpu=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 {
+		return 0, 0, errors.New("unexpected ps output")
+	}
+	rssKB, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	cpu, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return rssKB * 1024, cpu, nil
+}
+
+// UsageHistory returns the process's usage samples of the last window,
+// oldest first, or all that are kept if window is 0.
+func (pm *ProcessManager) UsageHistory(name string, window time.Duration) (models.UsageHistory, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	state, ok := pm.processes[name]
+	if !ok {
+		return models.UsageHistory{}, ErrProcessNotFound
+	}
+
+	history := models.UsageHistory{
+		Name:            name,
+		IntervalSeconds: int(pm.usageInterval / time.Second),
+		Samples:         []models.UsageSample{},
+	}
+	cutoff := time.Now().Add(-window)
+	for _, sample := range state.usage {
+		if window == 0 || !sample.Time.Before(cutoff) {
+			history.Samples = append(history.Samples, sample)
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const watchdogInterval = 5 * time.Second
+
+// Heartbeat records that the process is alive and making progress.
+func (pm *ProcessManager) Heartbeat(name string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	state, ok := pm.processes[name]
+	if !ok {
+		return ErrProcessNotFound
+	}
+	if state.Status != "running" {
+		return ErrProcessNotRunning
+	}
+
+	state.LastHeartbeat = pm.now()
+	return nil
+}
+
+// StartWatchdog periodically restarts running processes with a heartbeat
+// timeout whose last heartbeat is older than that timeout.
+func (pm *ProcessManager) StartWatchdog() {
+	go func() {
+		ticker := time.NewTicker(watchdogInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, name := range pm.findHungProcesses() {
+				pm.restartHung(name)
+			}
+		}
+	}()
+}
+
+func (pm *ProcessManager) findHungProcesses() []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var hung []string
+	for name, state := range pm.processes {
+		if pm.isHung(state) {
+			hung = append(hung, name)
+		}
+	}
+	return hung
+}
+
+// isHung reports whether a running process with a heartbeat timeout has not
+// sent a heartbeat within it. Callers must hold pm.mu for writing.
+func (pm *ProcessManager) isHung(state *ProcessState) bool {
+	timeout := time.Duration(state.Config.HeartbeatTimeout) * time.Second
+	if timeout <= 0 || state.Status != "running" || state.held {
+		return false
+	}
+
+	if state.Config.HeartbeatFile != "" {
+		if info, err := os.Stat(state.Config.HeartbeatFile); err == nil && info.ModTime().After(state.LastHeartbeat) {
+			state.LastHeartbeat = info.ModTime()
+		}
+	}
+
+	// A freshly started process gets a full timeout before its first heartbeat
+	last := state.StartTime
+	if state.LastHeartbeat.After(last) {
+		last = state.LastHeartbeat
+	}
+	return pm.now().Sub(last) > timeout
+}
+
+// restartHung restarts a process found hung, unless it was removed, stopped,
+// held or sent a heartbeat since.
+func (pm *ProcessManager) restartHung(name string) {
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	hung := ok && pm.isHung(state)
+	var timeout int
+	if hung {
+		timeout = state.Config.HeartbeatTimeout
+	}
+	pm.mu.Unlock()
+	if !hung {
+		return
+	}
+
+	reason := fmt.Sprintf("Process %s is hung: no heartbeat for %ds, restarting", name, timeout)
+	pm.logPersistent("warning", reason, name)
+
+	if err := pm.RestartProcess(name); err != nil {
+		pm.log("error", fmt.Sprintf("Watchdog failed to restart %s: %v", name, err), name)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	pm, _ := newTestManager(t, `
+processes:
+  - name: app
+    command: sleep
+    args: ["30"]
+    heartbeattimeout: 10
+`)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+	pm.now = func() time.Time { return base.Add(time.Duration(elapsed.Load())) }
+
+	if err := pm.StartProcess("app"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+	t.Cleanup(func() { pm.StopProcess("app") })
+
+	elapsed.Store(int64(5 * time.Second))
+	if hung := pm.findHungProcesses(); len(hung) != 0 {
+		t.Errorf("hung after 5s = %v, want none", hung)
+	}
+	elapsed.Store(int64(11 * time.Second))
+	if hung := pm.findHungProcesses(); !slices.Equal(hung, []string{"app"}) {
+		t.Errorf("hung after 11s = %v, want [app]", hung)
+	}
+
+	// A heartbeat resets the timeout
+	if err := pm.Heartbeat("app"); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if hung := pm.findHungProcesses(); len(hung) != 0 {
+		t.Errorf("hung after a heartbeat = %v, want none", hung)
+	}
+
+	// A process stopped or removed once found hung is left alone
+	elapsed.Store(int64(30 * time.Second))
+	if err := pm.StopProcess("app"); err != nil {
+		t.Fatalf("StopProcess: %v", err)
+	}
+	pm.restartHung("app")
+	pm.restartHung("missing")
+	if p, _ := pm.GetProcess("app"); p.Status != "stopped" {
+		t.Errorf("status = %s after restartHung of a stopped process, want stopped", p.Status)
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrCorrupt is returned by New when the database file is corrupt ("database
+// disk image is malformed") or is not a SQLite database.
+var ErrCorrupt = errors.New("database is corrupt")
+
+// checkCorrupt wraps err with ErrCorrupt if SQLite reported corruption.
+func checkCorrupt(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	// The primary result code is in the low byte of extended codes
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+		return fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return err
+}
+
+// MoveAside renames the database file at dbPath, and its WAL and shared
+// memory files if present, to <dbPath>.corrupt-<time> so a fresh database
+// can be created in its place. It returns the new name of the database file.
+func MoveAside(dbPath string) (string, error) {
+	aside := fmt.Sprintf("%s.corrupt-%s", dbPath, time.Now().Format("20060102-150405"))
+	if err := os.Rename(dbPath, aside); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(dbPath+suffix, aside+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return aside, err
+		}
+	}
+	return aside, nil
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration is a versioned schema change. Applied migrations are recorded
+// in the schema_migrations table so each runs once.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	apply   func(tx *sql.Tx) error
+}
+
+// migrations are the schema changes in the order they are applied. Append
+// new ones with the next version; never change or reorder released ones.
+// The early ones are idempotent, as databases created before versioning
+// already have some or all of their changes.
+var migrations = []Migration{
+	{Version: 1, Name: "create tables", apply: execMigration(`
+	CREATE TABLE IF NOT EXISTS crashes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		process_name TEXT NOT NULL,
+		exit_code INTEGER,
+		signal TEXT,
+		error_message TEXT,
+		stdout TEXT,
+		stderr TEXT,
+		started_at DATETIME,
+		crashed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		uptime TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_crashes_process ON crashes(process_name);
+	CREATE INDEX IF NOT EXISTS idx_crashes_time ON crashes(crashed_at DESC);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT UNIQUE NOT NULL,
+		value TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS error_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		level TEXT NOT NULL,
+		source TEXT,
+		message TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_errors_time ON error_logs(created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_errors_level ON error_logs(level);
+
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target TEXT NOT NULL,
+		event_type TEXT,
+		process_name TEXT,
+		status TEXT NOT NULL,
+		detail TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_notifications_time ON notifications(created_at DESC);
+
+	CREATE TABLE IF NOT EXISTS transitions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		process_name TEXT NOT NULL,
+		from_state TEXT,
+		to_state TEXT NOT NULL,
+		reason TEXT,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_transitions_time ON transitions(created_at DESC);
+	`)},
+	{Version: 2, Name: "add crashes.version", apply: func(tx *sql.Tx) error {
+		if err := addColumn(tx, "crashes", "version", "TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_crashes_version ON crashes(version)`)
+		return err
+	}},
+	{Version: 3, Name: "add crashes.command_line", apply: func(tx *sql.Tx) error {
+		return addColumn(tx, "crashes", "command_line", "TEXT")
+	}},
+	{Version: 4, Name: "add crashes.fingerprint", apply: func(tx *sql.Tx) error {
+		if err := addColumn(tx, "crashes", "fingerprint", "TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_crashes_fingerprint ON crashes(fingerprint)`)
+		return err
+	}},
+	{Version: 5, Name: "add error_logs.count", apply: func(tx *sql.Tx) error {
+		return addColumn(tx, "error_logs", "count", "INTEGER NOT NULL DEFAULT 1")
+	}},
+	{Version: 6, Name: "add crashes.startup_stderr", apply: func(tx *sql.Tx) error {
+		return addColumn(tx, "crashes", "startup_stderr", "TEXT")
+	}},
+	{Version: 7, Name: "create config_changes", apply: execMigration(`
+	CREATE TABLE config_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		key TEXT NOT NULL,
+		old_value TEXT,
+		new_value TEXT,
+		actor TEXT,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX idx_config_changes_key ON config_changes(key, created_at);
+	CREATE INDEX idx_config_changes_time ON config_changes(created_at);
+	`)},
+	{Version: 8, Name: "rewrite timestamps in SQLite format", apply: func(tx *sql.Tx) error {
+		for _, c := range []struct{ table, column string }{
+			{"crashes", "started_at"},
+			{"crashes", "crashed_at"},
+			{"settings", "updated_at"},
+			{"error_logs", "created_at"},
+			{"notifications", "created_at"},
+			{"transitions", "created_at"},
+		} {
+			if err := rewriteGoTimes(tx, c.table, c.column); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+func execMigration(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// Migrate applies the migrations not yet recorded in the database, each in
+// its own transaction, and returns those it applied. It stops at the first
+// one that fails.
+func (s *Storage) Migrate() ([]Migration, error) {
+	s.migrateMu.Lock()
+	defer s.migrateMu.Unlock()
+
+	_, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := s.applyMigration(m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func (s *Storage) applyMigration(m Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the last applied migration, 0 if
+// none has been applied.
+func (s *Storage) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// LatestSchemaVersion is the version Migrate brings the database to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+const (
+	// goTimeLayout is how the driver wrote times before the sqlite time
+	// format was set: time.Time.String without the monotonic clock reading
+	goTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+	// sqliteTimeLayout is how the driver writes times in the sqlite time
+	// format
+	sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+)
+
+// rewriteGoTimes rewrites the values of a column written in goTimeLayout,
+// which SQLite's date functions do not understand, in the sqlite time
+// format. Values in neither format are left alone.
+func rewriteGoTimes(tx *sql.Tx, table, column string) error {
+	// Cast so the driver returns the text instead of parsing it
+	rows, err := tx.Query(fmt.Sprintf(
+		`SELECT id, CAST(%[2]s AS TEXT) FROM %[1]s WHERE %[2]s IS NOT NULL AND julianday(%[2]s) IS NULL`,
+		table, column))
+	if err != nil {
+		return err
+	}
+
+	rewritten := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		if i := strings.Index(value, " m="); i >= 0 {
+			value = value[:i]
+		}
+		if t, err := time.Parse(goTimeLayout, value); err == nil {
+			rewritten[id] = t.Format(sqliteTimeLayout)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, value := range rewritten {
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table, column), value, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to an existing table unless it is already there.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func columns(t *testing.T, s *Storage, table string) map[string]bool {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		cols[name] = true
+	}
+	return cols
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	s := newTestStorage(t)
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+
+	applied, err := s.Migrate()
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate applied %v, want nothing", applied)
+	}
+}
+
+// TestMigrateUnversionedDatabase opens a database created before migrations
+// were versioned, with some of the later columns already added.
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE crashes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		process_name TEXT NOT NULL,
+		exit_code INTEGER,
+		signal TEXT,
+		error_message TEXT,
+		stdout TEXT,
+		stderr TEXT,
+		started_at DATETIME,
+		crashed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		uptime TEXT,
+		version TEXT,
+		fingerprint TEXT,
+		startup_stderr TEXT
+	);
+	CREATE TABLE settings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT UNIQUE NOT NULL,
+		value TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE error_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		level TEXT NOT NULL,
+		source TEXT,
+		message TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO crashes (process_name, exit_code, version) VALUES ('web', 1, 'v1');
+	INSERT INTO settings (key, value) VALUES ('theme', 'dark');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(path, Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+
+	if version, _ := s.SchemaVersion(); version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+	cols := columns(t, s, "crashes")
+	for _, col := range []string{"version", "command_line", "fingerprint", "startup_stderr"} {
+		if !cols[col] {
+			t.Errorf("crashes.%s missing", col)
+		}
+	}
+	if !columns(t, s, "error_logs")["count"] {
+		t.Error("error_logs.count missing")
+	}
+
+	crashes, err := s.GetCrashesByProcess("web", 10)
+	if err != nil || len(crashes) != 1 || crashes[0].Version != "v1" {
+		t.Errorf("existing crash = %+v, %v", crashes, err)
+	}
+	if value, _ := s.GetSetting("theme"); value != "dark" {
+		t.Errorf("existing setting = %q, want dark", value)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	s := newTestStorage(t)
+
+	next := LatestSchemaVersion() + 1
+	saved := migrations
+	migrations = append(saved, Migration{Version: next, Name: "broken", apply: func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE half_done (id INTEGER)`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}})
+	t.Cleanup(func() { migrations = saved })
+
+	applied, err := s.Migrate()
+	if err == nil {
+		t.Fatal("Migrate succeeded")
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %v, want nothing", applied)
+	}
+	if version, _ := s.SchemaVersion(); version != next-1 {
+		t.Errorf("SchemaVersion() = %d, want %d", version, next-1)
+	}
+
+	var tables int
+	s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&tables)
+	if tables != 0 {
+		t.Error("the failed migration's table was not rolled back")
+	}
+}
+
+// TestMigrateRewritesGoTimes checks that rows written in the driver's old
+// default time format are rewritten so time-based queries see them.
+func TestMigrateRewritesGoTimes(t *testing.T) {
+	s := newTestStorage(t)
+	if _, err := s.db.Exec(`DELETE FROM schema_migrations WHERE version >= 8`); err != nil {
+		t.Fatal(err)
+	}
+
+	old := "2020-03-01 10:00:00.5 +0000 UTC m=+12.345"
+	recent := time.Now().Add(-time.Hour).UTC().Format(goTimeLayout)
+	for _, crashedAt := range []string{old, recent} {
+		if _, err := s.db.Exec(`INSERT INTO crashes (process_name, exit_code, started_at, crashed_at) VALUES ('web', 1, ?, ?)`, crashedAt, crashedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.db.Exec(`INSERT INTO transitions (process_name, to_state, created_at) VALUES ('web', 'running', ?)`, recent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO error_logs (level, message, created_at) VALUES ('error', 'kept as is', 'yesterday')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	var unreadable int
+	s.db.QueryRow(`SELECT COUNT(*) FROM crashes WHERE julianday(crashed_at) IS NULL OR julianday(started_at) IS NULL`).Scan(&unreadable)
+	if unreadable != 0 {
+		t.Errorf("%d crashes still have unreadable times", unreadable)
+	}
+
+	top, err := s.GetTopCrashers(time.Now().Add(-24*time.Hour), 10)
+	if err != nil || len(top) != 1 || top[0].Count != 1 {
+		t.Errorf("GetTopCrashers() = %+v, %v, want the recent crash only", top, err)
+	}
+	transitions, err := s.GetTransitions(time.Now().Add(-24*time.Hour), 0, 10)
+	if err != nil || len(transitions) != 1 {
+		t.Errorf("GetTransitions() = %+v, %v, want the rewritten transition", transitions, err)
+	}
+
+	deleted, err := s.ClearOldCrashes(30)
+	if err != nil || deleted != 1 {
+		t.Errorf("ClearOldCrashes() = %d, %v, want the 2020 crash deleted", deleted, err)
+	}
+
+	var message string
+	s.db.QueryRow(`SELECT CAST(created_at AS TEXT) FROM error_logs WHERE message = 'kept as is'`).Scan(&message)
+	if message != "yesterday" {
+		t.Errorf("unparseable time rewritten to %q", message)
+	}
+}
@@ -2,13 +2,35 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+var ErrCrashNotFound = errors.New("crash not found")
+
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+	// maxSize caps the database size in bytes, see TrimToSize
+	maxSize int64
+	// errorDedupWindow is how recent an identical error log must be for
+	// SaveError to count a repeat on it, see SaveError
+	errorDedupWindow time.Duration
+
+	// migrateMu serializes Migrate
+	migrateMu sync.Mutex
+
+	mu sync.RWMutex
+	// settingListeners are called after a setting is saved
+	settingListeners []func(key, value string)
 }
 
 // CrashRecord represents a process crash event
@@ -23,6 +45,29 @@ type CrashRecord struct {
 	StartedAt   time.Time `json:"started_at"`
 	CrashedAt   time.Time `json:"crashed_at"`
 	Uptime      string    `json:"uptime"`
+	// Version is the deploy_version setting at the time of the crash
+	Version string `json:"version,omitempty"`
+	// CommandLine is the command and arguments the process was started
+	// with, before ${secret:key} references were resolved
+	CommandLine []string `json:"command_line,omitempty"`
+	// Fingerprint groups crashes with the same cause, see
+	// service.CrashFingerprint
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// StartupStderr is the stderr the process wrote right after it started,
+	// kept apart from Stderr since it tends to say why a start went wrong
+	StartupStderr string `json:"startup_stderr,omitempty"`
+}
+
+// CrashFilter selects the crashes to delete. Empty fields match any crash.
+type CrashFilter struct {
+	ProcessName string
+	Before      time.Time
+	Fingerprint string
+}
+
+// IsEmpty reports whether the filter would match every crash.
+func (f CrashFilter) IsEmpty() bool {
+	return f.ProcessName == "" && f.Before.IsZero() && f.Fingerprint == ""
 }
 
 // Settings represents user settings
@@ -39,67 +84,141 @@ type ErrorLog struct {
 	Level     string    `json:"level"`
 	Source    string    `json:"source"`
 	Message   string    `json:"message"`
+	Count     int       `json:"count"` // occurrences folded into this entry
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Transition represents a change of a process's state
+type Transition struct {
+	ID          int64     `json:"id"`
+	ProcessName string    `json:"process_name"`
+	FromState   string    `json:"from_state"`
+	ToState     string    `json:"to_state"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Kinds of config change
+const (
+	ConfigChangeSetting = "setting"
+	ConfigChangeProcess = "process"
+)
+
+// ConfigChange records a change of a setting's value or of a process's
+// config. OldValue is empty for an added setting or process and NewValue for
+// a removed process.
+type ConfigChange struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	Key       string    `json:"key"`
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-func New(dbPath string) (*Storage, error) {
-	db, err := sql.Open("sqlite", dbPath)
+// Notification represents a notification delivery attempt or a change of a
+// notification target's circuit breaker state
+type Notification struct {
+	ID          int64     `json:"id"`
+	Target      string    `json:"target"`
+	EventType   string    `json:"event_type"`
+	ProcessName string    `json:"process_name,omitempty"`
+	Status      string    `json:"status"`
+	Detail      string    `json:"detail,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Options tunes SQLite durability and throughput. Zero values keep the
+// SQLite defaults.
+type Options struct {
+	BusyTimeout int    // milliseconds to wait on a locked database
+	Synchronous string // OFF, NORMAL, FULL or EXTRA
+	CacheSize   int    // pages if positive, KiB if negative
+	MaxSize     int64  // bytes before TrimToSize deletes old rows; 0 disables
+	// ErrorDedupWindow folds an error log into an identical one saved less
+	// than this long ago; 0 disables
+	ErrorDedupWindow time.Duration
+}
+
+// New opens the database at dbPath and applies pending migrations. A file
+// that is corrupt or not a SQLite database is reported as ErrCorrupt.
+func New(dbPath string, opts Options) (*Storage, error) {
+	pragmas, err := opts.pragmas()
 	if err != nil {
 		return nil, err
 	}
 
+	// Pragmas are per connection, so pass them in the DSN for the driver to
+	// apply to every pooled connection. Times are written in SQLite's own
+	// format so date functions such as julianday() can be used in queries;
+	// migration 8 rewrites the times of older databases.
+	q := url.Values{}
+	q.Set("_time_format", "sqlite")
+	for _, pragma := range pragmas {
+		q.Add("_pragma", pragma)
+	}
+	dsn := dbPath + "?" + q.Encode()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, checkCorrupt(fmt.Errorf("failed to open database with pragmas %s: %w", strings.Join(pragmas, ", "), err))
+	}
+
 	// Enable WAL mode for better concurrency
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		return nil, err
+		db.Close()
+		return nil, checkCorrupt(err)
 	}
 
-	s := &Storage{db: db}
-	if err := s.migrate(); err != nil {
-		return nil, err
+	if opts.MaxSize < 0 {
+		db.Close()
+		return nil, fmt.Errorf("invalid max size %d: must not be negative", opts.MaxSize)
+	}
+	if opts.ErrorDedupWindow < 0 {
+		db.Close()
+		return nil, fmt.Errorf("invalid error dedup window %s: must not be negative", opts.ErrorDedupWindow)
+	}
+
+	s := &Storage{db: db, path: dbPath, maxSize: opts.MaxSize, errorDedupWindow: opts.ErrorDedupWindow}
+	if _, err := s.Migrate(); err != nil {
+		db.Close()
+		return nil, checkCorrupt(err)
 	}
 
 	return s, nil
 }
 
-func (s *Storage) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS crashes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		process_name TEXT NOT NULL,
-		exit_code INTEGER,
-		signal TEXT,
-		error_message TEXT,
-		stdout TEXT,
-		stderr TEXT,
-		started_at DATETIME,
-		crashed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		uptime TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_crashes_process ON crashes(process_name);
-	CREATE INDEX IF NOT EXISTS idx_crashes_time ON crashes(crashed_at DESC);
-
-	CREATE TABLE IF NOT EXISTS settings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		key TEXT UNIQUE NOT NULL,
-		value TEXT,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS error_logs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		level TEXT NOT NULL,
-		source TEXT,
-		message TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_errors_time ON error_logs(created_at DESC);
-	CREATE INDEX IF NOT EXISTS idx_errors_level ON error_logs(level);
-	`
+func (o Options) pragmas() ([]string, error) {
+	var pragmas []string
+
+	if o.BusyTimeout < 0 {
+		return nil, fmt.Errorf("invalid busy_timeout %d: must not be negative", o.BusyTimeout)
+	}
+	if o.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("busy_timeout=%d", o.BusyTimeout))
+	}
 
-	_, err := s.db.Exec(schema)
-	return err
+	if o.Synchronous != "" {
+		mode := strings.ToUpper(o.Synchronous)
+		switch mode {
+		case "OFF", "NORMAL", "FULL", "EXTRA":
+			pragmas = append(pragmas, "synchronous="+mode)
+		default:
+			return nil, fmt.Errorf("invalid synchronous mode %q: must be OFF, NORMAL, FULL or EXTRA", o.Synchronous)
+		}
+	}
+
+	if o.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("cache_size=%d", o.CacheSize))
+	}
+
+	return pragmas, nil
 }
 
 func (s *Storage) Close() error {
@@ -109,9 +228,18 @@ func (s *Storage) Close() error {
 // Crash operations
 
 func (s *Storage) SaveCrash(crash *CrashRecord) error {
+	var commandLine sql.NullString
+	if len(crash.CommandLine) > 0 {
+		data, err := json.Marshal(crash.CommandLine)
+		if err != nil {
+			return err
+		}
+		commandLine = sql.NullString{String: string(data), Valid: true}
+	}
+
 	query := `
-		INSERT INTO crashes (process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO crashes (process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime, version, command_line, fingerprint, startup_stderr)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := s.db.Exec(query,
 		crash.ProcessName,
@@ -123,6 +251,10 @@ func (s *Storage) SaveCrash(crash *CrashRecord) error {
 		crash.StartedAt,
 		crash.CrashedAt,
 		crash.Uptime,
+		crash.Version,
+		commandLine,
+		crash.Fingerprint,
+		crash.StartupStderr,
 	)
 	if err != nil {
 		return err
@@ -132,14 +264,71 @@ func (s *Storage) SaveCrash(crash *CrashRecord) error {
 	return nil
 }
 
-func (s *Storage) GetCrashes(limit int) ([]CrashRecord, error) {
-	query := `
-		SELECT id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime
-		FROM crashes
-		ORDER BY crashed_at DESC
-		LIMIT ?
-	`
-	rows, err := s.db.Query(query, limit)
+const crashColumns = `id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime, version, command_line, fingerprint, startup_stderr`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCrash(row rowScanner) (CrashRecord, error) {
+	var c CrashRecord
+	var signal, errMsg, stdout, stderr sql.NullString
+	var startedAt, crashedAt sql.NullTime
+	var uptime, version, commandLine, fingerprint, startupStderr sql.NullString
+
+	err := row.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime, &version, &commandLine, &fingerprint, &startupStderr)
+	if err != nil {
+		return c, err
+	}
+
+	c.Signal = signal.String
+	c.ErrorMsg = errMsg.String
+	c.Stdout = stdout.String
+	c.Stderr = stderr.String
+	if startedAt.Valid {
+		c.StartedAt = startedAt.Time
+	}
+	if crashedAt.Valid {
+		c.CrashedAt = crashedAt.Time
+	}
+	c.Uptime = uptime.String
+	c.Version = version.String
+	c.Fingerprint = fingerprint.String
+	c.StartupStderr = startupStderr.String
+	if commandLine.Valid {
+		if err := json.Unmarshal([]byte(commandLine.String), &c.CommandLine); err != nil {
+			return c, fmt.Errorf("crash %d: invalid command_line: %w", c.ID, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (s *Storage) GetCrashByID(id int64) (*CrashRecord, error) {
+	row := s.db.QueryRow(`SELECT `+crashColumns+` FROM crashes WHERE id = ?`, id)
+	c, err := scanCrash(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrCrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCrashes returns the most recent crashes, only those recorded under the
+// given deploy version if it is not empty.
+func (s *Storage) GetCrashes(limit int, version string) ([]CrashRecord, error) {
+	query := `SELECT ` + crashColumns + ` FROM crashes`
+	args := []any{}
+	if version != "" {
+		query += ` WHERE version = ?`
+		args = append(args, version)
+	}
+	query += ` ORDER BY crashed_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -147,28 +336,32 @@ func (s *Storage) GetCrashes(limit int) ([]CrashRecord, error) {
 
 	var crashes []CrashRecord
 	for rows.Next() {
-		var c CrashRecord
-		var signal, errMsg, stdout, stderr sql.NullString
-		var startedAt, crashedAt sql.NullTime
-		var uptime sql.NullString
-
-		err := rows.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime)
+		c, err := scanCrash(rows)
 		if err != nil {
 			return nil, err
 		}
+		crashes = append(crashes, c)
+	}
 
-		c.Signal = signal.String
-		c.ErrorMsg = errMsg.String
-		c.Stdout = stdout.String
-		c.Stderr = stderr.String
-		if startedAt.Valid {
-			c.StartedAt = startedAt.Time
-		}
-		if crashedAt.Valid {
-			c.CrashedAt = crashedAt.Time
-		}
-		c.Uptime = uptime.String
+	return crashes, rows.Err()
+}
 
+// GetCrashesPage returns limit crashes, newest first, after skipping the
+// offset newest ones.
+func (s *Storage) GetCrashesPage(limit, offset int) ([]CrashRecord, error) {
+	query := `SELECT ` + crashColumns + ` FROM crashes ORDER BY crashed_at DESC, id DESC LIMIT ? OFFSET ?`
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crashes := []CrashRecord{}
+	for rows.Next() {
+		c, err := scanCrash(rows)
+		if err != nil {
+			return nil, err
+		}
 		crashes = append(crashes, c)
 	}
 
@@ -177,7 +370,7 @@ func (s *Storage) GetCrashes(limit int) ([]CrashRecord, error) {
 
 func (s *Storage) GetCrashesByProcess(processName string, limit int) ([]CrashRecord, error) {
 	query := `
-		SELECT id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime
+		SELECT ` + crashColumns + `
 		FROM crashes
 		WHERE process_name = ?
 		ORDER BY crashed_at DESC
@@ -191,32 +384,85 @@ func (s *Storage) GetCrashesByProcess(processName string, limit int) ([]CrashRec
 
 	var crashes []CrashRecord
 	for rows.Next() {
-		var c CrashRecord
-		var signal, errMsg, stdout, stderr sql.NullString
-		var startedAt, crashedAt sql.NullTime
-		var uptime sql.NullString
-
-		err := rows.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime)
+		c, err := scanCrash(rows)
 		if err != nil {
 			return nil, err
 		}
+		crashes = append(crashes, c)
+	}
 
-		c.Signal = signal.String
-		c.ErrorMsg = errMsg.String
-		c.Stdout = stdout.String
-		c.Stderr = stderr.String
-		if startedAt.Valid {
-			c.StartedAt = startedAt.Time
-		}
-		if crashedAt.Valid {
-			c.CrashedAt = crashedAt.Time
+	return crashes, rows.Err()
+}
+
+// CrashTiming is the start and crash time of a single crash record.
+type CrashTiming struct {
+	ProcessName string
+	StartedAt   time.Time
+	CrashedAt   time.Time
+}
+
+// GetCrashTimings returns the timings of all crashes ordered by process and
+// crash time, for computing uptime and restart interval distributions.
+func (s *Storage) GetCrashTimings() ([]CrashTiming, error) {
+	query := `
+		SELECT process_name, started_at, crashed_at
+		FROM crashes
+		ORDER BY process_name, crashed_at
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var timings []CrashTiming
+	for rows.Next() {
+		var t CrashTiming
+		var startedAt, crashedAt sql.NullTime
+		if err := rows.Scan(&t.ProcessName, &startedAt, &crashedAt); err != nil {
+			return nil, err
 		}
-		c.Uptime = uptime.String
+		t.StartedAt = startedAt.Time
+		t.CrashedAt = crashedAt.Time
+		timings = append(timings, t)
+	}
 
-		crashes = append(crashes, c)
+	return timings, rows.Err()
+}
+
+// ProcessCount is a process with a number of events, such as crashes
+type ProcessCount struct {
+	ProcessName string `json:"process_name"`
+	Count       int    `json:"count"`
+}
+
+// GetTopCrashers returns the processes with the most crashes since the given
+// time, most crashes first.
+func (s *Storage) GetTopCrashers(since time.Time, limit int) ([]ProcessCount, error) {
+	query := `
+		SELECT process_name, COUNT(*) as count
+		FROM crashes
+		WHERE julianday(crashed_at) >= julianday(?)
+		GROUP BY process_name
+		ORDER BY count DESC, process_name
+		LIMIT ?
+	`
+	rows, err := s.db.Query(query, since.Format(time.RFC3339Nano), limit)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return crashes, rows.Err()
+	counts := []ProcessCount{}
+	for rows.Next() {
+		var pc ProcessCount
+		if err := rows.Scan(&pc.ProcessName, &pc.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, pc)
+	}
+
+	return counts, rows.Err()
 }
 
 func (s *Storage) GetCrashStats() (map[string]int, error) {
@@ -248,24 +494,81 @@ func (s *Storage) GetCrashStats() (map[string]int, error) {
 // Settings operations
 
 func (s *Storage) GetSetting(key string) (string, error) {
+	value, _, err := s.LookupSetting(key)
+	return value, err
+}
+
+// LookupSetting returns a setting's value and whether it is set at all.
+func (s *Storage) LookupSetting(key string) (string, bool, error) {
 	var value sql.NullString
 	err := s.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
 	if err == sql.ErrNoRows {
-		return "", nil
+		return "", false, nil
 	}
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
-	return value.String, nil
+	return value.String, true, nil
 }
 
+// SetSetting saves a setting and then tells the OnSettingChange listeners.
 func (s *Storage) SetSetting(key, value string) error {
 	query := `
 		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
 	`
-	_, err := s.db.Exec(query, key, value)
-	return err
+	if _, err := s.db.Exec(query, key, value); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	listeners := s.settingListeners
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(key, value)
+	}
+	return nil
+}
+
+// SetSettings saves several settings in one transaction, so either all or
+// none are saved, and then tells the OnSettingChange listeners.
+func (s *Storage) SetSettings(settings map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`
+	for key, value := range settings {
+		if _, err := tx.Exec(query, key, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	listeners := s.settingListeners
+	s.mu.RUnlock()
+	for key, value := range settings {
+		for _, fn := range listeners {
+			fn(key, value)
+		}
+	}
+	return nil
+}
+
+// OnSettingChange registers fn to be called with every setting saved by
+// SetSetting, so that subsystems can apply changes without a restart.
+func (s *Storage) OnSettingChange(fn func(key, value string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settingListeners = append(s.settingListeners, fn)
 }
 
 func (s *Storage) GetAllSettings() (map[string]string, error) {
@@ -290,15 +593,50 @@ func (s *Storage) GetAllSettings() (map[string]string, error) {
 
 // Error log operations
 
+// SaveError records an error log. With an error dedup window, an error with
+// the same level, source and message as one saved within the window only
+// increments that entry's count, so a repeating failure takes one row per
+// window instead of one per occurrence.
 func (s *Storage) SaveError(level, source, message string) error {
-	query := `INSERT INTO error_logs (level, source, message) VALUES (?, ?, ?)`
-	_, err := s.db.Exec(query, level, source, message)
-	return err
+	if s.errorDedupWindow <= 0 {
+		_, err := s.db.Exec(`INSERT INTO error_logs (level, source, message) VALUES (?, ?, ?)`, level, source, message)
+		return err
+	}
+
+	// The UPDATE takes the write lock, so concurrent repeats cannot both
+	// miss the entry and insert one each
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE error_logs SET count = count + 1
+		WHERE id = (
+			SELECT id FROM error_logs
+			WHERE level = ? AND source IS ? AND message = ?
+			  AND created_at >= datetime('now', '-' || ? || ' seconds')
+			ORDER BY created_at DESC
+			LIMIT 1
+		)
+	`, level, source, message, s.errorDedupWindow.Seconds())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if _, err := tx.Exec(`INSERT INTO error_logs (level, source, message) VALUES (?, ?, ?)`, level, source, message); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (s *Storage) GetErrors(limit int) ([]ErrorLog, error) {
 	query := `
-		SELECT id, level, source, message, created_at
+		SELECT id, level, source, message, count, created_at
 		FROM error_logs
 		ORDER BY created_at DESC
 		LIMIT ?
@@ -313,7 +651,7 @@ func (s *Storage) GetErrors(limit int) ([]ErrorLog, error) {
 	for rows.Next() {
 		var e ErrorLog
 		var source sql.NullString
-		if err := rows.Scan(&e.ID, &e.Level, &source, &e.Message, &e.CreatedAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.Level, &source, &e.Message, &e.Count, &e.CreatedAt); err != nil {
 			return nil, err
 		}
 		e.Source = source.String
@@ -325,7 +663,7 @@ func (s *Storage) GetErrors(limit int) ([]ErrorLog, error) {
 
 func (s *Storage) GetErrorsByLevel(level string, limit int) ([]ErrorLog, error) {
 	query := `
-		SELECT id, level, source, message, created_at
+		SELECT id, level, source, message, count, created_at
 		FROM error_logs
 		WHERE level = ?
 		ORDER BY created_at DESC
@@ -341,7 +679,7 @@ func (s *Storage) GetErrorsByLevel(level string, limit int) ([]ErrorLog, error)
 	for rows.Next() {
 		var e ErrorLog
 		var source sql.NullString
-		if err := rows.Scan(&e.ID, &e.Level, &source, &e.Message, &e.CreatedAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.Level, &source, &e.Message, &e.Count, &e.CreatedAt); err != nil {
 			return nil, err
 		}
 		e.Source = source.String
@@ -351,14 +689,405 @@ func (s *Storage) GetErrorsByLevel(level string, limit int) ([]ErrorLog, error)
 	return errors, rows.Err()
 }
 
-func (s *Storage) ClearOldErrors(daysToKeep int) error {
+// ClearOldErrors deletes error logs older than daysToKeep days, except those
+// of exceptSources, and returns how many were removed.
+func (s *Storage) ClearOldErrors(daysToKeep int, exceptSources ...string) (int64, error) {
 	query := `DELETE FROM error_logs WHERE created_at < datetime('now', '-' || ? || ' days')`
-	_, err := s.db.Exec(query, daysToKeep)
-	return err
+	args := []any{daysToKeep}
+	if len(exceptSources) > 0 {
+		query += ` AND (source IS NULL OR source NOT IN (?` + strings.Repeat(", ?", len(exceptSources)-1) + `))`
+		for _, source := range exceptSources {
+			args = append(args, source)
+		}
+	}
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClearOldProcessErrors deletes the error logs of one process older than
+// daysToKeep.
+func (s *Storage) ClearOldProcessErrors(source string, daysToKeep int) (int64, error) {
+	query := `DELETE FROM error_logs WHERE source = ? AND created_at < datetime('now', '-' || ? || ' days')`
+	result, err := s.db.Exec(query, source, daysToKeep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteCrash deletes a single crash record.
+func (s *Storage) DeleteCrash(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM crashes WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCrashNotFound
+	}
+	return nil
+}
+
+// DeleteCrashes deletes the crashes matching filter and returns how many
+// were removed.
+func (s *Storage) DeleteCrashes(filter CrashFilter) (int64, error) {
+	query := `DELETE FROM crashes WHERE 1 = 1`
+	args := []any{}
+	if filter.ProcessName != "" {
+		query += ` AND process_name = ?`
+		args = append(args, filter.ProcessName)
+	}
+	if !filter.Before.IsZero() {
+		query += ` AND julianday(crashed_at) < julianday(?)`
+		args = append(args, filter.Before.Format(time.RFC3339Nano))
+	}
+	if filter.Fingerprint != "" {
+		query += ` AND fingerprint = ?`
+		args = append(args, filter.Fingerprint)
+	}
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClearOldCrashes deletes crash records older than daysToKeep days and
+// returns how many were removed.
+func (s *Storage) ClearOldCrashes(daysToKeep int) (int64, error) {
+	query := `DELETE FROM crashes WHERE julianday(crashed_at) < julianday('now', '-' || ? || ' days')`
+	result, err := s.db.Exec(query, daysToKeep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Notification operations
+
+func (s *Storage) SaveNotification(n *Notification) error {
+	query := `
+		INSERT INTO notifications (target, event_type, process_name, status, detail)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query, n.Target, n.EventType, n.ProcessName, n.Status, n.Detail)
+	if err != nil {
+		return err
+	}
+
+	n.ID, _ = result.LastInsertId()
+	return nil
+}
+
+func (s *Storage) GetNotifications(limit int) ([]Notification, error) {
+	query := `
+		SELECT id, target, event_type, process_name, status, detail, created_at
+		FROM notifications
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var eventType, processName, detail sql.NullString
+		if err := rows.Scan(&n.ID, &n.Target, &eventType, &processName, &n.Status, &detail, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.EventType = eventType.String
+		n.ProcessName = processName.String
+		n.Detail = detail.String
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// Transition operations
+
+func (s *Storage) SaveTransition(t *Transition) error {
+	query := `
+		INSERT INTO transitions (process_name, from_state, to_state, reason, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query, t.ProcessName, t.FromState, t.ToState, t.Reason, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	t.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetTransitions returns up to limit transitions newest first. A non-zero
+// since only returns transitions after that time; a non-zero beforeID only
+// those older than that transition, for paging through the feed.
+func (s *Storage) GetTransitions(since time.Time, beforeID int64, limit int) ([]Transition, error) {
+	query := `SELECT id, process_name, from_state, to_state, reason, created_at FROM transitions WHERE 1 = 1`
+	args := []any{}
+	if !since.IsZero() {
+		query += ` AND julianday(created_at) > julianday(?)`
+		args = append(args, since)
+	}
+	if beforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	return s.queryTransitions(query, args...)
+}
+
+// GetTransitionsByProcess returns the latest limit state transitions of a
+// process, newest first.
+func (s *Storage) GetTransitionsByProcess(processName string, limit int) ([]Transition, error) {
+	query := `SELECT id, process_name, from_state, to_state, reason, created_at FROM transitions
+		WHERE process_name = ? ORDER BY id DESC LIMIT ?`
+	return s.queryTransitions(query, processName, limit)
+}
+
+func (s *Storage) queryTransitions(query string, args ...any) ([]Transition, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []Transition{}
+	for rows.Next() {
+		var t Transition
+		var from, reason sql.NullString
+		if err := rows.Scan(&t.ID, &t.ProcessName, &from, &t.ToState, &reason, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.FromState = from.String
+		t.Reason = reason.String
+		transitions = append(transitions, t)
+	}
+
+	return transitions, rows.Err()
+}
+
+// ClearOldTransitions deletes state transitions older than daysToKeep days
+// and returns how many were removed.
+func (s *Storage) ClearOldTransitions(daysToKeep int) (int64, error) {
+	query := `DELETE FROM transitions WHERE julianday(created_at) < julianday('now', '-' || ? || ' days')`
+	result, err := s.db.Exec(query, daysToKeep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Config change operations
+
+// SaveConfigChanges records changes in one transaction.
+func (s *Storage) SaveConfigChanges(changes []ConfigChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO config_changes (kind, key, old_value, new_value, actor, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for _, c := range changes {
+		if _, err := tx.Exec(query, c.Kind, c.Key, c.OldValue, c.NewValue, c.Actor, c.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetConfigChanges returns up to limit config changes oldest first. A
+// non-empty key only returns changes of that setting or process; non-zero
+// from and to bound when they were made.
+func (s *Storage) GetConfigChanges(key string, from, to time.Time, limit int) ([]ConfigChange, error) {
+	query := `SELECT id, kind, key, old_value, new_value, actor, created_at FROM config_changes WHERE 1 = 1`
+	args := []any{}
+	if key != "" {
+		query += ` AND key = ?`
+		args = append(args, key)
+	}
+	if !from.IsZero() {
+		query += ` AND julianday(created_at) >= julianday(?)`
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += ` AND julianday(created_at) <= julianday(?)`
+		args = append(args, to)
+	}
+	query += ` ORDER BY julianday(created_at), id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []ConfigChange{}
+	for rows.Next() {
+		var c ConfigChange
+		var oldValue, newValue, actor sql.NullString
+		if err := rows.Scan(&c.ID, &c.Kind, &c.Key, &oldValue, &newValue, &actor, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.OldValue = oldValue.String
+		c.NewValue = newValue.String
+		c.Actor = actor.String
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
+
+// Size operations
+
+// growableTables are the tables that grow with event volume, with the column
+// that orders their rows by age. TrimToSize deletes from these.
+var growableTables = []struct{ name, timeColumn string }{
+	{"crashes", "crashed_at"},
+	{"error_logs", "created_at"},
+	{"notifications", "created_at"},
+	{"transitions", "created_at"},
+}
+
+// StorageStats describes the size of the database.
+type StorageStats struct {
+	// FileSize is the size on disk of the database and its WAL file
+	FileSize int64 `json:"file_size"`
+	// UsedSize excludes free pages, which SQLite reuses but does not
+	// return to the file system
+	UsedSize int64 `json:"used_size"`
+	MaxSize  int64 `json:"max_size,omitempty"`
+	// Rows counts the rows of each growable table
+	Rows map[string]int64 `json:"rows"`
 }
 
-func (s *Storage) ClearOldCrashes(daysToKeep int) error {
-	query := `DELETE FROM crashes WHERE crashed_at < datetime('now', '-' || ? || ' days')`
-	_, err := s.db.Exec(query, daysToKeep)
-	return err
+func (s *Storage) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Stats returns the current database size and row counts.
+func (s *Storage) Stats() (StorageStats, error) {
+	stats := StorageStats{MaxSize: s.maxSize, Rows: make(map[string]int64)}
+
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		info, err := os.Stat(path)
+		if err == nil {
+			stats.FileSize += info.Size()
+		} else if !os.IsNotExist(err) {
+			return stats, err
+		}
+	}
+
+	used, err := s.usedSize()
+	if err != nil {
+		return stats, err
+	}
+	stats.UsedSize = used
+
+	for _, table := range growableTables {
+		var n int64
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM ` + table.name).Scan(&n); err != nil {
+			return stats, err
+		}
+		stats.Rows[table.name] = n
+	}
+
+	return stats, nil
+}
+
+// usedSize returns the bytes of the database pages in use.
+func (s *Storage) usedSize() (int64, error) {
+	var pageCount, freePages, pageSize int64
+	err := s.db.QueryRow(`SELECT page_count, freelist_count, page_size FROM pragma_page_count, pragma_freelist_count, pragma_page_size`).
+		Scan(&pageCount, &freePages, &pageSize)
+	if err != nil {
+		return 0, err
+	}
+	return (pageCount - freePages) * pageSize, nil
+}
+
+// TrimToSize deletes the oldest rows of the growable tables in batches of
+// batchSize, always from the table with the oldest remaining row, until the
+// used size is within the configured maximum. It returns the
+// number of rows deleted. Freed pages are reused by SQLite rather than
+// shrinking the file.
+func (s *Storage) TrimToSize(batchSize int) (int64, error) {
+	if s.maxSize <= 0 {
+		return 0, nil
+	}
+
+	var deleted int64
+	for {
+		used, err := s.usedSize()
+		if err != nil {
+			return deleted, err
+		}
+		if used <= s.maxSize {
+			break
+		}
+
+		table, timeColumn, err := s.oldestTable()
+		if err != nil {
+			return deleted, err
+		}
+		if table == "" {
+			break // nothing left to delete
+		}
+
+		result, err := s.db.Exec(fmt.Sprintf(
+			`DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s ORDER BY julianday(%[2]s), id LIMIT ?)`,
+			table, timeColumn), batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+
+	if deleted > 0 {
+		// Let the WAL file shrink back now that the deletions are written
+		if _, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// oldestTable returns the growable table holding the oldest row and its
+// time column, or "" if they are all empty.
+func (s *Storage) oldestTable() (string, string, error) {
+	parts := make([]string, 0, len(growableTables))
+	for i, table := range growableTables {
+		parts = append(parts, fmt.Sprintf(`SELECT %d AS i, MIN(julianday(%s)) AS t FROM %s`, i, table.timeColumn, table.name))
+	}
+	query := `SELECT i FROM (` + strings.Join(parts, ` UNION ALL `) + `) WHERE t IS NOT NULL ORDER BY t LIMIT 1`
+
+	var i int
+	err := s.db.QueryRow(query).Scan(&i)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return growableTables[i].name, growableTables[i].timeColumn, nil
 }
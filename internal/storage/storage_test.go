@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "test.db"), Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestOptionsPragmas(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		wantErr bool
+	}{
+		{"defaults", Options{}, nil, false},
+		{"all set", Options{BusyTimeout: 250, Synchronous: "normal", CacheSize: -2000},
+			[]string{"busy_timeout=250", "synchronous=NORMAL", "cache_size=-2000"}, false},
+		{"negative busy timeout", Options{BusyTimeout: -1}, nil, true},
+		{"unknown synchronous mode", Options{Synchronous: "FAST"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.pragmas()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pragmas() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pragmas() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAppliesPragmas(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "test.db"), Options{BusyTimeout: 1234, Synchronous: "FULL", CacheSize: 500})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+
+	// Every pooled connection gets the pragmas, not just the first one
+	s.db.SetMaxOpenConns(2)
+	for range 2 {
+		conn, err := s.db.Conn(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var busyTimeout, synchronous, cacheSize int
+		row := conn.QueryRowContext(t.Context(), `SELECT * FROM pragma_busy_timeout, pragma_synchronous, pragma_cache_size`)
+		if err := row.Scan(&busyTimeout, &synchronous, &cacheSize); err != nil {
+			t.Fatal(err)
+		}
+		// synchronous FULL is 2
+		if busyTimeout != 1234 || synchronous != 2 || cacheSize != 500 {
+			t.Errorf("pragmas = busy_timeout %d, synchronous %d, cache_size %d, want 1234, 2, 500", busyTimeout, synchronous, cacheSize)
+		}
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "test.db"), Options{Synchronous: "sometimes"}); err == nil {
+		t.Error("New() with an invalid synchronous mode succeeded")
+	}
+}
+
+func TestGetTransitions(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"web", "worker", "web", "web"} {
+		if err := s.SaveTransition(&Transition{
+			ProcessName: name,
+			FromState:   "stopped",
+			ToState:     "running",
+			Reason:      "started",
+			CreatedAt:   base.Add(time.Duration(i) * time.Minute),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(transitions []Transition) []int64 {
+		var ids []int64
+		for _, tr := range transitions {
+			ids = append(ids, tr.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		since    time.Time
+		beforeID int64
+		limit    int
+		want     []int64
+	}{
+		{"all newest first", time.Time{}, 0, 10, []int64{4, 3, 2, 1}},
+		{"limit", time.Time{}, 0, 2, []int64{4, 3}},
+		{"next page", time.Time{}, 3, 2, []int64{2, 1}},
+		{"since excludes that time", base.Add(time.Minute), 0, 10, []int64{4, 3}},
+		{"since in another zone", base.Add(time.Minute).In(time.FixedZone("UTC+3", 3*3600)), 0, 10, []int64{4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetTransitions(tt.since, tt.beforeID, tt.limit)
+			if err != nil {
+				t.Fatalf("GetTransitions: %v", err)
+			}
+			if !slices.Equal(ids(got), tt.want) {
+				t.Errorf("GetTransitions() = ids %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+
+	got, err := s.GetTransitionsByProcess("web", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{4, 3}; !slices.Equal(ids(got), want) {
+		t.Errorf("GetTransitionsByProcess() = ids %v, want %v", ids(got), want)
+	}
+	if got[0].Reason != "started" || got[0].FromState != "stopped" || !got[0].CreatedAt.Equal(base.Add(3*time.Minute)) {
+		t.Errorf("transition = %+v, want the saved fields", got[0])
+	}
+}
+
+func TestSaveErrorDedup(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "test.db"), Options{ErrorDedupWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+
+	for _, e := range []struct{ level, source, message string }{
+		{"error", "web", "connection refused"},
+		{"error", "web", "connection refused"},
+		{"error", "web", "connection refused"},
+		{"error", "worker", "connection refused"},
+		{"warning", "web", "connection refused"},
+		{"error", "web", "timeout"},
+	} {
+		if err := s.SaveError(e.level, e.source, e.message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(level, source, message string) []int {
+		t.Helper()
+		errs, err := s.GetErrors(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var counts []int
+		for _, e := range errs {
+			if e.Level == level && e.Source == source && e.Message == message {
+				counts = append(counts, e.Count)
+			}
+		}
+		return counts
+	}
+
+	if got := count("error", "web", "connection refused"); !slices.Equal(got, []int{3}) {
+		t.Errorf("repeated error counts = %v, want [3]", got)
+	}
+	for _, other := range [][3]string{
+		{"error", "worker", "connection refused"},
+		{"warning", "web", "connection refused"},
+		{"error", "web", "timeout"},
+	} {
+		if got := count(other[0], other[1], other[2]); !slices.Equal(got, []int{1}) {
+			t.Errorf("%v counts = %v, want [1]", other, got)
+		}
+	}
+
+	// Once the entry is older than the window, a repeat starts a new one
+	if _, err := s.db.Exec(`UPDATE error_logs SET created_at = datetime('now', '-2 minutes')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveError("error", "web", "connection refused"); err != nil {
+		t.Fatal(err)
+	}
+	if got := count("error", "web", "connection refused"); !slices.Equal(got, []int{1, 3}) {
+		t.Errorf("counts after the window = %v, want [1 3]", got)
+	}
+}
+
+func TestSaveErrorWithoutDedup(t *testing.T) {
+	s := newTestStorage(t)
+	for range 2 {
+		if err := s.SaveError("error", "web", "connection refused"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs, err := s.GetErrorsByLevel("error", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || errs[0].Count != 1 || errs[1].Count != 1 {
+		t.Errorf("GetErrorsByLevel() = %+v, want two entries counted once", errs)
+	}
+}
+
+func TestNewRejectsNegativeErrorDedupWindow(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "test.db"), Options{ErrorDedupWindow: -time.Second}); err == nil {
+		t.Error("New() with a negative error dedup window succeeded")
+	}
+}
+
+func TestClearOldErrors(t *testing.T) {
+	s := newTestStorage(t)
+	for _, message := range []string{"old", "new"} {
+		if err := s.SaveError("error", "web", message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.db.Exec(`UPDATE error_logs SET created_at = datetime('now', '-10 days') WHERE message = 'old'`); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := s.ClearOldErrors(7)
+	if err != nil {
+		t.Fatalf("ClearOldErrors: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("ClearOldErrors() = %d, want 1", deleted)
+	}
+
+	errs, err := s.GetErrors(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != "new" {
+		t.Errorf("GetErrors() = %+v, want only the new error", errs)
+	}
+}
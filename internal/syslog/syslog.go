@@ -0,0 +1,194 @@
+// Package syslog sends supervisor events to a syslog server as RFC 5424
+// messages over UDP or TCP.
+package syslog
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const appName = "pupervisor"
+
+// queueSize is how many messages wait for the connection before new ones
+// are dropped.
+const queueSize = 1000
+
+// Backoff between reconnection attempts
+const (
+	retryBase = time.Second
+	retryMax  = time.Minute
+)
+
+// facilities are the facility names in order of their code.
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Writer sends messages in the background so a slow or unreachable server
+// never blocks the caller. Messages are queued while the server is down and
+// sent once it can be reached again; when the queue is full they are
+// dropped and counted.
+type Writer struct {
+	network  string
+	addr     string
+	facility int
+	hostname string
+	pid      int
+
+	queue chan []byte
+	done  chan struct{}
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// New returns a Writer sending to addr over network, "udp" or "tcp", with
+// the named facility. It does not connect until the first message.
+func New(network, addr, facility string) (*Writer, error) {
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("invalid syslog protocol %q: must be udp or tcp", network)
+	}
+	code := slices.Index(facilities, facility)
+	if code < 0 {
+		return nil, fmt.Errorf("invalid syslog facility %q: must be a name such as daemon or local0", facility)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	w := &Writer{
+		network:  network,
+		addr:     addr,
+		facility: code,
+		hostname: hostname,
+		pid:      os.Getpid(),
+		queue:    make(chan []byte, queueSize),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Send queues an event at level (error, warning, info or debug) about
+// process, which may be "" for supervisor-wide events.
+func (w *Writer) Send(level, process, message string, t time.Time) {
+	select {
+	case w.queue <- w.format(level, process, message, t):
+	default:
+		w.mu.Lock()
+		w.dropped++
+		w.mu.Unlock()
+	}
+}
+
+// Close stops sending. Queued messages are discarded.
+func (w *Writer) Close() {
+	close(w.done)
+}
+
+// format renders an RFC 5424 message. The process name goes in MSGID.
+func (w *Writer) format(level, process, message string, t time.Time) []byte {
+	msgID := process
+	if msgID == "" {
+		msgID = "-"
+	} else if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+	pri := w.facility*8 + severity(level)
+	return fmt.Appendf(nil, "<%d>1 %s %s %s %d %s - %s",
+		pri, t.Format(time.RFC3339Nano), w.hostname, appName, w.pid, msgID, message)
+}
+
+// severity maps a log level to its syslog severity code.
+func severity(level string) int {
+	switch level {
+	case "error":
+		return 3
+	case "warning":
+		return 4
+	case "debug":
+		return 7
+	default:
+		return 6 // informational
+	}
+}
+
+func (w *Writer) run() {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	backoff := retryBase
+	for {
+		var msg []byte
+		select {
+		case msg = <-w.queue:
+		case <-w.done:
+			return
+		}
+
+		// Keep the message until it is sent
+		for {
+			if conn == nil {
+				c, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+				if err == nil {
+					conn = c
+					backoff = retryBase
+				} else {
+					log.Printf("syslog: cannot connect to %s: %v, retrying in %s", w.addr, err, backoff)
+				}
+			}
+			if conn != nil {
+				err := w.write(conn, msg)
+				if err == nil {
+					w.reportDropped()
+					break
+				}
+				log.Printf("syslog: write to %s failed: %v", w.addr, err)
+				conn.Close()
+				conn = nil
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-w.done:
+				return
+			}
+			backoff = min(backoff*2, retryMax)
+		}
+	}
+}
+
+// write sends msg, framed by octet counting (RFC 6587) over TCP.
+func (w *Writer) write(conn net.Conn, msg []byte) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if w.network == "tcp" {
+		msg = fmt.Appendf(nil, "%d %s", len(msg), msg)
+	}
+	_, err := conn.Write(msg)
+	return err
+}
+
+// reportDropped logs how many messages were dropped because the queue was
+// full since it last reported.
+func (w *Writer) reportDropped() {
+	w.mu.Lock()
+	dropped := w.dropped
+	w.dropped = 0
+	w.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("syslog: dropped %d messages to %s, the queue was full", dropped, w.addr)
+	}
+}
@@ -33,7 +33,7 @@ export function displayProcesses(processStatusDiv, processes) {
                 <div class="process-info">
                     <h3>
                         <span class="status-indicator ${statusClass}"></span>
-                        ${process.name}
+                        ${process.display_name || process.name}
                     </h3>
                     <div class="process-details">
                         <span>Status: ${process.status}</span>